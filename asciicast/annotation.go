@@ -0,0 +1,68 @@
+package asciicast
+
+import (
+	"errors"
+	"sort"
+)
+
+// AnnotationEventType 录制后添加的注释，数据为注释的文字。播放时显示在状态栏中，导出HTML和GIF时显示为标注
+const AnnotationEventType = "a"
+
+// AnnotationDuration 注释显示的录像时长(秒)，下一条注释出现时提前结束
+const AnnotationDuration = 5.0
+
+// Annotation 一条注释及其显示的时间段
+type Annotation struct {
+	Time float64 `json:"time"`
+	End  float64 `json:"end"`
+	Text string  `json:"text"`
+}
+
+// Annotations 返回帧中的所有注释，按时间排列
+func Annotations(frames []Frame) []Annotation {
+	var list []Annotation
+	for _, f := range frames {
+		if f.EventType == AnnotationEventType {
+			list = append(list, Annotation{Time: f.Time, End: f.Time + AnnotationDuration, Text: string(f.EventData)})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Time < list[j].Time })
+	for i := 0; i+1 < len(list); i++ {
+		list[i].End = min(list[i].End, list[i+1].Time)
+	}
+	return list
+}
+
+// AddAnnotation 在at秒处插入注释，位于同一时间的其他帧之后，返回新的帧列表
+func AddAnnotation(frames []Frame, at float64, text string) ([]Frame, error) {
+	if at < 0 {
+		return nil, errors.New("the annotation time must not be negative")
+	}
+	if text == "" {
+		return nil, errors.New("the annotation text is empty")
+	}
+	i := sort.Search(len(frames), func(i int) bool { return frames[i].Time > at })
+	frame := Frame{Time: at, EventType: AnnotationEventType, EventData: []byte(text)}
+	result := make([]Frame, 0, len(frames)+1)
+	result = append(result, frames[:i]...)
+	result = append(result, frame)
+	return append(result, frames[i:]...), nil
+}
+
+// RemoveAnnotation 删除按时间排列的第n条(从1开始)注释，返回新的帧列表；没有这条注释时ok为false
+func RemoveAnnotation(frames []Frame, n int) (result []Frame, ok bool) {
+	list := Annotations(frames)
+	if n < 1 || n > len(list) {
+		return frames, false
+	}
+	target := list[n-1]
+	result = make([]Frame, 0, len(frames))
+	for _, f := range frames {
+		if !ok && f.EventType == AnnotationEventType && f.Time == target.Time && string(f.EventData) == target.Text {
+			ok = true
+			continue
+		}
+		result = append(result, f)
+	}
+	return result, ok
+}
@@ -0,0 +1,149 @@
+package asciicast
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ArchiveSeparator 分隔归档和其中录像路径的标记，如recordings.tar.gz::sessions/demo.cast
+const ArchiveSeparator = "::"
+
+// maxArchiveHint 找不到录像时最多列出的归档中的录像数
+const maxArchiveHint = 5
+
+// SplitArchivePath 将"归档::路径"形式的地址拆成归档地址和其中的路径，从最后一个::处拆分，
+// 因此归档本身也可以是HTTP、s3://等地址。不是这种形式时ok为false
+func SplitArchivePath(url string) (archive, member string, ok bool) {
+	i := strings.LastIndex(url, ArchiveSeparator)
+	if i <= 0 || i+len(ArchiveSeparator) == len(url) {
+		return "", "", false
+	}
+	return url[:i], url[i+len(ArchiveSeparator):], true
+}
+
+// archiveMember 归档中的一个文件，关闭时一并关闭归档
+type archiveMember struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m *archiveMember) Close() error {
+	var err error
+	for i := len(m.closers) - 1; i >= 0; i-- {
+		if e := m.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// cleanMemberName 统一归档中的路径形式：去掉开头的./和/，使用/分隔
+func cleanMemberName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	return strings.TrimLeft(path.Clean("/"+name), "/")
+}
+
+// openArchiveMember 不解压到磁盘，直接读取归档中的一个文件。支持tar、tar.gz(.tgz)和zip，按文件头识别格式
+func openArchiveMember(archive, member string) (io.ReadCloser, error) {
+	source, err := getSource(archive)
+	if err != nil {
+		return nil, err
+	}
+	name := cleanMemberName(member)
+	br := bufio.NewReader(source)
+	magic, _ := br.Peek(4)
+	var rc io.ReadCloser
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")) || bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		rc, err = openZipMember(source, br, name)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(br); err == nil {
+			rc, err = openTarMember(tar.NewReader(gz), name)
+		}
+	default:
+		rc, err = openTarMember(tar.NewReader(br), name)
+	}
+	if err != nil {
+		source.Close()
+		return nil, fmt.Errorf("%s: %v", archive, err)
+	}
+	return &archiveMember{Reader: rc, closers: []io.Closer{source, rc}}, nil
+}
+
+// openTarMember 在tar中顺序查找name
+func openTarMember(tr *tar.Reader, name string) (io.ReadCloser, error) {
+	var casts []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, memberNotFound(name, casts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if entry := cleanMemberName(hdr.Name); entry == name {
+			return io.NopCloser(tr), nil
+		} else if path.Ext(entry) == ".cast" {
+			casts = append(casts, entry)
+		}
+	}
+}
+
+// openZipMember 在zip中查找name。zip的目录在文件末尾，本地文件直接随机读取，其他来源先读入内存
+func openZipMember(source io.Reader, br *bufio.Reader, name string) (io.ReadCloser, error) {
+	var ra io.ReaderAt
+	var size int64
+	if f, ok := source.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		ra, size = f, info.Size()
+	} else {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		ra, size = bytes.NewReader(data), int64(len(data))
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	var casts []string
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if entry := cleanMemberName(f.Name); entry == name {
+			return f.Open()
+		} else if path.Ext(entry) == ".cast" {
+			casts = append(casts, entry)
+		}
+	}
+	return nil, memberNotFound(name, casts)
+}
+
+// memberNotFound 返回找不到name的错误，并列出归档中的部分录像
+func memberNotFound(name string, casts []string) error {
+	if len(casts) == 0 {
+		return fmt.Errorf("%s not found in archive", name)
+	}
+	hint := strings.Join(casts[:min(len(casts), maxArchiveHint)], ", ")
+	if len(casts) > maxArchiveHint {
+		hint += fmt.Sprintf(" and %d more", len(casts)-maxArchiveHint)
+	}
+	return fmt.Errorf("%s not found in archive, it contains %s", name, hint)
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"regexp"
 	"runtime"
@@ -13,14 +12,53 @@ import (
 )
 
 type Env struct {
-	Term  string `json:"TERM"`
-	Shell string `json:"SHELL"`
+	Term  string            `json:"TERM"`
+	Shell string            `json:"SHELL"`
+	Extra map[string]string `json:"-"` // 额外记录到头部的环境变量
+}
+
+// MarshalJSON 将额外的环境变量与TERM/SHELL平铺到同一个对象中
+func (e Env) MarshalJSON() ([]byte, error) {
+	type plainEnv Env
+	if len(e.Extra) == 0 {
+		return json.Marshal(plainEnv(e))
+	}
+	m := make(map[string]string, len(e.Extra)+2)
+	for k, v := range e.Extra {
+		m[k] = v
+	}
+	m["TERM"] = e.Term
+	m["SHELL"] = e.Shell
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON 读取TERM/SHELL，其余的环境变量保存到Extra中
+func (e *Env) UnmarshalJSON(data []byte) error {
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	for k, v := range m {
+		value, _ := v.(string)
+		switch k {
+		case "TERM":
+			e.Term = value
+		case "SHELL":
+			e.Shell = value
+		default:
+			if e.Extra == nil {
+				e.Extra = map[string]string{}
+			}
+			e.Extra[k] = value
+		}
+	}
+	return nil
 }
 
 type Duration float64
 
 func (d Duration) MarshalJSON() ([]byte, error) {
-	return []byte(fmt.Sprintf(`%.6f`, d)), nil
+	return []byte(EncodeTime(float64(d))), nil
 }
 
 type Asciicast struct {
@@ -32,10 +70,14 @@ type Asciicast struct {
 	Command   string   `json:"command,omitempty"`
 	Title     string   `json:"title,omitempty"`
 	Env       *Env     `json:"env"`
+	Theme     *Theme   `json:"theme,omitempty"`
+	Machine   *Machine `json:"machine,omitempty"`
+	Audio     *Audio   `json:"audio,omitempty"`
 	Stdout    []Frame  `json:"stdout"`
 }
 
-func NewAsciicast(width, height int, duration float64, command, title string, frames []Frame, env map[string]string) *Asciicast {
+// NewEnv 为录制的命令生成头部的env部分
+func NewEnv(command string, env map[string]string) *Env {
 	// {"SHELL":"powershell.exe","TERM":"ms-terminal"}
 	env_ := &Env{Term: env["TERM"], Shell: env["SHELL"]}
 	if runtime.GOOS == "windows" {
@@ -46,6 +88,10 @@ func NewAsciicast(width, height int, duration float64, command, title string, fr
 			env_.Shell = "cmd.exe"
 		}
 	}
+	return env_
+}
+
+func NewAsciicast(width, height int, duration float64, command, title string, frames []Frame, env map[string]string) *Asciicast {
 	return &Asciicast{
 		Version:   2,
 		Width:     width,
@@ -54,7 +100,7 @@ func NewAsciicast(width, height int, duration float64, command, title string, fr
 		Timestamp: time.Now().Unix(),
 		Command:   command,
 		Title:     title,
-		Env:       env_,
+		Env:       NewEnv(command, env),
 		Stdout:    frames,
 	}
 }
@@ -63,17 +109,25 @@ type Header struct {
 	Version   int      `json:"version"`
 	Width     int      `json:"width"`
 	Height    int      `json:"height"`
-	Timestamp int64    `json:"timestamp"`
+	Timestamp int64    `json:"timestamp,omitempty"`
 	Duration  Duration `json:"duration,omitempty"`
 	Command   string   `json:"command,omitempty"`
 	Title     string   `json:"title,omitempty"`
 	Env       *Env     `json:"env"`
+	Theme     *Theme   `json:"theme,omitempty"`
+	Machine   *Machine `json:"machine,omitempty"`
+	Audio     *Audio   `json:"audio,omitempty"`
 }
 
 // asciinema play file.json
 // asciinema play https://asciinema.org/a/123.json
 // asciinema play https://asciinema.org/a/123
 // asciinema play ipfs://ipfs/QmbdpNCwqeZgnmAWBCQcs8u6Ts6P2ku97tfKAycE1XY88p
+// asciinema play ipfs://QmbdpNCwqeZgnmAWBCQcs8u6Ts6P2ku97tfKAycE1XY88p
+// asciinema play ipns://example.com/demo.cast
+// asciinema play s3://bucket/casts/demo.cast
+// asciinema play "https://bucket.s3.amazonaws.com/demo.cast?X-Amz-Signature=..."
+// asciinema play recordings.tar.gz::sessions/demo.cast
 // asciinema play -
 
 func extractJSONURL(htmlDoc io.Reader) (string, error) {
@@ -98,26 +152,25 @@ func getSource(url string) (io.ReadCloser, error) {
 	var isHTML bool
 	var err error
 
-	if strings.HasPrefix(url, "ipfs:/") {
-		url = fmt.Sprintf("https://ipfs.io/%v", url[6:])
-	} else if strings.HasPrefix(url, "fs:/") {
-		url = fmt.Sprintf("https://ipfs.io/%v", url[4:])
+	// 名称中正好含有::的本地文件仍按文件打开
+	if archive, member, ok := SplitArchivePath(url); ok {
+		if _, err := os.Stat(url); err != nil {
+			return openArchiveMember(archive, member)
+		}
 	}
 
+	url = resolveIPFS(url)
+
 	if url == "-" {
 		source = os.Stdin
+	} else if strings.HasPrefix(url, "s3://") {
+		return openS3(url)
 	} else if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
-		resp, err := http.Get(url)
-
+		resp, err := httpGet(url)
 		if err != nil {
 			return nil, err
 		}
 
-		if resp.StatusCode != 200 {
-			resp.Body.Close()
-			return nil, fmt.Errorf("got status %v when requesting %v", resp.StatusCode, url)
-		}
-
 		source = resp.Body
 
 		if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
@@ -147,6 +200,11 @@ func getSource(url string) (io.ReadCloser, error) {
 	return source, nil
 }
 
+// Open 打开录像源：本地文件、"-"(标准输入)、HTTP地址(包括asciinema.org的页面和预签名地址)、s3://、IPFS地址，或"归档::路径"形式的tar、tar.gz、zip中的录像
+func Open(url string) (io.ReadCloser, error) {
+	return getSource(url)
+}
+
 func Load(url string) (*Asciicast, error) {
 	source, err := getSource(url)
 	if err != nil {
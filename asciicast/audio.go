@@ -0,0 +1,17 @@
+package asciicast
+
+import "path/filepath"
+
+// Audio 录像的旁白音频，音频文件作为附属文件与录像放在一起
+type Audio struct {
+	File   string  `json:"file"`             // 音频文件路径，相对路径以录像所在目录为基准
+	Offset float64 `json:"offset,omitempty"` // 音频开始时对应的录像时间（秒），为负数时跳过音频的开头
+}
+
+// Path 返回音频文件的实际路径
+func (a *Audio) Path(castPath string) string {
+	if filepath.IsAbs(a.File) {
+		return a.File
+	}
+	return filepath.Join(filepath.Dir(castPath), a.File)
+}
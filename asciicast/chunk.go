@@ -0,0 +1,115 @@
+package asciicast
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+// chunkInterval 同一帧拆出的相邻小块之间的最大间隔(秒)
+const chunkInterval = 0.01
+
+// 拆分时跟踪转义序列的状态
+const (
+	chunkGround = iota
+	chunkEscape
+	chunkCSI
+	chunkString
+	chunkStringEsc
+)
+
+// SplitFrames 将超过maxBytes字节的输出帧(包括压缩帧)拆成多个较小的输出帧，播放时逐块写出而不是一次写入。
+// 拆分点不会落在UTF-8字符或转义序列的中间，单个超长的转义序列不拆分。
+// 拆出的小块的时间在该帧与下一帧之间插值，相邻小块最多间隔chunkInterval秒，其他帧原样保留
+func SplitFrames(frames []Frame, maxBytes int) ([]Frame, error) {
+	if maxBytes <= 0 {
+		return frames, nil
+	}
+	out := make([]Frame, 0, len(frames))
+	for i, frame := range frames {
+		data, err := frame.OutputData()
+		if err != nil {
+			return nil, err
+		}
+		if len(data) <= maxBytes {
+			out = append(out, frame)
+			continue
+		}
+		chunks := splitOutput(data, maxBytes)
+		spread := float64(len(chunks)) * chunkInterval
+		if i+1 < len(frames) {
+			spread = math.Min(spread, frames[i+1].Time-frame.Time)
+		}
+		for k, chunk := range chunks {
+			t := frame.Time + math.Max(spread, 0)*float64(k)/float64(len(chunks))
+			out = append(out, Frame{Time: RoundTime(t), EventType: OutputEventType, EventData: chunk})
+		}
+	}
+	return out, nil
+}
+
+// splitOutput 在UTF-8字符和转义序列之间将data拆成不超过maxBytes字节的小块，
+// 超长的转义序列单独成为一块
+func splitOutput(data []byte, maxBytes int) [][]byte {
+	var chunks [][]byte
+	state := chunkGround
+	start, last := 0, 0 // 当前小块的开头，以及其中最后一个可以拆分的位置
+	for i, b := range data {
+		if i > start && state == chunkGround && utf8.RuneStart(b) {
+			if i-start > maxBytes && last > start {
+				chunks = append(chunks, data[start:last])
+				start = last
+			}
+			if i-start >= maxBytes {
+				chunks = append(chunks, data[start:i])
+				start = i
+			}
+			last = i
+		}
+		state = chunkState(state, b)
+	}
+	return append(chunks, data[start:])
+}
+
+// chunkState 返回处理字节b之后的转义序列状态
+func chunkState(state int, b byte) int {
+	if b == 0x18 || b == 0x1a {
+		// CAN、SUB中止正在进行的序列
+		return chunkGround
+	}
+	switch state {
+	case chunkGround:
+		if b == 0x1b {
+			return chunkEscape
+		}
+	case chunkEscape:
+		switch {
+		case b == '[':
+			return chunkCSI
+		case b == ']' || b == 'P' || b == '_' || b == '^' || b == 'X':
+			return chunkString
+		case b == 0x1b || (b >= 0x20 && b <= 0x2f):
+			// 中间字节，如ESC ( B
+			return chunkEscape
+		}
+		return chunkGround
+	case chunkCSI:
+		if b >= 0x40 && b <= 0x7e {
+			return chunkGround
+		}
+		return chunkCSI
+	case chunkString:
+		switch b {
+		case 0x07:
+			return chunkGround
+		case 0x1b:
+			return chunkStringEsc
+		}
+		return chunkString
+	case chunkStringEsc:
+		if b == '\\' {
+			return chunkGround
+		}
+		return chunkString
+	}
+	return state
+}
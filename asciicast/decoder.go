@@ -0,0 +1,144 @@
+package asciicast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+)
+
+// utf8BOM Windows编辑器保存UTF-8文件时可能在开头写入的字节序标记
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// Decoder 流式读取asciicast v2录像：第一行为头部，之后每行为一个事件。
+// 不受单行长度的限制，文件开头的BOM和\r\n换行不影响读取，空行被忽略，
+// 无法解析的行被跳过并交给OnInvalid。播放、编辑、tojson、info等命令都通过它读取录像
+type Decoder struct {
+	// OnInvalid 跳过无法解析的事件行时调用，n为行号(从1开始，头部为第1行)，为nil时直接跳过
+	OnInvalid func(n int, line []byte, err error)
+
+	reader     *bufio.Reader
+	n          int // 最后读取的行号
+	headerLine []byte
+	headerRead bool
+	frame      Frame
+	raw        []byte
+	err        error
+}
+
+// NewDecoder 创建从r读取录像的Decoder
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{reader: bufio.NewReader(r)}
+}
+
+// readLine 读取一行，去掉行尾的\r\n或\n以及文件开头的BOM，读到结尾时返回io.EOF
+func (d *Decoder) readLine() ([]byte, error) {
+	line, err := d.reader.ReadBytes('\n')
+	if len(line) == 0 && err != nil {
+		return nil, err
+	}
+	d.n++
+	line = bytes.TrimRight(line, "\r\n")
+	if d.n == 1 {
+		line = bytes.TrimPrefix(line, utf8BOM)
+	}
+	return line, nil
+}
+
+// HeaderLine 返回头部行的原文，只在第一次调用时读取
+func (d *Decoder) HeaderLine() ([]byte, error) {
+	if !d.headerRead {
+		d.headerRead = true
+		line, err := d.readLine()
+		if err == io.EOF {
+			err = fmt.Errorf("empty cast")
+		}
+		d.headerLine, d.err = line, err
+	}
+	if d.headerLine == nil {
+		return nil, d.err
+	}
+	return d.headerLine, nil
+}
+
+// Header 读取并解析头部
+func (d *Decoder) Header() (*Header, error) {
+	line, err := d.HeaderLine()
+	if err != nil {
+		return nil, err
+	}
+	header := &Header{}
+	if err := json.Unmarshal(line, header); err != nil {
+		return nil, fmt.Errorf("invalid cast header: %v", err)
+	}
+	return header, nil
+}
+
+// Remaining 返回还没有读取的内容，用于按其他格式(如asciicast v1)解析
+func (d *Decoder) Remaining() io.Reader {
+	return d.reader
+}
+
+// Next 读取下一个事件，没有更多事件或读取出错时返回false，之后用Err检查错误。
+// 还没有读取头部时先读取(并跳过)头部
+func (d *Decoder) Next() bool {
+	if _, err := d.HeaderLine(); err != nil {
+		return false
+	}
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			if err != io.EOF {
+				d.err = fmt.Errorf("line %d: %v", d.n+1, err)
+			}
+			return false
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		frame := Frame{}
+		if err := frame.UnmarshalJSON(line); err != nil {
+			if d.OnInvalid != nil {
+				d.OnInvalid(d.n, line, err)
+			}
+			continue
+		}
+		d.frame, d.raw = frame, line
+		return true
+	}
+}
+
+// Frame 返回Next读取的事件
+func (d *Decoder) Frame() Frame {
+	return d.frame
+}
+
+// Raw 返回Next读取的事件行的原文
+func (d *Decoder) Raw() []byte {
+	return d.raw
+}
+
+// Line 返回最后读取的行号
+func (d *Decoder) Line() int {
+	return d.n
+}
+
+// Err 返回读取中遇到的错误，读到结尾不算错误
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// All 以迭代器的形式返回剩余的事件及其行号，迭代结束后用Err检查错误：
+//
+//	for n, frame := range dec.All() { ... }
+func (d *Decoder) All() iter.Seq2[int, Frame] {
+	return func(yield func(int, Frame) bool) {
+		for d.Next() {
+			if !yield(d.n, d.frame) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package asciicast
+
+import (
+	"strconv"
+	"strings"
+)
+
+// asciicast标准定义的事件类型
+const (
+	OutputEventType = "o" // 终端输出
+	InputEventType  = "i" // 用户输入
+	MarkerEventType = "m" // 标记，数据为标记的名称
+	ResizeEventType = "r" // 终端大小改变，数据为"列x行"
+	ExitEventType   = "x" // 被录制程序退出，数据为退出码
+)
+
+// CompressedEventType 本项目的压缩帧，数据为gzip压缩后的多帧输出
+const CompressedEventType = "z"
+
+// IsStandardEventType 判断是否为asciicast标准定义的事件类型，其他播放器和服务端都能理解
+func IsStandardEventType(t string) bool {
+	switch t {
+	case OutputEventType, InputEventType, MarkerEventType, ResizeEventType, ExitEventType:
+		return true
+	}
+	return false
+}
+
+// IsKnownEventType 判断是否为能识别的事件类型，包括本项目扩展的压缩帧、响铃、shell集成、工作目录和注释事件。
+// 不认识的事件在读取时保留，播放、转换时跳过
+func IsKnownEventType(t string) bool {
+	switch t {
+	case CompressedEventType, BellEventType, ShellEventType, CwdEventType, AnnotationEventType:
+		return true
+	}
+	return IsStandardEventType(t)
+}
+
+// IsOutput 判断是否为输出帧(包括压缩帧)
+func (f *Frame) IsOutput() bool {
+	return f.EventType == OutputEventType || f.EventType == CompressedEventType
+}
+
+// IsMarker 判断是否为标记
+func (f *Frame) IsMarker() bool {
+	return f.EventType == MarkerEventType
+}
+
+// Size 返回大小改变事件中新的列数和行数，不是大小改变事件或数据无效时ok为false
+func (f *Frame) Size() (cols, rows int, ok bool) {
+	if f.EventType != ResizeEventType {
+		return 0, 0, false
+	}
+	return ParseSize(string(f.EventData))
+}
+
+// ParseSize 解析"列x行"形式的终端大小
+func ParseSize(data string) (cols, rows int, ok bool) {
+	c, r, found := strings.Cut(data, "x")
+	if !found {
+		return 0, 0, false
+	}
+	cols, err1 := strconv.Atoi(c)
+	rows, err2 := strconv.Atoi(r)
+	return cols, rows, err1 == nil && err2 == nil && cols > 0 && rows > 0
+}
+
+// ExitStatus 返回退出事件中的退出码，不是退出事件或数据无效时ok为false
+func (f *Frame) ExitStatus() (status int, ok bool) {
+	if f.EventType != ExitEventType {
+		return 0, false
+	}
+	status, err := strconv.Atoi(strings.TrimSpace(string(f.EventData)))
+	return status, err == nil
+}
@@ -0,0 +1,122 @@
+package asciicast
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/x6nux/asciinema/terminal"
+)
+
+// HyperlinkMode 导出时对OSC 8超链接的处理方式
+type HyperlinkMode string
+
+const (
+	HyperlinksKeep  HyperlinkMode = "keep"  // 保留，HTML/SVG等导出可以渲染为真正的链接
+	HyperlinksStrip HyperlinkMode = "strip" // 去掉链接只保留文本，用于纯文本、GIF等导出
+)
+
+const (
+	osc8            = "\x1b]8;"
+	maxPendingBytes = 4096 // 超过该长度仍未结束的序列原样输出
+)
+
+// ParseHyperlinkMode 解析keep或strip
+func ParseHyperlinkMode(s string) (HyperlinkMode, error) {
+	switch mode := HyperlinkMode(s); mode {
+	case HyperlinksKeep, HyperlinksStrip:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid hyperlink mode %q, must be keep or strip", s)
+}
+
+// EscapeFilter 导出前过滤输出中的转义序列。序列可以跨越多帧，
+// 同一个录像的帧须按顺序交给同一个EscapeFilter
+type EscapeFilter struct {
+	Hyperlinks  HyperlinkMode
+	StripImages bool   // 去掉kitty、sixel和iTerm2图片，GIF和网页播放器无法显示，图片数据会显示为乱码
+	pending     []byte // 上一段输出末尾未结束的序列
+	images      *terminal.ImageStripper
+}
+
+// Filter 过滤一段输出，末尾未结束的序列会留到下一次调用或Flush时再输出
+func (f *EscapeFilter) Filter(data []byte) []byte {
+	if f.StripImages {
+		if f.images == nil {
+			f.images, _ = terminal.NewImageStripper(nil)
+		}
+		data = f.images.Strip(data)
+	}
+	if f.Hyperlinks != HyperlinksStrip {
+		return data
+	}
+	if len(f.pending) > 0 {
+		data = append(f.pending, data...)
+		f.pending = nil
+	}
+	out := make([]byte, 0, len(data))
+	for {
+		i := bytes.Index(data, []byte(osc8))
+		if i < 0 {
+			k := partialSuffix(data, osc8)
+			out = append(out, data[:len(data)-k]...)
+			f.hold(data[len(data)-k:])
+			return out
+		}
+		out = append(out, data[:i]...)
+		rest := data[i+len(osc8):]
+		end, n := oscEnd(rest)
+		if end < 0 {
+			if len(rest) > maxPendingBytes {
+				return append(out, data[i:]...)
+			}
+			f.hold(data[i:])
+			return out
+		}
+		data = rest[end+n:]
+	}
+}
+
+func (f *EscapeFilter) hold(data []byte) {
+	if len(data) > 0 {
+		f.pending = append([]byte{}, data...)
+	}
+}
+
+// Flush 返回还没有输出的内容
+func (f *EscapeFilter) Flush() []byte {
+	data := f.pending
+	f.pending = nil
+	return data
+}
+
+// FilterFrames 按顺序过滤所有输出帧，压缩帧解压过滤后重新压缩；其他事件保持不变
+func (f *EscapeFilter) FilterFrames(frames []Frame) ([]Frame, error) {
+	result := make([]Frame, 0, len(frames))
+	last := -1 // 最后一个输出帧的位置
+	for _, frame := range frames {
+		switch frame.EventType {
+		case OutputEventType:
+			frame.EventData = f.Filter(frame.EventData)
+		case CompressedEventType:
+			data, err := frame.OutputData()
+			if err != nil {
+				return nil, err
+			}
+			if frame.EventData, err = CompressFrameData(f.Filter(data)); err != nil {
+				return nil, err
+			}
+		default:
+			result = append(result, frame)
+			continue
+		}
+		last = len(result)
+		result = append(result, frame)
+	}
+	// 最后一个输出帧之后补上未结束的序列
+	if rest := f.Flush(); len(rest) > 0 && last >= 0 {
+		tail := Frame{Time: math.Max(result[last].Time, result[last].EndTime), EventType: OutputEventType, EventData: rest}
+		result = append(result[:last+1], append([]Frame{tail}, result[last+1:]...)...)
+	}
+	return result, nil
+}
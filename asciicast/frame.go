@@ -6,6 +6,9 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+
+	"github.com/x6nux/asciinema/util"
 )
 
 // Frame 表示一个播放帧
@@ -14,58 +17,68 @@ type Frame struct {
 	EventType string  `json:"b"`           // 事件类型：o（输出）或z（压缩数据）
 	EventData []byte  `json:"c"`           // 输出数据
 	EndTime   float64 `json:"d,omitempty"` // 压缩帧的结束时间，仅当EventType为z时使用
+	// Extra 数组格式的帧中数据之后的其他元素，原样保留，写回时放在数据之后
+	Extra []json.RawMessage `json:"-"`
 }
 
 // MarshalJSON 自定义JSON序列化，以适应asciicast v2格式
 func (f Frame) MarshalJSON() ([]byte, error) {
 	// 特殊处理z类型压缩帧
-	if f.EventType == "z" {
+	if f.EventType == CompressedEventType {
 		// 使用结构体序列化
 		type ZFrame struct {
-			Time      float64 `json:"a"`
-			EventType string  `json:"b"`
-			EventData string  `json:"c"`
-			EndTime   float64 `json:"d,omitempty"`
+			Time      json.Number `json:"a"`
+			EventType string      `json:"b"`
+			EventData string      `json:"c"`
+			EndTime   json.Number `json:"d,omitempty"`
 		}
 
 		zf := ZFrame{
-			Time:      f.Time,
+			Time:      EncodeTime(f.Time),
 			EventType: f.EventType,
 			EventData: string(f.EventData), // 压缩帧的数据已经是base64编码的
-			EndTime:   f.EndTime,
+		}
+		if f.EndTime != 0 {
+			zf.EndTime = EncodeTime(f.EndTime)
 		}
 
 		return json.Marshal(zf)
 	}
 
 	// 普通输出帧，格式为[time, type, data]
-	return json.Marshal([]interface{}{f.Time, f.EventType, string(f.EventData)})
+	event := []interface{}{EncodeTime(f.Time), f.EventType, string(f.EventData)}
+	for _, v := range f.Extra {
+		event = append(event, v)
+	}
+	return json.Marshal(event)
 }
 
-// UnmarshalJSON 自定义JSON反序列化，以支持不同格式
+// UnmarshalJSON 自定义JSON反序列化，以支持不同格式。
+// 时间可以是小数、整数或数字字符串，数组格式的帧多出的元素保存到Extra中
 func (f *Frame) UnmarshalJSON(data []byte) error {
 	// 检查是结构体还是数组格式
 	if bytes.HasPrefix(data, []byte("{")) {
 		// 结构体格式，可能是压缩帧
-		var frameMap map[string]interface{}
+		var frameMap map[string]json.RawMessage
 		if err := json.Unmarshal(data, &frameMap); err != nil {
 			return err
 		}
 
 		// 提取基本属性
-		if time, ok := frameMap["a"].(float64); ok {
+		if time, ok := parseFrameTime(frameMap["a"]); ok {
 			f.Time = time
 		}
 
-		if eventType, ok := frameMap["b"].(string); ok {
+		var eventType, eventData string
+		if json.Unmarshal(frameMap["b"], &eventType) == nil {
 			f.EventType = eventType
 		}
 
-		if eventData, ok := frameMap["c"].(string); ok {
+		if json.Unmarshal(frameMap["c"], &eventData) == nil {
 			f.EventData = []byte(eventData)
 		}
 
-		if endTime, ok := frameMap["d"].(float64); ok {
+		if endTime, ok := parseFrameTime(frameMap["d"]); ok {
 			f.EndTime = endTime
 		}
 
@@ -73,7 +86,7 @@ func (f *Frame) UnmarshalJSON(data []byte) error {
 	}
 
 	// 数组格式，标准的asciicast v2帧: [time, type, data]
-	var arr []interface{}
+	var arr []json.RawMessage
 	if err := json.Unmarshal(data, &arr); err != nil {
 		return err
 	}
@@ -83,32 +96,48 @@ func (f *Frame) UnmarshalJSON(data []byte) error {
 	}
 
 	// 提取时间
-	if time, ok := arr[0].(float64); ok {
-		f.Time = time
-	} else {
-		return fmt.Errorf("invalid time format: %v", arr[0])
+	time, ok := parseFrameTime(arr[0])
+	if !ok {
+		return fmt.Errorf("invalid time format: %s", arr[0])
 	}
+	f.Time = time
 
 	// 提取类型
-	if eventType, ok := arr[1].(string); ok {
-		f.EventType = eventType
-	} else {
-		return fmt.Errorf("invalid event type: %v", arr[1])
+	var eventType string
+	if err := json.Unmarshal(arr[1], &eventType); err != nil {
+		return fmt.Errorf("invalid event type: %s", arr[1])
 	}
+	f.EventType = eventType
 
 	// 提取数据
-	if eventData, ok := arr[2].(string); ok {
-		f.EventData = []byte(eventData)
-	} else {
-		return fmt.Errorf("invalid event data: %v", arr[2])
+	var eventData string
+	if err := json.Unmarshal(arr[2], &eventData); err != nil {
+		return fmt.Errorf("invalid event data: %s", arr[2])
+	}
+	f.EventData = []byte(eventData)
+
+	// 其他生成器附加的元素
+	f.Extra = nil
+	for _, v := range arr[3:] {
+		f.Extra = append(f.Extra, append(json.RawMessage{}, v...))
 	}
 
 	return nil
 }
 
+// parseFrameTime 解析帧时间，接受小数、整数和数字字符串(如"1.5")
+func parseFrameTime(raw json.RawMessage) (float64, bool) {
+	var n json.Number
+	if len(raw) == 0 || json.Unmarshal(raw, &n) != nil {
+		return 0, false
+	}
+	t, err := n.Float64()
+	return t, err == nil
+}
+
 // IsCompressed 检查帧是否为压缩帧
 func (f *Frame) IsCompressed() bool {
-	return f.EventType == "z"
+	return f.EventType == CompressedEventType
 }
 
 // CompressFrameData 使用gzip和base64压缩帧数据
@@ -120,12 +149,12 @@ func CompressFrameData(data []byte) ([]byte, error) {
 
 	// 写入数据
 	if _, err := gzipWriter.Write(data); err != nil {
-		return nil, fmt.Errorf("压缩数据失败: %v", err)
+		return nil, fmt.Errorf(util.T("compressing the data failed: %v"), err)
 	}
 
 	// 关闭压缩器
 	if err := gzipWriter.Close(); err != nil {
-		return nil, fmt.Errorf("关闭压缩器失败: %v", err)
+		return nil, fmt.Errorf(util.T("closing the compressor failed: %v"), err)
 	}
 
 	// 对压缩后的数据进行base64编码
@@ -143,8 +172,39 @@ func NewCompressedFrame(startTime, endTime float64, data []byte) (*Frame, error)
 
 	return &Frame{
 		Time:      startTime,
-		EventType: "z",
+		EventType: CompressedEventType,
 		EventData: compressedData,
 		EndTime:   endTime,
 	}, nil
 }
+
+// DecompressFrameData 解码base64并解压缩z型压缩帧的数据
+func DecompressFrameData(data []byte) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, fmt.Errorf(util.T("base64 decoding failed: %v"), err)
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(decoded))
+	if err != nil {
+		return nil, fmt.Errorf(util.T("creating the gzip reader failed: %v"), err)
+	}
+	defer gzipReader.Close()
+
+	decompressed, err := io.ReadAll(gzipReader)
+	if err != nil {
+		return nil, fmt.Errorf(util.T("reading the decompressed data failed: %v"), err)
+	}
+	return decompressed, nil
+}
+
+// OutputData 返回帧的终端输出数据，压缩帧会被解压，非输出帧返回nil
+func (f *Frame) OutputData() ([]byte, error) {
+	switch f.EventType {
+	case CompressedEventType:
+		return DecompressFrameData(f.EventData)
+	case OutputEventType:
+		return f.EventData, nil
+	}
+	return nil, nil
+}
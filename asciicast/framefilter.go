@@ -0,0 +1,304 @@
+package asciicast
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/x6nux/asciinema/terminal"
+)
+
+// BellEventType 录制时从输出中检测到的响铃事件，数据为空
+const BellEventType = "b"
+
+// FrameFilter 录制时在帧到达录像、回调和镜像之前处理帧，用于在录制时就执行策略(不记录密钥、不记录标题等)。
+// 同一个录制的帧按顺序交给同一个FrameFilter
+type FrameFilter interface {
+	// Filter 处理一帧，返回继续传递的帧，可以为空
+	Filter(frame Frame) []Frame
+	// Flush 录制结束时返回还没有传递的帧
+	Flush() []Frame
+}
+
+// FilterChain 依次经过的多个FrameFilter
+type FilterChain []FrameFilter
+
+func (c FilterChain) Filter(frame Frame) []Frame {
+	frames := []Frame{frame}
+	for _, f := range c {
+		var next []Frame
+		for _, frame := range frames {
+			next = append(next, f.Filter(frame)...)
+		}
+		frames = next
+	}
+	return frames
+}
+
+func (c FilterChain) Flush() []Frame {
+	var frames []Frame
+	for _, f := range c {
+		// 前面的过滤器留下的帧先经过f，再加上f自己留下的帧
+		var next []Frame
+		for _, frame := range frames {
+			next = append(next, f.Filter(frame)...)
+		}
+		frames = append(next, f.Flush()...)
+	}
+	return frames
+}
+
+// ParseFrameFilter 解析--filter的值，格式为name或name=参数：
+//
+//	strip-osc            去掉所有OSC序列(标题、剪贴板、超链接等)
+//	strip-osc=0,1,2,52   只去掉指定编号的OSC序列
+//	strip-images         去掉kitty、sixel和iTerm2图片
+//	strip-images=kitty   只去掉指定协议(kitty、sixel、iterm2)的图片
+//	redact-regex=RE      将输出和输入事件(如录制的粘贴)中匹配RE的内容替换为[REDACTED]，只在一帧之内匹配
+//	rate-limit=N         每秒最多N帧，间隔更短的帧合并到前一帧中，合并后的帧使用第一帧的时间
+//	bell                 输出中有响铃时在输出帧之后另外记录一个响铃事件
+func ParseFrameFilter(spec string) (FrameFilter, error) {
+	name, arg, hasArg := strings.Cut(spec, "=")
+	switch name {
+	case "strip-osc":
+		f := &OSCStripFilter{}
+		if hasArg {
+			for _, v := range strings.Split(arg, ",") {
+				n, err := strconv.Atoi(strings.TrimSpace(v))
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid OSC number %q in filter %q", v, spec)
+				}
+				f.Numbers = append(f.Numbers, n)
+			}
+		}
+		return f, nil
+	case "strip-images":
+		var protocols []string
+		if hasArg {
+			protocols = strings.Split(arg, ",")
+		}
+		stripper, err := terminal.NewImageStripper(protocols)
+		if err != nil {
+			return nil, fmt.Errorf("filter %q: %v", spec, err)
+		}
+		return &ImageStripFilter{stripper: stripper}, nil
+	case "redact-regex":
+		if arg == "" {
+			return nil, fmt.Errorf("filter %q needs a pattern, e.g. redact-regex=AKIA[0-9A-Z]{16}", spec)
+		}
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in filter %q: %v", spec, err)
+		}
+		return &RedactFilter{Pattern: re}, nil
+	case "rate-limit":
+		fps, err := strconv.ParseFloat(arg, 64)
+		if err != nil || fps <= 0 {
+			return nil, fmt.Errorf("filter %q needs a positive number of frames per second, e.g. rate-limit=30", spec)
+		}
+		return &RateLimitFilter{FPS: fps}, nil
+	case "bell":
+		return &BellFilter{}, nil
+	}
+	return nil, fmt.Errorf("unknown filter %q, use strip-osc, strip-images, redact-regex, rate-limit or bell", name)
+}
+
+// ParseFrameFilters 解析多个--filter，按顺序组成FilterChain，没有过滤器时返回nil
+func ParseFrameFilters(specs []string) (FrameFilter, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	chain := make(FilterChain, 0, len(specs))
+	for _, spec := range specs {
+		f, err := ParseFrameFilter(spec)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, f)
+	}
+	return chain, nil
+}
+
+// OSCStripFilter 去掉输出中的OSC序列，Numbers为空时去掉所有OSC序列。
+// 跨越多帧的序列会留到序列结束的那一帧再处理
+type OSCStripFilter struct {
+	Numbers []int
+	pending []byte
+	time    float64 // pending开始的帧的时间
+}
+
+func (f *OSCStripFilter) Filter(frame Frame) []Frame {
+	// 去掉OSC 7时也不记录由它得到的工作目录
+	if frame.EventType == CwdEventType && f.strips([]byte("7")) {
+		return nil
+	}
+	if frame.EventType != OutputEventType {
+		return []Frame{frame}
+	}
+	data := frame.EventData
+	if len(f.pending) > 0 {
+		data = append(f.pending, data...)
+		frame.Time = f.time
+		f.pending = nil
+	}
+	out := make([]byte, 0, len(data))
+	for {
+		i := bytes.Index(data, []byte("\x1b]"))
+		if i < 0 {
+			k := partialSuffix(data, "\x1b]")
+			out = append(out, data[:len(data)-k]...)
+			f.hold(data[len(data)-k:], frame.Time)
+			break
+		}
+		out = append(out, data[:i]...)
+		rest := data[i+2:]
+		end, n := oscEnd(rest)
+		if end < 0 {
+			if len(rest) > maxPendingBytes {
+				out = append(out, data[i:]...)
+			} else {
+				f.hold(data[i:], frame.Time)
+			}
+			break
+		}
+		if !f.strips(rest[:end]) {
+			out = append(out, data[i:i+2+end+n]...)
+		}
+		data = rest[end+n:]
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	frame.EventData = out
+	return []Frame{frame}
+}
+
+// strips 判断是否去掉参数为params的OSC序列
+func (f *OSCStripFilter) strips(params []byte) bool {
+	if len(f.Numbers) == 0 {
+		return true
+	}
+	num, _, _ := bytes.Cut(params, []byte(";"))
+	n, err := strconv.Atoi(string(num))
+	if err != nil {
+		return false
+	}
+	for _, v := range f.Numbers {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *OSCStripFilter) hold(data []byte, t float64) {
+	if len(data) > 0 {
+		f.pending = append([]byte{}, data...)
+		f.time = t
+	}
+}
+
+func (f *OSCStripFilter) Flush() []Frame {
+	if len(f.pending) == 0 {
+		return nil
+	}
+	frame := Frame{Time: f.time, EventType: OutputEventType, EventData: f.pending}
+	f.pending = nil
+	return []Frame{frame}
+}
+
+// ImageStripFilter 去掉输出中的图片序列，录像中不保存图片数据，kitty的Unicode占位符替换为空格。
+// 跨越多帧的图片逐帧去掉，只有图片数据的帧不再记录
+type ImageStripFilter struct {
+	stripper *terminal.ImageStripper
+}
+
+func (f *ImageStripFilter) Filter(frame Frame) []Frame {
+	if frame.EventType != OutputEventType {
+		return []Frame{frame}
+	}
+	frame.EventData = f.stripper.Strip(frame.EventData)
+	if len(frame.EventData) == 0 {
+		return nil
+	}
+	return []Frame{frame}
+}
+
+func (f *ImageStripFilter) Flush() []Frame {
+	return nil
+}
+
+// RedactFilter 将输出和输入中匹配Pattern的内容替换为[REDACTED]，粘贴事件只替换粘贴的内容，保留开始和结束序列
+type RedactFilter struct {
+	Pattern *regexp.Regexp
+}
+
+func (f *RedactFilter) Filter(frame Frame) []Frame {
+	switch {
+	case frame.IsPaste():
+		text := f.Pattern.ReplaceAllLiteral(frame.PasteText(), []byte("[REDACTED]"))
+		frame.EventData = append(append([]byte(terminal.PasteBegin), text...), terminal.PasteEnd...)
+	case frame.EventType == OutputEventType || frame.EventType == InputEventType:
+		frame.EventData = f.Pattern.ReplaceAllLiteral(frame.EventData, []byte("[REDACTED]"))
+	}
+	return []Frame{frame}
+}
+
+func (f *RedactFilter) Flush() []Frame {
+	return nil
+}
+
+// RateLimitFilter 限制每秒的输出帧数，与上一帧间隔小于1/FPS秒的输出合并到上一帧中，
+// 上一帧在下一个足够晚的帧到来或录制结束时才传递
+type RateLimitFilter struct {
+	FPS     float64
+	pending *Frame
+}
+
+func (f *RateLimitFilter) Filter(frame Frame) []Frame {
+	if frame.EventType != OutputEventType {
+		if f.pending == nil {
+			return []Frame{frame}
+		}
+		// 其他事件不能排在它之前发生的输出前面
+		return append(f.Flush(), frame)
+	}
+	if f.pending != nil && frame.Time-f.pending.Time < 1/f.FPS {
+		f.pending.EventData = append(f.pending.EventData, frame.EventData...)
+		return nil
+	}
+	out := f.Flush()
+	frame.EventData = append([]byte{}, frame.EventData...)
+	f.pending = &frame
+	return out
+}
+
+func (f *RateLimitFilter) Flush() []Frame {
+	if f.pending == nil {
+		return nil
+	}
+	frame := *f.pending
+	f.pending = nil
+	return []Frame{frame}
+}
+
+// BellFilter 在含有响铃(BEL)的输出帧之后记录一个响铃事件，输出本身不变
+type BellFilter struct {
+	scanner terminal.BellScanner
+}
+
+func (f *BellFilter) Filter(frame Frame) []Frame {
+	if frame.EventType != OutputEventType {
+		return []Frame{frame}
+	}
+	if _, bells := f.scanner.Scan(frame.EventData, false); bells == 0 {
+		return []Frame{frame}
+	}
+	return []Frame{frame, {Time: frame.Time, EventType: BellEventType}}
+}
+
+func (f *BellFilter) Flush() []Frame {
+	return nil
+}
@@ -0,0 +1,73 @@
+package asciicast
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// HTTPHeaders 通过HTTP打开录像时按主机附加的请求头，键为主机名或"*.example.com"形式的通配，
+// 可在配置文件的[http "主机"]中设置。预签名地址(S3、GCS、Azure等)签名时包含的请求头必须随请求发送，
+// 如SSE-C加密对象的x-amz-server-side-encryption-customer-*
+var HTTPHeaders = map[string]http.Header{}
+
+// headersFor 返回发往host的请求需要附加的请求头
+func headersFor(host string) http.Header {
+	header := http.Header{}
+	for pattern, h := range HTTPHeaders {
+		pattern = strings.ToLower(pattern)
+		if pattern != host && !(strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])) {
+			continue
+		}
+		for name, values := range h {
+			for _, v := range values {
+				header.Add(name, v)
+			}
+		}
+	}
+	return header
+}
+
+// httpGet 请求url，附加该主机配置的请求头。重定向时请求头随之发送，跨域时Authorization、Cookie除外
+func httpGet(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range headersFor(strings.ToLower(req.URL.Hostname())) {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// 错误信息中包含地址，去掉其中的签名
+		return nil, fmt.Errorf("requesting %v: %v", redactURL(url), unwrapURLError(err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = fmt.Errorf("got status %v when requesting %v", resp.StatusCode, redactURL(url))
+		if resp.StatusCode == http.StatusForbidden && req.URL.RawQuery != "" {
+			err = fmt.Errorf("%v (a presigned URL may have expired or need headers set in the [http] config section)", err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// redactURL 去掉地址中的查询参数，避免在错误信息中泄露预签名地址的签名
+func redactURL(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil || u.RawQuery == "" {
+		return url
+	}
+	u.RawQuery = "..."
+	return u.String()
+}
+
+// unwrapURLError 取出*url.Error中的原始错误，*url.Error的信息中包含完整的地址
+func unwrapURLError(err error) error {
+	if e, ok := err.(*neturl.Error); ok {
+		return e.Err
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package asciicast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultIPFSGateway 默认的IPFS网关
+const DefaultIPFSGateway = "https://ipfs.io"
+
+// IPFSGateway 打开ipfs://、ipns://地址时使用的HTTP网关，可在配置文件的[ipfs]中修改
+var IPFSGateway = DefaultIPFSGateway
+
+// resolveIPFS 将ipfs://<cid>、ipns://<name>以及旧的ipfs://ipfs/<cid>、fs:/ipfs/<cid>形式的地址
+// 转换为网关上的HTTP地址，其他地址原样返回
+func resolveIPFS(url string) string {
+	var path string
+	switch {
+	case strings.HasPrefix(url, "ipfs://"):
+		path = strings.TrimPrefix(url, "ipfs://")
+		if !strings.HasPrefix(path, "ipfs/") && !strings.HasPrefix(path, "ipns/") {
+			path = "ipfs/" + path
+		}
+	case strings.HasPrefix(url, "ipns://"):
+		path = "ipns/" + strings.TrimPrefix(url, "ipns://")
+	case strings.HasPrefix(url, "fs:/"):
+		path = strings.TrimLeft(strings.TrimPrefix(url, "fs:"), "/")
+	default:
+		return url
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimRight(IPFSGateway, "/"), path)
+}
+
+// IPFSURL 返回CID在网关上的HTTP地址
+func IPFSURL(cid string) string {
+	return resolveIPFS("ipfs://" + cid)
+}
@@ -0,0 +1,49 @@
+package asciicast
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/x6nux/asciinema/util"
+)
+
+// Machine 录制所在机器的信息，用于审计和批量录制时确定录像来源。出于隐私考虑默认不记录
+type Machine struct {
+	Hostname string `json:"hostname,omitempty"`
+	User     string `json:"user,omitempty"`
+	OS       string `json:"os,omitempty"`
+	Cwd      string `json:"cwd,omitempty"`
+}
+
+// MachineFields 可以记录到头部的机器信息
+var MachineFields = []string{"hostname", "user", "os", "cwd"}
+
+// NewMachine 收集fields中指定的机器信息，"all"表示全部；fields为空时返回nil
+func NewMachine(fields []string) (*Machine, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	m := &Machine{}
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "all" {
+			m, _ = NewMachine(MachineFields)
+			continue
+		}
+		switch field {
+		case "hostname":
+			m.Hostname, _ = os.Hostname()
+		case "user":
+			m.User = util.Username()
+		case "os":
+			m.OS = runtime.GOOS + "/" + runtime.GOARCH
+		case "cwd":
+			m.Cwd, _ = os.Getwd()
+		default:
+			return nil, fmt.Errorf("unknown machine metadata %q, must be one of %s or all", field, strings.Join(MachineFields, ", "))
+		}
+	}
+	return m, nil
+}
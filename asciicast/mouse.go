@@ -0,0 +1,71 @@
+package asciicast
+
+import "bytes"
+
+// maxMouseReport 鼠标上报序列的最大长度，超过时不再等待后续字节
+const maxMouseReport = 32
+
+// mouseScanner 从用户输入中找出终端的鼠标上报，支持SGR(1006)、urxvt(1015)和X10/普通(1000)格式。
+// 上报可以跨越多次读取
+type mouseScanner struct {
+	pending []byte
+}
+
+// scan 返回p中完整的鼠标上报，多个上报连在一起返回
+func (s *mouseScanner) scan(p []byte) []byte {
+	data := append(s.pending, p...)
+	s.pending = nil
+	var out []byte
+	for {
+		i := bytes.Index(data, []byte("\x1b["))
+		if i < 0 {
+			if len(data) > 0 && data[len(data)-1] == 0x1b {
+				s.pending = []byte{0x1b}
+			}
+			return out
+		}
+		n, complete := mouseReport(data[i+2:])
+		if !complete {
+			if len(data)-i <= maxMouseReport {
+				s.pending = append([]byte{}, data[i:]...)
+			}
+			return out
+		}
+		if n > 0 {
+			out = append(out, data[i:i+2+n]...)
+		}
+		data = data[i+2+n:]
+	}
+}
+
+// mouseReport 检查CSI之后的内容是否为鼠标上报，返回上报在CSI之后的长度；
+// 不是鼠标上报时返回0，内容还不完整时complete为false
+func mouseReport(data []byte) (n int, complete bool) {
+	if len(data) == 0 {
+		return 0, false
+	}
+	if data[0] == 'M' {
+		// X10格式：CSI M后面是按键、列、行三个字节
+		if len(data) < 4 {
+			return 0, false
+		}
+		return 4, true
+	}
+	start := 0
+	if data[0] == '<' {
+		start = 1
+	}
+	fields := 1
+	for k := start; k < len(data); k++ {
+		switch b := data[k]; {
+		case b >= '0' && b <= '9':
+		case b == ';':
+			fields++
+		case (b == 'M' || (b == 'm' && start == 1)) && fields == 3 && k > start:
+			return k + 1, true
+		default:
+			return 0, true
+		}
+	}
+	return 0, false
+}
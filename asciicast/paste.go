@@ -0,0 +1,56 @@
+package asciicast
+
+import (
+	"bytes"
+
+	"github.com/x6nux/asciinema/terminal"
+)
+
+// pasteScanner 从用户输入中找出括号粘贴模式下的粘贴内容，一次粘贴可以跨越多次读取
+type pasteScanner struct {
+	pending []byte // 粘贴中已经收到的内容，或末尾可能是开始序列开头的输入
+	pasting bool
+}
+
+// scan 返回p中完整的粘贴(包括开始和结束序列)，以及粘贴之外的输入
+func (s *pasteScanner) scan(p []byte) (pastes [][]byte, rest []byte) {
+	data := append(s.pending, p...)
+	s.pending = nil
+	for {
+		if !s.pasting {
+			i := bytes.Index(data, []byte(terminal.PasteBegin))
+			if i < 0 {
+				k := partialSuffix(data, terminal.PasteBegin)
+				rest = append(rest, data[:len(data)-k]...)
+				s.pending = append(s.pending, data[len(data)-k:]...)
+				return pastes, rest
+			}
+			rest = append(rest, data[:i]...)
+			data = data[i:]
+			s.pasting = true
+		}
+		j := bytes.Index(data, []byte(terminal.PasteEnd))
+		if j < 0 {
+			s.pending = append([]byte{}, data...)
+			return pastes, rest
+		}
+		end := j + len(terminal.PasteEnd)
+		pastes = append(pastes, append([]byte{}, data[:end]...))
+		data = data[end:]
+		s.pasting = false
+	}
+}
+
+// IsPaste 判断是否为录制的一次粘贴，即包含开始和结束序列的输入事件。
+// 帧过滤器可以据此单独处理粘贴的内容
+func (f *Frame) IsPaste() bool {
+	return f.EventType == InputEventType && bytes.HasPrefix(f.EventData, []byte(terminal.PasteBegin)) && bytes.HasSuffix(f.EventData, []byte(terminal.PasteEnd))
+}
+
+// PasteText 返回粘贴事件中粘贴的内容，不是粘贴事件时返回nil
+func (f *Frame) PasteText() []byte {
+	if !f.IsPaste() {
+		return nil
+	}
+	return f.EventData[len(terminal.PasteBegin) : len(f.EventData)-len(terminal.PasteEnd)]
+}
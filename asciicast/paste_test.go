@@ -0,0 +1,75 @@
+package asciicast
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPasteScanner(t *testing.T) {
+	tests := []struct {
+		name    string
+		writes  []string // 依次读到的输入
+		pastes  []string
+		rest    string // 各次返回的粘贴之外的输入
+		pasting bool   // 最后是否仍在粘贴中
+	}{
+		{"no paste", []string{"ls -l\r"}, nil, "ls -l\r", false},
+		{"single write", []string{"a\x1b[200~hello\x1b[201~b"}, []string{"\x1b[200~hello\x1b[201~"}, "ab", false},
+		{"two pastes", []string{"\x1b[200~x\x1b[201~ \x1b[200~y\x1b[201~"}, []string{"\x1b[200~x\x1b[201~", "\x1b[200~y\x1b[201~"}, " ", false},
+		{"split across writes", []string{"a\x1b[200~hel", "lo\r\nwor", "ld\x1b[201~b"}, []string{"\x1b[200~hello\r\nworld\x1b[201~"}, "ab", false},
+		{"split sequences", []string{"\x1b[20", "0~hi\x1b[2", "01~"}, []string{"\x1b[200~hi\x1b[201~"}, "", false},
+		{"escape that is not a paste", []string{"\x1b[2", "A"}, nil, "\x1b[2A", false},
+		{"unterminated", []string{"a\x1b[200~never", " ends"}, nil, "a", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s pasteScanner
+			var pastes []string
+			var rest strings.Builder
+			for _, w := range tt.writes {
+				p, r := s.scan([]byte(w))
+				for _, paste := range p {
+					pastes = append(pastes, string(paste))
+				}
+				rest.Write(r)
+			}
+			if !reflect.DeepEqual(pastes, tt.pastes) {
+				t.Errorf("pastes = %q, want %q", pastes, tt.pastes)
+			}
+			if rest.String() != tt.rest {
+				t.Errorf("rest = %q, want %q", rest.String(), tt.rest)
+			}
+			if s.pasting != tt.pasting {
+				t.Errorf("pasting = %v, want %v", s.pasting, tt.pasting)
+			}
+		})
+	}
+}
+
+// 录制时输出和粘贴依次经过--filter指定的各个过滤器
+func TestRecordFilterChain(t *testing.T) {
+	filter, err := ParseFrameFilters([]string{"strip-osc", "redact-regex=secret[0-9]+"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStream(1)
+	s.SetFilter(filter)
+	input := s.CaptureInput(false, true)
+	s.Write([]byte("\x1b]0;title\x07token secret123\r\n"))
+	input.Write([]byte("\x1b[200~pass sec"))
+	input.Write([]byte("ret42\x1b[201~"))
+	s.Close()
+
+	var got []string
+	for _, f := range s.Frames {
+		got = append(got, f.EventType+" "+string(f.EventData))
+	}
+	want := []string{
+		"o token [REDACTED]\r\n",
+		"i \x1b[200~pass [REDACTED]\x1b[201~",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("frames = %q, want %q", got, want)
+	}
+}
@@ -2,6 +2,8 @@ package asciicast
 
 import (
 	"time"
+
+	"github.com/x6nux/asciinema/util"
 )
 
 type PlayerTerminal interface {
@@ -14,6 +16,7 @@ type Player interface {
 
 type AsciicastPlayer struct {
 	Terminal PlayerTerminal
+	Clock    util.Clock // 为nil时使用系统时钟
 }
 
 func NewPlayer(terminal PlayerTerminal) Player {
@@ -21,6 +24,10 @@ func NewPlayer(terminal PlayerTerminal) Player {
 }
 
 func (r *AsciicastPlayer) Play(asciicast *Asciicast, maxWait float64) error {
+	clock := r.Clock
+	if clock == nil {
+		clock = util.SystemClock
+	}
 	lenFrames := len(asciicast.Stdout)
 	for i, frame := range asciicast.Stdout {
 		delay := frame.Time
@@ -32,8 +39,10 @@ func (r *AsciicastPlayer) Play(asciicast *Asciicast, maxWait float64) error {
 		if maxWait > 0 && delay > maxWait {
 			delay = maxWait
 		}
-		r.Terminal.Write(frame.EventData)
-		time.Sleep(time.Duration(float64(time.Second) * delay))
+		if data, err := frame.OutputData(); err == nil && data != nil {
+			r.Terminal.Write(data)
+		}
+		clock.Sleep(time.Duration(float64(time.Second) * delay))
 	}
 
 	return nil
@@ -0,0 +1,38 @@
+package asciicast
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// DefaultTimePrecision 时间默认保留的小数位数(微秒)，与上游asciinema一致
+const DefaultTimePrecision = 6
+
+// maxTimePrecision 时间最多保留的小数位数(纳秒)
+const maxTimePrecision = 9
+
+// TimePrecision 写入录像时帧时间和时长保留的小数位数。录制、编辑和转换写出的录像都按它格式化，
+// 同一个时间总是写成同样的文本，编辑后重新写入也不会因为浮点误差产生多余的差异
+var TimePrecision = DefaultTimePrecision
+
+// SetTimePrecision 设置TimePrecision，3为毫秒，6为微秒
+func SetTimePrecision(digits int) error {
+	if digits < 0 || digits > maxTimePrecision {
+		return fmt.Errorf("invalid time precision %d, use 0 to %d decimal places", digits, maxTimePrecision)
+	}
+	TimePrecision = digits
+	return nil
+}
+
+// RoundTime 将时间取整到TimePrecision位小数，去掉运算累积的浮点误差
+func RoundTime(t float64) float64 {
+	scale := math.Pow10(TimePrecision)
+	return math.Round(t*scale) / scale
+}
+
+// EncodeTime 返回按TimePrecision格式化的时间，编码为JSON时是固定小数位数的数字
+func EncodeTime(t float64) json.Number {
+	return json.Number(strconv.FormatFloat(t, 'f', TimePrecision, 64))
+}
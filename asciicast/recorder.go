@@ -1,10 +1,13 @@
 package asciicast
 
 import (
+	"io"
 	"os"
+	"time"
 
 	"github.com/x6nux/asciinema/terminal"
 	"github.com/x6nux/asciinema/util"
+	"golang.org/x/term"
 )
 
 const (
@@ -12,6 +15,28 @@ const (
 	warnRows = 30
 )
 
+const (
+	// RecEnv 是asciinema标准的录制中环境变量
+	RecEnv = "ASCIINEMA_REC"
+	// RecordingEnv 是旧版本使用的录制中环境变量
+	RecordingEnv = "ASCIINEMA_RECORDING"
+)
+
+// IsRecording 检查当前环境是否已经处于录制中，用于检测嵌套录制
+func IsRecording(env map[string]string) bool {
+	return env[RecEnv] == "1" || env[RecordingEnv] != ""
+}
+
+func setRecordingEnv() {
+	os.Setenv(RecEnv, "1")
+	os.Setenv(RecordingEnv, "true")
+}
+
+func unsetRecordingEnv() {
+	os.Unsetenv(RecEnv)
+	os.Unsetenv(RecordingEnv)
+}
+
 // FrameCallback 定义帧处理的回调函数类型
 type FrameCallback func(frame Frame)
 
@@ -21,35 +46,52 @@ type Recorder interface {
 	RecordWithCallback(command, title string, maxWait float64, assumeYes bool, env map[string]string, callback FrameCallback) (Asciicast, error)
 	// 获取终端大小
 	GetTerminalSize() (rows, cols int, err error)
+	// 设置只注入到被录制shell中的额外环境变量(KEY=VAL)
+	SetExtraEnv(envs []string)
+	// 固定被录制程序的终端大小，不受真实终端大小的影响
+	SetSize(cols, rows int)
+	// 将录制的输出实时复制到另一个writer，如其他终端设备
+	SetMirror(w io.Writer)
+	// 设置额外写入被录制程序的输入，如远程观看者的按键
+	SetInput(in <-chan []byte)
+	// 设置计时使用的时钟，默认为系统时钟
+	SetClock(clock util.Clock)
+	// 将帧时间取整到precision的倍数，为0时不取整
+	SetPrecision(precision time.Duration)
+	// 设置帧在记录之前经过的过滤器，为nil时不过滤
+	SetFilter(filter FrameFilter)
+	// 将用户输入中的鼠标上报记录为输入("i")事件
+	SetCaptureMouse(capture bool)
+	// 将用户的每次粘贴(括号粘贴模式)记录为输入("i")事件
+	SetCapturePaste(capture bool)
 }
 
 type AsciicastRecorder struct {
-	Terminal terminal.Terminal
+	Terminal  terminal.Terminal
+	ExtraEnv  []string
+	Mirror    io.Writer
+	Clock     util.Clock
+	Precision time.Duration
+	Filter    FrameFilter
+	Mouse     bool // 记录鼠标输入
+	Paste     bool // 记录粘贴
+	fixedSize bool
 }
 
 func NewRecorder() Recorder {
-	return &AsciicastRecorder{Terminal: terminal.NewTerminal()}
+	return &AsciicastRecorder{Terminal: terminal.NewTerminal(), Clock: util.SystemClock}
 }
 
 func (r *AsciicastRecorder) Record(command, title string, maxWait float64, assumeYes bool, env map[string]string) (Asciicast, error) {
-	rows, cols, _ := r.Terminal.Size()
-	if rows > warnRows || cols > warnCols {
-		if !assumeYes {
-			doneChan := r.checkTerminalSize()
-			util.Warningf("Current terminal size is %vx%v.", cols, rows)
-			util.Warningf("It may be too big to be properly replayed on smaller screens.")
-			util.Warningf("You can now resize it. Press <Enter> to start recording.")
-			util.ReadLine()
-			doneChan <- true
-		}
-	}
-	os.Setenv("ASCIINEMA_RECORDING", "true")
+	r.warnSize(assumeYes)
+	theme := QueryTheme()
+	setRecordingEnv()
 	util.Printf("Asciicast recording started.")
 	util.Printf(`Hit Ctrl-D or type "exit" to finish.`)
 
-	stdout := NewStream(maxWait)
+	stdout := r.stream(NewStream(maxWait))
 
-	err := r.Terminal.Record(command, stdout)
+	err := r.Terminal.Record(command, stdout, r.childEnv()...)
 	if err != nil {
 		return Asciicast{}, err
 	}
@@ -58,7 +100,7 @@ func (r *AsciicastRecorder) Record(command, title string, maxWait float64, assum
 
 	util.Printf("Asciicast recording finished.")
 
-	rows, cols, _ = r.Terminal.Size()
+	rows, cols, _ := r.Terminal.Size()
 
 	asciicast := NewAsciicast(
 		cols,
@@ -69,32 +111,24 @@ func (r *AsciicastRecorder) Record(command, title string, maxWait float64, assum
 		stdout.Frames,
 		env,
 	)
+	asciicast.Timestamp = r.Clock.Now().Unix()
+	asciicast.Theme = theme
 
-	os.Unsetenv("ASCIINEMA_RECORDING")
+	unsetRecordingEnv()
 	return *asciicast, nil
 }
 
 // 实现支持回调的录制方法
 func (r *AsciicastRecorder) RecordWithCallback(command, title string, maxWait float64, assumeYes bool, env map[string]string, callback FrameCallback) (Asciicast, error) {
-	rows, cols, _ := r.Terminal.Size()
-	if rows > warnRows || cols > warnCols {
-		if !assumeYes {
-			doneChan := r.checkTerminalSize()
-			util.Warningf("Current terminal size is %vx%v.", cols, rows)
-			util.Warningf("It may be too big to be properly replayed on smaller screens.")
-			util.Warningf("You can now resize it. Press <Enter> to start recording.")
-			util.ReadLine()
-			doneChan <- true
-		}
-	}
-	os.Setenv("ASCIINEMA_RECORDING", "true")
+	r.warnSize(assumeYes)
+	setRecordingEnv()
 	util.Printf("Asciicast recording with stream writing started.")
 	util.Printf(`Hit Ctrl-D or type "exit" to finish.`)
 
 	// 创建一个自定义的Stream，支持回调
-	stdout := NewStreamWithCallback(maxWait, callback)
+	stdout := r.stream(NewStreamWithCallback(maxWait, callback))
 
-	err := r.Terminal.Record(command, stdout)
+	err := r.Terminal.Record(command, stdout, r.childEnv()...)
 	if err != nil {
 		return Asciicast{}, err
 	}
@@ -103,7 +137,7 @@ func (r *AsciicastRecorder) RecordWithCallback(command, title string, maxWait fl
 
 	util.Printf("Asciicast recording finished.")
 
-	rows, cols, _ = r.Terminal.Size()
+	rows, cols, _ := r.Terminal.Size()
 
 	asciicast := NewAsciicast(
 		cols,
@@ -114,8 +148,9 @@ func (r *AsciicastRecorder) RecordWithCallback(command, title string, maxWait fl
 		stdout.Frames,
 		env,
 	)
+	asciicast.Timestamp = r.Clock.Now().Unix()
 
-	os.Unsetenv("ASCIINEMA_RECORDING")
+	unsetRecordingEnv()
 	return *asciicast, nil
 }
 
@@ -123,3 +158,94 @@ func (r *AsciicastRecorder) RecordWithCallback(command, title string, maxWait fl
 func (r *AsciicastRecorder) GetTerminalSize() (rows, cols int, err error) {
 	return r.Terminal.Size()
 }
+
+// warnSize 终端过大时提示可能无法在较小的屏幕上播放，并等待用户调整终端大小；
+// 固定了终端大小时只在真实终端放不下录制内容时提示
+func (r *AsciicastRecorder) warnSize(assumeYes bool) {
+	rows, cols, _ := r.Terminal.Size()
+	if r.fixedSize {
+		width, height, err := term.GetSize(int(os.Stdout.Fd()))
+		if err == nil && (width < cols || height < rows) {
+			util.Warningf("Recording at %vx%v, which is larger than the current terminal (%vx%v).", cols, rows, width, height)
+			util.Warningf("The output may look garbled here, but the recording is not affected.")
+		}
+		return
+	}
+	if rows > warnRows || cols > warnCols {
+		if !assumeYes {
+			doneChan := r.checkTerminalSize()
+			util.Warningf("Current terminal size is %vx%v.", cols, rows)
+			util.Warningf("It may be too big to be properly replayed on smaller screens.")
+			util.Warningf("You can now resize it. Press <Enter> to start recording.")
+			util.ReadLine()
+			doneChan <- true
+		}
+	}
+}
+
+// 固定终端大小
+func (r *AsciicastRecorder) SetSize(cols, rows int) {
+	r.Terminal.SetSize(cols, rows)
+	r.fixedSize = cols > 0 && rows > 0
+}
+
+// 设置输出的镜像
+func (r *AsciicastRecorder) SetMirror(w io.Writer) {
+	r.Mirror = w
+}
+
+// 设置额外的输入
+func (r *AsciicastRecorder) SetInput(in <-chan []byte) {
+	r.Terminal.SetInput(in)
+}
+
+// 设置计时的时钟
+func (r *AsciicastRecorder) SetClock(clock util.Clock) {
+	r.Clock = clock
+}
+
+// 设置帧时间的精度
+func (r *AsciicastRecorder) SetPrecision(precision time.Duration) {
+	r.Precision = precision
+}
+
+// 设置帧的过滤器
+func (r *AsciicastRecorder) SetFilter(filter FrameFilter) {
+	r.Filter = filter
+}
+
+// 设置是否记录鼠标输入
+func (r *AsciicastRecorder) SetCaptureMouse(capture bool) {
+	r.Mouse = capture
+}
+
+// 设置是否记录粘贴
+func (r *AsciicastRecorder) SetCapturePaste(capture bool) {
+	r.Paste = capture
+}
+
+// stream 按照设置的时钟、精度、过滤器和镜像配置录制输出的Stream，镜像收到的是过滤后的输出；
+// 记录鼠标输入或粘贴时用户的输入也交给这个Stream
+func (r *AsciicastRecorder) stream(s *Stream) *Stream {
+	s.SetClock(r.Clock)
+	s.SetPrecision(r.Precision)
+	s.SetFilter(r.Filter)
+	s.SetMirror(r.Mirror)
+	if r.Mouse || r.Paste {
+		r.Terminal.SetInputTap(s.CaptureInput(r.Mouse, r.Paste))
+	}
+	return s
+}
+
+// 设置额外的环境变量
+func (r *AsciicastRecorder) SetExtraEnv(envs []string) {
+	r.ExtraEnv = envs
+}
+
+// childEnv 返回被录制shell的环境变量，为空时由终端使用默认环境
+func (r *AsciicastRecorder) childEnv() []string {
+	if len(r.ExtraEnv) == 0 {
+		return nil
+	}
+	return append(os.Environ(), r.ExtraEnv...)
+}
@@ -0,0 +1,135 @@
+package asciicast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// defaultS3Region 没有配置区域时使用的区域，桶在其他区域时按服务器返回的区域重试
+const defaultS3Region = "us-east-1"
+
+// S3Endpoint 打开s3://地址时使用的S3兼容服务地址(如MinIO)，为空时使用AWS S3，可在配置文件的[s3]中修改
+var S3Endpoint string
+
+// ParseS3URL 解析s3://bucket/key形式的地址，key可以为空或是前缀
+func ParseS3URL(url string) (bucket, key string, err error) {
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(url, "s3://"), "/")
+	if !strings.HasPrefix(url, "s3://") || bucket == "" {
+		return "", "", fmt.Errorf("invalid s3 address %v, expected s3://bucket/key", url)
+	}
+	return bucket, key, nil
+}
+
+// S3Client 访问一个桶的S3客户端。凭证和区域按AWS SDK的默认顺序查找：
+// 环境变量、~/.aws/credentials和~/.aws/config中的profile、SSO、EC2/ECS实例角色等，
+// 请求到错误的区域时改用桶实际所在的区域重试
+type S3Client struct {
+	Bucket string
+
+	cfg    aws.Config
+	region string
+	client *s3.Client
+}
+
+// NewS3Client 创建访问bucket的S3客户端
+func NewS3Client(ctx context.Context, bucket string) (*S3Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load aws config: %v", err)
+	}
+	c := &S3Client{Bucket: bucket, cfg: cfg}
+	region := cfg.Region
+	if region == "" {
+		region = defaultS3Region
+	}
+	c.setRegion(region)
+	return c, nil
+}
+
+func (c *S3Client) setRegion(region string) {
+	c.region = region
+	c.client = s3.NewFromConfig(c.cfg, func(o *s3.Options) {
+		// S3兼容服务大多不返回校验和，不为此打印警告
+		o.DisableLogOutputChecksumValidationSkipped = true
+		o.Region = region
+		if S3Endpoint != "" {
+			o.BaseEndpoint = aws.String(S3Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+}
+
+// do 执行一个请求，桶在其他区域时改用该区域重试一次
+func (c *S3Client) do(request func(client *s3.Client) error) error {
+	err := request(c.client)
+	if actual := bucketRegion(err); actual != "" && actual != c.region {
+		c.setRegion(actual)
+		err = request(c.client)
+	}
+	return err
+}
+
+// Get 读取对象，对象不存在时返回的错误满足errors.Is(err, fs.ErrNotExist)
+func (c *S3Client) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	var out *s3.GetObjectOutput
+	err := c.do(func(client *s3.Client) (err error) {
+		out, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(c.Bucket), Key: aws.String(key)})
+		return err
+	})
+	var noKey *types.NoSuchKey
+	if errors.As(err, &noKey) {
+		return nil, fmt.Errorf("s3://%s/%s: %w", c.Bucket, key, fs.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get s3://%s/%s: %v", c.Bucket, key, err)
+	}
+	return out.Body, nil
+}
+
+// Put 写入对象
+func (c *S3Client) Put(ctx context.Context, key string, body io.ReadSeeker) error {
+	err := c.do(func(client *s3.Client) error {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String(c.Bucket), Key: aws.String(key), Body: body})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("put s3://%s/%s: %v", c.Bucket, key, err)
+	}
+	return nil
+}
+
+// openS3 读取s3://bucket/key
+func openS3(url string) (io.ReadCloser, error) {
+	bucket, key, err := ParseS3URL(url)
+	if err != nil || key == "" {
+		return nil, fmt.Errorf("invalid s3 address %v, expected s3://bucket/key", url)
+	}
+	ctx := context.Background()
+	client, err := NewS3Client(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return client.Get(ctx, key)
+}
+
+// bucketRegion 从请求到错误区域时S3返回的错误中取出桶实际所在的区域
+func bucketRegion(err error) string {
+	var respErr *awshttp.ResponseError
+	if err == nil || !errors.As(err, &respErr) || respErr.Response == nil {
+		return ""
+	}
+	return respErr.Response.Header.Get("X-Amz-Bucket-Region")
+}
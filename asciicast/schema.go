@@ -0,0 +1,21 @@
+package asciicast
+
+import (
+	"embed"
+	"fmt"
+)
+
+//go:embed schema/*.schema.json
+var schemaFS embed.FS
+
+// SchemaNames 可导出的JSON Schema名称
+var SchemaNames = []string{"header", "frame"}
+
+// Schema 返回cast格式的JSON Schema，name为header(头部)或frame(帧，包括z压缩帧)
+func Schema(name string) ([]byte, error) {
+	data, err := schemaFS.ReadFile("schema/" + name + ".schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown schema %q, available: %v", name, SchemaNames)
+	}
+	return data, nil
+}
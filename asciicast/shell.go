@@ -0,0 +1,108 @@
+package asciicast
+
+import (
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ShellEventType 录制时从输出中捕获的shell集成事件(OSC 133)，数据为"133;"之后的内容，
+// 如A(提示符开始)、B(提示符结束)、C(命令开始执行)、D;0(命令结束及退出码)
+const ShellEventType = "s"
+
+// CwdEventType 录制时从输出中捕获的工作目录变化(OSC 7)，数据为"7;"之后shell发出的地址，
+// 如file://host/home/me/src
+const CwdEventType = "d"
+
+const (
+	osc133         = "\x1b]133;"
+	osc7           = "\x1b]7;"
+	maxOSCEventLen = 4096 // 超过该长度仍未结束的序列视为无效，足以容纳较长的路径
+)
+
+// ParseShellEvent 解析shell集成事件的数据，返回事件类型(A/B/C/D)以及D事件中的退出码
+func ParseShellEvent(data string) (kind string, status int, hasStatus bool) {
+	fields := strings.Split(data, ";")
+	kind = fields[0]
+	if kind == "D" && len(fields) > 1 {
+		if code, err := strconv.Atoi(fields[1]); err == nil {
+			return kind, code, true
+		}
+	}
+	return kind, 0, false
+}
+
+// ParseCwdEvent 解析工作目录事件的数据，返回主机名和路径；不是URL时整个数据作为路径
+func ParseCwdEvent(data string) (host, path string) {
+	u, err := url.Parse(data)
+	if err != nil || u.Scheme == "" {
+		return "", data
+	}
+	return u.Host, u.Path
+}
+
+// oscScanner 从输出流中提取以intro开头的OSC序列的参数，序列可以跨越多次写入。
+// 同一个oscScanner总是使用同一个intro
+type oscScanner struct {
+	buf []byte // 上次写入末尾未结束的序列
+}
+
+func (s *oscScanner) scan(intro string, p []byte) []string {
+	data := p
+	if len(s.buf) > 0 {
+		data = append(s.buf, p...)
+		s.buf = nil
+	}
+	var events []string
+	for {
+		i := bytes.Index(data, []byte(intro))
+		if i < 0 {
+			// 保留可能是序列开头的部分
+			if k := partialSuffix(data, intro); k > 0 {
+				s.buf = append([]byte{}, data[len(data)-k:]...)
+			}
+			return events
+		}
+		rest := data[i+len(intro):]
+		end, n := oscEnd(rest)
+		if end < 0 {
+			if len(rest) <= maxOSCEventLen {
+				s.buf = append([]byte{}, data[i:]...)
+			}
+			return events
+		}
+		events = append(events, string(rest[:end]))
+		data = rest[end+n:]
+	}
+}
+
+// oscEnd 返回OSC序列结束符(BEL或ST)的位置及长度，尚未结束时返回-1
+func oscEnd(data []byte) (int, int) {
+	for j, b := range data {
+		switch b {
+		case 0x07:
+			return j, 1
+		case 0x1b:
+			if j+1 == len(data) {
+				return -1, 0
+			}
+			if data[j+1] == '\\' {
+				return j, 2
+			}
+			// 其他转义序列打断了OSC，该序列本身保留
+			return j, 0
+		}
+	}
+	return -1, 0
+}
+
+// partialSuffix 返回data末尾与intro开头相同部分的长度，即可能被截断的序列开头
+func partialSuffix(data []byte, intro string) int {
+	for k := min(len(data), len(intro)-1); k > 0; k-- {
+		if bytes.HasSuffix(data, []byte(intro[:k])) {
+			return k
+		}
+	}
+	return 0
+}
@@ -1,8 +1,11 @@
 package asciicast
 
 import (
+	"io"
 	"sync"
 	"time"
+
+	"github.com/x6nux/asciinema/util"
 )
 
 type Stream struct {
@@ -12,50 +15,154 @@ type Stream struct {
 	maxWait       time.Duration
 	lock          *sync.Mutex
 	callback      func(frame Frame)
+	shell         oscScanner // OSC 133
+	cwd           oscScanner // OSC 7
+	clock         util.Clock
+	precision     time.Duration // 大于0时帧时间取整到它的倍数
+	filter        FrameFilter   // 帧在记录之前经过的过滤器
+	mirror        io.Writer     // 过滤后的输出实时复制到这里
+	mu            sync.Mutex    // 输出和输入事件来自不同的goroutine
 }
 
+// NewStream 创建Stream，记录的空闲时间最多为maxWait秒，maxWait不大于0时不限制
 func NewStream(maxWait float64) *Stream {
-	if maxWait <= 0 {
-		maxWait = 1.0
-	}
 	return &Stream{
-		lastWriteTime: time.Now(),
+		lastWriteTime: util.SystemClock.Now(),
 		maxWait:       time.Duration(maxWait*1000000) * time.Microsecond,
 		lock:          &sync.Mutex{},
+		clock:         util.SystemClock,
 	}
 }
 
 // 创建支持回调的Stream
 func NewStreamWithCallback(maxWait float64, callback func(frame Frame)) *Stream {
-	if maxWait <= 0 {
-		maxWait = 1.0
-	}
 	return &Stream{
-		lastWriteTime: time.Now(),
+		lastWriteTime: util.SystemClock.Now(),
 		maxWait:       time.Duration(maxWait*1000000) * time.Microsecond,
 		lock:          &sync.Mutex{},
 		callback:      callback,
+		clock:         util.SystemClock,
 	}
 }
 
+// SetClock 使用指定的时钟计时，应在写入之前调用
+func (s *Stream) SetClock(clock util.Clock) {
+	s.lock.Lock()
+	s.clock = clock
+	s.lastWriteTime = clock.Now()
+	s.lock.Unlock()
+}
+
+// SetPrecision 将帧时间取整到precision的倍数，时间的微小抖动不会改变录像的内容
+func (s *Stream) SetPrecision(precision time.Duration) {
+	s.precision = precision
+}
+
+// SetFilter 帧在记录、回调和复制到镜像之前经过filter，应在写入之前调用
+func (s *Stream) SetFilter(filter FrameFilter) {
+	s.filter = filter
+}
+
+// SetMirror 将过滤后的输出实时复制到w，w出错不影响录制，应在写入之前调用
+func (s *Stream) SetMirror(w io.Writer) {
+	s.mirror = w
+}
+
 func (s *Stream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	frame := Frame{}
-	frame.EventType = "o"
+	frame.EventType = OutputEventType
 	frame.Time = s.incrementElapsedTime().Seconds()
 	frame.EventData = make([]byte, len(p))
 	copy(frame.EventData, p)
+	s.emit(frame)
+
+	// 输出中的shell集成序列和工作目录变化另外记录为事件
+	for _, data := range s.shell.scan(osc133, p) {
+		s.emit(Frame{Time: frame.Time, EventType: ShellEventType, EventData: []byte(data)})
+	}
+	for _, data := range s.cwd.scan(osc7, p) {
+		s.emit(Frame{Time: frame.Time, EventType: CwdEventType, EventData: []byte(data)})
+	}
+
+	return len(p), nil
+}
+
+// CaptureInput 返回记录用户输入的writer：mouse为true时记录其中的鼠标上报，paste为true时记录括号粘贴模式下
+// 的每次粘贴(包括开始和结束序列，分成多次读取的粘贴合并为一个事件)，都记录为输入("i")事件，其他输入不记录
+func (s *Stream) CaptureInput(mouse, paste bool) io.Writer {
+	return &inputCapture{s: s, mouse: mouse, paste: paste}
+}
+
+type inputCapture struct {
+	s           *Stream
+	mouse       bool
+	paste       bool
+	mouseReport mouseScanner
+	pasted      pasteScanner
+}
+
+func (c *inputCapture) Write(p []byte) (int, error) {
+	s := c.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rest := p
+	var pastes [][]byte
+	if c.paste {
+		pastes, rest = c.pasted.scan(p)
+	}
+	var frames []Frame
+	if c.mouse {
+		if data := c.mouseReport.scan(rest); len(data) > 0 {
+			frames = append(frames, Frame{EventType: InputEventType, EventData: data})
+		}
+	}
+	for _, data := range pastes {
+		frames = append(frames, Frame{EventType: InputEventType, EventData: data})
+	}
+	if len(frames) > 0 {
+		t := s.incrementElapsedTime().Seconds()
+		for _, frame := range frames {
+			frame.Time = t
+			s.emit(frame)
+		}
+	}
+	return len(p), nil
+}
+
+// emit 将一帧交给过滤器，记录过滤后的帧
+func (s *Stream) emit(frame Frame) {
+	if s.filter == nil {
+		s.record(frame)
+		return
+	}
+	for _, f := range s.filter.Filter(frame) {
+		s.record(f)
+	}
+}
+
+func (s *Stream) record(frame Frame) {
 	s.Frames = append(s.Frames, frame)
 
 	// 如果有回调函数，实时调用回调处理帧数据
 	if s.callback != nil {
 		s.callback(frame)
 	}
-
-	return len(p), nil
+	if s.mirror != nil && frame.EventType == OutputEventType {
+		s.mirror.Write(frame.EventData)
+	}
 }
 
 func (s *Stream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.incrementElapsedTime()
+	if s.filter != nil {
+		for _, f := range s.filter.Flush() {
+			s.record(f)
+		}
+	}
 
 	if len(s.Frames) > 0 && string(s.Frames[len(s.Frames)-1].EventData) == "exit\r\n" {
 		s.Frames = s.Frames[:len(s.Frames)-1]
@@ -63,12 +170,19 @@ func (s *Stream) Close() {
 }
 
 func (s *Stream) Duration() time.Duration {
-	return s.elapsedTime
+	return s.round(s.elapsedTime)
+}
+
+func (s *Stream) round(d time.Duration) time.Duration {
+	if s.precision <= 0 {
+		return d
+	}
+	return d.Round(s.precision)
 }
 
 func (s *Stream) incrementElapsedTime() time.Duration {
 	s.lock.Lock()
-	now := time.Now()
+	now := s.clock.Now()
 	d := now.Sub(s.lastWriteTime)
 
 	if s.maxWait > 0 && d > s.maxWait {
@@ -80,6 +194,7 @@ func (s *Stream) incrementElapsedTime() time.Duration {
 
 	s.elapsedTime += d
 	s.lastWriteTime = now
+	elapsed := s.round(s.elapsedTime)
 	s.lock.Unlock()
-	return s.elapsedTime
+	return elapsed
 }
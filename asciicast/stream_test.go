@@ -0,0 +1,32 @@
+package asciicast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/x6nux/asciinema/util"
+)
+
+// maxWait限制记录的空闲时间，为0时不限制
+func TestStreamMaxWait(t *testing.T) {
+	tests := []struct {
+		maxWait float64
+		want    float64 // 空闲5秒之后的帧时间
+	}{
+		{1, 2},
+		{2.5, 3.5},
+		{0, 6},
+	}
+	for _, tt := range tests {
+		clock := util.NewFakeClock(time.Unix(0, 0))
+		s := NewStream(tt.maxWait)
+		s.SetClock(clock)
+		clock.Advance(time.Second)
+		s.Write([]byte("a"))
+		clock.Advance(5 * time.Second)
+		s.Write([]byte("b"))
+		if got := s.Frames[1].Time; got != tt.want {
+			t.Errorf("maxWait %v: frame after 5s idle at %v, want %v", tt.maxWait, got, tt.want)
+		}
+	}
+}
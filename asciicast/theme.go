@@ -0,0 +1,67 @@
+package asciicast
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/x6nux/asciinema/terminal"
+)
+
+// themeQueryTimeout 等待终端回应颜色查询的最长时间
+const themeQueryTimeout = 300 * time.Millisecond
+
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Theme 录制时终端的配色，对应asciicast v2头部的theme字段
+type Theme struct {
+	Fg      string `json:"fg"`
+	Bg      string `json:"bg"`
+	Palette string `json:"palette,omitempty"` // 8或16个颜色，以冒号分隔
+}
+
+// QueryTheme 查询当前终端的前景色、背景色和调色板，终端不支持时返回nil
+func QueryTheme() *Theme {
+	colors, err := terminal.QueryColors(os.Stdin, os.Stdout, themeQueryTimeout)
+	if err != nil || colors.Fg == "" || colors.Bg == "" {
+		return nil
+	}
+	return &Theme{Fg: colors.Fg, Bg: colors.Bg, Palette: joinPalette(colors.Palette)}
+}
+
+// joinPalette 只有取到连续的前8或16个颜色时才记录调色板
+func joinPalette(palette map[int]string) string {
+	n := 0
+	for n < 16 && palette[n] != "" {
+		n++
+	}
+	if n < 8 {
+		return ""
+	}
+	n = n / 8 * 8
+	colors := make([]string, n)
+	for i := range colors {
+		colors[i] = palette[i]
+	}
+	return strings.Join(colors, ":")
+}
+
+// Validate 检查颜色是否为#rrggbb格式，调色板须为8或16个颜色
+func (t *Theme) Validate() error {
+	colors := []string{t.Fg, t.Bg}
+	if t.Palette != "" {
+		palette := strings.Split(t.Palette, ":")
+		if len(palette) != 8 && len(palette) != 16 {
+			return fmt.Errorf("palette must have 8 or 16 colors, got %d", len(palette))
+		}
+		colors = append(colors, palette...)
+	}
+	for _, c := range colors {
+		if !hexColor.MatchString(c) {
+			return fmt.Errorf("invalid color %q, must be #rrggbb", c)
+		}
+	}
+	return nil
+}
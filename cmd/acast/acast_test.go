@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// acast speed --factor 2 'casts/*.cast' --out-dir fast/ 不指定区间时调节整个录像
+func TestSpeedWithoutRange(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("LC_ALL", "en_US.UTF-8")
+	casts, fast := filepath.Join(dir, "casts"), filepath.Join(dir, "fast")
+	os.Mkdir(casts, 0o755)
+	cast := "{\"version\":2,\"width\":80,\"height\":24}\n[1.0,\"o\",\"a\"]\n[2.0,\"o\",\"b\"]\n[4.0,\"o\",\"c\"]\n"
+	for _, name := range []string{"one.cast", "two.cast"} {
+		if err := os.WriteFile(filepath.Join(casts, name), []byte(cast), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewCli()
+	c.rootCmd.SetArgs([]string{"speed", "--factor", "2", filepath.Join(casts, "*.cast"), "--out-dir", fast})
+	if err := c.rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"one.cast", "two.cast"} {
+		data, err := os.ReadFile(filepath.Join(fast, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		want := []string{`[1.000000,"o","a"]`, `[3.000000,"o","b"]`, `[7.000000,"o","c"]`}
+		if got := lines[1:]; strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: got events %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/util"
+	"golang.org/x/net/websocket"
+	"golang.org/x/term"
+)
+
+// IsRemoteSession 判断attach的参数是否为acast daemon中录制的地址
+func IsRemoteSession(name string) bool {
+	for _, scheme := range []string{"ws://", "wss://", "http://", "https://"} {
+		if strings.HasPrefix(name, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// AttachRemote 通过网络实时观看acast daemon中的录制，rawURL为录制的attach地址，
+// 如ws://host:7078/api/v1/sessions/<id>/attach。收到的输出先在抖动缓冲中停留buffer，
+// 再按录制时的时间戳输出，除非设置了Unsafe，危险的转义序列会被去掉；input为true时将按键发送给被录制的程序
+func (r *Runner) AttachRemote(rawURL, token string, input bool, buffer time.Duration) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	origin := &url.URL{Scheme: "http", Host: u.Host}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme, origin.Scheme = "wss", "https"
+	case "wss":
+		origin.Scheme = "https"
+	}
+	query := u.Query()
+	query.Set("format", "asciicast")
+	if !input {
+		query.Set("readonly", "1")
+	}
+	u.RawQuery = query.Encode()
+	config, err := websocket.NewConfig(u.String(), origin.String())
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		config.Header.Set("Authorization", "Bearer "+token)
+	}
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	var line string
+	if err := websocket.Message.Receive(ws, &line); err != nil {
+		return err
+	}
+	header := &asciicast.Header{}
+	if err := json.Unmarshal([]byte(line), header); err != nil {
+		return fmt.Errorf("invalid session header: %v", err)
+	}
+	if cols, rows, err := term.GetSize(int(os.Stdout.Fd())); err == nil && (cols < header.Width || rows < header.Height) {
+		util.Warningf("Terminal size %dx%d is smaller than the session size %dx%d, the output may be garbled.", cols, rows, header.Width, header.Height)
+	}
+
+	quit, restore, err := startAttachInput(input, func(data string) error {
+		return websocket.Message.Send(ws, data)
+	})
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	jitter := newJitterBuffer(r.attachOutput(), buffer)
+	ended := make(chan error, 1)
+	go func() {
+		for {
+			var line string
+			if err := websocket.Message.Receive(ws, &line); err != nil {
+				if closeErr := jitter.Close(); closeErr != nil {
+					err = closeErr
+				}
+				ended <- err
+				return
+			}
+			frame := asciicast.Frame{}
+			if frame.UnmarshalJSON([]byte(line)) == nil && frame.EventType == asciicast.OutputEventType {
+				jitter.Push(frame)
+			}
+		}
+	}()
+	select {
+	case <-quit:
+		return nil
+	case err = <-ended:
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/x6nux/asciinema/asciicast"
+)
+
+// 写入跟不上录制的输出时的处理策略
+const (
+	// BackpressureBlock 等待写入，被录制的程序也随之变慢，不丢失任何输出
+	BackpressureBlock = "block"
+	// BackpressureDropOldest 丢弃最早排队的帧，录制不受影响但录像会缺少部分输出
+	BackpressureDropOldest = "drop-oldest"
+	// BackpressureCoalesce 将新的输出合并到最后排队的帧中，不丢失输出但时间精度降低
+	BackpressureCoalesce = "coalesce"
+)
+
+// frameQueueSize 等待写入的帧数上限，超过时按照策略处理
+const frameQueueSize = 4096
+
+// checkBackpressure 检查策略名称，为空时使用block
+func checkBackpressure(policy string) (string, error) {
+	switch policy {
+	case "":
+		return BackpressureBlock, nil
+	case BackpressureBlock, BackpressureDropOldest, BackpressureCoalesce:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown backpressure policy %q, use %s, %s or %s", policy, BackpressureBlock, BackpressureDropOldest, BackpressureCoalesce)
+}
+
+// frameQueue 录制和写入之间的队列：录制的输出先进入队列，由单独的协程写入文件，
+// 写入跟不上时按照策略等待、丢弃或合并，并统计丢弃和合并的帧数
+type frameQueue struct {
+	policy string
+	max    int
+	write  func(asciicast.Frame) error
+
+	mu        sync.Mutex
+	notEmpty  *sync.Cond
+	notFull   *sync.Cond
+	frames    []asciicast.Frame
+	closed    bool
+	dropped   int
+	coalesced int
+	done      chan struct{}
+}
+
+func newFrameQueue(policy string, max int, write func(asciicast.Frame) error) *frameQueue {
+	q := &frameQueue{policy: policy, max: max, write: write, done: make(chan struct{})}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	go q.loop()
+	return q
+}
+
+func (q *frameQueue) loop() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for len(q.frames) == 0 && !q.closed {
+			q.notEmpty.Wait()
+		}
+		if len(q.frames) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		frame := q.frames[0]
+		q.frames = q.frames[1:]
+		q.notFull.Signal()
+		q.mu.Unlock()
+		q.write(frame)
+	}
+}
+
+// Push 将一帧放入队列，队列已满时按照策略处理；关闭后放入的帧被忽略
+func (q *frameQueue) Push(frame asciicast.Frame) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.frames) >= q.max && !q.closed {
+		switch q.policy {
+		case BackpressureDropOldest:
+			q.frames = q.frames[1:]
+			q.dropped++
+			continue
+		case BackpressureCoalesce:
+			// 只有输出可以合并，其他事件(标记、调整大小等)仍然等待
+			if last := &q.frames[len(q.frames)-1]; frame.EventType == asciicast.OutputEventType && last.EventType == asciicast.OutputEventType {
+				last.EventData = append(last.EventData, frame.EventData...)
+				q.coalesced++
+				return
+			}
+		}
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return
+	}
+	q.frames = append(q.frames, frame)
+	q.notEmpty.Signal()
+}
+
+// Close 写完队列中剩余的帧后返回，可重复调用
+func (q *frameQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+	<-q.done
+}
+
+// Report 返回丢弃和合并的帧数的说明，都为0时返回空字符串
+func (q *frameQueue) Report() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	switch {
+	case q.dropped > 0:
+		return fmt.Sprintf("The file could not keep up with the output, %d frames were dropped (--backpressure=%s).", q.dropped, q.policy)
+	case q.coalesced > 0:
+		return fmt.Sprintf("The file could not keep up with the output, %d frames were merged into earlier ones (--backpressure=%s).", q.coalesced, q.policy)
+	}
+	return ""
+}
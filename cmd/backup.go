@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/x6nux/asciinema/util"
+)
+
+// backupEnabled 覆盖文件前是否创建备份，可在配置文件的[edit]中关闭
+func backupEnabled() bool {
+	return cfg == nil || cfg.EditBackup()
+}
+
+func backupSuffix() string {
+	if cfg == nil {
+		return util.DefaultBackupSuffix
+	}
+	return cfg.EditBackupSuffix()
+}
+
+// backupFile 将文件复制为fPath加备份后缀，在覆盖文件前调用，返回备份文件路径
+func backupFile(fPath string) (string, error) {
+	src, err := os.Open(fPath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	bak := fPath + backupSuffix()
+	dst, err := os.Create(bak)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", err
+	}
+	return bak, dst.Close()
+}
+
+// sameFile 判断两个路径是否指向同一个已存在的文件
+func sameFile(a, b string) bool {
+	sa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	sb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(sa, sb)
+}
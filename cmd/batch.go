@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/x6nux/asciinema/util"
+)
+
+// BatchResult 批量编辑中单个文件的处理结果
+type BatchResult struct {
+	In       string
+	Out      string
+	Err      error
+	Duration time.Duration
+}
+
+// expandGlobs 展开输入的glob模式，去掉重复的文件，保持出现的顺序
+func expandGlobs(patterns []string) ([]string, error) {
+	files := []string{}
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern %s", pattern)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if info, err := os.Stat(m); err != nil || info.IsDir() || seen[m] {
+				continue
+			}
+			seen[m] = true
+			files = append(files, m)
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("no files match %v", patterns)
+	}
+	return files, nil
+}
+
+// Batch 对匹配patterns的所有文件并发执行同一个编辑操作，结果写入outDir下的同名文件；
+// jobs为并发数，小于1时使用CPU核数。返回的结果与输入文件的顺序一致
+func (r *Runner) Batch(patterns []string, outDir string, jobs int, edit func(in, out string) error) ([]BatchResult, error) {
+	files, err := expandGlobs(patterns)
+	if err != nil {
+		return nil, err
+	}
+	outputs := map[string]string{}
+	for _, f := range files {
+		base := filepath.Base(f)
+		if other, ok := outputs[base]; ok {
+			return nil, errors.Errorf("%s and %s would both be written to %s", other, f, filepath.Join(outDir, base))
+		}
+		outputs[base] = f
+	}
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+
+	results := make([]BatchResult, len(files))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(jobs, len(files)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				res := &results[i]
+				res.In = files[i]
+				res.Out = filepath.Join(outDir, filepath.Base(files[i]))
+				start := time.Now()
+				res.Err = edit(res.In, res.Out)
+				res.Duration = time.Since(start)
+				if res.Err != nil && !sameFile(res.In, res.Out) {
+					// 不留下不完整的输出
+					os.Remove(res.Out)
+				}
+			}
+		}()
+	}
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results, nil
+}
+
+// PrintBatchReport 打印批量编辑的汇总信息，返回失败的文件数
+func PrintBatchReport(results []BatchResult) (failed int) {
+	for _, res := range results {
+		if res.Err != nil {
+			failed++
+			util.PrintError("%s: %v", res.In, res.Err)
+			continue
+		}
+		util.PrintSuccess("%s -> %s (%v)", res.In, res.Out, res.Duration.Round(time.Millisecond))
+	}
+	util.PrintInfo(util.T("%d files processed: %d succeeded, %d failed"), len(results), len(results)-failed, failed)
+	return failed
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/vt"
+)
+
+const (
+	// calloutMaxLines 每条注释在GIF中最多占用的行数，超出的部分截断
+	calloutMaxLines = 3
+	// calloutStyle 标注的颜色：黄底黑字
+	calloutStyle = "\x1b[0;30;43m"
+)
+
+// regionReset 会重置滚动区域的序列：DECSTBM、RIS以及切换备用屏幕
+var regionReset = regexp.MustCompile(`\x1b\[[0-9;]*r|\x1bc|\x1b\[\?(?:1049|1047|47)[hl]`)
+
+// calloutToggle 标注出现(lines不为nil)或消失的时间
+type calloutToggle struct {
+	time  float64
+	lines []string
+}
+
+// addCallouts 在录像下方增加几行，在注释的时间段内以标注显示注释。frames为只含输出帧的录像，
+// 滚动区域被限制在录像原有的rows行内，录像内容不会滚入这几行；清屏等操作擦掉标注时在同一帧末尾重画。
+// 写入标注后按屏幕模型恢复光标位置和显示属性，不使用DECSC，以免覆盖录像自己保存的光标。
+// 返回新的帧和增加的行数，没有注释时原样返回
+func addCallouts(frames []asciicast.Frame, cols, rows int, notes []asciicast.Annotation) ([]asciicast.Frame, int) {
+	if len(frames) == 0 {
+		return frames, 0
+	}
+	last := frames[len(frames)-1].Time
+	var toggles []calloutToggle
+	band := 0
+	for i, n := range notes {
+		start := max(n.Time, 0)
+		if start > last || n.End <= 0 {
+			continue
+		}
+		lines := wrapCallout(n.Text, cols)
+		band = max(band, len(lines))
+		toggles = append(toggles, calloutToggle{time: start, lines: lines})
+		// 下一条注释紧接着出现时不需要先擦掉
+		if n.End < last && (i+1 == len(notes) || notes[i+1].Time > n.End) {
+			toggles = append(toggles, calloutToggle{time: n.End})
+		}
+	}
+	if len(toggles) == 0 {
+		return frames, 0
+	}
+	sort.SliceStable(toggles, func(i, j int) bool { return toggles[i].time < toggles[j].time })
+
+	screen := vt.New(cols, rows)
+	result := make([]asciicast.Frame, 0, len(frames)+len(toggles)+1)
+	result = append(result, asciicast.Frame{Time: 0, EventType: asciicast.OutputEventType, EventData: []byte(fmt.Sprintf("\x1b[1;%dr\x1b[H", rows))})
+	var active []string
+	k := 0
+	for _, f := range frames {
+		for ; k < len(toggles) && toggles[k].time < f.Time; k++ {
+			active = toggles[k].lines
+			result = append(result, calloutFrame(toggles[k].time, drawCallout(screen, band, active)))
+		}
+		screen.Write(f.EventData)
+		var fix strings.Builder
+		if regionReset.Match(f.EventData) {
+			top, bottom := screen.ScrollRegion()
+			fmt.Fprintf(&fix, "\x1b[%d;%dr", top+1, bottom+1)
+		}
+		if active != nil {
+			fix.WriteString(drawCallout(screen, band, active))
+		} else if fix.Len() > 0 {
+			fix.WriteString(restoreCursor(screen))
+		}
+		if fix.Len() > 0 {
+			f.EventData = append(append([]byte{}, f.EventData...), fix.String()...)
+		}
+		result = append(result, f)
+	}
+	for ; k < len(toggles); k++ {
+		active = toggles[k].lines
+		result = append(result, calloutFrame(toggles[k].time, drawCallout(screen, band, active)))
+	}
+	return result, band
+}
+
+func calloutFrame(t float64, data string) asciicast.Frame {
+	return asciicast.Frame{Time: t, EventType: asciicast.OutputEventType, EventData: []byte(data)}
+}
+
+// drawCallout 在录像下方的band行中写入标注，lines为nil时清空这几行，然后恢复光标
+func drawCallout(screen *vt.Screen, band int, lines []string) string {
+	cols, rows := screen.Size()
+	var b strings.Builder
+	for i := 0; i < band; i++ {
+		fmt.Fprintf(&b, "\x1b[%d;1H\x1b[0m\x1b[2K", rows+i+1)
+		if i < len(lines) {
+			b.WriteString(calloutStyle + lines[i] + strings.Repeat(" ", max(0, cols-vt.StringWidth(lines[i]))) + "\x1b[0m")
+		}
+	}
+	b.WriteString(restoreCursor(screen))
+	return b.String()
+}
+
+// restoreCursor 按屏幕模型恢复光标位置和显示属性。光标停在行尾等待换行时，
+// 重写行尾的字符以恢复这一状态，否则下一个字符会覆盖行尾而不是换行
+func restoreCursor(screen *vt.Screen) string {
+	x, y, _ := screen.Cursor()
+	if screen.WrapPending() {
+		line := screen.Line(y)
+		if x > 0 && line[x].Char == 0 {
+			x-- // 双宽字符的后半
+		}
+		if c := line[x]; c.Char != 0 {
+			return fmt.Sprintf("\x1b[%d;%dH%s%c%s", y+1, x+1, c.Attr.SGR(), c.Char, screen.Pen().SGR())
+		}
+	}
+	return fmt.Sprintf("\x1b[%d;%dH%s", y+1, x+1, screen.Pen().SGR())
+}
+
+// wrapCallout 将注释按终端宽度折行，每行以"» "或两个空格开头，最多calloutMaxLines行
+func wrapCallout(text string, cols int) []string {
+	var lines []string
+	line, width := "", 0
+	for i, word := range strings.Fields(text) {
+		w := vt.StringWidth(word)
+		if i > 0 && width+1+w > cols-2 {
+			lines = append(lines, line)
+			line, width = "", 0
+		}
+		if width > 0 {
+			line, width = line+" ", width+1
+		}
+		line, width = line+word, width+w
+	}
+	lines = append(lines, line)
+	for i := range lines {
+		prefix := "  "
+		if i == 0 {
+			prefix = "» "
+		}
+		lines[i] = truncateWidth(prefix+lines[i], cols)
+	}
+	if len(lines) > calloutMaxLines {
+		lines = lines[:calloutMaxLines]
+		lines[calloutMaxLines-1] = truncateWidth(lines[calloutMaxLines-1], cols-1) + "…"
+	}
+	return lines
+}
+
+// truncateWidth 将文字截断到终端中的cols列以内
+func truncateWidth(s string, cols int) string {
+	width := 0
+	for i, r := range s {
+		if width += vt.StringWidth(string(r)); width > cols {
+			return s[:i]
+		}
+	}
+	return s
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/util"
+)
+
+// readCast 读取cast文件，第一行为头部，之后每行为一帧。
+// fPath也可以是HTTP、s3://、ipfs://、ipns://地址或"归档::路径"形式的归档中的录像。文件开头的BOM和\r\n换行(Windows编辑器保存的录像)不影响读取；
+// 无法解析的行(如程序崩溃时写了一半的最后一行)会被跳过，并给出行号的警告
+func readCast(fPath string) (*asciicast.Asciicast, error) {
+	return readCastTimed(fPath, nil)
+}
+
+// readCastTimed 与readCast相同，decoded不为nil时传入每帧的解码耗时(包括读取文件)
+func readCastTimed(fPath string, decoded func(time.Duration)) (*asciicast.Asciicast, error) {
+	f, err := asciicast.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := asciicast.NewDecoder(f)
+	dec.OnInvalid = func(n int, line []byte, err error) {
+		util.Warningf("%s: line %d is not a valid event, skipped: %v", fPath, n, err)
+	}
+	header, err := dec.Header()
+	if err != nil {
+		return nil, err
+	}
+	frameList := make([]asciicast.Frame, 0)
+	start := time.Now()
+	for _, frame := range dec.All() {
+		if decoded != nil {
+			decoded(time.Since(start))
+		}
+		frameList = append(frameList, frame)
+		start = time.Now()
+	}
+	if err := dec.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fPath, err)
+	}
+
+	return &asciicast.Asciicast{
+		Version:   header.Version,
+		Width:     header.Width,
+		Height:    header.Height,
+		Duration:  header.Duration,
+		Timestamp: header.Timestamp,
+		Command:   header.Command,
+		Title:     header.Title,
+		Env:       header.Env,
+		Theme:     header.Theme,
+		Machine:   header.Machine,
+		Audio:     header.Audio,
+		Stdout:    frameList,
+	}, nil
+}
+
+// writeCast 将录像写入cast文件
+func writeCast(fPath string, cast *asciicast.Asciicast) error {
+	data, err := encodeCast(cast)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fPath, data, os.ModePerm)
+}
+
+// encodeCast 将录像编码为asciicast v2格式
+func encodeCast(cast *asciicast.Asciicast) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	header := &asciicast.Header{
+		Version:   cast.Version,
+		Width:     cast.Width,
+		Height:    cast.Height,
+		Timestamp: cast.Timestamp,
+		Duration:  cast.Duration,
+		Command:   cast.Command,
+		Title:     cast.Title,
+		Env:       cast.Env,
+		Theme:     cast.Theme,
+		Machine:   cast.Machine,
+		Audio:     cast.Audio,
+	}
+	if err := enc.Encode(header); err != nil {
+		return nil, err
+	}
+	for _, f := range cast.Stdout {
+		if err := enc.Encode(f); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// standardFrames 将录像的帧转换为其他播放器和服务端都能理解的标准事件：
+// 压缩帧解压为输出帧，响铃、shell集成和不认识的事件被去掉
+func standardFrames(frames []asciicast.Frame) ([]asciicast.Frame, error) {
+	result := make([]asciicast.Frame, 0, len(frames))
+	for _, f := range frames {
+		switch {
+		case f.IsCompressed():
+			data, err := f.OutputData()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, asciicast.Frame{Time: f.Time, EventType: asciicast.OutputEventType, EventData: data})
+		case asciicast.IsStandardEventType(f.EventType):
+			result = append(result, f)
+		}
+	}
+	return result, nil
+}
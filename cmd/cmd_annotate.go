@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/x6nux/asciinema/asciicast"
+)
+
+// Annotate 在录像的at秒处添加注释，保存为a事件。播放时显示在状态栏中，导出HTML和GIF时显示为标注
+func (r *Runner) Annotate(castPath string, at float64, text string) error {
+	text = strings.TrimSpace(text)
+	return r.editAnnotations(castPath, func(c *asciicast.Asciicast) error {
+		if d := framesDuration(c.Stdout); at > d {
+			return fmt.Errorf("%.3fs is past the end of the recording (%.3fs)", at, d)
+		}
+		frames, err := asciicast.AddAnnotation(c.Stdout, at, text)
+		if err != nil {
+			return err
+		}
+		c.Stdout = frames
+		return nil
+	})
+}
+
+// RemoveAnnotation 删除录像中的第n条注释，序号与AnnotationList列出的相同
+func (r *Runner) RemoveAnnotation(castPath string, n int) error {
+	return r.editAnnotations(castPath, func(c *asciicast.Asciicast) error {
+		frames, ok := asciicast.RemoveAnnotation(c.Stdout, n)
+		if !ok {
+			return fmt.Errorf("no annotation #%d, the recording has %d", n, len(asciicast.Annotations(c.Stdout)))
+		}
+		c.Stdout = frames
+		return nil
+	})
+}
+
+// editAnnotations 读取录像，修改后写回原文件，写入前按配置备份
+func (r *Runner) editAnnotations(castPath string, edit func(c *asciicast.Asciicast) error) error {
+	c, err := readCast(castPath)
+	if err != nil {
+		return err
+	}
+	if err := edit(c); err != nil {
+		return err
+	}
+	if !r.NoBackup && backupEnabled() {
+		if _, err := backupFile(castPath); err != nil {
+			return err
+		}
+	}
+	return writeCast(castPath, c)
+}
+
+// AnnotationList 返回录像中的注释，按时间排列
+func (r *Runner) AnnotationList(castPath string) ([]asciicast.Annotation, error) {
+	c, err := readCast(castPath)
+	if err != nil {
+		return nil, err
+	}
+	return asciicast.Annotations(c.Stdout), nil
+}
+
+// PrintAnnotations 打印acast annotate --list的结果，序号用于--remove
+func PrintAnnotations(list []asciicast.Annotation, asJSON bool) error {
+	if asJSON {
+		if list == nil {
+			list = []asciicast.Annotation{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(list)
+	}
+	for i, a := range list {
+		fmt.Printf("%3d  %10.3fs  %s\n", i+1, a.Time, a.Text)
+	}
+	return nil
+}
+
+// framesDuration 返回最后一帧(压缩帧为其结束时间)的时间
+func framesDuration(frames []asciicast.Frame) float64 {
+	d := 0.0
+	for _, f := range frames {
+		d = math.Max(d, math.Max(f.Time, f.EndTime))
+	}
+	return d
+}
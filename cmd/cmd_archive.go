@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/x6nux/asciinema/asciicast"
+)
+
+const (
+	// ArchiveExt 录像归档的扩展名
+	ArchiveExt = ".acar"
+	// archiveVersion 归档格式的版本
+	archiveVersion = 1
+	// archiveIndexName 归档中索引的文件名，写在所有录像之前
+	archiveIndexName = "index.json"
+	// archiveComment 写在zip注释中，用于识别录像归档
+	archiveComment = "acast archive"
+)
+
+// ArchiveIndex .acar归档的索引。归档是一个zip文件，第一个文件为索引，之后是各个录像，
+// 列出和搜索时只需读取索引，播放时按"归档::路径"直接读取其中的录像
+type ArchiveIndex struct {
+	Version int         `json:"version"`
+	Created time.Time   `json:"created"`
+	Casts   []CastEntry `json:"casts"` // Path为录像在归档中的路径
+}
+
+// archiveFile 打包的一个录像：磁盘上的路径和归档中的路径
+type archiveFile struct {
+	path, name string
+}
+
+// ArchivePack 将dirs目录下(递归)的所有cast打包为out归档，标签和备注写入索引。
+// 只有一个目录时路径相对于该目录，多个目录时以目录名开头
+func (r *Runner) ArchivePack(dirs []string, out string) (*ArchiveIndex, error) {
+	var files []archiveFile
+	seen := map[string]string{}
+	for _, dir := range dirs {
+		base := dir
+		if len(dirs) > 1 {
+			base = filepath.Dir(filepath.Clean(dir))
+		}
+		casts, err := findCasts(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range casts {
+			rel, err := filepath.Rel(base, f)
+			if err != nil {
+				return nil, err
+			}
+			name := filepath.ToSlash(rel)
+			if other, ok := seen[name]; ok {
+				return nil, fmt.Errorf("%s and %s would both be stored as %s", other, f, name)
+			}
+			seen[name] = f
+			files = append(files, archiveFile{f, name})
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no casts found in %s", strings.Join(dirs, ", "))
+	}
+
+	index := &ArchiveIndex{Version: archiveVersion, Created: time.Now().UTC(), Casts: []CastEntry{}}
+	for _, f := range files {
+		meta, err := readCastMeta(f.path)
+		if err != nil {
+			return nil, err
+		}
+		entry := CastEntry{Path: f.name, Tags: meta.Tags, Note: meta.Note}
+		info, err := ReadCastInfo(f.path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", f.path)
+		}
+		entry.Title, _ = info.Header["title"].(string)
+		entry.Duration = info.Duration
+		index.Casts = append(index.Casts, entry)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(out), ".acast-*"+ArchiveExt)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := writeArchive(tmp, index, files); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	return index, os.Rename(tmp.Name(), out)
+}
+
+// writeArchive 写入索引和录像
+func writeArchive(w io.Writer, index *ArchiveIndex, files []archiveFile) error {
+	zw := zip.NewWriter(w)
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	iw, err := zw.CreateHeader(&zip.FileHeader{Name: archiveIndexName, Method: zip.Deflate, Modified: index.Created})
+	if err != nil {
+		return err
+	}
+	if _, err := iw.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := addArchiveFile(zw, f.path, f.name); err != nil {
+			return err
+		}
+	}
+	if err := zw.SetComment(fmt.Sprintf("%s v%d", archiveComment, archiveVersion)); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// addArchiveFile 将文件fPath以name为名写入归档，保留修改时间
+func addArchiveFile(zw *zip.Writer, fPath, name string) error {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	hdr.Name, hdr.Method = name, zip.Deflate
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// ReadArchiveIndex 读取归档的索引，归档可以是本地文件或能打开的地址
+func ReadArchiveIndex(archive string) (*ArchiveIndex, error) {
+	f, err := asciicast.Open(archive + asciicast.ArchiveSeparator + archiveIndexName)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an acast archive: %v", archive, err)
+	}
+	defer f.Close()
+	index := &ArchiveIndex{}
+	if err := json.NewDecoder(f).Decode(index); err != nil {
+		return nil, errors.Wrapf(err, "invalid index in %s", archive)
+	}
+	if index.Version > archiveVersion {
+		return nil, fmt.Errorf("%s has archive version %d, this acast reads up to %d", archive, index.Version, archiveVersion)
+	}
+	return index, nil
+}
+
+// ArchiveList 列出归档中带有tags中所有标签、且路径、标题或备注包含query(不区分大小写)的录像
+func (r *Runner) ArchiveList(archive string, tags []string, query string) ([]CastEntry, error) {
+	index, err := ReadArchiveIndex(archive)
+	if err != nil {
+		return nil, err
+	}
+	query = strings.ToLower(query)
+	entries := []CastEntry{}
+	for _, e := range index.Casts {
+		matched := true
+		for _, tag := range tags {
+			matched = matched && hasTag(e.Tags, tag)
+		}
+		text := strings.ToLower(e.Path + "\n" + e.Title + "\n" + e.Note)
+		if matched && strings.Contains(text, query) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// ArchiveExtract 将归档中的录像解压到outDir，names为空时解压全部。
+// 索引中的标签和备注写回旁路元数据文件
+func (r *Runner) ArchiveExtract(archive, outDir string, names []string) ([]string, error) {
+	index, err := ReadArchiveIndex(archive)
+	if err != nil {
+		return nil, err
+	}
+	entries := index.Casts
+	if len(names) > 0 {
+		entries = nil
+		for _, name := range names {
+			entry, ok := findArchiveEntry(index, name)
+			if !ok {
+				return nil, fmt.Errorf("%s not found in %s", name, archive)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	var written []string
+	for _, e := range entries {
+		clean := path.Clean("/" + e.Path)[1:]
+		if clean == "" || clean != e.Path {
+			return written, fmt.Errorf("refusing to extract unsafe path %q", e.Path)
+		}
+		dst := filepath.Join(outDir, filepath.FromSlash(clean))
+		if err := extractArchiveFile(archive, e.Path, dst); err != nil {
+			return written, err
+		}
+		if err := writeCastMeta(dst, &CastMeta{Tags: e.Tags, Note: e.Note}); err != nil {
+			return written, err
+		}
+		written = append(written, dst)
+	}
+	return written, nil
+}
+
+// extractArchiveFile 将归档中的name写入dst
+func extractArchiveFile(archive, name, dst string) error {
+	src, err := asciicast.Open(archive + asciicast.ArchiveSeparator + name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// findArchiveEntry 按路径查找索引中的录像，也可以只写文件名(不能有重名)
+func findArchiveEntry(index *ArchiveIndex, name string) (CastEntry, bool) {
+	name = strings.TrimPrefix(filepath.ToSlash(name), "./")
+	var found []CastEntry
+	for _, e := range index.Casts {
+		if e.Path == name {
+			return e, true
+		}
+		if path.Base(e.Path) == name {
+			found = append(found, e)
+		}
+	}
+	if len(found) == 1 {
+		return found[0], true
+	}
+	return CastEntry{}, false
+}
+
+// ArchivePlay 播放归档中的录像，names为空时按索引的顺序播放全部
+func (r *Runner) ArchivePlay(archive string, names []string, loop, shuffle bool) error {
+	index, err := ReadArchiveIndex(archive)
+	if err != nil {
+		return err
+	}
+	var items []string
+	if len(names) == 0 {
+		for _, e := range index.Casts {
+			items = append(items, archive+asciicast.ArchiveSeparator+e.Path)
+		}
+	}
+	for _, name := range names {
+		entry, ok := findArchiveEntry(index, name)
+		if !ok {
+			return fmt.Errorf("%s not found in %s", name, archive)
+		}
+		items = append(items, archive+asciicast.ArchiveSeparator+entry.Path)
+	}
+	return r.PlayList(items, loop, shuffle)
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+
+	"github.com/x6nux/asciinema/terminal"
+	"github.com/x6nux/asciinema/util"
+	"golang.org/x/term"
+)
+
+// Sessions 返回本机正在录制、可以attach的会话
+func (r *Runner) Sessions() []string {
+	return listSessions()
+}
+
+// Attach 实时观看本机正在录制的会话，name可以是会话名称的前缀，只有一个会话时可以为空。
+// 默认只读，按q或Ctrl-C退出；input为true时凭token将按键发送给被录制的程序，按Ctrl-]退出。
+// 除非设置了Unsafe，输出中危险的转义序列会被去掉
+func (r *Runner) Attach(name string, input bool, token string) error {
+	name, err := findSession(name)
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("unix", sessionPath(name))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	header, err := readSessionHeader(reader)
+	if err != nil {
+		return err
+	}
+	if cols, rows, err := term.GetSize(int(os.Stdout.Fd())); err == nil && (cols < header.Width || rows < header.Height) {
+		util.Warningf("Terminal size %dx%d is smaller than the session size %dx%d, the output may be garbled.", cols, rows, header.Width, header.Height)
+	}
+
+	if input {
+		if err := sendViewerMessage(conn, viewerMessage{Token: token, Viewer: viewerName()}); err != nil {
+			return err
+		}
+	}
+
+	quit, restore, err := startAttachInput(input, func(data string) error {
+		return sendViewerMessage(conn, viewerMessage{Input: data})
+	})
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	ended := make(chan error, 1)
+	go func() {
+		ended <- copySession(r.attachOutput(), reader)
+	}()
+	select {
+	case <-quit:
+		return nil
+	case err = <-ended:
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// attachOutput 返回写入会话输出的目标：默认去掉危险的转义序列后写入标准输出，设置了Unsafe时原样写入
+func (r *Runner) attachOutput() io.Writer {
+	if r.Unsafe {
+		return os.Stdout
+	}
+	return &sanitizedWriter{w: os.Stdout, s: terminal.NewSanitizer()}
+}
+
+// sanitizedWriter 将数据去掉危险的转义序列后写入w
+type sanitizedWriter struct {
+	w io.Writer
+	s *terminal.Sanitizer
+}
+
+func (sw *sanitizedWriter) Write(p []byte) (int, error) {
+	if _, err := sw.w.Write(sw.s.Sanitize(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// startAttachInput 在终端中切换到原始模式和备用屏幕，并在后台读取按键：input为true时用send发送按键，
+// 按下退出键时关闭返回的通道。标准输入输出不是终端时不读取按键。返回的函数恢复终端
+func startAttachInput(input bool, send func(data string) error) (<-chan struct{}, func(), error) {
+	quit := make(chan struct{})
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return quit, func() {}, nil
+	}
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, nil, err
+	}
+	restore := func() {
+		term.Restore(int(os.Stdin.Fd()), state)
+		fmt.Fprint(os.Stdout, "\x1b[0m\x1b[?25h\x1b[?1049l")
+	}
+	remove := util.AddCleanup(restore)
+	fmt.Fprint(os.Stdout, "\x1b[?1049h")
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			data := buf[:n]
+			for i, b := range data {
+				if isDetachKey(b, input) {
+					if input && i > 0 {
+						send(string(data[:i]))
+					}
+					close(quit)
+					return
+				}
+			}
+			if input && n > 0 {
+				if send(string(data)) != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return quit, func() {
+		remove()
+		restore()
+	}, nil
+}
+
+// isDetachKey 判断是否为退出attach的按键，可以输入时q和Ctrl-C会发送给被录制的程序
+func isDetachKey(b byte, input bool) bool {
+	if input {
+		return b == 0x1d // Ctrl-]
+	}
+	return b == 'q' || b == 0x03
+}
+
+// viewerName 返回发送给会话的观看者名称，记录在审计日志中
+func viewerName() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
+
+func sendViewerMessage(w io.Writer, msg viewerMessage) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// copySession 将会话事件流中的输出写入w，直到会话结束或拒绝了观看者
+func copySession(w io.Writer, r *bufio.Reader) error {
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(line, []byte("{")) {
+			var e sessionError
+			if json.Unmarshal(line, &e) == nil && e.Error != "" {
+				return errors.New(e.Error)
+			}
+			continue
+		}
+		var event []interface{}
+		if err := json.Unmarshal(line, &event); err != nil || len(event) < 3 {
+			continue
+		}
+		if typ, _ := event[1].(string); typ != "o" {
+			continue
+		}
+		data, _ := event[2].(string)
+		if _, err := io.WriteString(w, data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/x6nux/asciinema/terminal"
+)
+
+// attach时会话输出中危险的转义序列被去掉，跨越多个事件的序列也是如此
+func TestCopySessionSanitizes(t *testing.T) {
+	events := strings.Join([]string{
+		`[0.1, "o", "hello \u001b]0;pwned\u0007"]`,
+		`[0.2, "o", "\u001b]52;c;ZWNobyBoaQ=="]`,
+		`[0.3, "o", "\u0007\u001b[6n\u001b[31mred\u001b[0m \u001b]8;;http://x\u0007link\u001b]8;;\u0007"]`,
+	}, "\n") + "\n"
+	tests := []struct {
+		name   string
+		unsafe bool
+		want   string
+	}{
+		{"sanitized", false, "hello \x1b[31mred\x1b[0m \x1b]8;;http://x\x07link\x1b]8;;\x07"},
+		{"unsafe", true, "hello \x1b]0;pwned\x07\x1b]52;c;ZWNobyBoaQ==\x07\x1b[6n\x1b[31mred\x1b[0m \x1b]8;;http://x\x07link\x1b]8;;\x07"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			var w io.Writer = &out
+			if !tt.unsafe {
+				w = &sanitizedWriter{w: &out, s: terminal.NewSanitizer()}
+			}
+			if err := copySession(w, bufio.NewReader(strings.NewReader(events))); err != io.EOF {
+				t.Fatalf("copySession() = %v, want EOF", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
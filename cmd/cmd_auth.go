@@ -2,10 +2,14 @@ package cmd
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/x6nux/asciinema/util"
 )
 
 const (
-	Auth_API = "https://asciinema.org/connect/%s"
+	Auth_API = "%s/connect/%s"
 )
 
 var info string = `Open the following URL in a web browser to link your install ID with your https://asciinema.org user account:
@@ -14,7 +18,43 @@ This will associate all recordings uploaded from this machine (past and future o
 and allow you to manage them (change title/theme, delete) at https://asciinema.org.`
 
 func (r *Runner) Auth() (authUrl, result string) {
-	authUrl = fmt.Sprintf(Auth_API, cfg.ApiToken())
+	authUrl = fmt.Sprintf(Auth_API, strings.TrimRight(cfg.ApiUrl(), "/"), cfg.ApiToken())
 	result = fmt.Sprintf(info, authUrl)
 	return
 }
+
+// AuthStatus 返回当前的install ID、关联的服务器和配置文件的位置
+func (r *Runner) AuthStatus() string {
+	token := util.FirstNonBlank(cfg.ApiToken(), "(not set)")
+	authUrl, _ := r.Auth()
+	return fmt.Sprintf("install ID: %s\nserver:     %s\nconnect:    %s\nconfig:     %s", token, cfg.ApiUrl(), authUrl, cfg.Path)
+}
+
+// AuthRotate 生成新的install ID并写入配置文件，之后上传的录像需要重新关联账号
+func (r *Runner) AuthRotate() (string, error) {
+	token := util.NewUUID().String()
+	if err := cfg.SetApiToken(token); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+var installIDRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{7,127}$`)
+
+// AuthExport 返回当前的install ID，用于在其他机器或CI中导入
+func (r *Runner) AuthExport() (string, error) {
+	token := cfg.ApiToken()
+	if token == "" {
+		return "", fmt.Errorf("no install ID in %s", cfg.Path)
+	}
+	return token, nil
+}
+
+// AuthImport 将导出的install ID写入配置文件，之后的上传都归属于该ID关联的账号
+func (r *Runner) AuthImport(token string) error {
+	token = strings.TrimSpace(token)
+	if !installIDRe.MatchString(token) {
+		return fmt.Errorf("invalid install ID %q", token)
+	}
+	return cfg.SetApiToken(token)
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/x6nux/asciinema/asciicast"
+)
+
+// Chunk 将超过maxBytes字节的输出帧拆成多个较小的帧，时间在相邻帧之间插值，播放时更平滑
+func (r *Runner) Chunk(inFilePath, outFilePath string, maxBytes int) error {
+	if maxBytes <= 0 {
+		return fmt.Errorf("invalid chunk size %d", maxBytes)
+	}
+	return r.withStdio(inFilePath, outFilePath, func(in, out string) error {
+		cast, err := readCast(in)
+		if err != nil {
+			return err
+		}
+		cast.Stdout, err = asciicast.SplitFrames(cast.Stdout, maxBytes)
+		if err != nil {
+			return err
+		}
+		return writeCast(out, cast)
+	})
+}
@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 颜色模式
+const (
+	Color16        = "16"
+	Color256       = "256"
+	ColorTruecolor = "truecolor"
+)
+
+// 颜色报告的导出目标
+const (
+	ColorTargetGIF  = "gif"
+	ColorTargetHTML = "html"
+)
+
+// gifPaletteSize GIF每帧调色板的颜色数
+const gifPaletteSize = 256
+
+var sgrPattern = regexp.MustCompile(`\x1b\[([0-9;:]*)m`)
+
+// ColorMode 一种颜色模式的使用情况
+type ColorMode struct {
+	Sequences int     `json:"sequences"`         // 使用该模式的SGR序列数
+	Colors    int     `json:"colors"`            // 不同颜色的个数
+	First     float64 `json:"first,omitempty"`   // 第一次出现的时间
+	Example   string  `json:"example,omitempty"` // 第一次出现的序列
+	seen      map[string]bool
+}
+
+// ColorWarning 导出到某个目标时会失真的颜色
+type ColorWarning struct {
+	Target  string  `json:"target"`
+	Mode    string  `json:"mode"`
+	Count   int     `json:"count"` // 受影响的序列数
+	First   float64 `json:"first"`
+	Example string  `json:"example"`
+	Message string  `json:"message"`
+}
+
+// ColorReport cast文件中SGR序列使用的颜色模式，以及导出时的失真
+type ColorReport struct {
+	Path     string                `json:"path"`
+	Modes    map[string]*ColorMode `json:"modes"`
+	Bright   int                   `json:"bright"` // 使用亮色(调色板8-15)的序列数
+	Theme    string                `json:"theme"`  // 录制时记录的配色：none、8 colors、16 colors或fg/bg only
+	Warnings []ColorWarning        `json:"warnings,omitempty"`
+
+	palette   int // 录制时记录的调色板颜色数
+	brightAt  float64
+	brightSeq string
+}
+
+// ReadColorReport 统计录像输出中各颜色模式的使用情况，并检查导出到targets时会失真的序列
+func ReadColorReport(fPath string, targets []string) (*ColorReport, error) {
+	for _, t := range targets {
+		if t != ColorTargetGIF && t != ColorTargetHTML {
+			return nil, fmt.Errorf("unknown target %q, use %s or %s", t, ColorTargetGIF, ColorTargetHTML)
+		}
+	}
+	c, err := readCast(fPath)
+	if err != nil {
+		return nil, err
+	}
+	report := &ColorReport{Path: fPath, Modes: map[string]*ColorMode{}, Theme: "none"}
+	for _, mode := range []string{Color16, Color256, ColorTruecolor} {
+		report.Modes[mode] = &ColorMode{seen: map[string]bool{}}
+	}
+	if c.Theme != nil {
+		report.palette = len(strings.Split(c.Theme.Palette, ":"))
+		report.Theme = fmt.Sprintf("%d colors", report.palette)
+		if c.Theme.Palette == "" {
+			report.palette = 0
+			report.Theme = "fg/bg only"
+		}
+	}
+
+	var pending []byte
+	for _, f := range c.Stdout {
+		data, err := f.OutputData()
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			continue
+		}
+		data = append(pending, data...)
+		// 末尾未结束的序列留到下一帧
+		pending = nil
+		if i := bytes.LastIndexByte(data, 0x1b); i >= 0 && !sgrTerminated(data[i:]) {
+			pending = append([]byte{}, data[i:]...)
+			data = data[:i]
+		}
+		for _, m := range sgrPattern.FindAllSubmatch(data, -1) {
+			report.addSGR(f.Time, string(m[0]), string(m[1]))
+		}
+	}
+	for _, m := range report.Modes {
+		m.Colors = len(m.seen)
+	}
+	for _, t := range targets {
+		report.check(t)
+	}
+	return report, nil
+}
+
+// sgrTerminated 判断以ESC开头的seq是否已经是完整的序列(或者不是CSI序列)
+func sgrTerminated(seq []byte) bool {
+	if len(seq) < 2 {
+		return false
+	}
+	if seq[1] != '[' {
+		return true
+	}
+	for _, b := range seq[2:] {
+		if b >= 0x40 && b <= 0x7e {
+			return true
+		}
+	}
+	return false
+}
+
+// addSGR 记录一个SGR序列中的颜色
+func (r *ColorReport) addSGR(t float64, seq, params string) {
+	modes := map[string]bool{}
+	bright := false
+	add := func(mode, color string) {
+		modes[mode] = true
+		r.Modes[mode].seen[color] = true
+	}
+	indexed := func(n int) {
+		switch {
+		case n < 8:
+			add(Color16, strconv.Itoa(n))
+		case n < 16:
+			add(Color16, strconv.Itoa(n))
+			bright = true
+		case n < 256:
+			add(Color256, strconv.Itoa(n))
+		}
+	}
+	rgb := func(v []string) {
+		if len(v) == 3 {
+			red, _ := strconv.Atoi(v[0])
+			green, _ := strconv.Atoi(v[1])
+			blue, _ := strconv.Atoi(v[2])
+			add(ColorTruecolor, fmt.Sprintf("#%02x%02x%02x", red&0xff, green&0xff, blue&0xff))
+		}
+	}
+
+	fields := strings.Split(params, ";")
+	for i := 0; i < len(fields); i++ {
+		if sub := strings.Split(fields[i], ":"); len(sub) > 1 {
+			// ITU T.416格式：38:5:n、38:2:r:g:b或38:2:色彩空间:r:g:b
+			if code := sub[0]; code == "38" || code == "48" || code == "58" {
+				switch {
+				case sub[1] == "5" && len(sub) >= 3:
+					n, _ := strconv.Atoi(sub[2])
+					indexed(n)
+				case sub[1] == "2" && len(sub) >= 5:
+					rgb(sub[len(sub)-3:])
+				}
+			}
+			continue
+		}
+		n, err := strconv.Atoi(fields[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case n >= 30 && n <= 37, n >= 40 && n <= 47:
+			indexed(n % 10)
+		case n >= 90 && n <= 97, n >= 100 && n <= 107:
+			indexed(n%10 + 8)
+		case n == 38 || n == 48 || n == 58:
+			if i+2 < len(fields) && fields[i+1] == "5" {
+				m, _ := strconv.Atoi(fields[i+2])
+				indexed(m)
+				i += 2
+			} else if i+4 < len(fields) && fields[i+1] == "2" {
+				rgb(fields[i+2 : i+5])
+				i += 4
+			}
+		}
+	}
+
+	for mode := range modes {
+		m := r.Modes[mode]
+		if m.Sequences == 0 {
+			m.First, m.Example = t, seq
+		}
+		m.Sequences++
+	}
+	if bright {
+		if r.Bright == 0 {
+			r.brightAt, r.brightSeq = t, seq
+		}
+		r.Bright++
+	}
+}
+
+// check 检查导出到target时会失真的颜色
+func (r *ColorReport) check(target string) {
+	basic := r.Modes[Color16]
+	warn := func(mode string, count int, first float64, example, message string) {
+		r.Warnings = append(r.Warnings, ColorWarning{Target: target, Mode: mode, Count: count, First: first, Example: example, Message: message})
+	}
+	switch {
+	case basic.Sequences > 0 && r.palette == 0:
+		message := "no palette was recorded, so the 16 basic colors are drawn with the player's default theme instead of the recording terminal's colors"
+		if target == ColorTargetGIF {
+			message = "no palette was recorded, so the 16 basic colors are drawn with agg's default theme instead of the recording terminal's colors; pick one with --theme"
+		}
+		warn(Color16, basic.Sequences, basic.First, basic.Example, message)
+	case r.Bright > 0 && r.palette == 8:
+		warn(Color16, r.Bright, r.brightAt, r.brightSeq,
+			"the recorded theme has only 8 colors, so bright colors are drawn as their normal counterparts")
+	}
+	if target != ColorTargetGIF {
+		// 网页播放器可以准确显示256色和真彩色
+		return
+	}
+	true24 := r.Modes[ColorTruecolor]
+	if true24.Sequences == 0 {
+		return
+	}
+	total := 2 + max(r.palette, 16) + r.Modes[Color256].Colors + true24.Colors
+	message := fmt.Sprintf("GIF frames have a %d-color palette, truecolor is approximated (also in APNG, WebP and MP4 made from the GIF)", gifPaletteSize)
+	if total > gifPaletteSize {
+		message = fmt.Sprintf("about %d distinct colors do not fit the %d-color GIF palette, truecolor gradients will be quantized and dithered (also in APNG, WebP and MP4 made from the GIF)", total, gifPaletteSize)
+	}
+	warn(ColorTruecolor, true24.Sequences, true24.First, true24.Example, message)
+}
+
+// Colors 打印录像使用的颜色模式，以及导出到targets时会失真的序列
+func (r *Runner) Colors(fPath string, targets []string, asJSON bool) error {
+	report, err := ReadColorReport(fPath, targets)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	row := func(key string, value interface{}) {
+		fmt.Printf("%-16s %v\n", key+":", value)
+	}
+	names := map[string]string{Color16: "16 colors", Color256: "256 colors", ColorTruecolor: "Truecolor"}
+	row("File", report.Path)
+	for _, mode := range []string{Color16, Color256, ColorTruecolor} {
+		m := report.Modes[mode]
+		value := fmt.Sprintf("%d sequences, %d colors", m.Sequences, m.Colors)
+		if m.Sequences > 0 {
+			value += fmt.Sprintf(", first at %.3fs %q", m.First, m.Example)
+		}
+		row(names[mode], value)
+	}
+	row("Recorded theme", report.Theme)
+	if len(report.Warnings) == 0 {
+		row("Warnings", "none")
+		return nil
+	}
+	row("Warnings", len(report.Warnings))
+	for _, w := range report.Warnings {
+		fmt.Printf("  [%s] %s: %d sequences, first at %.3fs %q\n    %s\n", w.Target, names[w.Mode], w.Count, w.First, w.Example, w.Message)
+	}
+	return nil
+}
@@ -1,30 +1,255 @@
 package cmd
 
 import (
+	"fmt"
+	"math"
 	"os"
+	"strconv"
 	"strings"
 
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/goutils/pkgs/gutils"
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/render"
+	"github.com/x6nux/asciinema/util"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// animationExts 支持的动画格式及其文件扩展名
+var animationExts = map[string]string{
+	"gif":  ".gif",
+	"apng": ".png",
+	"webp": ".webp",
+	"mp4":  ".mp4",
+}
+
 func isAggInstalled() bool {
 	_, err := gutils.ExecuteSysCommand(true, "", "agg", "--help")
 	return err == nil
 }
 
+func isGif2WebpInstalled() bool {
+	_, err := gutils.ExecuteSysCommand(true, "", "gif2webp", "-version")
+	return err == nil
+}
+
+func isFFmpegInstalled() bool {
+	_, err := gutils.ExecuteSysCommand(true, "", "ffmpeg", "-version")
+	return err == nil
+}
+
+// ConvertToGif 使用agg渲染GIF，再按--format转换为APNG、WebP或MP4
 func (r *Runner) ConvertToGif(fPath, outFilePath string) (err error) {
+	format := util.FirstNonBlank(r.AnimFormat, "gif")
+	end := traceOperation("convert", attribute.String("acast.file", fPath), attribute.String("acast.format", format))
+	defer func() { end(err) }()
+	ext, ok := animationExts[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q, must be gif, apng, webp or mp4", format)
+	}
 	if !isAggInstalled() {
-		gprint.PrintError("agg<https://github.com/asciinema/agg> is not installed.")
-		gprint.PrintInfo("Please use vm<https://github.com/gvcgo/version-manager> to install agg.")
+		util.PrintError(util.T("agg<https://github.com/asciinema/agg> is not installed."))
+		util.PrintInfo(util.T("Please use vm<https://github.com/gvcgo/version-manager> to install agg."))
+		return
+	}
+	if format == "webp" && !isGif2WebpInstalled() {
+		util.PrintError(util.T("gif2webp<https://developers.google.com/speed/webp/docs/gif2webp> is not installed."))
+		util.PrintInfo(util.T("Please install libwebp (e.g. apt install webp, brew install webp)."))
 		return
 	}
-	if !strings.HasSuffix(outFilePath, ".gif") {
-		outFilePath += ".gif"
+	if format == "mp4" && !isFFmpegInstalled() {
+		util.PrintError(util.T("ffmpeg<https://ffmpeg.org> is not installed."))
+		return
+	}
+	if !strings.HasSuffix(outFilePath, ext) {
+		outFilePath += ext
+	}
+	if r.GifSpeed < 0 || r.GifFPS < 0 || r.GifMaxFrames < 0 {
+		return fmt.Errorf("--speed, --fps and --max-frames must not be negative")
+	}
+	if r.GifStart < 0 || (r.GifEnd > 0 && r.GifEnd <= r.GifStart) {
+		return fmt.Errorf("constraint not verified: 0 <= start < end")
 	}
+	// GIF无法渲染超链接，默认去掉OSC 8序列
+	mode, err := asciicast.ParseHyperlinkMode(util.FirstNonBlank(r.Hyperlinks, string(asciicast.HyperlinksStrip)))
+	if err != nil {
+		return err
+	}
+	src, c, err := r.gifSource(fPath, &asciicast.EscapeFilter{Hyperlinks: mode, StripImages: true})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(src)
+	duration := float64(c.Duration)
+
+	args := []string{"agg"}
+	speed := 1.0
+	if r.GifSpeed > 0 {
+		speed = r.GifSpeed
+	}
+	renderArgs, err := r.aggRenderArgs(c.Theme)
+	if err != nil {
+		return err
+	}
+	args = append(args, renderArgs...)
+	var audioArgs []string
+	if format == "mp4" && c.Audio != nil && !r.NoAudio {
+		if audioArgs, err = narrationArgs(fPath, c.Audio, r.GifStart, speed); err != nil {
+			return err
+		}
+		// agg默认会缩短较长的空闲时间，会导致音频与画面不同步
+		args = append(args, "--idle-time-limit", "86400")
+	}
+	if speed != 1 {
+		args = append(args, "--speed", strconv.FormatFloat(speed, 'f', -1, 64))
+	}
+	fps := r.GifFPS
+	if r.GifMaxFrames > 0 && duration > 0 {
+		// 帧数大约为播放时长乘以帧率，通过降低帧率限制帧数
+		limit := max(1, int(float64(r.GifMaxFrames)/(duration/speed)))
+		if fps == 0 || limit < fps {
+			fps = limit
+		}
+	}
+	if fps > 0 {
+		args = append(args, "--fps-cap", strconv.Itoa(fps))
+	}
+	gifPath := outFilePath
+	if format != "gif" {
+		tmp, err := os.CreateTemp("", "acast-*.gif")
+		if err != nil {
+			return err
+		}
+		tmp.Close()
+		gifPath = tmp.Name()
+		defer os.Remove(gifPath)
+	}
+	args = append(args, src, gifPath)
+
 	workDir, _ := os.Getwd()
-	_, err = gutils.ExecuteSysCommand(false, workDir,
-		"agg", fPath, outFilePath,
-	)
+	if _, err = gutils.ExecuteSysCommand(false, workDir, args...); err != nil {
+		return
+	}
+	switch format {
+	case "apng":
+		err = gifToAPNG(gifPath, outFilePath)
+	case "webp":
+		_, err = gutils.ExecuteSysCommand(true, workDir, "gif2webp", "-mixed", "-quiet", gifPath, "-o", outFilePath)
+	case "mp4":
+		args := []string{"ffmpeg", "-y", "-loglevel", "error", "-i", gifPath}
+		args = append(args, audioArgs...)
+		// H.264要求宽高为偶数
+		args = append(args, "-movflags", "+faststart", "-pix_fmt", "yuv420p", "-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2", outFilePath)
+		_, err = gutils.ExecuteSysCommand(true, workDir, args...)
+	}
 	return
 }
+
+func gifToAPNG(gifPath, outFilePath string) error {
+	in, err := os.Open(gifPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(outFilePath)
+	if err != nil {
+		return err
+	}
+	if err := render.GifToAPNG(in, out); err != nil {
+		out.Close()
+		os.Remove(outFilePath)
+		return err
+	}
+	return out.Close()
+}
+
+// aggRenderArgs 将配色和字体选项转换为agg的参数，未指定配色时使用录制时的配色
+func (r *Runner) aggRenderArgs(recorded *asciicast.Theme) ([]string, error) {
+	var args []string
+	theme, err := render.LoadTheme(util.FirstNonBlank(r.Theme, render.RecordedTheme), recorded)
+	if err != nil {
+		return nil, err
+	}
+	if theme != nil {
+		args = append(args, "--theme", render.AggTheme(theme))
+	}
+	if r.FontSize < 0 {
+		return nil, fmt.Errorf("--font-size must not be negative")
+	}
+	if r.FontSize > 0 {
+		args = append(args, "--font-size", strconv.Itoa(r.FontSize))
+	}
+	if r.FontFamily != "" {
+		args = append(args, "--font-family", r.FontFamily)
+	}
+	return args, nil
+}
+
+// gifSource 生成交给agg渲染的临时cast文件：过滤转义序列，解压压缩帧(agg不支持)，
+// 并只保留[GifStart, GifEnd]区间；有注释时在下方增加几行显示标注。返回临时文件路径和写入的录像
+func (r *Runner) gifSource(fPath string, filter *asciicast.EscapeFilter) (string, *asciicast.Asciicast, error) {
+	c, err := readCast(fPath)
+	if err != nil {
+		return "", nil, err
+	}
+	var notes []asciicast.Annotation
+	if !r.NoAnnotations {
+		notes = asciicast.Annotations(c.Stdout)
+	}
+	frames, err := filter.FilterFrames(c.Stdout)
+	if err != nil {
+		return "", nil, err
+	}
+	if c.Stdout, err = sliceOutput(frames, r.GifStart, r.GifEnd); err != nil {
+		return "", nil, err
+	}
+	if len(c.Stdout) == 0 {
+		return "", nil, fmt.Errorf("no frames found between %v and %v", r.GifStart, r.GifEnd)
+	}
+	for i := range notes {
+		notes[i].Time = roundTime(notes[i].Time - r.GifStart)
+		notes[i].End = roundTime(notes[i].End - r.GifStart)
+	}
+	var band int
+	c.Stdout, band = addCallouts(c.Stdout, c.Width, c.Height, notes)
+	c.Height += band
+	c.Duration = asciicast.Duration(c.Stdout[len(c.Stdout)-1].Time)
+
+	tmp, err := os.CreateTemp("", "acast-*.cast")
+	if err != nil {
+		return "", nil, err
+	}
+	tmp.Close()
+	if err := writeCast(tmp.Name(), c); err != nil {
+		os.Remove(tmp.Name())
+		return "", nil, err
+	}
+	return tmp.Name(), c, nil
+}
+
+// sliceOutput 只保留[start, end]区间的输出帧并以start为0点，end为0表示到结尾。
+// start之前的输出合并为第0秒的一帧，使区间开始时的屏幕内容保持不变
+func sliceOutput(frames []asciicast.Frame, start, end float64) ([]asciicast.Frame, error) {
+	if end <= 0 {
+		end = math.Inf(1)
+	}
+	var before []byte
+	result := []asciicast.Frame{}
+	for _, f := range frames {
+		data, err := f.OutputData()
+		if err != nil {
+			return nil, err
+		}
+		if data == nil || f.Time > end {
+			continue
+		}
+		if f.Time < start {
+			before = append(before, data...)
+			continue
+		}
+		result = append(result, asciicast.Frame{Time: roundTime(f.Time - start), EventType: asciicast.OutputEventType, EventData: data})
+	}
+	if len(before) > 0 {
+		result = append([]asciicast.Frame{{Time: 0, EventType: asciicast.OutputEventType, EventData: before}}, result...)
+	}
+	return result, nil
+}
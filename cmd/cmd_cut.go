@@ -2,34 +2,78 @@ package cmd
 
 import (
 	"github.com/gvcgo/asciinema-edit/cast"
-	"github.com/gvcgo/asciinema-edit/commands/transformer"
-	"github.com/gvcgo/asciinema-edit/editor"
+	"github.com/pkg/errors"
 )
 
 // Cut: Removes a certain range of time frames.
 type cutTransformation struct {
 	from float64
 	to   float64
+	keep bool // 只保留该区间，而不是删除它
 }
 
-func (t *cutTransformation) Transform(c *cast.Cast) (err error) {
-	err = editor.Cut(c, t.from, t.to)
-	return
+func (t *cutTransformation) Transform(c *cast.Cast) error {
+	if t.keep {
+		return keepRange(c, t.from, t.to)
+	}
+	return removeRange(c, t.from, t.to)
 }
 
-func (r *Runner) Cut(inFilePath, outFilePath string, start, end float64) error {
-	transformation := &cutTransformation{
-		from: start,
-		to:   end,
+// removeRange 删除[from, to]区间内的所有事件，之后的事件提前该区间的长度
+func removeRange(c *cast.Cast, from, to float64) error {
+	if c == nil || len(c.EventStream) == 0 {
+		return errors.New("a cast with non-empty event stream must be supplied")
+	}
+	if from > to {
+		return errors.New("`from` cant be bigger than `to`")
+	}
+	kept := make([]*cast.Event, 0, len(c.EventStream))
+	for _, ev := range c.EventStream {
+		switch {
+		case ev.Time < from:
+		case ev.Time > to:
+			ev.Time -= to - from
+		default:
+			continue
+		}
+		kept = append(kept, ev)
+	}
+	c.EventStream = kept
+	return nil
+}
+
+// keepRange 删除[from, to]区间外的所有事件，剩下的事件从0开始计时
+func keepRange(c *cast.Cast, from, to float64) error {
+	if c == nil || len(c.EventStream) == 0 {
+		return errors.New("a cast with non-empty event stream must be supplied")
 	}
-	t, err := transformer.New(transformation, inFilePath, outFilePath)
-	if err != nil {
-		return err
+	if from > to {
+		return errors.New("`from` cant be bigger than `to`")
 	}
-	defer t.Close()
-	err = t.Transform()
-	if err == nil {
-		FixHeaderForEditOperations(inFilePath, outFilePath)
+	kept := make([]*cast.Event, 0, len(c.EventStream))
+	for _, ev := range c.EventStream {
+		if ev.Time >= from && ev.Time <= to {
+			ev.Time -= from
+			kept = append(kept, ev)
+		}
 	}
-	return err
+	if len(kept) == 0 {
+		return errors.Errorf("no frames found between %v and %v", from, to)
+	}
+	c.EventStream = kept
+	return nil
+}
+
+// Cut 删除一段区间(设置了CutKeep时只保留该区间)；"-"表示标准输入/标准输出
+func (r *Runner) Cut(inFilePath, outFilePath string, start, end float64) error {
+	return r.withStdio(inFilePath, outFilePath, func(in, out string) error {
+		return r.cut(in, out, start, end)
+	})
+}
+
+func (r *Runner) cut(inFilePath, outFilePath string, start, end float64) error {
+	return r.edit(inFilePath, outFilePath, []editOp{{
+		line:           "cut",
+		transformation: &cutTransformation{from: start, to: end, keep: r.CutKeep},
+	}})
 }
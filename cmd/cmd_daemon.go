@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/util"
+	"golang.org/x/term"
+)
+
+const (
+	// DefaultSessionDir 登录会话录像的默认目录，每个用户一个子目录
+	DefaultSessionDir = "/var/log/acast"
+	// sessionStateFile 记录已上传的会话，位于会话目录下
+	sessionStateFile = ".session-daemon.json"
+	// sessionNameTemplate 会话录像的文件名模板
+	sessionNameTemplate = "%Y%m%d-%H%M%S-{hostname}"
+)
+
+// DaemonOptions acast session-daemon run的选项
+type DaemonOptions struct {
+	Dir       string
+	Keep      time.Duration // 删除早于该时长的会话录像，为0时不按时间删除
+	MaxBytes  int64         // 会话录像的总大小上限，超过时从最旧的开始删除，为0时不限制
+	UploadCmd string        // 每个结束的会话执行一次，录像路径作为$1和$ACAST_FILE传入
+	Stale     time.Duration // 没有正常结束(如被kill)的录像在多久没有修改后视为结束
+	Interval  time.Duration
+	Once      bool
+}
+
+// daemonState 已上传的会话及上传时间
+type daemonState struct {
+	Uploaded map[string]time.Time `json:"uploaded"`
+}
+
+// sessionCast 会话目录中的一个录像
+type sessionCast struct {
+	path     string
+	size     int64
+	modTime  time.Time
+	finished bool
+}
+
+// SessionSnippet 返回部署到登录流程中的配置片段：kind为profile时是/etc/profile.d脚本，
+// 为sshd时是sshd_config的ForceCommand配置
+func (r *Runner) SessionSnippet(kind, dir string) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "acast"
+	}
+	switch kind {
+	case "profile":
+		return fmt.Sprintf(`# /etc/profile.d/acast.sh: record every interactive login shell with acast.
+# Create the directory once with: install -d -m 1733 %[2]s
+# Set ACAST_NO_RECORD=1 to skip the recording.
+if [ -t 0 ] && [ -z "$ASCIINEMA_REC" ] && [ -z "$ACAST_NO_RECORD" ] && [ -x %[1]q ]; then
+  case $- in
+    *i*) exec %[1]q session-daemon login --dir %[2]q ;;
+  esac
+fi
+`, exe, dir), nil
+	case "sshd":
+		return fmt.Sprintf(`# sshd_config: record every interactive ssh session with acast.
+# Commands run without a terminal (scp, sftp, ssh host cmd) are not recorded.
+# Create the directory once with: install -d -m 1733 %[2]s
+ForceCommand %[1]s session-daemon login --dir %[2]s
+`, exe, dir), nil
+	}
+	return "", fmt.Errorf("unknown snippet kind %q, use profile or sshd", kind)
+}
+
+// SessionLogin 作为登录shell的入口：交互式登录时录制一个登录shell到dir/<用户>/下，
+// 非交互式的ssh命令、没有终端或已经在录制中时直接运行，不录制
+func (r *Runner) SessionLogin(dir string) error {
+	shell := util.FirstNonBlank(os.Getenv("SHELL"), cfg.RecordCommand())
+	if command := os.Getenv("SSH_ORIGINAL_COMMAND"); command != "" {
+		return runUnrecorded(shell, "-c", command)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || asciicast.IsRecording(env) {
+		return runUnrecorded(shell, "-l")
+	}
+
+	userDir := filepath.Join(dir, util.Username())
+	if err := os.MkdirAll(userDir, 0700); err != nil {
+		// 无法录制时不能阻止用户登录
+		util.Warningf("Session recording is not available: %v", err)
+		return runUnrecorded(shell, "-l")
+	}
+	name := fmt.Sprintf("%s-%d.cast", util.ExpandNameTemplate(sessionNameTemplate, time.Now()), os.Getpid())
+	r.FilePath = filepath.Join(userDir, name)
+	r.Title = strings.TrimSuffix(name, ".cast")
+	r.Command = shell + " -l"
+	r.StreamWrite = true
+	r.Quite = true
+	r.AssumeYes = true
+	// 审计录像不允许其他人attach观看
+	r.NoAttach = true
+	// 导出审计事件时需要用户和主机名
+	r.Meta = []string{"hostname", "user"}
+	return r.Rec()
+}
+
+// runUnrecorded 运行命令并以它的退出码退出
+func runUnrecorded(name string, args ...string) error {
+	c := exec.Command(name, args...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	return err
+}
+
+// SessionDaemon 定期处理会话目录：对每个结束的会话执行上传钩子，然后按保留时长和总大小删除旧的录像。
+// 正在录制的会话不会被上传或删除；设置了上传钩子时，未上传成功的录像也不会被删除
+func (r *Runner) SessionDaemon(opts DaemonOptions) error {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	for {
+		if err := sessionDaemonPass(opts); err != nil {
+			if opts.Once {
+				return err
+			}
+			log.Printf("session-daemon: %v", err)
+		}
+		if opts.Once {
+			return nil
+		}
+		time.Sleep(opts.Interval)
+	}
+}
+
+func sessionDaemonPass(opts DaemonOptions) error {
+	statePath := filepath.Join(opts.Dir, sessionStateFile)
+	state := &daemonState{Uploaded: map[string]time.Time{}}
+	if data, err := os.ReadFile(statePath); err == nil {
+		json.Unmarshal(data, state)
+		if state.Uploaded == nil {
+			state.Uploaded = map[string]time.Time{}
+		}
+	}
+
+	casts, err := listSessionCasts(opts.Dir, opts.Stale)
+	if err != nil {
+		return err
+	}
+	// 只有已上传(或没有上传钩子)的结束的会话可以删除
+	removable := func(c sessionCast) bool {
+		if !c.finished {
+			return false
+		}
+		_, uploaded := state.Uploaded[c.path]
+		return opts.UploadCmd == "" || uploaded
+	}
+
+	if opts.UploadCmd != "" {
+		for _, c := range casts {
+			if _, ok := state.Uploaded[c.path]; ok || !c.finished {
+				continue
+			}
+			if err := runUploadHook(opts.UploadCmd, c.path); err != nil {
+				log.Printf("session-daemon: upload of %s failed, retrying later: %v", c.path, err)
+				continue
+			}
+			log.Printf("session-daemon: uploaded %s", c.path)
+			state.Uploaded[c.path] = time.Now()
+		}
+	}
+
+	var total int64
+	kept := casts[:0]
+	for _, c := range casts {
+		if opts.Keep > 0 && time.Since(c.modTime) > opts.Keep && removable(c) {
+			removeSessionCast(c.path, state)
+			continue
+		}
+		total += c.size
+		kept = append(kept, c)
+	}
+	// casts按修改时间排序，从最旧的开始删除
+	for _, c := range kept {
+		if opts.MaxBytes <= 0 || total <= opts.MaxBytes {
+			break
+		}
+		if removable(c) {
+			removeSessionCast(c.path, state)
+			total -= c.size
+		}
+	}
+
+	// 去掉已经不存在的录像的上传记录
+	for path := range state.Uploaded {
+		if _, err := os.Stat(path); err != nil {
+			delete(state.Uploaded, path)
+		}
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath, data, 0600)
+}
+
+// listSessionCasts 返回会话目录中的所有录像，按修改时间从旧到新排序。
+// 流式写入的录像在录制结束时才写入时长，没有时长且最近修改过的录像视为正在录制
+func listSessionCasts(dir string, stale time.Duration) ([]sessionCast, error) {
+	files, err := findCasts(dir)
+	if err != nil {
+		return nil, err
+	}
+	casts := make([]sessionCast, 0, len(files))
+	for _, path := range files {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		c := sessionCast{path: path, size: fi.Size(), modTime: fi.ModTime()}
+		c.finished = castFinished(path) || (stale > 0 && time.Since(fi.ModTime()) > stale)
+		casts = append(casts, c)
+	}
+	sort.Slice(casts, func(i, j int) bool { return casts[i].modTime.Before(casts[j].modTime) })
+	return casts, nil
+}
+
+// castFinished 检查录像的头部是否已经写入了时长
+func castFinished(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header, err := asciicast.NewDecoder(f).Header()
+	return err == nil && header.Duration > 0
+}
+
+// runUploadHook 以sh执行上传钩子，录像路径作为$1和$ACAST_FILE传入
+func runUploadHook(command, path string) error {
+	c := exec.Command("sh", "-c", command, "sh", path)
+	c.Env = append(os.Environ(), "ACAST_FILE="+path)
+	out, err := c.CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return err
+}
+
+// removeSessionCast 删除录像及其旁路文件
+func removeSessionCast(path string, state *daemonState) {
+	for _, p := range []string{path, path + metaExt, path + ".input.log"} {
+		os.Remove(p)
+	}
+	delete(state.Uploaded, path)
+	log.Printf("session-daemon: removed %s", path)
+}
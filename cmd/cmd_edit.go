@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+	"github.com/gvcgo/asciinema-edit/commands/transformer"
+	"github.com/pkg/errors"
+	"github.com/x6nux/asciinema/asciicast"
+)
+
+// Edit: 一次性对录像依次执行多个操作。
+//
+// 每个操作为一行，格式为`名称 参数...`：
+//
+//	cut start:end                删除该区间
+//	trim start:end               只保留该区间，并从0开始计时
+//	speed start:end:factor       改变该区间的播放速度
+//	quantize value[,value]...    按量化区间调整帧间隔
+//	redact regexp [replacement]  替换匹配的输出(正则表达式中不能有空格，使用\s)
+//
+// 编辑脚本中的空行和以`#`开头的行会被忽略。
+
+// editOp 解析后的编辑操作及其所在的行
+type editOp struct {
+	line           string
+	transformation transformer.Transformation
+}
+
+// redactTransformation 替换与正则表达式匹配的输出，跨越多帧的匹配无法识别
+type redactTransformation struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+func (t *redactTransformation) Transform(c *cast.Cast) error {
+	for _, ev := range c.EventStream {
+		switch ev.Type {
+		case "o":
+			ev.Data = t.re.ReplaceAllString(ev.Data, t.repl)
+		case "z":
+			data, err := asciicast.DecompressFrameData([]byte(ev.Data))
+			if err != nil {
+				return err
+			}
+			data, err = asciicast.CompressFrameData(t.re.ReplaceAll(data, []byte(t.repl)))
+			if err != nil {
+				return err
+			}
+			ev.Data = string(data)
+		}
+	}
+	return nil
+}
+
+// parseTimeRange 解析`start:end`形式的时间区间
+func parseTimeRange(input string) (from, to float64, err error) {
+	cols := strings.Split(input, ":")
+	if len(cols) != 2 {
+		err = errors.Errorf("invalid range format: must be `start:end`")
+		return
+	}
+	if from, err = strconv.ParseFloat(cols[0], 64); err != nil {
+		err = errors.Errorf("malformed range: start is not a float '%s'", cols[0])
+		return
+	}
+	if to, err = strconv.ParseFloat(cols[1], 64); err != nil {
+		err = errors.Errorf("malformed range: end is not a float '%s'", cols[1])
+		return
+	}
+	if from < 0 || to <= from {
+		err = errors.Errorf("constraint not verified: 0 <= start < end")
+	}
+	return
+}
+
+// ParseEditOp 将`speed 0:10:0.5`这样的一行转换为编辑操作
+func ParseEditOp(line string) (transformer.Transformation, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, errors.New("empty operation")
+	}
+	name, args := fields[0], fields[1:]
+	switch name {
+	case "cut", "trim":
+		if len(args) != 1 {
+			return nil, errors.Errorf("%s expects `start:end`", name)
+		}
+		from, to, err := parseTimeRange(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return &cutTransformation{from: from, to: to, keep: name == "trim"}, nil
+	case "speed":
+		if len(args) != 1 {
+			return nil, errors.New("speed expects `start:end:factor`")
+		}
+		sRange, err := ParseSpeedRange(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return &speedTransformation{ranges: []SpeedRange{sRange}}, nil
+	case "quantize":
+		if len(args) == 0 {
+			return nil, errors.New("quantize expects at least one range")
+		}
+		ranges, err := parseQuantizeRanges(args)
+		if err != nil {
+			return nil, err
+		}
+		return &quantizeTransformation{ranges: ranges}, nil
+	case "redact":
+		if len(args) == 0 || len(args) > 2 {
+			return nil, errors.New("redact expects `regexp [replacement]`")
+		}
+		re, err := regexp.Compile(args[0])
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid redact pattern")
+		}
+		t := &redactTransformation{re: re, repl: "***"}
+		if len(args) == 2 {
+			t.repl = args[1]
+		}
+		return t, nil
+	}
+	return nil, errors.Errorf("unknown operation %q", name)
+}
+
+// parseEditOps 解析编辑脚本中的操作，以及之后命令行中给出的操作
+func parseEditOps(script string, lines []string) ([]editOp, error) {
+	all := []string{}
+	if script != "" {
+		f, err := os.Open(script)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open edit script %s", script)
+		}
+		defer f.Close()
+		scriptLines, err := readScriptLines(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read edit script %s", script)
+		}
+		all = append(all, scriptLines...)
+	}
+	all = append(all, lines...)
+
+	ops := make([]editOp, 0, len(all))
+	for _, line := range all {
+		t, err := ParseEditOp(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid operation `%s`", line)
+		}
+		ops = append(ops, editOp{line: line, transformation: t})
+	}
+	if len(ops) == 0 {
+		return nil, errors.New("at least one operation must be specified")
+	}
+	return ops, nil
+}
+
+func readScriptLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// spanEndType 表示压缩帧结束时刻的隐藏事件的类型，编辑操作因此会同时调整压缩帧两端的时间
+const spanEndType = "z-end"
+
+// framesToEvents 将帧转换为可编辑的事件，压缩帧原样保留，并在其后加上标记结束时刻的隐藏事件
+func framesToEvents(frames []asciicast.Frame) ([]*cast.Event, map[*cast.Event]*cast.Event) {
+	events := make([]*cast.Event, 0, len(frames))
+	spans := map[*cast.Event]*cast.Event{}
+	for _, f := range frames {
+		ev := &cast.Event{Time: f.Time, Type: f.EventType, Data: string(f.EventData)}
+		events = append(events, ev)
+		if f.IsCompressed() && f.EndTime > f.Time {
+			end := &cast.Event{Time: f.EndTime, Type: spanEndType}
+			spans[end] = ev
+			events = append(events, end)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time < events[j].Time
+	})
+	return events, spans
+}
+
+func eventsToFrames(events []*cast.Event, spans map[*cast.Event]*cast.Event) []asciicast.Frame {
+	ends := map[*cast.Event]float64{}
+	for _, ev := range events {
+		if start, ok := spans[ev]; ok {
+			ends[start] = ev.Time
+		}
+	}
+	frames := make([]asciicast.Frame, 0, len(events))
+	for _, ev := range events {
+		if ev.Type == spanEndType {
+			continue
+		}
+		f := asciicast.Frame{
+			Time:      roundTime(ev.Time),
+			EventType: ev.Type,
+			EventData: []byte(ev.Data),
+		}
+		if end, ok := ends[ev]; ok {
+			f.EndTime = roundTime(end)
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// roundTime 去掉编辑操作累积的浮点误差，保留asciicast.TimePrecision位小数
+func roundTime(t float64) float64 {
+	return asciicast.RoundTime(t)
+}
+
+// Edit 依次执行编辑脚本(如果有)中的操作和给出的操作；"-"表示标准输入/标准输出
+func (r *Runner) Edit(inFilePath, outFilePath, script string, lines []string) error {
+	ops, err := parseEditOps(script, lines)
+	if err != nil {
+		return err
+	}
+	return r.withStdio(inFilePath, outFilePath, func(in, out string) error {
+		return r.edit(in, out, ops)
+	})
+}
+
+func (r *Runner) edit(inFilePath, outFilePath string, ops []editOp) error {
+	c, err := readCast(inFilePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read cast %s", inFilePath)
+	}
+	if len(c.Stdout) == 0 {
+		return errors.New("a cast with non-empty event stream must be supplied")
+	}
+	events, spans := framesToEvents(c.Stdout)
+	editable := &cast.Cast{EventStream: events}
+	for _, op := range ops {
+		if err := op.transformation.Transform(editable); err != nil {
+			return errors.Wrapf(err, "failed to apply `%s`", op.line)
+		}
+	}
+	c.Stdout = eventsToFrames(editable.EventStream, spans)
+	if c.Duration != 0 && len(c.Stdout) > 0 {
+		last := c.Stdout[len(c.Stdout)-1]
+		c.Duration = asciicast.Duration(math.Max(last.Time, last.EndTime))
+	}
+	return writeCast(outFilePath, c)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const extraEventsCast = `{"version":2,"width":80,"height":24}
+[0.5,"o","hello\r\n"]
+[1.0,"m","intro"]
+[2.0,"x","0"]
+[3.0,"o","world\r\n"]
+[4.0,"a","1\tnote"]
+[6.0,"o","bye\r\n"]
+`
+
+// 编辑命令保留o/i以外的事件，并和输出一起调整时间
+func TestEditKeepsExtraEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(r *Runner, in, out string) error
+		want []float64 // m、x、a事件编辑后的时间
+	}{
+		{"cut", func(r *Runner, in, out string) error {
+			return r.Cut(in, out, 2.5, 3.5)
+		}, []float64{1, 2, 3}},
+		{"speed", func(r *Runner, in, out string) error {
+			return r.Speed(in, out, 2, 0, 6)
+		}, []float64{1.5, 3.5, 7.5}},
+		{"quantize", func(r *Runner, in, out string) error {
+			return r.Quantize(in, out, []string{"0.5"})
+		}, []float64{1, 1.5, 2.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			in, out := filepath.Join(dir, "in.cast"), filepath.Join(dir, "out.cast")
+			if err := os.WriteFile(in, []byte(extraEventsCast), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.run(&Runner{}, in, out); err != nil {
+				t.Fatal(err)
+			}
+			c, err := readCast(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []float64{}
+			for _, f := range c.Stdout {
+				if f.EventType != "o" {
+					got = append(got, f.Time)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extra event times = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
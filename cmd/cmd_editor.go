@@ -0,0 +1,412 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+	"github.com/pkg/errors"
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/util"
+	"github.com/x6nux/asciinema/vt"
+	"golang.org/x/term"
+)
+
+const editorHelp = "←/→ ±1s  H/L ±10s  ,/. frame  g/G start/end  i/o in/out  d delete  t trim  m marker  n/p next/prev marker  u undo  s save  q quit"
+
+// timelineEditor 交互式时间轴编辑器的状态
+type timelineEditor struct {
+	cast    *asciicast.Asciicast
+	outPath string
+	pos     float64
+	in, out float64 // 入点和出点，小于0表示未设置
+	history [][]asciicast.Frame
+	dirty   bool
+	backup  bool   // 保存时是否需要先备份(覆盖输入文件且尚未备份)
+	message string // 状态栏中显示一次的提示
+	prompt  *string
+	quit    bool
+
+	screen *vt.Screen
+	fed    int // 已写入screen的帧数
+	w      *bufio.Writer
+}
+
+// Editor 打开交互式时间轴编辑器，outFilePath为空时保存到输入文件
+func (r *Runner) Editor(inFilePath, outFilePath string) error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("the editor needs an interactive terminal")
+	}
+	c, err := readCast(inFilePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read cast %s", inFilePath)
+	}
+	if outFilePath == "" {
+		outFilePath = inFilePath
+	}
+	e := &timelineEditor{
+		cast:    c,
+		outPath: outFilePath,
+		in:      -1,
+		out:     -1,
+		backup:  !r.NoBackup && backupEnabled() && sameFile(inFilePath, outFilePath),
+		screen:  vt.New(c.Width, c.Height),
+		w:       bufio.NewWriter(os.Stdout),
+	}
+
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	restore := func() {
+		term.Restore(int(os.Stdin.Fd()), state)
+		fmt.Fprint(os.Stdout, "\x1b[0m\x1b[?25h\x1b[?1049l")
+	}
+	remove := util.AddCleanup(restore)
+	defer func() {
+		remove()
+		restore()
+	}()
+	fmt.Fprint(os.Stdout, "\x1b[?1049h\x1b[?25l")
+
+	buf := make([]byte, 64)
+	for !e.quit {
+		e.render()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, key := range splitKeys(buf[:n]) {
+			e.handleKey(key)
+		}
+	}
+	return nil
+}
+
+// splitKeys 将一次读取的输入拆分为按键，转义序列作为一个整体
+func splitKeys(data []byte) []string {
+	keys := []string{}
+	for i := 0; i < len(data); {
+		if data[i] == 0x1b && i+1 < len(data) && (data[i+1] == '[' || data[i+1] == 'O') {
+			j := i + 2
+			for j < len(data) && (data[j] < 0x40 || data[j] > 0x7e) {
+				j++
+			}
+			if j < len(data) {
+				j++
+			}
+			keys = append(keys, string(data[i:j]))
+			i = j
+			continue
+		}
+		_, size := utf8.DecodeRune(data[i:])
+		keys = append(keys, string(data[i:i+size]))
+		i += size
+	}
+	return keys
+}
+
+func (e *timelineEditor) frames() []asciicast.Frame {
+	return e.cast.Stdout
+}
+
+func (e *timelineEditor) duration() float64 {
+	return framesDuration(e.frames())
+}
+
+func (e *timelineEditor) seek(t float64) {
+	e.pos = math.Max(0, math.Min(t, e.duration()))
+}
+
+// seekFrame 跳到前一帧或后一帧(dir为-1或1)，types为空时不限帧类型
+func (e *timelineEditor) seekFrame(dir int, types ...string) {
+	frames := e.frames()
+	match := func(f asciicast.Frame) bool {
+		if len(types) == 0 {
+			return true
+		}
+		for _, t := range types {
+			if f.EventType == t {
+				return true
+			}
+		}
+		return false
+	}
+	if dir > 0 {
+		for _, f := range frames {
+			if f.Time > e.pos && match(f) {
+				e.pos = f.Time
+				return
+			}
+		}
+	} else {
+		for i := len(frames) - 1; i >= 0; i-- {
+			if frames[i].Time < e.pos && match(frames[i]) {
+				e.pos = frames[i].Time
+				return
+			}
+		}
+	}
+}
+
+func (e *timelineEditor) handleKey(key string) {
+	if e.prompt != nil {
+		e.handlePromptKey(key)
+		return
+	}
+	if key != "q" && key != "\x03" {
+		e.message = ""
+	}
+	switch key {
+	case "\x1b[D", "h":
+		e.seek(e.pos - 1)
+	case "\x1b[C", "l":
+		e.seek(e.pos + 1)
+	case "H":
+		e.seek(e.pos - 10)
+	case "L":
+		e.seek(e.pos + 10)
+	case ",":
+		e.seekFrame(-1)
+	case ".":
+		e.seekFrame(1)
+	case "g", "\x1b[H", "\x1b[1~", "\x1bOH":
+		e.seek(0)
+	case "G", "\x1b[F", "\x1b[4~", "\x1bOF":
+		e.seek(e.duration())
+	case "p":
+		e.seekFrame(-1, "m")
+	case "n":
+		e.seekFrame(1, "m")
+	case "i":
+		e.in = e.pos
+	case "o":
+		e.out = e.pos
+	case "d":
+		e.editRange(false)
+	case "t":
+		e.editRange(true)
+	case "m":
+		label := ""
+		e.prompt = &label
+	case "u":
+		e.undo()
+	case "s":
+		e.save()
+	case "q", "\x03":
+		if e.dirty && e.message != "unsaved changes, press q again to quit" {
+			e.message = "unsaved changes, press q again to quit"
+			return
+		}
+		e.quit = true
+	}
+}
+
+// handlePromptKey 处理输入标记名称时的按键
+func (e *timelineEditor) handlePromptKey(key string) {
+	switch key {
+	case "\r", "\n":
+		e.addMarker(*e.prompt)
+		e.prompt = nil
+	case "\x1b", "\x03":
+		e.prompt = nil
+	case "\x7f", "\b":
+		if s := *e.prompt; s != "" {
+			_, size := utf8.DecodeLastRuneInString(s)
+			*e.prompt = s[:len(s)-size]
+		}
+	default:
+		if r, _ := utf8.DecodeRuneInString(key); len(key) > 0 && r >= 0x20 && r != 0x7f {
+			*e.prompt += key
+		}
+	}
+}
+
+// snapshot 在修改前保存当前帧列表，用于撤销
+func (e *timelineEditor) snapshot() {
+	frames := make([]asciicast.Frame, len(e.frames()))
+	copy(frames, e.frames())
+	e.history = append(e.history, frames)
+	e.dirty = true
+}
+
+func (e *timelineEditor) undo() {
+	if len(e.history) == 0 {
+		e.message = "nothing to undo"
+		return
+	}
+	e.cast.Stdout = e.history[len(e.history)-1]
+	e.history = e.history[:len(e.history)-1]
+	e.invalidate()
+	e.seek(e.pos)
+}
+
+// invalidate 帧列表改变后需要重新模拟屏幕
+func (e *timelineEditor) invalidate() {
+	e.screen.Reset()
+	e.fed = 0
+}
+
+// editRange 删除(或只保留)入点和出点之间的内容
+func (e *timelineEditor) editRange(keep bool) {
+	if e.in < 0 || e.out <= e.in {
+		e.message = "set the in point (i) before the out point (o) first"
+		return
+	}
+	e.snapshot()
+	events, spans := framesToEvents(e.frames())
+	editable := &cast.Cast{EventStream: events}
+	var err error
+	if keep {
+		err = keepRange(editable, e.in, e.out)
+	} else {
+		err = removeRange(editable, e.in, e.out)
+	}
+	if err != nil {
+		e.history = e.history[:len(e.history)-1]
+		e.message = err.Error()
+		return
+	}
+	e.cast.Stdout = eventsToFrames(editable.EventStream, spans)
+	if keep {
+		e.pos = 0
+	} else {
+		e.pos = e.in
+	}
+	e.in, e.out = -1, -1
+	e.invalidate()
+	e.seek(e.pos)
+}
+
+func (e *timelineEditor) addMarker(label string) {
+	e.snapshot()
+	frames := append(e.frames(), asciicast.Frame{Time: roundTime(e.pos), EventType: asciicast.MarkerEventType, EventData: []byte(label)})
+	sort.SliceStable(frames, func(i, j int) bool {
+		return frames[i].Time < frames[j].Time
+	})
+	e.cast.Stdout = frames
+	e.invalidate()
+}
+
+func (e *timelineEditor) save() {
+	if e.backup {
+		if _, err := backupFile(e.outPath); err != nil {
+			e.message = "backup failed: " + err.Error()
+			return
+		}
+		e.backup = false
+	}
+	if e.cast.Duration != 0 {
+		e.cast.Duration = asciicast.Duration(e.duration())
+	}
+	if err := writeCast(e.outPath, e.cast); err != nil {
+		e.message = "save failed: " + err.Error()
+		return
+	}
+	e.dirty = false
+	e.message = "saved to " + e.outPath
+}
+
+// advance 将屏幕模型推进到当前位置，后退时从头重放
+func (e *timelineEditor) advance() {
+	frames := e.frames()
+	if e.fed > 0 && frames[e.fed-1].Time > e.pos {
+		e.invalidate()
+	}
+	for e.fed < len(frames) && frames[e.fed].Time <= e.pos {
+		if data, err := frames[e.fed].OutputData(); err == nil && data != nil {
+			e.screen.Write(data)
+		}
+		e.fed++
+	}
+}
+
+func (e *timelineEditor) render() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+	e.advance()
+	fmt.Fprint(e.w, "\x1b[0m\x1b[H\x1b[2J")
+
+	_, rows := e.screen.Size()
+	rows = min(rows, height-3)
+	for y := 0; y < rows; y++ {
+		cells := e.screen.Line(y)
+		if len(cells) > width {
+			cells = cells[:width]
+		}
+		fmt.Fprintf(e.w, "\x1b[%d;1H%s", y+1, vt.RenderCells(cells))
+	}
+
+	fmt.Fprintf(e.w, "\x1b[%d;1H%s", height-2, e.timeline(width))
+	status := fmt.Sprintf("%.2fs / %.2fs  frame %d/%d", e.pos, e.duration(), e.fed, len(e.frames()))
+	if e.in >= 0 {
+		status += fmt.Sprintf("  in %.2fs", e.in)
+	}
+	if e.out >= 0 {
+		status += fmt.Sprintf("  out %.2fs", e.out)
+	}
+	if e.dirty {
+		status += "  [modified]"
+	}
+	fmt.Fprintf(e.w, "\x1b[%d;1H\x1b[7m%s\x1b[0m", height-1, truncate(status, width))
+	line := editorHelp
+	switch {
+	case e.prompt != nil:
+		line = "marker label: " + *e.prompt
+	case e.message != "":
+		line = e.message
+	}
+	fmt.Fprintf(e.w, "\x1b[%d;1H%s", height, truncate(line, width))
+	e.w.Flush()
+}
+
+// timeline 绘制时间轴：选中区间反色显示，◆为标记，█为当前位置
+func (e *timelineEditor) timeline(width int) string {
+	dur := e.duration()
+	col := func(t float64) int {
+		if dur <= 0 {
+			return 0
+		}
+		return int(math.Round(t / dur * float64(width-1)))
+	}
+	bar := []rune(strings.Repeat("─", width))
+	for _, f := range e.frames() {
+		if f.EventType == asciicast.MarkerEventType {
+			bar[col(f.Time)] = '◆'
+		}
+	}
+	bar[col(e.pos)] = '█'
+
+	from, to := -1, -1
+	if e.in >= 0 {
+		from, to = col(e.in), col(e.in)
+		if e.out > e.in {
+			to = col(e.out)
+		}
+	}
+	var b strings.Builder
+	for i, r := range bar {
+		if i == from {
+			b.WriteString("\x1b[7m")
+		}
+		b.WriteRune(r)
+		if i == to {
+			b.WriteString("\x1b[0m")
+		}
+	}
+	return b.String()
+}
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
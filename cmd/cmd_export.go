@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/util"
+)
+
+// SIEM导出格式
+const (
+	ExportECS = "ecs" // Elastic Common Schema，每行一个JSON事件
+	ExportCEF = "cef" // ArcSight Common Event Format，每行一个事件
+)
+
+// ecsVersion 导出的事件遵循的ECS版本
+const ecsVersion = "8.11.0"
+
+// exportOutputLimit 每个事件中保留的命令输出的最大字节数，超出部分被截断
+const exportOutputLimit = 8192
+
+// exportSession 导出事件共用的会话信息
+type exportSession struct {
+	path  string
+	title string
+	user  string
+	host  string
+	start time.Time // 录制开始的时间
+}
+
+// Export 将录像中识别出的每条命令作为一个审计事件写入w，format为ecs或cef
+func (r *Runner) Export(fPath, format string, w io.Writer) error {
+	if format != ExportECS && format != ExportCEF {
+		return fmt.Errorf("unknown export format %q, use %s or %s", format, ExportECS, ExportCEF)
+	}
+	promptRe, err := CompilePromptRegex(r.promptRegex())
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	session, err := readExportSession(f, fPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	return transcribe(f, promptRe, func(c CommandOutput) error {
+		if strings.TrimSpace(c.Cmd) == "" {
+			return nil
+		}
+		if format == ExportECS {
+			return encoder.Encode(ecsEvent(session, c))
+		}
+		_, err := fmt.Fprintln(out, cefEvent(session, c))
+		return err
+	})
+}
+
+// readExportSession 从录像头部读取会话信息，没有录制时间时使用文件的修改时间
+func readExportSession(f *os.File, fPath string) (*exportSession, error) {
+	header, err := asciicast.NewDecoder(f).Header()
+	if err != nil {
+		return nil, fmt.Errorf(util.T("invalid cast header: %v"), err)
+	}
+	session := &exportSession{path: fPath, title: header.Title}
+	if abs, err := filepath.Abs(fPath); err == nil {
+		session.path = abs
+	}
+	if header.Machine != nil {
+		session.user = header.Machine.User
+		session.host = header.Machine.Hostname
+	}
+	if header.Timestamp > 0 {
+		session.start = time.Unix(header.Timestamp, 0)
+	} else if fi, err := f.Stat(); err == nil {
+		session.start = fi.ModTime().Add(-time.Duration(float64(header.Duration) * float64(time.Second)))
+	}
+	return session, nil
+}
+
+// at 返回录像中offset秒处的时间
+func (s *exportSession) at(offset float64) time.Time {
+	return s.start.Add(time.Duration(offset * float64(time.Second))).UTC()
+}
+
+// exportOutput 截断过长的命令输出
+func exportOutput(out string) string {
+	if len(out) <= exportOutputLimit {
+		return out
+	}
+	out = out[:exportOutputLimit]
+	// 不要在UTF-8字符的中间截断
+	for len(out) > 0 && out[len(out)-1]&0xC0 == 0x80 {
+		out = out[:len(out)-1]
+	}
+	if len(out) > 0 && out[len(out)-1] >= 0xC0 {
+		out = out[:len(out)-1]
+	}
+	return out + "…"
+}
+
+// exportOutcome 返回ECS的event.outcome
+func exportOutcome(c CommandOutput) string {
+	switch {
+	case c.ExitStatus == nil:
+		return "unknown"
+	case *c.ExitStatus == 0:
+		return "success"
+	}
+	return "failure"
+}
+
+// ecsEvent 将一条命令转换为ECS事件，ECS中没有的字段放在acast下
+func ecsEvent(s *exportSession, c CommandOutput) map[string]interface{} {
+	process := map[string]interface{}{
+		"command_line": c.Cmd,
+		"name":         strings.Fields(c.Cmd)[0],
+	}
+	if c.ExitStatus != nil {
+		process["exit_code"] = *c.ExitStatus
+	}
+	if c.Cwd != "" {
+		process["working_directory"] = c.Cwd
+	}
+	event := map[string]interface{}{
+		"@timestamp": s.at(c.Start).Format(time.RFC3339Nano),
+		"ecs":        map[string]string{"version": ecsVersion},
+		"message":    c.Cmd,
+		"event": map[string]interface{}{
+			"kind":     "event",
+			"category": []string{"process"},
+			"type":     []string{"start"},
+			"action":   "command-executed",
+			"dataset":  "acast.session",
+			"module":   "acast",
+			"outcome":  exportOutcome(c),
+			"start":    s.at(c.Start).Format(time.RFC3339Nano),
+			"end":      s.at(c.End).Format(time.RFC3339Nano),
+			"duration": int64(c.Duration * float64(time.Second)),
+		},
+		"process": process,
+		"file":    map[string]string{"path": s.path, "name": filepath.Base(s.path)},
+		"acast": map[string]interface{}{
+			"offset": c.Start,
+			"title":  s.title,
+			"output": exportOutput(c.Out),
+		},
+	}
+	if s.user != "" {
+		event["user"] = map[string]string{"name": s.user}
+	}
+	if s.host != "" {
+		event["host"] = map[string]string{"hostname": s.host, "name": s.host}
+	}
+	return event
+}
+
+// cefEvent 将一条命令转换为一行CEF事件
+func cefEvent(s *exportSession, c CommandOutput) string {
+	severity := 3
+	if c.ExitStatus != nil && *c.ExitStatus != 0 {
+		severity = 5
+	}
+	ext := [][2]string{
+		{"rt", fmt.Sprint(s.at(c.Start).UnixMilli())},
+		{"start", fmt.Sprint(s.at(c.Start).UnixMilli())},
+		{"end", fmt.Sprint(s.at(c.End).UnixMilli())},
+		{"act", "command-executed"},
+		{"outcome", exportOutcome(c)},
+		{"msg", c.Cmd},
+		{"cs1Label", "command"},
+		{"cs1", c.Cmd},
+		{"cs2Label", "output"},
+		{"cs2", exportOutput(c.Out)},
+		{"cn2Label", "durationMs"},
+		{"cn2", fmt.Sprint(int64(c.Duration * 1000))},
+		{"fname", filepath.Base(s.path)},
+		{"filePath", s.path},
+	}
+	if c.ExitStatus != nil {
+		ext = append(ext, [2]string{"cn1Label", "exitCode"}, [2]string{"cn1", fmt.Sprint(*c.ExitStatus)})
+	}
+	if s.user != "" {
+		ext = append(ext, [2]string{"suser", s.user})
+	}
+	if s.host != "" {
+		ext = append(ext, [2]string{"shost", s.host})
+	}
+	if s.title != "" {
+		ext = append(ext, [2]string{"cs3Label", "title"}, [2]string{"cs3", s.title})
+	}
+	if c.Cwd != "" {
+		ext = append(ext, [2]string{"cs4Label", "workingDirectory"}, [2]string{"cs4", c.Cwd})
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|asciinema|acast|%s|command|Command executed|%d|", cefHeader(Version), severity)
+	for i, kv := range ext {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(kv[0])
+		b.WriteByte('=')
+		b.WriteString(cefValue(kv[1]))
+	}
+	return b.String()
+}
+
+// cefHeader 转义CEF头部字段中的\和|
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`).Replace(s)
+}
+
+// cefValue 转义CEF扩展字段值中的\、=和换行
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/render"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ExportHTML 将录像导出为可直接在浏览器中打开的网页，标记作为可点击的章节，注释显示为标注(设置了NoAnnotations时不显示)。
+// outFilePath为空时写入与录像同名的.html文件
+func (r *Runner) ExportHTML(fPath, outFilePath string) (err error) {
+	end := traceOperation("convert", attribute.String("acast.file", fPath), attribute.String("acast.format", "html"))
+	defer func() { end(err) }()
+	c, err := readCast(fPath)
+	if err != nil {
+		return err
+	}
+	if outFilePath == "" {
+		outFilePath = strings.TrimSuffix(fPath, ".cast") + ".html"
+	}
+	var annotations []asciicast.Annotation
+	if !r.NoAnnotations {
+		annotations = asciicast.Annotations(c.Stdout)
+	}
+	// 网页播放器不支持压缩帧，shell集成等扩展事件也没有意义，注释由网页自己显示
+	frames, err := standardFrames(c.Stdout)
+	if err != nil {
+		return err
+	}
+	// 网页播放器也不能显示图片
+	if c.Stdout, err = (&asciicast.EscapeFilter{StripImages: true}).FilterFrames(frames); err != nil {
+		return err
+	}
+	style, err := r.htmlStyle()
+	if err != nil {
+		return err
+	}
+	if style.Theme != nil {
+		// 指定的配色代替录制时的配色
+		c.Theme = nil
+	}
+	data, err := encodeCast(c)
+	if err != nil {
+		return err
+	}
+
+	title := c.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(fPath), ".cast")
+	}
+	out, err := os.Create(outFilePath)
+	if err != nil {
+		return err
+	}
+	if err := render.HTML(out, title, data, render.Chapters(c.Stdout), annotations, style); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// htmlStyle 将配色和字体选项转换为网页播放器的设置，未指定配色时播放器使用录制时的配色
+func (r *Runner) htmlStyle() (render.HTMLStyle, error) {
+	style := render.HTMLStyle{FontSize: r.FontSize, FontFamily: r.FontFamily}
+	if r.FontSize < 0 {
+		return style, fmt.Errorf("--font-size must not be negative")
+	}
+	if r.Theme != "" && r.Theme != render.RecordedTheme {
+		theme, err := render.LoadTheme(r.Theme, nil)
+		if err != nil {
+			return style, err
+		}
+		style.Theme = theme
+	}
+	return style, nil
+}
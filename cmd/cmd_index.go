@@ -0,0 +1,390 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/util"
+)
+
+const (
+	// indexVersion 索引文件格式的版本，版本不同时重新建立索引
+	indexVersion = 1
+	// indexLineMax 一行文本最多保留的字符数，进度条等不换行的输出会被截断成多行
+	indexLineMax = 512
+)
+
+// indexedLine 录像中的一行文本
+type indexedLine struct {
+	Time float64 `json:"t"`
+	Text string  `json:"s"`
+	Cmd  bool    `json:"c,omitempty"` // 由tojson识别出的命令
+}
+
+// indexedFile 已建立索引的cast文件，大小和修改时间未变时重建索引可以直接复用
+type indexedFile struct {
+	Path    string        `json:"path"`
+	Size    int64         `json:"size"`
+	ModTime time.Time     `json:"mtime"`
+	Lines   []indexedLine `json:"lines"`
+}
+
+// searchIndex 磁盘上的全文索引：Terms为倒排表，记录每个词出现的文件和行
+type searchIndex struct {
+	Version int                 `json:"version"`
+	Built   time.Time           `json:"built"`
+	Roots   []string            `json:"roots"`
+	Files   []indexedFile       `json:"files"`
+	Terms   map[string][][2]int `json:"terms"`
+}
+
+// SearchHit 一条搜索结果
+type SearchHit struct {
+	Path  string  `json:"path"`
+	Time  float64 `json:"time"`
+	Text  string  `json:"text"`
+	Cmd   bool    `json:"cmd,omitempty"`
+	exact bool
+}
+
+// DefaultIndexPath 默认的索引文件位置
+func DefaultIndexPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "acast", "index.json.gz")
+}
+
+// tokenize 将文本拆分为小写的词，建立索引和搜索时使用同样的规则
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+// textExtractor 从终端输出中提取纯文本行：去掉转义序列和控制字符，按换行切分，
+// 每行记录开始输出的时间。状态跨帧保留，转义序列被拆到两帧中也能正确处理
+type textExtractor struct {
+	lines []indexedLine
+	line  []rune
+	start float64
+	state int // 0: 文本, 1: ESC之后, 2: CSI, 3: OSC等字符串序列, 4: 字符串序列中的ESC, 5: 字符集选择
+}
+
+func (x *textExtractor) write(t float64, data []byte) {
+	for _, r := range string(data) {
+		switch x.state {
+		case 1:
+			switch r {
+			case '[':
+				x.state = 2
+			case ']', 'P', '_', '^', 'X':
+				x.state = 3
+			case '(', ')', '*', '+', '#', '%':
+				// 字符集选择，再跳过一个字符
+				x.state = 5
+			default:
+				x.state = 0
+			}
+			continue
+		case 2:
+			if r >= 0x40 && r <= 0x7e {
+				x.state = 0
+			}
+			continue
+		case 3:
+			if r == 0x07 {
+				x.state = 0
+			} else if r == 0x1b {
+				x.state = 4
+			}
+			continue
+		case 4:
+			x.state = 0
+			if r != '\\' {
+				x.state = 3
+			}
+			continue
+		case 5:
+			x.state = 0
+			continue
+		}
+		switch {
+		case r == 0x1b:
+			x.state = 1
+		case r == '\n':
+			x.flush()
+		case r == '\b':
+			if len(x.line) > 0 {
+				x.line = x.line[:len(x.line)-1]
+			}
+		case r == '\t':
+			x.add(t, ' ')
+		case unicode.IsControl(r):
+		default:
+			x.add(t, r)
+		}
+	}
+}
+
+func (x *textExtractor) add(t float64, r rune) {
+	if len(x.line) == 0 {
+		x.start = t
+	}
+	x.line = append(x.line, r)
+	if len(x.line) >= indexLineMax {
+		x.flush()
+	}
+}
+
+func (x *textExtractor) flush() {
+	if text := strings.TrimSpace(string(x.line)); text != "" {
+		x.lines = append(x.lines, indexedLine{Time: x.start, Text: text})
+	}
+	x.line = x.line[:0]
+}
+
+// extractLines 读取cast文件中所有输出的文本行，以及tojson识别出的命令
+func extractLines(fPath string, promptRe *regexp.Regexp) ([]indexedLine, error) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := asciicast.NewDecoder(f)
+	header, err := dec.Header()
+	if err != nil || header.Version < 2 {
+		return nil, errors.New("not an asciicast v2 file")
+	}
+	x := &textExtractor{}
+	for _, frame := range dec.All() {
+		if data, derr := frame.OutputData(); derr == nil && data != nil {
+			x.write(frame.Time, data)
+		}
+	}
+	if err := dec.Err(); err != nil {
+		return nil, err
+	}
+	x.flush()
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	transcribe(f, promptRe, func(c CommandOutput) error {
+		if c.Cmd != "" {
+			x.lines = append(x.lines, indexedLine{Time: c.Start, Text: c.Cmd, Cmd: true})
+		}
+		return nil
+	})
+	sort.SliceStable(x.lines, func(i, j int) bool { return x.lines[i].Time < x.lines[j].Time })
+	return x.lines, nil
+}
+
+// loadIndex 读取索引文件
+func loadIndex(path string) (*searchIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid index %s", path)
+	}
+	index := &searchIndex{}
+	if err := json.NewDecoder(zr).Decode(index); err != nil {
+		return nil, errors.Wrapf(err, "invalid index %s", path)
+	}
+	if index.Version != indexVersion {
+		return nil, errors.Errorf("index %s was built by another version, run acast index build again", path)
+	}
+	return index, nil
+}
+
+// save 先写入临时文件再改名，中断时不会留下损坏的索引
+func (index *searchIndex) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	err = json.NewEncoder(zw).Encode(index)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// buildTerms 根据所有文件的文本行重建倒排表
+func (index *searchIndex) buildTerms() {
+	index.Terms = map[string][][2]int{}
+	for fi, file := range index.Files {
+		for li, line := range file.Lines {
+			seen := map[string]bool{}
+			for _, term := range tokenize(line.Text) {
+				if !seen[term] {
+					seen[term] = true
+					index.Terms[term] = append(index.Terms[term], [2]int{fi, li})
+				}
+			}
+		}
+	}
+}
+
+// IndexBuild 为dirs目录下(递归)的所有cast文件建立全文索引，写入indexPath。
+// 已有索引中大小和修改时间未变的文件直接复用，不再重新解析
+func (r *Runner) IndexBuild(dirs []string, indexPath string) error {
+	promptRe, err := CompilePromptRegex(r.promptRegex())
+	if err != nil {
+		return err
+	}
+	previous := map[string]indexedFile{}
+	if old, err := loadIndex(indexPath); err == nil {
+		for _, file := range old.Files {
+			previous[file.Path] = file
+		}
+	}
+
+	index := &searchIndex{Version: indexVersion, Built: time.Now()}
+	reused := 0
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		files, err := findCasts(abs)
+		if err != nil {
+			return err
+		}
+		index.Roots = append(index.Roots, abs)
+		for _, path := range files {
+			fi, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			if old, ok := previous[path]; ok && old.Size == fi.Size() && old.ModTime.Equal(fi.ModTime()) {
+				index.Files = append(index.Files, old)
+				reused++
+				continue
+			}
+			lines, err := extractLines(path, promptRe)
+			if err != nil {
+				util.Warningf("Skipping %s: %v", path, err)
+				continue
+			}
+			index.Files = append(index.Files, indexedFile{Path: path, Size: fi.Size(), ModTime: fi.ModTime(), Lines: lines})
+		}
+	}
+	index.buildTerms()
+	if err := index.save(indexPath); err != nil {
+		return err
+	}
+	fmt.Printf("Indexed %d casts (%d unchanged, %d terms) into %s\n", len(index.Files), reused, len(index.Terms), indexPath)
+	return nil
+}
+
+// IndexSearch 在索引中查找包含查询中所有词的行，完整包含查询文本的结果排在前面；
+// commands为true时只查找命令，limit小于1时不限制结果数
+func (r *Runner) IndexSearch(query, indexPath string, commands bool, limit int) ([]SearchHit, error) {
+	index, err := loadIndex(indexPath)
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil, errors.Errorf("no index at %s, run acast index build <dir> first", indexPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil, errors.New("empty query")
+	}
+	// 从最短的倒排表开始求交集
+	sort.Slice(terms, func(i, j int) bool { return len(index.Terms[terms[i]]) < len(index.Terms[terms[j]]) })
+	matches := map[[2]int]bool{}
+	for _, p := range index.Terms[terms[0]] {
+		matches[p] = true
+	}
+	for _, term := range terms[1:] {
+		next := map[[2]int]bool{}
+		for _, p := range index.Terms[term] {
+			if matches[p] {
+				next[p] = true
+			}
+		}
+		matches = next
+	}
+
+	phrase := strings.ToLower(strings.TrimSpace(query))
+	hits := []SearchHit{}
+	for p := range matches {
+		file := index.Files[p[0]]
+		line := file.Lines[p[1]]
+		if commands && !line.Cmd {
+			continue
+		}
+		hits = append(hits, SearchHit{
+			Path:  file.Path,
+			Time:  line.Time,
+			Text:  line.Text,
+			Cmd:   line.Cmd,
+			exact: strings.Contains(strings.ToLower(line.Text), phrase),
+		})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.exact != b.exact {
+			return a.exact
+		}
+		if a.Cmd != b.Cmd {
+			return a.Cmd
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Time < b.Time
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// PrintSearchHits 打印搜索结果，命令以$开头，多行的命令合并为一行
+func PrintSearchHits(hits []SearchHit, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(hits)
+	}
+	for _, hit := range hits {
+		prefix := " "
+		if hit.Cmd {
+			prefix = "$"
+		}
+		fmt.Printf("%s  %9.3fs  %s %s\n", hit.Path, hit.Time, prefix, strings.ReplaceAll(hit.Text, "\n", " ↵ "))
+	}
+	return nil
+}
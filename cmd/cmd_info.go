@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/terminal"
+)
+
+// CastMarker 录像中的一个标记
+type CastMarker struct {
+	Time  float64 `json:"time"`
+	Label string  `json:"label"`
+}
+
+// CastInfo cast文件的概要信息
+type CastInfo struct {
+	Path          string                 `json:"path"`
+	Format        string                 `json:"format"`
+	Version       int                    `json:"version"`
+	Header        map[string]interface{} `json:"header"`
+	Frames        int                    `json:"frames"`
+	FrameTypes    map[string]int         `json:"frame_types"`
+	Compressed    bool                   `json:"compressed"`
+	Markers       []CastMarker           `json:"markers,omitempty"`
+	Annotations   []CastMarker           `json:"annotations,omitempty"`
+	Bells         []float64              `json:"bells,omitempty"` // 响铃的时间，没有响铃事件时从输出中检测
+	Duration      float64                `json:"duration"`
+	Commands      int                    `json:"commands,omitempty"`       // 有shell集成事件时为命令开始执行(133;C)的次数，否则为输入中主屏幕上回车的次数
+	Resizes       int                    `json:"resizes,omitempty"`        // 终端大小改变的次数
+	ExitStatus    *int                   `json:"exit_status,omitempty"`    // 退出事件中的退出码
+	UnknownFrames int                    `json:"unknown_frames,omitempty"` // 不认识的事件类型的帧数，播放和转换时跳过
+	InvalidLines  int                    `json:"invalid_lines,omitempty"`
+	InvalidAt     []int                  `json:"invalid_at,omitempty"` // 无法解析的行的行号
+
+	bellScanner terminal.BellScanner
+	outputBells []float64 // 输出中检测到的响铃时间
+	enters      int       // 输入中主屏幕上回车的次数，\r\n算一次
+	lastCR      bool      // 上一个输入字节是\r
+	altScreen   bool      // 输出当前处于备用屏幕，全屏程序(如编辑器)中的回车不是命令
+	shellStarts int       // 133;C事件的次数
+	shellEnds   int       // 133;D事件的次数
+}
+
+// altScreenSeq 进入或离开备用屏幕的序列
+var altScreenSeq = regexp.MustCompile(`\x1b\[\?(?:1049|1047|47)([hl])`)
+
+// ReadCastInfo 逐行扫描cast文件统计信息，不会把所有帧读入内存；"-"表示标准输入
+func ReadCastInfo(fPath string) (*CastInfo, error) {
+	var in io.Reader = os.Stdin
+	if fPath != StdioPath {
+		f, err := os.Open(fPath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+	dec := asciicast.NewDecoder(in)
+	first, err := dec.HeaderLine()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &CastInfo{Path: fPath, FrameTypes: map[string]int{}}
+	if err := json.Unmarshal(first, &info.Header); err != nil {
+		// asciicast v1是一个完整的JSON文档，第一行无法单独解析
+		rest, _ := io.ReadAll(dec.Remaining())
+		return info, info.readV1(append(append(first, '\n'), rest...))
+	}
+	if v, ok := info.Header["version"].(float64); ok {
+		info.Version = int(v)
+	}
+	if info.Version == 1 {
+		return info, info.readV1(first)
+	}
+	info.Format = fmt.Sprintf("asciicast v%d", info.Version)
+
+	dec.OnInvalid = func(n int, line []byte, err error) {
+		info.InvalidLines++
+		info.InvalidAt = append(info.InvalidAt, n)
+	}
+	for _, frame := range dec.All() {
+		info.addFrame(frame)
+	}
+	if err := dec.Err(); err != nil {
+		return nil, err
+	}
+	if info.FrameTypes[asciicast.BellEventType] == 0 {
+		info.Bells = info.outputBells
+	}
+	// shell集成事件准确地标出了每条命令，只在没有C事件的录像中使用D事件
+	switch {
+	case info.shellStarts > 0:
+		info.Commands = info.shellStarts
+	case info.shellEnds > 0:
+		info.Commands = info.shellEnds
+	default:
+		info.Commands = info.enters
+	}
+	return info, nil
+}
+
+func (info *CastInfo) addFrame(frame asciicast.Frame) {
+	info.Frames++
+	info.FrameTypes[frame.EventType]++
+	switch frame.EventType {
+	case asciicast.CompressedEventType:
+		info.Compressed = true
+	case asciicast.InputEventType:
+		info.countEnters(frame.EventData)
+	case asciicast.ShellEventType:
+		switch kind, _, _ := asciicast.ParseShellEvent(string(frame.EventData)); kind {
+		case "C":
+			info.shellStarts++
+		case "D":
+			info.shellEnds++
+		}
+	case asciicast.MarkerEventType:
+		info.Markers = append(info.Markers, CastMarker{Time: frame.Time, Label: string(frame.EventData)})
+	case asciicast.AnnotationEventType:
+		info.Annotations = append(info.Annotations, CastMarker{Time: frame.Time, Label: string(frame.EventData)})
+	case asciicast.OutputEventType:
+		if _, bells := info.bellScanner.Scan(frame.EventData, false); bells > 0 {
+			info.outputBells = append(info.outputBells, frame.Time)
+		}
+		if m := altScreenSeq.FindAllSubmatch(frame.EventData, -1); len(m) > 0 {
+			info.altScreen = string(m[len(m)-1][1]) == "h"
+		}
+	case asciicast.ResizeEventType:
+		info.Resizes++
+	case asciicast.ExitEventType:
+		if status, ok := frame.ExitStatus(); ok {
+			info.ExitStatus = &status
+		}
+	case asciicast.BellEventType:
+		info.Bells = append(info.Bells, frame.Time)
+	default:
+		if !asciicast.IsKnownEventType(frame.EventType) {
+			info.UnknownFrames++
+		}
+	}
+	info.Duration = math.Max(info.Duration, math.Max(frame.Time, frame.EndTime))
+}
+
+// countEnters 统计输入中的回车，\r\n只算一次，备用屏幕中的不算
+func (info *CastInfo) countEnters(data []byte) {
+	for _, b := range data {
+		if (b == '\r' || (b == '\n' && !info.lastCR)) && !info.altScreen {
+			info.enters++
+		}
+		info.lastCR = b == '\r'
+	}
+}
+
+// CommandsCounted 是否能统计命令数，即录制了输入或shell集成事件
+func (info *CastInfo) CommandsCounted() bool {
+	return info.FrameTypes[asciicast.InputEventType] > 0 || info.FrameTypes[asciicast.ShellEventType] > 0
+}
+
+// readV1 解析asciicast v1文档，v1格式的帧时间为相对上一帧的延迟
+func (info *CastInfo) readV1(data []byte) error {
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return errors.Wrap(err, "unrecognized cast format")
+	}
+	stdout, _ := doc["stdout"].([]interface{})
+	delete(doc, "stdout")
+	info.Header = doc
+	info.Version = 1
+	info.Format = "asciicast v1"
+	for _, item := range stdout {
+		frame, ok := item.([]interface{})
+		if !ok || len(frame) < 2 {
+			info.InvalidLines++
+			continue
+		}
+		delay, _ := frame[0].(float64)
+		info.Duration += delay
+		info.Frames++
+		info.FrameTypes[asciicast.OutputEventType]++
+	}
+	return nil
+}
+
+// Info 打印cast文件的头部信息和统计信息
+func (r *Runner) Info(fPath string, asJSON bool) error {
+	info, err := ReadCastInfo(fPath)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+
+	row := func(key string, value interface{}) {
+		fmt.Printf("%-16s %v\n", key+":", value)
+	}
+	row("File", info.Path)
+	row("Format", info.Format)
+	keys := make([]string, 0, len(info.Header))
+	for k := range info.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value := info.Header[k]
+		switch k {
+		case "timestamp":
+			if ts, ok := value.(float64); ok && ts > 0 {
+				value = fmt.Sprintf("%.0f (%s)", ts, time.Unix(int64(ts), 0).Format(time.RFC3339))
+			}
+		case "env", "theme", "machine", "audio":
+			data, _ := json.Marshal(value)
+			value = string(data)
+		}
+		row("Header."+k, value)
+	}
+	row("Duration", fmt.Sprintf("%.3fs", info.Duration))
+	types := make([]string, 0, len(info.FrameTypes))
+	for t, n := range info.FrameTypes {
+		types = append(types, fmt.Sprintf("%s=%d", t, n))
+	}
+	sort.Strings(types)
+	row("Frames", fmt.Sprintf("%d (%s)", info.Frames, strings.Join(types, ", ")))
+	row("Compressed", info.Compressed)
+	if info.CommandsCounted() {
+		row("Commands", info.Commands)
+	}
+	if info.Resizes > 0 {
+		row("Resizes", info.Resizes)
+	}
+	if info.ExitStatus != nil {
+		row("Exit status", *info.ExitStatus)
+	}
+	if info.UnknownFrames > 0 {
+		row("Unknown events", info.UnknownFrames)
+	}
+	if info.InvalidLines > 0 {
+		row("Invalid lines", info.InvalidLines)
+		if len(info.InvalidAt) > 0 {
+			at := make([]string, len(info.InvalidAt))
+			for i, n := range info.InvalidAt {
+				at[i] = strconv.Itoa(n)
+			}
+			fmt.Printf("  line %s\n", strings.Join(at, ", "))
+		}
+	}
+	row("Markers", len(info.Markers))
+	for _, m := range info.Markers {
+		fmt.Printf("  %10.3fs  %s\n", m.Time, m.Label)
+	}
+	if len(info.Annotations) > 0 {
+		row("Annotations", len(info.Annotations))
+		for _, a := range info.Annotations {
+			fmt.Printf("  %10.3fs  %s\n", a.Time, a.Label)
+		}
+	}
+	row("Bells", len(info.Bells))
+	for _, t := range info.Bells {
+		fmt.Printf("  %10.3fs\n", t)
+	}
+	return nil
+}
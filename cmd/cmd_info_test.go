@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCastInfoCommands(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []string
+		want   int
+	}{
+		{"enter", []string{`[1, "i", "ls\r"]`, `[2, "i", "pwd\r"]`}, 2},
+		{"crlf counts once", []string{`[1, "i", "ls\r\n"]`, `[2, "i", "pwd\r"]`, `[2.1, "i", "\n"]`}, 2},
+		{"lf", []string{`[1, "i", "ls\n"]`}, 1},
+		{"editor", []string{
+			`[1, "i", "vim\r"]`,
+			`[1.1, "o", "\u001b[?1049h"]`,
+			`[2, "i", "ihello\rworld\r"]`,
+			`[3, "o", "\u001b[?1049l$ "]`,
+			`[4, "i", "exit\r"]`,
+		}, 2},
+		{"shell integration", []string{
+			`[1, "s", "B"]`, `[1.5, "i", "ls\r\n"]`, `[1.6, "s", "C"]`, `[1.7, "s", "D;0"]`,
+			`[2, "s", "B"]`, `[2.5, "i", "\r"]`, `[2.6, "s", "D;0"]`,
+		}, 1},
+		{"only D events", []string{`[1, "s", "D;0"]`, `[2, "s", "D;1"]`}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "in.cast")
+			data := `{"version": 2, "width": 80, "height": 24}` + "\n" + strings.Join(tt.frames, "\n") + "\n"
+			if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			info, err := ReadCastInfo(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Commands != tt.want {
+				t.Errorf("Commands = %d, want %d", info.Commands, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/x6nux/asciinema/util"
+)
+
+// initCheckTimeout 检查服务器能否连接的超时时间
+const initCheckTimeout = 10 * time.Second
+
+// initWizard 逐个提问并读取回答，assumeYes时不提问，全部使用默认值
+type initWizard struct {
+	in        *bufio.Reader
+	out       io.Writer
+	assumeYes bool
+}
+
+// ask 提问并返回回答，直接回车(或输入结束)时返回def。check不为空时检查回答，不正确时重新提问
+func (w *initWizard) ask(question, def string, check func(string) error) string {
+	for {
+		fmt.Fprintf(w.out, "%s [%s]: ", util.T(question), def)
+		if w.assumeYes {
+			fmt.Fprintln(w.out)
+			return def
+		}
+		line, err := w.in.ReadString('\n')
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = def
+		}
+		if check == nil {
+			return answer
+		}
+		cerr := check(answer)
+		if cerr == nil {
+			return answer
+		}
+		fmt.Fprintf(w.out, "  %v\n", cerr)
+		if err != nil {
+			// 输入已经结束，不能再次提问
+			return def
+		}
+	}
+}
+
+// confirm 提出是非问题
+func (w *initWizard) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		answer := strings.ToLower(w.ask(question, hint, nil))
+		switch answer {
+		case "y/n":
+			return def
+		case "y", "yes", "是":
+			return true
+		case "n", "no", "否":
+			return false
+		}
+		fmt.Fprintln(w.out, "  "+util.T("Please answer y or n."))
+	}
+}
+
+// checkServerURL 服务器地址必须是http(s)地址
+func checkServerURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf(util.T("%q is not an http:// or https:// URL"), s)
+	}
+	return nil
+}
+
+// checkCompressRatio 压缩比例必须是正整数
+func checkCompressRatio(s string) error {
+	if n, err := strconv.Atoi(s); err != nil || n <= 0 {
+		return fmt.Errorf(util.T("%q is not a positive whole number"), s)
+	}
+	return nil
+}
+
+// checkServer 检查能否连接服务器，服务器返回任何非5xx的响应都算可以连接
+func checkServer(server string) error {
+	client := &http.Client{Timeout: initCheckTimeout}
+	resp, err := client.Get(strings.TrimRight(server, "/") + "/")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// Init 交互式地设置配置文件：服务器地址、录制的shell、压缩设置和录像目录，然后检查能否连接服务器，
+// 并可以立即关联账号。默认值为当前的配置，assumeYes时不提问，直接写入默认值
+func (r *Runner) Init(in io.Reader, out io.Writer, assumeYes bool) error {
+	w := &initWizard{in: bufio.NewReader(in), out: out, assumeYes: assumeYes}
+	fmt.Fprintln(out, util.Tf("Setting up acast. The answers are saved to %s.", cfg.Path))
+	fmt.Fprintln(out, util.T("Press Enter to keep the value in brackets."))
+	fmt.Fprintln(out)
+
+	server := w.ask("asciinema server URL", cfg.ApiUrl(), checkServerURL)
+	shell := w.ask("Shell to record", cfg.RecordCommand(), nil)
+	compress := w.confirm("Compress repeated output in recordings", !cfg.RecordDisableCompress())
+	ratio := strconv.Itoa(r.CompressRatio)
+	if compress {
+		ratio = w.ask("Compression ratio, higher compresses more", ratio, checkCompressRatio)
+	}
+	dir := w.ask("Directory for new recordings, - for the current directory", util.FirstNonBlank(cfg.File.Record.Dir, "-"), nil)
+	if dir == "-" {
+		dir = ""
+	}
+
+	values := []struct{ section, key, value string }{
+		{"api", "url", server},
+		{"record", "command", shell},
+		{"record", "disable-compress", strconv.FormatBool(!compress)},
+		{"record", "compress-ratio", ratio},
+		{"record", "dir", dir},
+	}
+	for _, v := range values {
+		if err := cfg.SetValue(v.section, v.key, v.value); err != nil {
+			return err
+		}
+	}
+	updated, err := util.GetConfig(env)
+	if err != nil {
+		return err
+	}
+	cfg = updated
+	r.RecordDir = cfg.RecordDir()
+	if r.RecordDir != "" {
+		if err := os.MkdirAll(r.RecordDir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, util.Tf("Saved %s.", cfg.Path))
+
+	fmt.Fprintln(out, util.Tf("Checking %s ...", cfg.ApiUrl()))
+	if err := checkServer(cfg.ApiUrl()); err != nil {
+		fmt.Fprintln(out, util.Tf("Could not reach the server: %v. Uploads will fail until it is reachable.", err))
+		return nil
+	}
+	fmt.Fprintln(out, util.T("The server is reachable."))
+
+	if w.confirm("Link this machine with your asciinema account now", false) {
+		authURL, text := r.Auth()
+		fmt.Fprintln(out, text)
+		if err := util.CopyToClipboard(authURL); err == nil {
+			fmt.Fprintln(out, util.T("The URL was copied to the clipboard."))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/util"
+)
+
+// Narrate 为录像附加旁白音频，记录到头部的audio字段；audioPath为空时删除已有的音频
+func (r *Runner) Narrate(castPath, audioPath string, offset float64) error {
+	c, err := readCast(castPath)
+	if err != nil {
+		return err
+	}
+	if audioPath == "" {
+		c.Audio = nil
+	} else {
+		if _, err := os.Stat(audioPath); err != nil {
+			return err
+		}
+		c.Audio = &asciicast.Audio{File: audioRef(castPath, audioPath), Offset: offset}
+	}
+	if !r.NoBackup && backupEnabled() {
+		if _, err := backupFile(castPath); err != nil {
+			return err
+		}
+	}
+	return writeCast(castPath, c)
+}
+
+// audioRef 尽量使用相对于录像所在目录的路径，移动整个目录后引用仍然有效
+func audioRef(castPath, audioPath string) string {
+	castDir, err1 := filepath.Abs(filepath.Dir(castPath))
+	audio, err2 := filepath.Abs(audioPath)
+	if err1 != nil || err2 != nil {
+		return audioPath
+	}
+	if rel, err := filepath.Rel(castDir, audio); err == nil && !filepath.IsAbs(rel) {
+		return filepath.ToSlash(rel)
+	}
+	return audio
+}
+
+// audioPlayer 播放旁白音频的外部程序
+type audioPlayer struct {
+	name    string
+	canSeek bool // 是否支持从音频中间开始播放
+	args    func(path string, seek, speed float64) []string
+}
+
+var audioPlayers = []audioPlayer{
+	{"mpv", true, func(path string, seek, speed float64) []string {
+		return []string{"--no-video", "--really-quiet", "--start=" + formatSeconds(seek), "--speed=" + formatSeconds(speed), path}
+	}},
+	{"ffplay", true, func(path string, seek, speed float64) []string {
+		return []string{"-nodisp", "-autoexit", "-loglevel", "quiet", "-ss", formatSeconds(seek), "-af", "atempo=" + formatSeconds(speed), path}
+	}},
+	{"afplay", false, func(path string, seek, speed float64) []string {
+		return []string{"-r", formatSeconds(speed), path}
+	}},
+}
+
+func formatSeconds(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// narration 与播放同步的旁白音频
+type narration struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	cmd     *exec.Cmd
+	stopped bool
+}
+
+// startNarration 按录像的audio字段开始播放旁白音频。播放器从第一帧开始播放，
+// 因此音频的开始时间以第一帧为基准。没有音频或找不到音频播放程序时返回nil
+func startNarration(castPath string, c *asciicast.Asciicast, speed float64) *narration {
+	if c.Audio == nil || len(c.Stdout) == 0 {
+		return nil
+	}
+	path := c.Audio.Path(castPath)
+	if _, err := os.Stat(path); err != nil {
+		util.Warningf("Narration audio not found: %v", err)
+		return nil
+	}
+	// 正数表示音频需要延迟开始，负数表示需要跳过音频的开头
+	start := c.Audio.Offset - c.Stdout[0].Time
+	for _, p := range audioPlayers {
+		if start < 0 && !p.canSeek {
+			continue
+		}
+		bin, err := exec.LookPath(p.name)
+		if err != nil {
+			continue
+		}
+		n := &narration{cmd: exec.Command(bin, p.args(path, max(-start, 0), speed)...)}
+		if start > 0 {
+			n.timer = time.AfterFunc(time.Duration(start/speed*float64(time.Second)), n.run)
+		} else {
+			n.run()
+		}
+		return n
+	}
+	util.Warningf("No audio player found (mpv, ffplay or afplay), playing without narration.")
+	return nil
+}
+
+func (n *narration) run() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped {
+		return
+	}
+	if err := n.cmd.Start(); err != nil {
+		util.Warningf("Failed to play narration: %v", err)
+	}
+}
+
+// stop 结束音频播放
+func (n *narration) stop() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.stopped = true
+	if n.timer != nil {
+		n.timer.Stop()
+	}
+	if n.cmd.Process != nil {
+		n.cmd.Process.Kill()
+		n.cmd.Wait()
+	}
+}
+
+// narrationArgs 返回将旁白音频混入视频的ffmpeg参数。视频从录像的start时刻开始，
+// 按speed倍速播放，音频也要做相同的裁剪和变速
+func narrationArgs(castPath string, audio *asciicast.Audio, start, speed float64) ([]string, error) {
+	path := audio.Path(castPath)
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	var args []string
+	// 正数表示音频在视频开始后才开始，负数表示跳过音频的开头
+	delay := audio.Offset - start
+	if delay < 0 {
+		args = append(args, "-ss", formatSeconds(-delay))
+	}
+	args = append(args, "-i", path, "-map", "0:v", "-map", "1:a", "-c:a", "aac")
+	var filters []string
+	if speed != 1 {
+		filters = append(filters, "atempo="+formatSeconds(speed))
+	}
+	if delay > 0 {
+		filters = append(filters, fmt.Sprintf("adelay=delays=%d:all=1", int(delay/speed*1000)))
+	}
+	if len(filters) > 0 {
+		args = append(args, "-af", strings.Join(filters, ","))
+	}
+	return args, nil
+}
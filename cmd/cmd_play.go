@@ -2,55 +2,207 @@ package cmd
 
 import (
 	"bufio"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/x6nux/asciinema/asciicast"
 	"github.com/x6nux/asciinema/commands"
+	"github.com/x6nux/asciinema/terminal"
+	"github.com/x6nux/asciinema/util"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/term"
 )
 
+// clearScreen 清屏并将光标移到左上角
+const clearScreen = "\x1b[2J\x1b[H"
+
 func (r *Runner) Play() error {
 	r.loadFile()
-	cmd := commands.NewPlayCommand()
-	r.MaxWait = 3.0
-	return cmd.Execute(r.Cast, r.MaxWait)
+	tee, err := r.openTee()
+	if err != nil {
+		return err
+	}
+	if tee != nil {
+		defer tee.Close()
+	}
+	return r.playCast(r.FilePath, r.Cast, r.newPlayProfile(), tee)
 }
 
-func (r *Runner) loadFile() {
-	f, err := os.Open(r.FilePath)
+// openTee 打开--tee指定的文件，未指定时返回nil
+func (r *Runner) openTee() (io.WriteCloser, error) {
+	if r.Tee == "" {
+		return nil, nil
+	}
+	return os.Create(r.Tee)
+}
+
+// playCast 播放一个录像，有旁白音频时同步播放，tee不为nil时将输出复制到其中。
+// prof不为nil时记录每帧的耗时，播放结束后输出到标准错误
+func (r *Runner) playCast(fPath string, cast *asciicast.Asciicast, prof *terminal.PlaybackProfile, tee io.Writer) (err error) {
+	end := traceOperation("play", attribute.String("acast.file", fPath))
+	defer func() { end(err) }()
+	bell, err := terminal.ParseBellMode(r.Bell)
+	if err != nil {
+		return err
+	}
+	images, err := terminal.ParseImageMode(r.Images)
 	if err != nil {
-		log.Fatalf("open file failed: %v", r.FilePath)
+		return err
+	}
+	cmd := commands.NewPlayCommand(terminal.PlayOptions{
+		AltScreen:      r.AltScreen,
+		Force:          r.Force,
+		Resize:         r.TryResize,
+		PauseOnMarkers: r.PauseOnMarkers,
+		Tee:            tee,
+		Unsafe:         r.Unsafe,
+		Bell:           bell,
+		Images:         images,
+		Profile:        prof,
+	})
+	if r.MaxChunk > 0 {
+		chunked := *cast
+		if chunked.Stdout, err = asciicast.SplitFrames(cast.Stdout, r.MaxChunk); err != nil {
+			return err
+		}
+		cast = &chunked
+	}
+	r.MaxWait = 3.0
+	var audio *narration
+	if !r.NoAudio {
+		audio = startNarration(fPath, cast, r.MaxWait)
+	}
+	start := time.Now()
+	err = cmd.Execute(cast, r.MaxWait)
+	audio.stop()
+	if prof != nil && (err == nil || errors.Is(err, terminal.ErrInterrupted)) {
+		printPlayProfile(os.Stderr, fPath, prof, time.Since(start))
+	}
+	if errors.Is(err, terminal.ErrInterrupted) {
+		// 与收到中断信号时的处理一致
+		end(err)
+		util.RunCleanups()
 		os.Exit(1)
 	}
-	defer f.Close()
-	fileScanner := bufio.NewScanner(f)
-	fileScanner.Split(bufio.ScanLines)
-	header := &asciicast.Header{}
-	frameList := make([]asciicast.Frame, 0)
-	i := 0
-	for fileScanner.Scan() {
-		i++
-		if i == 1 {
-			json.Unmarshal(fileScanner.Bytes(), header)
-		} else {
-			frame := asciicast.Frame{}
-			if err := frame.UnmarshalJSON(fileScanner.Bytes()); err == nil {
-				frameList = append(frameList, frame)
+	return err
+}
+
+// PlayList 依次播放多个录像，参数可以是cast文件或.m3u/.m3u8播放列表。
+// loop为true时循环播放直到被中断，shuffle为true时每一轮都打乱顺序。
+// 无法播放的录像会被跳过，一轮中全部失败时返回错误
+func (r *Runner) PlayList(items []string, loop, shuffle bool) error {
+	paths, err := expandPlaylist(items)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("playlist is empty")
+	}
+	tee, err := r.openTee()
+	if err != nil {
+		return err
+	}
+	if tee != nil {
+		defer tee.Close()
+	}
+	if len(paths) == 1 && !loop {
+		cast, prof, err := r.loadPlayCast(paths[0])
+		if err != nil {
+			return err
+		}
+		return r.playCast(paths[0], cast, prof, tee)
+	}
+	clearBetween := term.IsTerminal(int(os.Stdout.Fd()))
+	first := true
+	for {
+		if shuffle {
+			rand.Shuffle(len(paths), func(i, j int) { paths[i], paths[j] = paths[j], paths[i] })
+		}
+		played := 0
+		var lastErr error
+		for _, p := range paths {
+			cast, prof, err := r.loadPlayCast(p)
+			if err == nil {
+				if !first && clearBetween {
+					os.Stdout.WriteString(clearScreen)
+				}
+				first = false
+				err = r.playCast(p, cast, prof, tee)
 			}
+			if err != nil {
+				util.Warningf("Skipping %s: %v", p, err)
+				lastErr = err
+				continue
+			}
+			played++
+		}
+		if played == 0 {
+			return fmt.Errorf("no item of the playlist could be played: %v", lastErr)
+		}
+		if !loop {
+			return nil
 		}
 	}
+}
+
+// isPlaylist 判断是否为播放列表文件
+func isPlaylist(fPath string) bool {
+	ext := strings.ToLower(filepath.Ext(fPath))
+	return ext == ".m3u" || ext == ".m3u8"
+}
 
-	if r.Cast == nil {
-		r.Cast = &asciicast.Asciicast{}
+// expandPlaylist 将参数中的播放列表展开为录像路径
+func expandPlaylist(items []string) ([]string, error) {
+	var paths []string
+	for _, item := range items {
+		if !isPlaylist(item) {
+			paths = append(paths, item)
+			continue
+		}
+		entries, err := readPlaylist(item)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, entries...)
+	}
+	return paths, nil
+}
+
+// readPlaylist 读取类似m3u格式的播放列表：每行一个录像路径或地址，
+// 以#开头的行(包括#EXTM3U、#EXTINF)为注释，相对路径以播放列表所在目录为基准
+func readPlaylist(fPath string) ([]string, error) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dir := filepath.Dir(fPath)
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.Contains(line, "://") && !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+		paths = append(paths, line)
+	}
+	return paths, scanner.Err()
+}
+
+func (r *Runner) loadFile() {
+	cast, err := readCast(r.FilePath)
+	if err != nil {
+		log.Fatalf("open file failed: %v, %v", r.FilePath, err)
 	}
-	r.Cast.Version = header.Version
-	r.Cast.Width = header.Width
-	r.Cast.Height = header.Height
-	r.Cast.Duration = header.Duration
-	r.Cast.Timestamp = header.Timestamp
-	r.Cast.Command = header.Command
-	r.Cast.Title = header.Title
-	r.Cast.Env = header.Env
-	r.Cast.Stdout = frameList
+	r.Cast = cast
 }
@@ -7,7 +7,6 @@ import (
 	"strings"
 
 	"github.com/gvcgo/asciinema-edit/cast"
-	"github.com/gvcgo/asciinema-edit/commands/transformer"
 	"github.com/gvcgo/asciinema-edit/editor"
 	"github.com/pkg/errors"
 )
@@ -99,7 +98,14 @@ func parseQuantizeRanges(inputs []string) (ranges []editor.QuantizeRange, err er
 	return
 }
 
-func (r *Runner) Quantize(inFilePath, outFilePath string, ranges []string) (err error) {
+// Quantize 按量化区间调整帧间隔；"-"表示标准输入/标准输出
+func (r *Runner) Quantize(inFilePath, outFilePath string, ranges []string) error {
+	return r.withStdio(inFilePath, outFilePath, func(in, out string) error {
+		return r.quantize(in, out, ranges)
+	})
+}
+
+func (r *Runner) quantize(inFilePath, outFilePath string, ranges []string) (err error) {
 	if len(ranges) == 0 {
 		return fmt.Errorf("a range must be specified")
 	}
@@ -108,15 +114,8 @@ func (r *Runner) Quantize(inFilePath, outFilePath string, ranges []string) (err
 	if err != nil {
 		return
 	}
-	var t *transformer.Transformer
-	t, err = transformer.New(transformation, inFilePath, outFilePath)
-	if err != nil {
-		return
-	}
-	defer t.Close()
-	err = t.Transform()
-	if err == nil {
-		FixHeaderForEditOperations(inFilePath, outFilePath)
-	}
-	return err
+	return r.edit(inFilePath, outFilePath, []editOp{{
+		line:           "quantize",
+		transformation: transformation,
+	}})
 }
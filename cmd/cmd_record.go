@@ -5,17 +5,19 @@ import (
 	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
-	"os/signal"
 	"runtime"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/olivere/ndjson"
 	"github.com/x6nux/asciinema/asciicast"
 	"github.com/x6nux/asciinema/commands"
 	"github.com/x6nux/asciinema/util"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // 获取当前时间的毫秒值
@@ -27,6 +29,7 @@ func currentTimeMs() int64 {
 type StreamWriter struct {
 	file           *os.File
 	writer         *ndjson.Writer
+	header         *asciicast.Header // 头部信息，关闭时回填后重写
 	mu             sync.Mutex
 	written        bool
 	filePath       string
@@ -61,6 +64,7 @@ func NewStreamWriter(filepath string, header *asciicast.Header) (*StreamWriter,
 	return &StreamWriter{
 		file:           file,
 		writer:         ndjson.NewWriter(file),
+		header:         header,
 		written:        true,
 		filePath:       filepath,
 		lastSyncTime:   0,
@@ -127,7 +131,7 @@ func (sw *StreamWriter) flushBatchFrames() error {
 	// 如果不启用压缩或帧数太少，直接写入
 	if !sw.enableCompress || len(sw.batchFrames) < sw.minBatchSize {
 		for _, frame := range sw.batchFrames {
-			if err := sw.writer.Encode([]interface{}{frame.Time, "o", string(frame.EventData)}); err != nil {
+			if err := sw.writer.Encode([]interface{}{asciicast.EncodeTime(frame.Time), asciicast.OutputEventType, string(frame.EventData)}); err != nil {
 				return err
 			}
 		}
@@ -201,7 +205,7 @@ func (sw *StreamWriter) flushBatchFrames() error {
 		// 对于非常小的组，直接写入不压缩
 		if len(group) < sw.minBatchSize {
 			for _, frame := range group {
-				if err := sw.writer.Encode([]interface{}{frame.Time, "o", string(frame.EventData)}); err != nil {
+				if err := sw.writer.Encode([]interface{}{asciicast.EncodeTime(frame.Time), asciicast.OutputEventType, string(frame.EventData)}); err != nil {
 					return err
 				}
 			}
@@ -224,7 +228,7 @@ func (sw *StreamWriter) flushBatchFrames() error {
 		if err != nil {
 			// 压缩失败，降级为普通写入
 			for _, frame := range group {
-				if err := sw.writer.Encode([]interface{}{frame.Time, "o", string(frame.EventData)}); err != nil {
+				if err := sw.writer.Encode([]interface{}{asciicast.EncodeTime(frame.Time), asciicast.OutputEventType, string(frame.EventData)}); err != nil {
 					return err
 				}
 			}
@@ -250,7 +254,7 @@ func (sw *StreamWriter) flushBatchFrames() error {
 			compressFrame := asciicast.Frame{
 				Time:      startTime,
 				EndTime:   endTime,
-				EventType: "z",
+				EventType: asciicast.CompressedEventType,
 				EventData: []byte(encoded),
 			}
 
@@ -259,7 +263,7 @@ func (sw *StreamWriter) flushBatchFrames() error {
 			if err != nil {
 				// JSON编码失败，降级为普通写入
 				for _, frame := range group {
-					if err := sw.writer.Encode([]interface{}{frame.Time, "o", string(frame.EventData)}); err != nil {
+					if err := sw.writer.Encode([]interface{}{asciicast.EncodeTime(frame.Time), asciicast.OutputEventType, string(frame.EventData)}); err != nil {
 						return err
 					}
 				}
@@ -275,7 +279,7 @@ func (sw *StreamWriter) flushBatchFrames() error {
 		} else {
 			// 压缩效果不好，使用原始数据
 			for _, frame := range group {
-				if err := sw.writer.Encode([]interface{}{frame.Time, "o", string(frame.EventData)}); err != nil {
+				if err := sw.writer.Encode([]interface{}{asciicast.EncodeTime(frame.Time), asciicast.OutputEventType, string(frame.EventData)}); err != nil {
 					return err
 				}
 			}
@@ -291,6 +295,15 @@ func (sw *StreamWriter) flushBatchFrames() error {
 func (sw *StreamWriter) WriteFrame(frame asciicast.Frame) error {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
+	metricFramesWritten.Add(1)
+
+	// 非输出事件不参与批量压缩，先写出缓冲的帧以保持时间顺序
+	if frame.EventType != asciicast.OutputEventType {
+		if err := sw.flushBatchFrames(); err != nil {
+			return err
+		}
+		return sw.writer.Encode([]interface{}{asciicast.EncodeTime(frame.Time), frame.EventType, string(frame.EventData)})
+	}
 
 	// 如果启用压缩，则将帧添加到批处理缓冲区
 	if sw.enableCompress {
@@ -318,15 +331,17 @@ func (sw *StreamWriter) WriteFrame(frame asciicast.Frame) error {
 		}
 	} else {
 		// 不启用压缩，直接写入
-		if err := sw.writer.Encode([]interface{}{frame.Time, "o", string(frame.EventData)}); err != nil {
+		if err := sw.writer.Encode([]interface{}{asciicast.EncodeTime(frame.Time), asciicast.OutputEventType, string(frame.EventData)}); err != nil {
 			return err
 		}
+		sw.lastWriteTime = frame.Time
 	}
 
 	// 基于时间的同步策略，减少file.Sync()调用频率
 	currentTime := currentTimeMs()
 	if currentTime-sw.lastSyncTime >= sw.syncIntervalMs {
 		sw.file.Sync()
+		metricFsyncs.Add(1)
 		sw.lastSyncTime = currentTime
 	}
 
@@ -346,21 +361,268 @@ func (sw *StreamWriter) Close() error {
 
 		// 最后一次刷新确保所有数据写入磁盘
 		sw.file.Sync()
+		metricFsyncs.Add(1)
 		err := sw.file.Close()
+		sw.file = nil
 		// 关闭后立即修复文件格式
 		FixCast(sw.filePath)
+		// 回填时长后重写头部信息
+		if sw.header != nil {
+			if sw.header.Duration == 0 {
+				sw.header.Duration = asciicast.Duration(sw.lastWriteTime)
+			}
+			if herr := RewriteHeader(sw.filePath, sw.header); err == nil {
+				err = herr
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// groupFrames 按时间连续性和内容相似度将输出帧分组，每组压缩为一个压缩帧
+func groupFrames(frames []asciicast.Frame, minBatchSize, maxBatchSize, targetBatchSize int) [][]asciicast.Frame {
+	groups := make([][]asciicast.Frame, 0)
+	if len(frames) > 0 {
+		currentGroup := []asciicast.Frame{frames[0]}
+
+		for i := 1; i < len(frames); i++ {
+			// 检查时间连续性和内容相似度
+			timeDiff := frames[i].Time - frames[i-1].Time
+			contentSim := contentSimilarity(frames[i].EventData, frames[i-1].EventData)
+
+			// 当前组大小控制
+			currentGroupSize := 0
+			for _, f := range currentGroup {
+				currentGroupSize += len(f.EventData)
+			}
+
+			// 如果时间接近且内容相似度高，且组大小未超限，则加入当前组
+			if timeDiff < 1.0 && contentSim > 0.5 && len(currentGroup) < maxBatchSize && currentGroupSize < 32768 {
+				currentGroup = append(currentGroup, frames[i])
+			} else {
+				// 如果当前组小于最小大小但时间差不大，尝试继续添加
+				if len(currentGroup) < minBatchSize && timeDiff < 0.5 {
+					currentGroup = append(currentGroup, frames[i])
+				} else {
+					// 否则，创建新组
+					if len(currentGroup) > 0 {
+						groups = append(groups, currentGroup)
+					}
+					currentGroup = []asciicast.Frame{frames[i]}
+				}
+			}
+		}
+
+		// 添加最后一组
+		if len(currentGroup) > 0 {
+			groups = append(groups, currentGroup)
+		}
+
+		// 合并小组
+		if len(groups) > 1 {
+			optimizedGroups := make([][]asciicast.Frame, 0)
+			currentMergedGroup := make([]asciicast.Frame, 0)
+
+			for _, group := range groups {
+				// 如果当前合并组加上新组的大小适中，则合并
+				if len(currentMergedGroup)+len(group) <= targetBatchSize*2 {
+					currentMergedGroup = append(currentMergedGroup, group...)
+				} else {
+					// 如果合并后超过目标大小的2倍，则先保存当前合并组
+					if len(currentMergedGroup) > 0 {
+						optimizedGroups = append(optimizedGroups, currentMergedGroup)
+					}
+					// 检查新组的大小
+					if len(group) >= minBatchSize {
+						optimizedGroups = append(optimizedGroups, group)
+						currentMergedGroup = make([]asciicast.Frame, 0)
+					} else {
+						currentMergedGroup = group
+					}
+				}
+			}
+
+			// 添加最后一个合并组
+			if len(currentMergedGroup) > 0 {
+				optimizedGroups = append(optimizedGroups, currentMergedGroup)
+			}
+
+			groups = optimizedGroups
+		}
+	}
+	return groups
+}
+
+// 解析KEY=VAL形式的环境变量
+func parseEnvSet(list []string) (map[string]string, error) {
+	result := make(map[string]string, len(list))
+	for _, kv := range list {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			return nil, fmt.Errorf("invalid env %q, must be KEY=VAL", kv)
+		}
+		result[pair[0]] = pair[1]
+	}
+	return result, nil
+}
+
+// 根据选项将注入的环境变量记录到头部
+func (r *Runner) headerEnv(e *asciicast.Env, extra map[string]string) *asciicast.Env {
+	if e == nil || !r.EnvRecord || len(extra) == 0 {
+		return e
+	}
+	e.Extra = extra
+	return e
+}
+
+// fixSize 按--cols/--rows固定被录制程序的终端大小，只指定一个时另一个取真实终端的大小
+func (r *Runner) fixSize(recorder asciicast.Recorder) error {
+	if r.Cols < 0 || r.Rows < 0 {
+		return fmt.Errorf("invalid size %dx%d", r.Cols, r.Rows)
+	}
+	if r.Cols == 0 && r.Rows == 0 {
+		return nil
+	}
+	cols, rows := r.Cols, r.Rows
+	if cols == 0 || rows == 0 {
+		realRows, realCols, err := recorder.GetTerminalSize()
+		if err != nil {
+			return fmt.Errorf("cannot get the terminal size, please give both --cols and --rows: %v", err)
+		}
+		if cols == 0 {
+			cols = realCols
+		}
+		if rows == 0 {
+			rows = realRows
+		}
+	}
+	recorder.SetSize(cols, rows)
+	return nil
+}
+
+// deterministicPrecision --deterministic录制时帧时间取整的精度
+const deterministicPrecision = 100 * time.Millisecond
+
+// setTiming --deterministic时将帧时间取整，同样的输入(如脚本)多次录制得到相同的录像
+func (r *Runner) setTiming(recorder asciicast.Recorder) {
+	if r.Deterministic {
+		recorder.SetPrecision(deterministicPrecision)
+	}
+}
+
+// timestamp 返回头部的录制时间，--deterministic时不记录
+func (r *Runner) timestamp(ts int64) int64 {
+	if r.Deterministic {
+		return 0
+	}
+	return ts
+}
+
+func (r *Runner) Rec() (err error) {
+	end := traceOperation("record", attribute.String("acast.file", r.FilePath), attribute.Bool("acast.stream_write", r.StreamWrite))
+	defer func() { end(err) }()
+	if asciicast.IsRecording(env) && !r.Force {
+		return fmt.Errorf(util.T("already recording in this terminal (%s is set), use --force to start a nested recording"), asciicast.RecEnv)
+	}
+	pre, post, err := r.recordHooks()
+	if err != nil {
+		return err
+	}
+	command := r.recordCommand()
+	if err := runRecordHooks(PreRecordHook, pre, r.hookPath(), r.hookEnv(command)); err != nil {
+		return err
+	}
+	if err := r.record(command); err != nil {
+		return err
+	}
+	if r.AutoTitle {
+		if err := r.setAutoTitle(); err != nil {
+			util.Warningf("Could not set the title from the first command: %v", err)
+		}
+	}
+	if err := runRecordHooks(PostRecordHook, post, r.hookPath(), r.hookEnv(command)); err != nil {
+		// 录像已经保存，安静模式下也提示钩子失败
+		util.PrintWarning("%v", err)
+	}
+	return nil
+}
+
+// autoTitleMax 自动标题的最大字符数，更长的命令截断
+const autoTitleMax = 80
+
+// setAutoTitle 以录像中识别出的第一条命令(第一行)作为标题写入头部，没有识别出命令时保留原来的标题
+func (r *Runner) setAutoTitle() error {
+	promptRe, err := CompilePromptRegex(r.promptRegex())
+	if err != nil {
+		return err
+	}
+	if r.Cast == nil {
+		return nil
+	}
+	command := firstCommand(r.Cast.Width, r.Cast.Height, r.Cast.Stdout, promptRe)
+	if command == "" {
+		return nil
+	}
+	title, _, _ := strings.Cut(strings.TrimSpace(command), "\n")
+	if runes := []rune(title); len(runes) > autoTitleMax {
+		title = string(runes[:autoTitleMax-3]) + "..."
+	}
+	f, err := os.Open(r.FilePath)
+	if err != nil {
+		return err
+	}
+	header, err := asciicast.NewDecoder(f).Header()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	header.Title = title
+	if err := RewriteHeader(r.FilePath, header); err != nil {
 		return err
 	}
+	r.Title, r.Cast.Title = title, title
 	return nil
 }
 
-func (r *Runner) Rec() error {
+// recordCommand 返回录制的命令：--command、配置文件[record]中的command、$SHELL，Windows上默认为PowerShell
+func (r *Runner) recordCommand() string {
 	command := "C:\\WINDOWS\\System32\\WindowsPowerShell\\v1.0\\powershell.exe"
 	if ok, _ := util.PathIsExist(command); !ok {
 		command = "powershell.exe"
 	}
-	if runtime.GOOS != "windows" {
-		command = util.FirstNonBlank(os.Getenv("SHELL"), cfg.RecordCommand())
+	// 配置文件[record]中的command优先于$SHELL，与官方asciinema相同
+	if runtime.GOOS != "windows" || cfg.File.Record.Command != "" {
+		command = cfg.RecordCommand()
+	}
+	if r.Command != "" {
+		command = r.Command
+	}
+	return command
+}
+
+// record 录制command并写入r.FilePath
+func (r *Runner) record(command string) error {
+	extraEnv, err := parseEnvSet(r.EnvSet)
+	if err != nil {
+		return err
+	}
+	backpressure, err := checkBackpressure(r.Backpressure)
+	if err != nil {
+		return err
+	}
+	r.Backpressure = backpressure
+	machine, err := asciicast.NewMachine(r.Meta)
+	if err != nil {
+		return err
+	}
+	filters := r.Filters
+	if r.BellEvents {
+		filters = append(filters[:len(filters):len(filters)], "bell")
+	}
+	filter, err := asciicast.ParseFrameFilters(filters)
+	if err != nil {
+		return err
 	}
 
 	if r.Quite {
@@ -369,11 +631,108 @@ func (r *Runner) Rec() error {
 	}
 
 	cmd := commands.NewRecordCommand(env)
+	cmd.Recorder.SetExtraEnv(r.EnvSet)
+	cmd.Recorder.SetFilter(filter)
+	cmd.Recorder.SetCaptureMouse(r.CaptureMouse)
+	cmd.Recorder.SetCapturePaste(r.CapturePaste)
+	r.setTiming(cmd.Recorder)
+	if err := r.fixSize(cmd.Recorder); err != nil {
+		return err
+	}
+	mirror, closeMirrors, err := openMirrors(r.Mirror)
+	if err != nil {
+		return fmt.Errorf("cannot open the mirror: %v", err)
+	}
+	defer closeMirrors()
+	var input chan []byte
+	if r.AllowInput && r.NoAttach {
+		return fmt.Errorf("--allow-input needs attach, it cannot be used with --no-attach")
+	}
+	if !r.NoAttach {
+		token := ""
+		if r.AllowInput {
+			token = newSessionToken()
+		}
+		rows, cols, _ := cmd.Recorder.GetTerminalSize()
+		sink, err := newSessionSink(r.Title, asciicast.Header{
+			Version:   2,
+			Width:     cols,
+			Height:    rows,
+			Timestamp: time.Now().Unix(),
+			Command:   command,
+			Title:     r.Title,
+		}, token, r.FilePath+".input.log")
+		if err != nil && r.AllowInput {
+			return fmt.Errorf("cannot start the session for --allow-input: %v", err)
+		}
+		if err != nil {
+			util.Warningf("Live viewing with attach is not available: %v", err)
+		} else {
+			defer sink.Close()
+			recordStatus.Lock()
+			recordStatus.sink = sink
+			recordStatus.Unlock()
+			util.Printf("Watch live with: acast attach %s", sink.name)
+			if r.AllowInput {
+				util.Warningf("Viewers can type into this session with: acast attach --input --token %s %s", token, sink.name)
+				util.Warningf("Their input is logged to %s.", sink.audit)
+				input = sink.input
+			}
+			if mirror != nil {
+				mirror = io.MultiWriter(mirror, sink)
+			} else {
+				mirror = sink
+			}
+		}
+	}
+	if r.MetricsAddr != "" {
+		addr, stop, err := serveMetrics(r.MetricsAddr)
+		if err != nil {
+			return fmt.Errorf("cannot serve the metrics: %v", err)
+		}
+		defer stop()
+		util.Printf("Metrics at http://%s/debug/vars", addr)
+		if mirror != nil {
+			mirror = io.MultiWriter(mirror, metricsWriter{})
+		} else {
+			mirror = metricsWriter{}
+		}
+	}
+	if r.Syslog != "" {
+		session := newSessionToken()
+		forward, err := newSyslogWriter(r.Syslog, session)
+		if err != nil {
+			return fmt.Errorf("cannot connect to syslog: %v", err)
+		}
+		defer forward.Close()
+		util.Printf("Forwarding output to syslog %s, session %s", r.Syslog, session)
+		if mirror != nil {
+			mirror = io.MultiWriter(mirror, forward)
+		} else {
+			mirror = forward
+		}
+	}
+	cmd.Recorder.SetMirror(mirror)
+	if input != nil {
+		cmd.Recorder.SetInput(input)
+	}
 
 	// 如果开启流式写入，需要修改Recorder接口以支持回调
 	if r.StreamWrite {
 		// 创建自定义的StreamRecorder
 		streamRecorder := commands.NewStreamRecordCommand(env)
+		streamRecorder.Recorder.SetExtraEnv(r.EnvSet)
+		streamRecorder.Recorder.SetFilter(filter)
+		streamRecorder.Recorder.SetCaptureMouse(r.CaptureMouse)
+		streamRecorder.Recorder.SetCapturePaste(r.CapturePaste)
+		r.setTiming(streamRecorder.Recorder)
+		if err := r.fixSize(streamRecorder.Recorder); err != nil {
+			return err
+		}
+		streamRecorder.Recorder.SetMirror(mirror)
+		if input != nil {
+			streamRecorder.Recorder.SetInput(input)
+		}
 
 		// 构建header
 		rows, cols, _ := streamRecorder.Recorder.GetTerminalSize()
@@ -383,7 +742,10 @@ func (r *Runner) Rec() error {
 			Title:     r.Title,
 			Width:     cols,
 			Height:    rows,
-			Timestamp: 0, // 会在实际录制开始时更新
+			Timestamp: r.timestamp(time.Now().Unix()),
+			Env:       r.headerEnv(asciicast.NewEnv(command, env), extraEnv),
+			Theme:     asciicast.QueryTheme(),
+			Machine:   machine,
 		}
 
 		// 创建流式写入器
@@ -408,59 +770,55 @@ func (r *Runner) Rec() error {
 			streamWriter.batchSize = r.CompressRatio // 使用压缩比例作为批处理大小
 		}
 
-		// 使用defer确保无论如何退出都会关闭文件并修复格式
-		defer func() {
+		// 录制的输出经过队列写入文件，写入跟不上时按照--backpressure处理
+		queue := newFrameQueue(r.Backpressure, frameQueueSize, func(frame asciicast.Frame) error {
+			// 捕获写入过程中的任何可能异常
+			defer func() {
+				if r := recover(); r != nil {
+					// 如果写入过程中panic，确保文件被修复
+					streamWriter.Close()
+					FixCast(streamWriter.filePath)
+				}
+			}()
+
+			return streamWriter.WriteFrame(frame)
+		})
+
+		recordStatus.Lock()
+		recordStatus.file, recordStatus.queue = r.FilePath, queue
+		recordStatus.Unlock()
+
+		// 无论正常结束还是被SIGINT、SIGTERM、SIGHUP中断，都写完队列中的帧、关闭文件并修复格式
+		closeWriter := func() {
+			queue.Close()
 			streamWriter.Close()
 			// 再次修复文件格式，以应对任何情况
 			FixCast(r.FilePath)
-		}()
-
-		// 设置信号处理，捕获退出信号以修复文件格式
-		signalChan := make(chan os.Signal, 1)
-		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
-
-		// 创建一个完成通道，用于正常退出时的信号
-		done := make(chan struct{})
-
-		go func() {
-			select {
-			case <-signalChan:
-				// 信号退出
-				streamWriter.Close()
-				os.Exit(0)
-			case <-done:
-				// 正常退出，不做任何事
-				return
-			}
+		}
+		removeCleanup := util.AddCleanup(closeWriter)
+		defer func() {
+			removeCleanup()
+			closeWriter()
 		}()
 
 		// 执行流式录制
-		cast, err := streamRecorder.ExecuteWithCallback(command, r.Title, r.AssumeYes, r.MaxWait,
-			func(frame asciicast.Frame) {
-				// 捕获写入过程中的任何可能异常
-				defer func() {
-					if r := recover(); r != nil {
-						// 如果写入过程中panic，确保文件被修复
-						streamWriter.Close()
-						FixCast(streamWriter.filePath)
-					}
-				}()
-
-				streamWriter.WriteFrame(frame)
-			})
-
-		// 通知信号处理协程已完成
-		close(done)
-
+		cast, err := streamRecorder.ExecuteWithCallback(command, r.Title, r.AssumeYes, r.MaxWait, queue.Push)
+		queue.Close()
+		if report := queue.Report(); report != "" {
+			util.Warningf("%s", report)
+		}
 		if err != nil {
 			return err
 		}
 		r.Cast = &cast
 
-		// 流式写入已经完成，修复文件格式
-		FixCast(r.FilePath)
-
-		return err
+		// 录制结束，回填时长和最终终端大小，关闭时会重写头部并修复文件格式
+		header.Duration = cast.Duration
+		if cast.Width > 0 && cast.Height > 0 {
+			header.Width = cast.Width
+			header.Height = cast.Height
+		}
+		return streamWriter.Close()
 	}
 
 	// 传统模式：先全部录制，然后一次性写入文件
@@ -478,9 +836,11 @@ func (r *Runner) Rec() error {
 		Title:     cast.Title,
 		Width:     cast.Width,
 		Height:    cast.Height,
-		Timestamp: cast.Timestamp,
+		Timestamp: r.timestamp(cast.Timestamp),
 		Duration:  cast.Duration,
-		Env:       cast.Env,
+		Env:       r.headerEnv(cast.Env, extraEnv),
+		Theme:     cast.Theme,
+		Machine:   machine,
 	}
 
 	// add header
@@ -505,83 +865,25 @@ func (r *Runner) Rec() error {
 			}
 		}
 
-		// 对帧进行智能分组
+		// 对帧进行智能分组，非输出事件单独成组，不参与压缩
 		groups := make([][]asciicast.Frame, 0)
-		if len(cast.Stdout) > 0 {
-			currentGroup := []asciicast.Frame{cast.Stdout[0]}
-
-			for i := 1; i < len(cast.Stdout); i++ {
-				// 检查时间连续性和内容相似度
-				timeDiff := cast.Stdout[i].Time - cast.Stdout[i-1].Time
-				contentSim := contentSimilarity(cast.Stdout[i].EventData, cast.Stdout[i-1].EventData)
-
-				// 当前组大小控制
-				currentGroupSize := 0
-				for _, f := range currentGroup {
-					currentGroupSize += len(f.EventData)
-				}
-
-				// 如果时间接近且内容相似度高，且组大小未超限，则加入当前组
-				if timeDiff < 1.0 && contentSim > 0.5 && len(currentGroup) < maxBatchSize && currentGroupSize < 32768 {
-					currentGroup = append(currentGroup, cast.Stdout[i])
-				} else {
-					// 如果当前组小于最小大小但时间差不大，尝试继续添加
-					if len(currentGroup) < minBatchSize && timeDiff < 0.5 {
-						currentGroup = append(currentGroup, cast.Stdout[i])
-					} else {
-						// 否则，创建新组
-						if len(currentGroup) > 0 {
-							groups = append(groups, currentGroup)
-						}
-						currentGroup = []asciicast.Frame{cast.Stdout[i]}
-					}
-				}
-			}
-
-			// 添加最后一组
-			if len(currentGroup) > 0 {
-				groups = append(groups, currentGroup)
-			}
-
-			// 合并小组
-			if len(groups) > 1 {
-				optimizedGroups := make([][]asciicast.Frame, 0)
-				currentMergedGroup := make([]asciicast.Frame, 0)
-
-				for _, group := range groups {
-					// 如果当前合并组加上新组的大小适中，则合并
-					if len(currentMergedGroup)+len(group) <= targetBatchSize*2 {
-						currentMergedGroup = append(currentMergedGroup, group...)
-					} else {
-						// 如果合并后超过目标大小的2倍，则先保存当前合并组
-						if len(currentMergedGroup) > 0 {
-							optimizedGroups = append(optimizedGroups, currentMergedGroup)
-						}
-						// 检查新组的大小
-						if len(group) >= minBatchSize {
-							optimizedGroups = append(optimizedGroups, group)
-							currentMergedGroup = make([]asciicast.Frame, 0)
-						} else {
-							currentMergedGroup = group
-						}
-					}
-				}
-
-				// 添加最后一个合并组
-				if len(currentMergedGroup) > 0 {
-					optimizedGroups = append(optimizedGroups, currentMergedGroup)
-				}
-
-				groups = optimizedGroups
+		start := 0
+		for i, f := range cast.Stdout {
+			if f.EventType == asciicast.OutputEventType {
+				continue
 			}
+			groups = append(groups, groupFrames(cast.Stdout[start:i], minBatchSize, maxBatchSize, targetBatchSize)...)
+			groups = append(groups, []asciicast.Frame{f})
+			start = i + 1
 		}
+		groups = append(groups, groupFrames(cast.Stdout[start:], minBatchSize, maxBatchSize, targetBatchSize)...)
 
 		// 为每个组应用压缩
 		for _, group := range groups {
 			// 对于非常小的组，直接写入不压缩
 			if len(group) < minBatchSize {
 				for _, f := range group {
-					if err := result.Encode([]interface{}{f.Time, "o", string(f.EventData)}); err != nil {
+					if err := result.Encode([]interface{}{asciicast.EncodeTime(f.Time), f.EventType, string(f.EventData)}); err != nil {
 						return err
 					}
 				}
@@ -604,7 +906,7 @@ func (r *Runner) Rec() error {
 			if err != nil {
 				// 压缩失败，降级为普通写入
 				for _, f := range group {
-					if err := result.Encode([]interface{}{f.Time, "o", string(f.EventData)}); err != nil {
+					if err := result.Encode([]interface{}{asciicast.EncodeTime(f.Time), asciicast.OutputEventType, string(f.EventData)}); err != nil {
 						return err
 					}
 				}
@@ -629,7 +931,7 @@ func (r *Runner) Rec() error {
 				compressFrame := asciicast.Frame{
 					Time:      startTime,
 					EndTime:   endTime,
-					EventType: "z",
+					EventType: asciicast.CompressedEventType,
 					EventData: []byte(encoded),
 				}
 
@@ -638,7 +940,7 @@ func (r *Runner) Rec() error {
 				if err != nil {
 					// JSON编码失败，降级为普通写入
 					for _, f := range group {
-						if err := result.Encode([]interface{}{f.Time, "o", string(f.EventData)}); err != nil {
+						if err := result.Encode([]interface{}{asciicast.EncodeTime(f.Time), asciicast.OutputEventType, string(f.EventData)}); err != nil {
 							return err
 						}
 					}
@@ -650,7 +952,7 @@ func (r *Runner) Rec() error {
 			} else {
 				// 压缩效果不好，使用原始数据
 				for _, f := range group {
-					if err := result.Encode([]interface{}{f.Time, "o", string(f.EventData)}); err != nil {
+					if err := result.Encode([]interface{}{asciicast.EncodeTime(f.Time), asciicast.OutputEventType, string(f.EventData)}); err != nil {
 						return err
 					}
 				}
@@ -659,7 +961,7 @@ func (r *Runner) Rec() error {
 	} else {
 		// 不压缩，直接写入所有帧
 		for _, f := range cast.Stdout {
-			if err := result.Encode([]interface{}{f.Time, "o", string(f.EventData)}); err != nil {
+			if err := result.Encode([]interface{}{asciicast.EncodeTime(f.Time), f.EventType, string(f.EventData)}); err != nil {
 				panic(err)
 			}
 		}
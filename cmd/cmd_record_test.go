@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/util"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// scriptedTerminal 按固定的间隔输出固定的内容，代替被录制的程序
+type scriptedTerminal struct {
+	clock  *util.FakeClock
+	script []scriptedWrite
+}
+
+type scriptedWrite struct {
+	after time.Duration // 距上一次输出的时长
+	data  string
+}
+
+func (t *scriptedTerminal) Size() (int, int, error) { return 24, 80, nil }
+func (t *scriptedTerminal) Write([]byte) error      { return nil }
+func (t *scriptedTerminal) SetSize(cols, rows int)  {}
+func (t *scriptedTerminal) SetInput(<-chan []byte)  {}
+func (t *scriptedTerminal) SetInputTap(io.Writer)   {}
+
+func (t *scriptedTerminal) Record(command string, w io.Writer, envs ...string) error {
+	for _, s := range t.script {
+		t.clock.Advance(s.after)
+		if _, err := w.Write([]byte(s.data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --deterministic录制同样的输出，得到与testdata中逐字节相同的录像
+func TestDeterministicRecordGolden(t *testing.T) {
+	clock := util.NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	recorder := &asciicast.AsciicastRecorder{
+		Clock: clock,
+		Terminal: &scriptedTerminal{clock: clock, script: []scriptedWrite{
+			{137 * time.Millisecond, "$ "},
+			{1520 * time.Millisecond, "echo hello\r\n"},
+			{12 * time.Millisecond, "hello\r\n"},
+			{3 * time.Second, "$ "},
+			{249 * time.Millisecond, "exit\r\n"},
+		}},
+	}
+	r := &Runner{Deterministic: true}
+	r.setTiming(recorder)
+	c, err := recorder.Record("/bin/sh", "golden", 2, true, map[string]string{"SHELL": "/bin/sh", "TERM": "xterm-256color"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Timestamp = r.timestamp(c.Timestamp)
+	c.Theme = nil // 取决于运行测试的终端
+	got, err := encodeCast(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "deterministic.cast")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("recording differs from %s (run with -update to rewrite it):\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
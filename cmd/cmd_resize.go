@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/vt"
+)
+
+// screenRenderer 将屏幕模型的变化渲染为终端输出
+type screenRenderer struct {
+	screen  *vt.Screen
+	lines   []string
+	cursorX int
+	cursorY int
+	visible bool
+	started bool
+}
+
+func newScreenRenderer(screen *vt.Screen) *screenRenderer {
+	_, rows := screen.Size()
+	return &screenRenderer{screen: screen, lines: make([]string, rows), visible: true}
+}
+
+// render 返回从上一次渲染到当前屏幕状态所需的输出，没有变化时返回空
+func (sr *screenRenderer) render() []byte {
+	var b strings.Builder
+	if !sr.started {
+		b.WriteString("\x1b[0m\x1b[H\x1b[2J")
+		sr.started = true
+	}
+	changed := false
+	for y := range sr.lines {
+		line := vt.RenderCells(sr.screen.Line(y))
+		if line == sr.lines[y] {
+			continue
+		}
+		fmt.Fprintf(&b, "\x1b[%d;1H\x1b[2K%s", y+1, line)
+		sr.lines[y] = line
+		changed = true
+	}
+	x, y, visible := sr.screen.Cursor()
+	if changed || x != sr.cursorX || y != sr.cursorY {
+		fmt.Fprintf(&b, "\x1b[%d;%dH", y+1, x+1)
+		sr.cursorX, sr.cursorY = x, y
+	}
+	if visible != sr.visible {
+		if visible {
+			b.WriteString("\x1b[?25h")
+		} else {
+			b.WriteString("\x1b[?25l")
+		}
+		sr.visible = visible
+	}
+	return []byte(b.String())
+}
+
+// Resize 使用终端模拟器按新的大小重新渲染录像
+func (r *Runner) Resize(inFilePath, outFilePath string, cols, rows int) error {
+	if cols <= 0 || rows <= 0 {
+		return fmt.Errorf("invalid size %dx%d", cols, rows)
+	}
+	return r.withStdio(inFilePath, outFilePath, func(in, out string) error {
+		return r.resize(in, out, cols, rows)
+	})
+}
+
+func (r *Runner) resize(inFilePath, outFilePath string, cols, rows int) error {
+	cast, err := readCast(inFilePath)
+	if err != nil {
+		return err
+	}
+
+	screen := vt.New(cols, rows)
+	renderer := newScreenRenderer(screen)
+	frames := make([]asciicast.Frame, 0, len(cast.Stdout))
+	for _, frame := range cast.Stdout {
+		data, err := frame.OutputData()
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			// 重新渲染后大小固定，去掉大小改变事件，其他非输出帧原样保留
+			if frame.EventType != asciicast.ResizeEventType {
+				frames = append(frames, frame)
+			}
+			continue
+		}
+		screen.Write(data)
+		if out := renderer.render(); len(out) > 0 {
+			frames = append(frames, asciicast.Frame{
+				Time:      frame.Time,
+				EventType: asciicast.OutputEventType,
+				EventData: out,
+			})
+		}
+	}
+
+	cast.Width = cols
+	cast.Height = rows
+	cast.Stdout = frames
+	return writeCast(outFilePath, cast)
+}
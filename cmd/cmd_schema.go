@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/x6nux/asciinema/asciicast"
+)
+
+// Schema 输出cast格式的JSON Schema：outDir为空时打印到标准输出，
+// 否则将每个schema写为outDir/<name>.schema.json；names为空表示全部
+func (r *Runner) Schema(names []string, outDir string) error {
+	if len(names) == 0 {
+		names = asciicast.SchemaNames
+	}
+	if outDir != "" {
+		if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		data, err := asciicast.Schema(name)
+		if err != nil {
+			return err
+		}
+		if outDir == "" {
+			os.Stdout.Write(data)
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(outDir, name+".schema.json"), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/x6nux/asciinema/render"
+	"github.com/x6nux/asciinema/util"
+)
+
+var uploadURL = regexp.MustCompile(`https?://\S+`)
+
+// Share 上传录像并返回链接，copyURL为true时复制到剪贴板，showQR为true时在终端中显示链接的二维码
+func (r *Runner) Share(copyURL, showQR bool) (string, error) {
+	resp, err := r.Upload()
+	if err != nil {
+		return "", err
+	}
+	url := uploadURL.FindString(resp)
+	if url == "" {
+		return "", fmt.Errorf("no url found in the upload response: %s", strings.TrimSpace(resp))
+	}
+	if copyURL {
+		if err := util.CopyToClipboard(url); err != nil {
+			util.Warningf("Failed to copy the url to the clipboard: %v", err)
+		}
+	}
+	if showQR {
+		qr, err := render.QRText(url)
+		if err != nil {
+			return url, err
+		}
+		fmt.Print(qr)
+	}
+	return url, nil
+}
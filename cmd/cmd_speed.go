@@ -1,41 +1,162 @@
 package cmd
 
 import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/gvcgo/asciinema-edit/cast"
-	"github.com/gvcgo/asciinema-edit/commands/transformer"
-	"github.com/gvcgo/asciinema-edit/editor"
+	"github.com/pkg/errors"
 )
 
+// SpeedRange 录像中使用单独速度系数的时间区间
+type SpeedRange struct {
+	From   float64
+	To     float64
+	Factor float64
+	Ease   float64 // 区间两端线性过渡速度系数的秒数
+}
+
+// weight 返回从区间起点到x的权重积分(区间外为0，区间内为1，过渡区线性变化)
+func (r SpeedRange) weight(x float64) float64 {
+	x = math.Max(r.From, math.Min(x, r.To))
+	ease := math.Min(r.Ease, (r.To-r.From)/2)
+	if ease <= 0 {
+		return x - r.From
+	}
+	u := x - r.From
+	v := r.To - x
+	switch {
+	case u <= ease:
+		return u * u / (2 * ease)
+	case v >= ease:
+		return ease/2 + (u - ease)
+	default:
+		return (r.To - r.From - ease) - v*v/(2*ease)
+	}
+}
+
 type speedTransformation struct {
-	from   float64
-	to     float64
-	factor float64
+	ranges []SpeedRange
 }
 
 func (t *speedTransformation) Transform(c *cast.Cast) (err error) {
-	if t.from == 0 && t.to == 0 {
-		t.from = c.EventStream[0].Time
-		t.to = c.EventStream[len(c.EventStream)-1].Time
+	if len(c.EventStream) == 0 {
+		return errors.Errorf("event stream must be nonempty")
+	}
+	ranges := make([]SpeedRange, len(t.ranges))
+	copy(ranges, t.ranges)
+	for i := range ranges {
+		if ranges[i].From == 0 && ranges[i].To == 0 {
+			ranges[i].From = c.EventStream[0].Time
+			ranges[i].To = c.EventStream[len(c.EventStream)-1].Time
+		}
+		if ranges[i].Factor <= 0 {
+			return errors.Errorf("factor must be greater than 0")
+		}
 	}
 
-	err = editor.Speed(c, t.factor, t.from, t.to)
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].From < ranges[j].From
+	})
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i].From < ranges[i-1].To {
+			return errors.Errorf("speed ranges %v-%v and %v-%v overlap",
+				ranges[i-1].From, ranges[i-1].To, ranges[i].From, ranges[i].To)
+		}
+	}
+
+	applySpeed(c.EventStream, ranges)
 	return
 }
 
-func (r *Runner) Speed(inFilePath, outFilePath string, factor, start, end float64) error {
-	transformation := &speedTransformation{
-		factor: factor,
-		from:   start,
-		to:     end,
+// applySpeed 按区间的速度系数缩放每个帧间隔落在区间内的部分，并相应地平移之后的事件。
+// 区间使用录像原始的时间轴
+func applySpeed(events []*cast.Event, ranges []SpeedRange) {
+	var (
+		shift float64
+		prev  = events[0].Time
+	)
+	for _, ev := range events {
+		orig := ev.Time
+		for _, r := range ranges {
+			if orig > r.From && prev < r.To {
+				shift += (r.weight(orig) - r.weight(prev)) * (r.Factor - 1)
+			}
+		}
+		prev = orig
+		ev.Time = orig + shift
 	}
-	t, err := transformer.New(transformation, inFilePath, outFilePath)
-	if err != nil {
-		return err
+}
+
+// ParseSpeedRange 将`start:end:factor`形式的字符串转换为SpeedRange
+func ParseSpeedRange(input string) (res SpeedRange, err error) {
+	cols := strings.Split(input, ":")
+	if len(cols) != 3 {
+		err = errors.Errorf(
+			"invalid range format: must be `start:end:factor`")
+		return
+	}
+
+	values := make([]float64, 3)
+	for i, col := range cols {
+		values[i], err = strconv.ParseFloat(col, 64)
+		if err != nil {
+			err = errors.Errorf(
+				"malformed range: element %d is not a float '%s'", i+1, col)
+			return
+		}
 	}
-	defer t.Close()
-	err = t.Transform()
-	if err == nil {
-		FixHeaderForEditOperations(inFilePath, outFilePath)
+	res = SpeedRange{From: values[0], To: values[1], Factor: values[2]}
+
+	if res.From < 0 || res.To <= res.From {
+		err = errors.Errorf(
+			"constraint not verified: 0 <= start < end")
+		return
+	}
+	if res.Factor <= 0 {
+		err = errors.Errorf(
+			"constraint not verified: factor > 0")
+	}
+	return
+}
+
+func (r *Runner) Speed(inFilePath, outFilePath string, factor, start, end float64) error {
+	return r.speed(inFilePath, outFilePath, []SpeedRange{{
+		Factor: factor,
+		From:   start,
+		To:     end,
+	}})
+}
+
+// SpeedRanges 一次性修改录像中多个区间的速度，每个区间的格式为`start:end:factor`
+func (r *Runner) SpeedRanges(inFilePath, outFilePath string, inputs []string) error {
+	ranges := make([]SpeedRange, 0, len(inputs))
+	for _, input := range inputs {
+		sRange, err := ParseSpeedRange(input)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse range %s", input)
+		}
+		ranges = append(ranges, sRange)
+	}
+	return r.speed(inFilePath, outFilePath, ranges)
+}
+
+func (r *Runner) speed(inFilePath, outFilePath string, ranges []SpeedRange) error {
+	return r.withStdio(inFilePath, outFilePath, func(in, out string) error {
+		return r.speedFile(in, out, ranges)
+	})
+}
+
+func (r *Runner) speedFile(inFilePath, outFilePath string, ranges []SpeedRange) error {
+	for i := range ranges {
+		if ranges[i].Ease == 0 {
+			ranges[i].Ease = r.SpeedEase
+		}
 	}
-	return err
+	return r.edit(inFilePath, outFilePath, []editOp{{
+		line:           "speed",
+		transformation: &speedTransformation{ranges: ranges},
+	}})
 }
@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/x6nux/asciinema/util"
+)
+
+// CastStatsRow 单个cast文件的统计
+type CastStatsRow struct {
+	Path     string  `json:"path"`
+	Day      string  `json:"day"`
+	Duration float64 `json:"duration"`
+	Frames   int     `json:"frames"`
+	Commands int     `json:"commands"`
+	Input    bool    `json:"input"` // 是否录制了输入或shell集成事件，都没有时无法统计命令数
+}
+
+// DayStats 一天内录制的cast
+type DayStats struct {
+	Day      string  `json:"day"`
+	Casts    int     `json:"casts"`
+	Hours    float64 `json:"hours"`
+	Commands int     `json:"commands"`
+}
+
+// DurationBucket 时长分布中的一档
+type DurationBucket struct {
+	Label string `json:"label"`
+	Casts int    `json:"casts"`
+}
+
+// CastStats 一批cast文件的汇总统计
+type CastStats struct {
+	Casts          int              `json:"casts"`
+	Failed         int              `json:"failed,omitempty"`
+	Hours          float64          `json:"hours"`
+	Commands       int              `json:"commands"`
+	WithoutInput   int              `json:"casts_without_input"`
+	MinDuration    float64          `json:"min_duration"`
+	MeanDuration   float64          `json:"mean_duration"`
+	MedianDuration float64          `json:"median_duration"`
+	MaxDuration    float64          `json:"max_duration"`
+	Durations      []DurationBucket `json:"duration_buckets"`
+	BusiestDays    []DayStats       `json:"busiest_days"`
+	Days           []DayStats       `json:"days"`
+}
+
+// durationBuckets 时长分布的上限(秒)和名称
+var durationBuckets = []struct {
+	max   float64
+	label string
+}{
+	{60, "<1m"},
+	{5 * 60, "1-5m"},
+	{15 * 60, "5-15m"},
+	{60 * 60, "15-60m"},
+	{math.Inf(1), ">=1h"},
+}
+
+// findCasts 递归查找目录中的.cast文件
+func findCasts(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), ".cast") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// readStatsRow 统计一个cast文件，没有时间戳的录像按文件的修改时间归到某一天
+func readStatsRow(fPath string) (*CastStatsRow, error) {
+	info, err := ReadCastInfo(fPath)
+	if err != nil {
+		return nil, err
+	}
+	var at time.Time
+	if ts, ok := info.Header["timestamp"].(float64); ok && ts > 0 {
+		at = time.Unix(int64(ts), 0)
+	} else if fi, err := os.Stat(fPath); err == nil {
+		at = fi.ModTime()
+	}
+	return &CastStatsRow{
+		Path:     fPath,
+		Day:      at.Local().Format("2006-01-02"),
+		Duration: info.Duration,
+		Frames:   info.Frames,
+		Commands: info.Commands,
+		Input:    info.CommandsCounted(),
+	}, nil
+}
+
+// aggregateStats 汇总所有文件的统计，top为列出的最忙的天数
+func aggregateStats(rows []*CastStatsRow, failed, top int) *CastStats {
+	stats := &CastStats{Casts: len(rows), Failed: failed}
+	for _, b := range durationBuckets {
+		stats.Durations = append(stats.Durations, DurationBucket{Label: b.label})
+	}
+	days := map[string]*DayStats{}
+	durations := make([]float64, 0, len(rows))
+	for _, row := range rows {
+		durations = append(durations, row.Duration)
+		stats.Hours += row.Duration / 3600
+		stats.Commands += row.Commands
+		if !row.Input {
+			stats.WithoutInput++
+		}
+		for i, b := range durationBuckets {
+			if row.Duration < b.max {
+				stats.Durations[i].Casts++
+				break
+			}
+		}
+		day, ok := days[row.Day]
+		if !ok {
+			day = &DayStats{Day: row.Day}
+			days[row.Day] = day
+		}
+		day.Casts++
+		day.Hours += row.Duration / 3600
+		day.Commands += row.Commands
+	}
+	if len(durations) > 0 {
+		sort.Float64s(durations)
+		stats.MinDuration = durations[0]
+		stats.MaxDuration = durations[len(durations)-1]
+		stats.MeanDuration = stats.Hours * 3600 / float64(len(durations))
+		mid := len(durations) / 2
+		stats.MedianDuration = durations[mid]
+		if len(durations)%2 == 0 {
+			stats.MedianDuration = (durations[mid-1] + durations[mid]) / 2
+		}
+	}
+	for _, day := range days {
+		stats.Days = append(stats.Days, *day)
+	}
+	sort.Slice(stats.Days, func(i, j int) bool { return stats.Days[i].Day < stats.Days[j].Day })
+	stats.BusiestDays = append([]DayStats{}, stats.Days...)
+	sort.SliceStable(stats.BusiestDays, func(i, j int) bool { return stats.BusiestDays[i].Hours > stats.BusiestDays[j].Hours })
+	if len(stats.BusiestDays) > top {
+		stats.BusiestDays = stats.BusiestDays[:top]
+	}
+	return stats
+}
+
+// Stats 统计dir目录下(递归)以及patterns匹配的所有cast文件。
+// aggregate为false时每个文件输出一行，否则输出总时长、命令数、时长分布和最忙的几天；
+// format为text、json或csv，aggregate的csv每天一行，便于导入仪表盘
+func (r *Runner) Stats(dir string, patterns []string, aggregate bool, format string, top int) error {
+	if format != "text" && format != "json" && format != "csv" {
+		return errors.Errorf("unknown format %q, use text, json or csv", format)
+	}
+	var files []string
+	if dir != "" {
+		found, err := findCasts(dir)
+		if err != nil {
+			return err
+		}
+		files = append(files, found...)
+	}
+	if len(patterns) > 0 {
+		matched, err := expandGlobs(patterns)
+		if err != nil {
+			return err
+		}
+		files = append(files, matched...)
+	}
+	if len(files) == 0 {
+		return errors.New("no cast files found")
+	}
+
+	rows := make([]*CastStatsRow, 0, len(files))
+	failed := 0
+	for _, f := range files {
+		row, err := readStatsRow(f)
+		if err != nil {
+			util.Warningf("Skipping %s: %v", f, err)
+			failed++
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	if !aggregate {
+		return writeStatsRows(os.Stdout, rows, format)
+	}
+	return writeStats(os.Stdout, aggregateStats(rows, failed, top), format)
+}
+
+func writeStatsRows(w io.Writer, rows []*CastStatsRow, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(rows)
+	case "csv":
+		out := csv.NewWriter(w)
+		out.Write([]string{"path", "day", "duration", "frames", "commands", "input"})
+		for _, row := range rows {
+			out.Write([]string{
+				row.Path, row.Day, strconv.FormatFloat(row.Duration, 'f', 3, 64),
+				strconv.Itoa(row.Frames), strconv.Itoa(row.Commands), strconv.FormatBool(row.Input),
+			})
+		}
+		out.Flush()
+		return out.Error()
+	}
+	for _, row := range rows {
+		commands := "-"
+		if row.Input {
+			commands = strconv.Itoa(row.Commands)
+		}
+		fmt.Fprintf(w, "%s  %10s  %6s commands  %s\n", row.Day, formatStatsDuration(row.Duration), commands, row.Path)
+	}
+	return nil
+}
+
+func writeStats(w io.Writer, stats *CastStats, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(stats)
+	case "csv":
+		out := csv.NewWriter(w)
+		out.Write([]string{"day", "casts", "hours", "commands"})
+		for _, day := range stats.Days {
+			out.Write([]string{day.Day, strconv.Itoa(day.Casts), strconv.FormatFloat(day.Hours, 'f', 3, 64), strconv.Itoa(day.Commands)})
+		}
+		out.Flush()
+		return out.Error()
+	}
+
+	row := func(key string, value interface{}) {
+		fmt.Fprintf(w, "%-16s %v\n", key+":", value)
+	}
+	row("Casts", stats.Casts)
+	if stats.Failed > 0 {
+		row("Unreadable", stats.Failed)
+	}
+	row("Recorded", fmt.Sprintf("%.2fh", stats.Hours))
+	row("Commands", fmt.Sprintf("%d (%d casts without input)", stats.Commands, stats.WithoutInput))
+	row("Duration", fmt.Sprintf("min %s, median %s, mean %s, max %s",
+		formatStatsDuration(stats.MinDuration), formatStatsDuration(stats.MedianDuration),
+		formatStatsDuration(stats.MeanDuration), formatStatsDuration(stats.MaxDuration)))
+	fmt.Fprintln(w, "Distribution:")
+	for _, b := range stats.Durations {
+		fmt.Fprintf(w, "  %-8s %5d\n", b.Label, b.Casts)
+	}
+	fmt.Fprintln(w, "Busiest days:")
+	for _, day := range stats.BusiestDays {
+		fmt.Fprintf(w, "  %s  %7.2fh  %4d casts  %6d commands\n", day.Day, day.Hours, day.Casts, day.Commands)
+	}
+	return nil
+}
+
+// formatStatsDuration 将秒数格式化为易读的时长
+func formatStatsDuration(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
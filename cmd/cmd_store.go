@@ -0,0 +1,394 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/x6nux/asciinema/util"
+)
+
+const (
+	// storeVersion 仓库中录像清单的格式版本
+	storeVersion = 1
+	// 内容定义分块的最小、最大块大小，以及决定平均块大小(约2KB)的哈希位数
+	storeChunkMin  = 512
+	storeChunkMax  = 16 << 10
+	storeChunkBits = 11
+	// storePrefixMax 事件行开头"[时间,"部分的最大长度，超过时整行作为内容存放
+	storePrefixMax = 32
+	// storeRecipeExt 录像清单的扩展名
+	storeRecipeExt = ".json.gz"
+)
+
+// storeGear 内容定义分块使用的随机表，由固定的种子生成，不同机器上的切分结果相同
+var storeGear = func() (table [256]uint64) {
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range table {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+		table[i] = x
+	}
+	return table
+}()
+
+// storeRecipe 仓库中的一个录像。头部和每行开头的"[时间,"部分单独保存，其余内容拼接后按内容切分成块，
+// 块以SHA-256命名，不同录像中相同的输出(提示符、登录信息等)只存一份，时间不同也不影响去重
+type storeRecipe struct {
+	Version  int       `json:"version"`
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	SHA256   string    `json:"sha256"`
+	Added    time.Time `json:"added"`
+	Header   string    `json:"header"`   // 第一行(包括换行符)，每个录像都不同，不参与分块
+	Prefixes []string  `json:"prefixes"` // 之后每行开头的时间部分，无法识别的行为空
+	Chunks   []string  `json:"chunks"`
+}
+
+// StorePutResult 存入一个录像的结果
+type StorePutResult struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Chunks    int    `json:"chunks"`
+	NewChunks int    `json:"new_chunks"` // 仓库中原来没有的块数
+	Written   int64  `json:"written"`    // 新写入的块压缩后的字节数
+}
+
+// StoreEntry 仓库中的一个录像
+type StoreEntry struct {
+	Name   string    `json:"name"`
+	Size   int64     `json:"size"`
+	Chunks int       `json:"chunks"`
+	Added  time.Time `json:"added"`
+}
+
+// DefaultStorePath 默认的仓库位置，在配置目录下
+func DefaultStorePath() string {
+	dir := os.Getenv(util.DefaultHomeEnv)
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".config", "asciinema")
+	}
+	return filepath.Join(dir, "store")
+}
+
+// storeObjectPath 块在仓库中的路径，按哈希的前两位分目录
+func storeObjectPath(store, sum string) string {
+	return filepath.Join(store, "objects", sum[:2], sum[2:])
+}
+
+// storeRecipePath 录像清单在仓库中的路径
+func storeRecipePath(store, name string) string {
+	return filepath.Join(store, "casts", filepath.FromSlash(name)+storeRecipeExt)
+}
+
+// checkStoreName 检查录像在仓库中的名称，可以用/分层，如host1/2024-01-02.cast
+func checkStoreName(name string) error {
+	if name == "" || path.Clean("/" + name)[1:] != name {
+		return fmt.Errorf("invalid store name %q", name)
+	}
+	return nil
+}
+
+// splitEventPrefix 将一行拆成开头的"[时间,"部分和其余内容，不是事件行时前一部分为空
+func splitEventPrefix(line []byte) (prefix, rest []byte) {
+	if !bytes.HasPrefix(line, []byte("[")) {
+		return nil, line
+	}
+	i := bytes.IndexByte(line, ',')
+	if i < 0 || i >= storePrefixMax {
+		return nil, line
+	}
+	return line[:i+1], line[i+1:]
+}
+
+// storeChunks 按内容将事件切分成块：不小于storeChunkMin的事件(登录信息、命令输出等)单独成块，
+// 相同的输出无论出现在哪个录像的什么位置都得到相同的块，较长的事件内部再用gear滚动哈希切分；
+// 较小的事件(提示符、键入的命令)连成一串，只在事件之间切分
+func storeChunks(events [][]byte) [][]byte {
+	var chunks [][]byte
+	var run []byte // 正在累积的较小事件
+	var h uint64
+	hit := false // run中是否已经出现切分点
+	flush := func() {
+		if len(run) > 0 {
+			chunks = append(chunks, run)
+		}
+		run, h, hit = nil, 0, false
+	}
+	for _, event := range events {
+		if len(event) >= storeChunkMin {
+			flush()
+			chunks = append(chunks, splitContent(event)...)
+			continue
+		}
+		for _, b := range event {
+			h = h<<1 + storeGear[b]
+			// 高位受最近64个字节的影响，低位只受最后几个字节的影响
+			hit = hit || h>>(64-storeChunkBits) == 0
+		}
+		run = append(run, event...)
+		if (hit && len(run) >= storeChunkMin) || len(run) >= storeChunkMax {
+			flush()
+		}
+	}
+	flush()
+	return chunks
+}
+
+// splitContent 用gear滚动哈希按内容切分data，插入或删除内容只影响附近的块
+func splitContent(data []byte) [][]byte {
+	var chunks [][]byte
+	var h uint64
+	start := 0
+	for i, b := range data {
+		h = h<<1 + storeGear[b]
+		n := i + 1 - start
+		if (n >= storeChunkMin && h>>(64-storeChunkBits) == 0) || n >= storeChunkMax {
+			chunks = append(chunks, data[start:i+1])
+			start, h = i+1, 0
+		}
+	}
+	if start < len(data) {
+		chunks = append(chunks, data[start:])
+	}
+	return chunks
+}
+
+// writeStoreFile 以gzip压缩写入文件，先写临时文件再改名，多个进程同时写入同一仓库也不会留下半个文件
+func writeStoreFile(fPath string, data []byte) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(fPath), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(fPath), ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	zw := gzip.NewWriter(f)
+	_, err = zw.Write(data)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	var size int64
+	if fi, serr := f.Stat(); err == nil && serr == nil {
+		size = fi.Size()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fPath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	return size, nil
+}
+
+// readStoreFile 读取并解压仓库中的文件
+func readStoreFile(fPath string) ([]byte, error) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fPath, err)
+	}
+	return io.ReadAll(zr)
+}
+
+// StorePut 将录像存入store仓库，name为空时使用文件名。同名的录像被替换
+func (r *Runner) StorePut(store, fPath, name string) (*StorePutResult, error) {
+	if name == "" {
+		name = filepath.Base(fPath)
+	}
+	if err := checkStoreName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(fPath)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	recipe := &storeRecipe{Version: storeVersion, Name: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:]), Added: time.Now().UTC()}
+
+	var events [][]byte
+	reader := bufio.NewReader(bytes.NewReader(data))
+	header, err := reader.ReadBytes('\n')
+	recipe.Header = string(header)
+	for err == nil {
+		var line []byte
+		line, err = reader.ReadBytes('\n')
+		if len(line) > 0 {
+			prefix, rest := splitEventPrefix(line)
+			recipe.Prefixes = append(recipe.Prefixes, string(prefix))
+			events = append(events, rest)
+		}
+	}
+
+	result := &StorePutResult{Name: name, Size: recipe.Size}
+	for _, chunk := range storeChunks(events) {
+		sum := sha256.Sum256(chunk)
+		id := hex.EncodeToString(sum[:])
+		recipe.Chunks = append(recipe.Chunks, id)
+		result.Chunks++
+		obj := storeObjectPath(store, id)
+		if _, err := os.Stat(obj); err == nil {
+			continue
+		}
+		n, err := writeStoreFile(obj, chunk)
+		if err != nil {
+			return nil, err
+		}
+		result.NewChunks++
+		result.Written += n
+	}
+
+	manifest, err := json.Marshal(recipe)
+	if err != nil {
+		return nil, err
+	}
+	n, err := writeStoreFile(storeRecipePath(store, name), manifest)
+	if err != nil {
+		return nil, err
+	}
+	result.Written += n
+	return result, nil
+}
+
+// StoreGet 从store仓库取出录像写入out(为空或"-"时写到标准输出)，还原的内容与存入时逐字节相同
+func (r *Runner) StoreGet(store, name, out string) error {
+	if err := checkStoreName(name); err != nil {
+		return err
+	}
+	manifest, err := readStoreFile(storeRecipePath(store, name))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s is not in the store %s", name, store)
+	}
+	if err != nil {
+		return err
+	}
+	recipe := &storeRecipe{}
+	if err := json.Unmarshal(manifest, recipe); err != nil {
+		return fmt.Errorf("invalid store entry %s: %v", name, err)
+	}
+	if recipe.Version > storeVersion {
+		return fmt.Errorf("%s has store version %d, this acast reads up to %d", name, recipe.Version, storeVersion)
+	}
+
+	var content bytes.Buffer
+	for _, id := range recipe.Chunks {
+		chunk, err := readStoreFile(storeObjectPath(store, id))
+		if err != nil {
+			return fmt.Errorf("chunk %s of %s: %v", id, name, err)
+		}
+		content.Write(chunk)
+	}
+	data := bytes.NewBufferString(recipe.Header)
+	reader := bufio.NewReader(&content)
+	for _, prefix := range recipe.Prefixes {
+		rest, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		data.WriteString(prefix)
+		data.Write(rest)
+	}
+	sum := sha256.Sum256(data.Bytes())
+	if hex.EncodeToString(sum[:]) != recipe.SHA256 {
+		return fmt.Errorf("%s is damaged in the store: checksum mismatch", name)
+	}
+	if out == "" || out == StdioPath {
+		_, err = os.Stdout.Write(data.Bytes())
+		return err
+	}
+	return os.WriteFile(out, data.Bytes(), 0644)
+}
+
+// StoreList 列出store仓库中的录像，以及所有块占用的磁盘空间
+func (r *Runner) StoreList(store string) ([]StoreEntry, int64, error) {
+	entries := []StoreEntry{}
+	casts := filepath.Join(store, "casts")
+	err := filepath.WalkDir(casts, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, storeRecipeExt) {
+			return err
+		}
+		manifest, err := readStoreFile(p)
+		if err != nil {
+			return err
+		}
+		recipe := &storeRecipe{}
+		if err := json.Unmarshal(manifest, recipe); err != nil {
+			return fmt.Errorf("invalid store entry %s: %v", p, err)
+		}
+		entries = append(entries, StoreEntry{Name: recipe.Name, Size: recipe.Size, Chunks: len(recipe.Chunks), Added: recipe.Added})
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, 0, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	var disk int64
+	err = filepath.WalkDir(store, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if fi, err := d.Info(); err == nil {
+			disk += fi.Size()
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, 0, err
+	}
+	return entries, disk, nil
+}
+
+// PrintStoreEntries 打印仓库中的录像，以及原始大小和实际占用的空间
+func PrintStoreEntries(entries []StoreEntry, disk int64, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+		fmt.Printf("%-40s %10s %6d chunks  %s\n", e.Name, formatBytes(e.Size), e.Chunks, e.Added.Local().Format("2006-01-02 15:04"))
+	}
+	fmt.Printf("%d casts, %s in total, %s on disk\n", len(entries), formatBytes(total), formatBytes(disk))
+	return nil
+}
+
+// formatBytes 以B、KB、MB、GB为单位显示字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, suffix := float64(n)/unit, "KB"
+	for _, s := range []string{"MB", "GB", "TB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, s
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
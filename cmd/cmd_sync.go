@@ -0,0 +1,497 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+)
+
+const (
+	// syncManifestName 目标目录中的同步清单，记录已复制文件的大小、修改时间和SHA-256
+	syncManifestName = ".acast-sync.json"
+	// syncManifestVersion 同步清单的格式版本
+	syncManifestVersion = 1
+	// sshMissingStatus 远程文件不存在时ssh命令的退出码
+	sshMissingStatus = 44
+)
+
+// syncManifest 同步清单，键为相对于同步目录的路径
+type syncManifest struct {
+	Version int                  `json:"version"`
+	Updated time.Time            `json:"updated"`
+	Files   map[string]syncEntry `json:"files"`
+	dirty   bool                 // 有变化，需要写回目标
+}
+
+// syncEntry 已复制的一个文件。大小和修改时间都没变的文件不再计算哈希
+type syncEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	SHA256  string    `json:"sha256"`
+}
+
+// SyncResult 一次同步的结果
+type SyncResult struct {
+	Target    string   // 目标，不含密码
+	Copied    []string // 复制的文件(dry run时为需要复制的文件)
+	Bytes     int64    // 复制的字节数
+	Unchanged int      // 没有变化的文件数
+	Recording []string // 正在录制、这次没有同步的录像
+}
+
+// syncTarget 同步的目标，name为以/分隔的相对路径
+type syncTarget interface {
+	// get 读取目标上的文件，文件不存在时返回的错误满足errors.Is(err, fs.ErrNotExist)
+	get(name string) ([]byte, error)
+	put(name string, f *os.File) error
+	String() string
+}
+
+// parseSyncTarget 解析同步目标：配置文件中[remote "名称"]定义的"名称:路径"、s3://bucket/前缀、
+// ssh://[user@]host[:port]/路径、user@host:路径、webdav://或webdavs://地址，其他视为本地目录
+func parseSyncTarget(spec string) (syncTarget, error) {
+	if name, rest, ok := strings.Cut(spec, ":"); ok && cfg != nil {
+		if remote, ok := cfg.Remote(name); ok {
+			spec = strings.TrimRight(remote, "/")
+			if rest = strings.Trim(rest, "/"); rest != "" {
+				spec += "/" + rest
+			}
+		}
+	}
+	switch {
+	case strings.HasPrefix(spec, "s3://"):
+		bucket, prefix, err := asciicast.ParseS3URL(spec)
+		if err != nil {
+			return nil, err
+		}
+		client, err := asciicast.NewS3Client(context.Background(), bucket)
+		if err != nil {
+			return nil, err
+		}
+		return &s3SyncTarget{client: client, prefix: strings.Trim(prefix, "/")}, nil
+	case strings.HasPrefix(spec, "ssh://"):
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		host := u.Hostname()
+		if u.User != nil {
+			host = u.User.Username() + "@" + host
+		}
+		return &sshSyncTarget{host: host, port: u.Port(), dir: u.Path}, nil
+	case strings.HasPrefix(spec, "webdav://"), strings.HasPrefix(spec, "webdavs://"):
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		u.Scheme = strings.Replace(u.Scheme, "webdav", "http", 1)
+		u.Path = strings.TrimRight(u.Path, "/")
+		return &webdavSyncTarget{base: u, created: map[string]bool{}}, nil
+	}
+	// user@host:路径，与scp相同。单个字母加冒号是Windows的盘符
+	if host, dir, ok := strings.Cut(spec, ":"); ok && len(host) > 1 && !strings.ContainsAny(host, `/\`) {
+		if dir == "" {
+			dir = "."
+		}
+		return &sshSyncTarget{host: host, dir: dir}, nil
+	}
+	return &localSyncTarget{dir: spec}, nil
+}
+
+// Sync 将dir目录下(递归)新增和修改过的录像及其旁路文件(标签、输入日志、旁白音频)复制到目标。
+// 目标中的同步清单记录了已复制的文件，只比较清单就能找出需要复制的文件。
+// 头部没有时长且最近stale之内修改过的录像视为正在录制，这次不同步
+func (r *Runner) Sync(dir, spec string, stale time.Duration, dryRun bool) (result *SyncResult, err error) {
+	target, err := parseSyncTarget(spec)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &syncManifest{Version: syncManifestVersion, Files: map[string]syncEntry{}}
+	data, err := target.get(syncManifestName)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, manifest); err != nil {
+			return nil, fmt.Errorf("invalid sync manifest in %s: %v", target, err)
+		}
+		if manifest.Version > syncManifestVersion {
+			return nil, fmt.Errorf("%s has sync manifest version %d, this acast reads up to %d", target, manifest.Version, syncManifestVersion)
+		}
+		if manifest.Files == nil {
+			manifest.Files = map[string]syncEntry{}
+		}
+	}
+
+	casts, err := listSessionCasts(dir, stale)
+	if err != nil {
+		return nil, err
+	}
+	result = &SyncResult{Target: target.String()}
+	// 出错时也保存已经复制的文件，下次不再重复复制
+	defer func() {
+		if manifest.dirty && !dryRun {
+			if serr := saveSyncManifest(target, manifest); err == nil {
+				err = serr
+			}
+		}
+	}()
+	for _, c := range casts {
+		if !c.finished {
+			result.Recording = append(result.Recording, c.path)
+			continue
+		}
+		for _, file := range append([]string{c.path}, castSidecars(c.path)...) {
+			rel, rerr := filepath.Rel(dir, file)
+			if rerr != nil || strings.HasPrefix(rel, "..") {
+				// 录像目录之外的旁白音频
+				continue
+			}
+			name := filepath.ToSlash(rel)
+			copied, size, serr := syncFile(target, manifest, file, name, dryRun)
+			if serr != nil {
+				return result, serr
+			}
+			if !copied {
+				result.Unchanged++
+				continue
+			}
+			result.Copied = append(result.Copied, name)
+			result.Bytes += size
+		}
+	}
+	return result, err
+}
+
+// syncFile 文件是新的或内容有变化时复制到目标并更新清单，返回是否复制
+func syncFile(target syncTarget, manifest *syncManifest, file, name string, dryRun bool) (bool, int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, 0, err
+	}
+	old, ok := manifest.Files[name]
+	if ok && old.Size == fi.Size() && old.ModTime.Equal(fi.ModTime()) {
+		return false, 0, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, 0, err
+	}
+	entry := syncEntry{Size: fi.Size(), ModTime: fi.ModTime(), SHA256: hex.EncodeToString(h.Sum(nil))}
+	if ok && old.SHA256 == entry.SHA256 {
+		// 只是修改时间变了
+		if !dryRun {
+			manifest.Files[name], manifest.dirty = entry, true
+		}
+		return false, 0, nil
+	}
+	if dryRun {
+		return true, fi.Size(), nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, 0, err
+	}
+	if err := target.put(name, f); err != nil {
+		return false, 0, err
+	}
+	manifest.Files[name], manifest.dirty = entry, true
+	return true, fi.Size(), nil
+}
+
+// saveSyncManifest 将同步清单写入目标
+func saveSyncManifest(target syncTarget, manifest *syncManifest) error {
+	manifest.Updated = time.Now().UTC()
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "acast-sync-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return target.put(syncManifestName, f)
+}
+
+// castSidecars 返回录像存在的旁路文件：标签和备注、输入日志，以及头部引用的旁白音频
+func castSidecars(castPath string) []string {
+	var files []string
+	for _, p := range []string{castPath + metaExt, castPath + ".input.log"} {
+		if fileExists(p) {
+			files = append(files, p)
+		}
+	}
+	f, err := os.Open(castPath)
+	if err != nil {
+		return files
+	}
+	defer f.Close()
+	header, err := asciicast.NewDecoder(f).Header()
+	if err == nil && header.Audio != nil && !filepath.IsAbs(header.Audio.File) {
+		if p := header.Audio.Path(castPath); fileExists(p) {
+			files = append(files, p)
+		}
+	}
+	return files
+}
+
+// fileExists 判断文件是否存在
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// PrintSyncResult 打印同步的结果
+func PrintSyncResult(res *SyncResult, dryRun bool) {
+	verb := "Copied"
+	if dryRun {
+		verb = "Would copy"
+	}
+	for _, name := range res.Copied {
+		fmt.Printf("%s %s\n", strings.ToLower(verb), name)
+	}
+	for _, p := range res.Recording {
+		fmt.Printf("skipped %s (still recording)\n", p)
+	}
+	fmt.Printf("%s %d files (%s) to %s, %d unchanged\n", verb, len(res.Copied), formatBytes(res.Bytes), res.Target, res.Unchanged)
+}
+
+// localSyncTarget 本地目录，如挂载的网络存储
+type localSyncTarget struct {
+	dir string
+}
+
+func (t *localSyncTarget) String() string {
+	return t.dir
+}
+
+func (t *localSyncTarget) get(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(t.dir, filepath.FromSlash(name)))
+}
+
+func (t *localSyncTarget) put(name string, f *os.File) error {
+	dst := filepath.Join(t.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".acast-sync-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, f)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// s3SyncTarget S3或S3兼容存储中的前缀
+type s3SyncTarget struct {
+	client *asciicast.S3Client
+	prefix string
+}
+
+func (t *s3SyncTarget) String() string {
+	return "s3://" + path.Join(t.client.Bucket, t.prefix)
+}
+
+func (t *s3SyncTarget) key(name string) string {
+	if t.prefix == "" {
+		return name
+	}
+	return t.prefix + "/" + name
+}
+
+func (t *s3SyncTarget) get(name string) ([]byte, error) {
+	body, err := t.client.Get(context.Background(), t.key(name))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func (t *s3SyncTarget) put(name string, f *os.File) error {
+	return t.client.Put(context.Background(), t.key(name), f)
+}
+
+// sshSyncTarget 通过系统的ssh命令访问的远程目录，使用用户的ssh配置、密钥和代理
+type sshSyncTarget struct {
+	host string
+	port string
+	dir  string
+}
+
+func (t *sshSyncTarget) String() string {
+	return t.host + ":" + t.dir
+}
+
+// run 在远程主机上以sh执行script
+func (t *sshSyncTarget) run(script string, stdin io.Reader) ([]byte, error) {
+	args := []string{}
+	if t.port != "" {
+		args = append(args, "-p", t.port)
+	}
+	args = append(args, "--", t.host, script)
+	c := exec.Command("ssh", args...)
+	c.Stdin = stdin
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == sshMissingStatus {
+		return nil, fs.ErrNotExist
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("ssh %s: %v: %s", t.host, err, msg)
+		}
+		return nil, fmt.Errorf("ssh %s: %v", t.host, err)
+	}
+	return out, nil
+}
+
+func (t *sshSyncTarget) get(name string) ([]byte, error) {
+	p := shellQuote(path.Join(t.dir, name))
+	out, err := t.run(fmt.Sprintf("test -e %s || exit %d; cat -- %s", p, sshMissingStatus, p), nil)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s:%s: %w", t.host, path.Join(t.dir, name), err)
+	}
+	return out, err
+}
+
+func (t *sshSyncTarget) put(name string, f *os.File) error {
+	dst := path.Join(t.dir, name)
+	tmp := path.Join(path.Dir(dst), ".acast-sync-"+path.Base(dst))
+	_, err := t.run(fmt.Sprintf("mkdir -p -- %s && cat > %s && mv -f -- %s %s",
+		shellQuote(path.Dir(dst)), shellQuote(tmp), shellQuote(tmp), shellQuote(dst)), f)
+	return err
+}
+
+// shellQuote 用单引号括起s，作为sh命令的一个参数
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// webdavSyncTarget WebDAV服务器上的目录，地址中的用户名和密码用于Basic认证
+type webdavSyncTarget struct {
+	base    *url.URL
+	created map[string]bool // 已经创建或确认存在的目录
+}
+
+func (t *webdavSyncTarget) String() string {
+	u := *t.base
+	u.Scheme = strings.Replace(u.Scheme, "http", "webdav", 1)
+	return u.Redacted()
+}
+
+// request 发送WebDAV请求，name为相对于目标目录的路径，以/开头时为服务器上的绝对路径
+func (t *webdavSyncTarget) request(method, name string, body io.Reader) (*http.Response, error) {
+	u := *t.base
+	u.User = nil
+	if !strings.HasPrefix(name, "/") {
+		name = u.Path + "/" + name
+	}
+	u.Path = strings.TrimRight(name, "/")
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if t.base.User != nil {
+		password, _ := t.base.User.Password()
+		req.SetBasicAuth(t.base.User.Username(), password)
+	}
+	if f, ok := body.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil {
+			req.ContentLength = fi.Size()
+		}
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func (t *webdavSyncTarget) get(name string) ([]byte, error) {
+	resp, err := t.request(http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s/%s: %w", t, name, fs.ErrNotExist)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status %v when fetching %s/%s", resp.StatusCode, t, name)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (t *webdavSyncTarget) put(name string, f *os.File) error {
+	if err := t.mkdirAll(path.Dir(path.Join(t.base.Path, name))); err != nil {
+		return err
+	}
+	resp, err := t.request(http.MethodPut, name, f)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("got status %v when uploading %s/%s", resp.StatusCode, t, name)
+	}
+	return nil
+}
+
+// mkdirAll 逐级创建服务器上的目录dir，已经存在时服务器返回405。
+// 目标目录的上级可能没有写权限，只忽略这些目录的错误
+func (t *webdavSyncTarget) mkdirAll(dir string) error {
+	if dir == "/" || dir == "." || t.created[dir] {
+		return nil
+	}
+	if err := t.mkdirAll(path.Dir(dir)); err != nil {
+		return err
+	}
+	resp, err := t.request("MKCOL", dir, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	base := strings.TrimRight(t.base.Path, "/")
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusMethodNotAllowed && len(dir) >= len(base) {
+		return fmt.Errorf("got status %v when creating %s", resp.StatusCode, dir)
+	}
+	t.created[dir] = true
+	return nil
+}
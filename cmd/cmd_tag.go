@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// metaExt 旁路元数据文件的扩展名，demo.cast的标签和备注保存在demo.cast.meta中，
+// cast文件本身保持不变，上传和播放不受影响
+const metaExt = ".meta"
+
+// CastMeta cast文件的标签和备注
+type CastMeta struct {
+	Tags []string `json:"tags,omitempty"`
+	Note string   `json:"note,omitempty"`
+}
+
+// CastEntry acast ls列出的一个cast
+type CastEntry struct {
+	Path     string   `json:"path"`
+	Title    string   `json:"title,omitempty"`
+	Duration float64  `json:"duration"`
+	Tags     []string `json:"tags,omitempty"`
+	Note     string   `json:"note,omitempty"`
+}
+
+// readCastMeta 读取cast的元数据，没有元数据文件时返回空的元数据
+func readCastMeta(fPath string) (*CastMeta, error) {
+	meta := &CastMeta{}
+	data, err := os.ReadFile(fPath + metaExt)
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, errors.Wrapf(err, "invalid metadata file %s", fPath+metaExt)
+	}
+	return meta, nil
+}
+
+// writeCastMeta 保存cast的元数据，没有标签和备注时删除元数据文件
+func writeCastMeta(fPath string, meta *CastMeta) error {
+	if len(meta.Tags) == 0 && meta.Note == "" {
+		if err := os.Remove(fPath + metaExt); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fPath+metaExt, append(data, '\n'), 0644)
+}
+
+// ParseTags 解析以逗号分隔的标签，去掉空白并转为小写
+func ParseTags(list string) []string {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// updateCastMeta 读取、修改并保存cast的元数据
+func updateCastMeta(fPath string, update func(meta *CastMeta)) (*CastMeta, error) {
+	if _, err := os.Stat(fPath); err != nil {
+		return nil, err
+	}
+	meta, err := readCastMeta(fPath)
+	if err != nil {
+		return nil, err
+	}
+	update(meta)
+	return meta, writeCastMeta(fPath, meta)
+}
+
+// TagAdd 为cast添加标签，已有的标签不会重复添加
+func (r *Runner) TagAdd(fPath string, tags []string) (*CastMeta, error) {
+	return updateCastMeta(fPath, func(meta *CastMeta) {
+		for _, tag := range tags {
+			if !hasTag(meta.Tags, tag) {
+				meta.Tags = append(meta.Tags, tag)
+			}
+		}
+		sort.Strings(meta.Tags)
+	})
+}
+
+// TagRemove 删除cast的标签
+func (r *Runner) TagRemove(fPath string, tags []string) (*CastMeta, error) {
+	return updateCastMeta(fPath, func(meta *CastMeta) {
+		kept := meta.Tags[:0]
+		for _, tag := range meta.Tags {
+			if !hasTag(tags, tag) {
+				kept = append(kept, tag)
+			}
+		}
+		meta.Tags = kept
+	})
+}
+
+// TagNote 设置cast的备注，note为空时删除备注
+func (r *Runner) TagNote(fPath, note string) (*CastMeta, error) {
+	return updateCastMeta(fPath, func(meta *CastMeta) {
+		meta.Note = strings.TrimSpace(note)
+	})
+}
+
+// TagShow 返回cast的标签和备注
+func (r *Runner) TagShow(fPath string) (*CastMeta, error) {
+	if _, err := os.Stat(fPath); err != nil {
+		return nil, err
+	}
+	return readCastMeta(fPath)
+}
+
+// List 列出dir目录下(递归)带有tags中所有标签的cast
+func (r *Runner) List(dir string, tags []string) ([]CastEntry, error) {
+	files, err := findCasts(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := []CastEntry{}
+	for _, f := range files {
+		meta, err := readCastMeta(f)
+		if err != nil {
+			return nil, err
+		}
+		matched := true
+		for _, tag := range tags {
+			matched = matched && hasTag(meta.Tags, tag)
+		}
+		if !matched {
+			continue
+		}
+		entry := CastEntry{Path: f, Tags: meta.Tags, Note: meta.Note}
+		if info, err := ReadCastInfo(f); err == nil {
+			entry.Title, _ = info.Header["title"].(string)
+			entry.Duration = info.Duration
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// PrintCastMeta 打印cast的标签和备注
+func PrintCastMeta(fPath string, meta *CastMeta) {
+	tags := strings.Join(meta.Tags, ", ")
+	if tags == "" {
+		tags = "(no tags)"
+	}
+	fmt.Printf("%s: %s\n", fPath, tags)
+	if meta.Note != "" {
+		fmt.Printf("  %s\n", meta.Note)
+	}
+}
+
+// PrintCastEntries 打印acast ls的结果
+func PrintCastEntries(entries []CastEntry, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(entries)
+	}
+	for _, e := range entries {
+		line := fmt.Sprintf("%-40s %10s", e.Path, formatStatsDuration(e.Duration))
+		if e.Title != "" {
+			line += "  " + e.Title
+		}
+		if len(e.Tags) > 0 {
+			line += "  [" + strings.Join(e.Tags, ", ") + "]"
+		}
+		fmt.Println(line)
+		if e.Note != "" {
+			fmt.Printf("    %s\n", e.Note)
+		}
+	}
+	return nil
+}
@@ -1,295 +1,670 @@
 package cmd
 
 import (
-	"bytes"
-	"compress/gzip"
-	"encoding/base64"
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/util"
+	"github.com/x6nux/asciinema/vt"
 )
 
 // CommandOutput 表示命令及其输出
 type CommandOutput struct {
-	Cmd string `json:"cmd"` // 命令
-	Out string `json:"out"` // 输出
+	Cmd        string  `json:"cmd"`                   // 命令
+	Out        string  `json:"out"`                   // 输出
+	Start      float64 `json:"start"`                 // 提交命令的时间(秒)
+	End        float64 `json:"end"`                   // 命令结束，即下一个提示符出现的时间(秒)
+	Duration   float64 `json:"duration"`              // 执行时长(秒)
+	ExitStatus *int    `json:"exit_status,omitempty"` // 退出码，仅在shell输出OSC 133;D时可用
+	Cwd        string  `json:"cwd,omitempty"`         // 执行命令时的工作目录，仅在shell输出OSC 7时可用
+	guessed    bool    // 没有识别出提示符，以第一行作为命令
 }
 
-// Frame 表示一个播放帧（内部使用）
-type castFrame struct {
-	Time      float64 `json:"a"`           // 时间
-	EventType string  `json:"b"`           // 事件类型：o（输出）或z（压缩数据）
-	EventData []byte  `json:"c"`           // 输出数据
-	EndTime   float64 `json:"d,omitempty"` // 压缩帧的结束时间，仅当EventType为z时使用
+// promptEvent 提示符出现或命令提交的时刻
+type promptEvent struct {
+	time         float64
+	cmd          string // 提交的命令，仅用于提交事件
+	continuation bool   // 是否为续行提示符
 }
 
-// UnmarshalJSON 自定义JSON反序列化
-func (f *castFrame) UnmarshalJSON(data []byte) error {
-	// 检查是结构体还是数组格式
-	if bytes.HasPrefix(data, []byte("{")) {
-		// 结构体格式，可能是压缩帧
-		var frameMap map[string]interface{}
-		if err := json.Unmarshal(data, &frameMap); err != nil {
-			return err
-		}
+// pendingPrompt 正在等待输入的提示符行
+type pendingPrompt struct {
+	prompt  string
+	row     int
+	text    string // 上一帧时该行的内容
+	learned bool   // 提示符是这一行新识别出的
+}
 
-		// 提取基本属性
-		if time, ok := frameMap["a"].(float64); ok {
-			f.Time = time
-		}
+// promptChars 常见提示符的结尾字符
+const promptChars = "$#%>❯➜λ»"
 
-		if eventType, ok := frameMap["b"].(string); ok {
-			f.EventType = eventType
-		}
+// transcriptLine 重建出的一行文本
+type transcriptLine struct {
+	text string
+	full bool // 该行写满了整行，可能是自动换行的长行
+}
 
-		if eventData, ok := frameMap["c"].(string); ok {
-			f.EventData = []byte(eventData)
-		}
+// sessionTranscriber 基于终端模拟器重建会话的文本，并根据提示符拆分为命令和输出。
+// 全屏程序(备用屏幕缓冲区)的画面不会进入文本；清屏前的内容会被保留
+type sessionTranscriber struct {
+	screen  *vt.Screen
+	history []transcriptLine    // 已滚出屏幕或被清除、尚未输出的行
+	prompts map[string]struct{} // 观察到的提示符
+	// promptRe 用户指定的提示符模式，为nil时根据promptChars自动识别
+	promptRe *regexp.Regexp
+	base     int // history[0]的绝对行号
+	done     int // 绝对行号小于done的行已经输出
+	emitted  int // 已输出的命令数
+	emit     func(CommandOutput) error
+	err      error // emit返回的第一个错误
+
+	time        float64
+	scrolled    int // 当前帧中滚出屏幕的行数
+	pending     *pendingPrompt
+	appearances []promptEvent // 提示符出现的时刻
+	submissions []promptEvent // 命令提交的时刻
+	exits       []exitEvent   // OSC 133;D报告的退出码
+	cwds        []cwdEvent    // OSC 7报告的工作目录
+	// integrated 录像中有shell集成事件，此时以事件确定提示符和命令边界
+	integrated bool
+}
 
-		if endTime, ok := frameMap["d"].(float64); ok {
-			f.EndTime = endTime
-		}
+type exitEvent struct {
+	time   float64
+	status int
+}
 
-		return nil
-	}
+type cwdEvent struct {
+	time float64
+	path string
+}
 
-	// 数组格式，标准的asciicast v2帧: [time, type, data]
-	var arr []interface{}
-	if err := json.Unmarshal(data, &arr); err != nil {
-		return err
+// newSessionTranscriber 创建会话重建器，每识别出一条完整的命令就调用emit
+func newSessionTranscriber(width, height int, promptRe *regexp.Regexp, emit func(CommandOutput) error) *sessionTranscriber {
+	t := &sessionTranscriber{
+		screen:   vt.New(width, height),
+		prompts:  map[string]struct{}{},
+		promptRe: promptRe,
+		emit:     emit,
 	}
-
-	if len(arr) < 3 {
-		return fmt.Errorf("invalid frame format: %s", string(data))
+	t.screen.OnScrollOut = func(line []vt.Cell) {
+		t.history = append(t.history, newTranscriptLine(line))
+		t.scrolled++
 	}
+	t.screen.OnOSC = func(data string) {
+		// FinalTerm shell集成：133;D;<退出码> 表示命令结束
+		if rest, ok := strings.CutPrefix(data, "133;D;"); ok {
+			if status, err := strconv.Atoi(strings.SplitN(rest, ";", 2)[0]); err == nil {
+				t.exits = append(t.exits, exitEvent{time: t.time, status: status})
+			}
+		}
+		// 没有记录工作目录事件的录像，从输出中的OSC 7得到工作目录
+		if rest, ok := strings.CutPrefix(data, "7;"); ok {
+			t.addCwd(t.time, rest)
+		}
+	}
+	t.screen.OnClear = func(lines [][]vt.Cell) {
+		t.history = append(t.history, trimBlankLines(linesOf(lines))...)
+	}
+	return t
+}
 
-	// 提取时间
-	if time, ok := arr[0].(float64); ok {
-		f.Time = time
-	} else {
-		return fmt.Errorf("invalid time format: %v", arr[0])
+func newTranscriptLine(cells []vt.Cell) transcriptLine {
+	last := len(cells) - 1
+	return transcriptLine{
+		text: vt.CellsText(cells),
+		full: last >= 0 && cells[last].Char != ' ',
 	}
+}
 
-	// 提取类型
-	if eventType, ok := arr[1].(string); ok {
-		f.EventType = eventType
-	} else {
-		return fmt.Errorf("invalid event type: %v", arr[1])
+func linesOf(rows [][]vt.Cell) []transcriptLine {
+	lines := make([]transcriptLine, len(rows))
+	for i, row := range rows {
+		lines[i] = newTranscriptLine(row)
 	}
+	return lines
+}
 
-	// 提取数据
-	if eventData, ok := arr[2].(string); ok {
-		f.EventData = []byte(eventData)
-	} else {
-		return fmt.Errorf("invalid event data: %v", arr[2])
+// trimBlankLines 去掉末尾的空行
+func trimBlankLines(lines []transcriptLine) []transcriptLine {
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(lines[end-1].text) == "" {
+		end--
 	}
+	return lines[:end]
+}
 
+// feed 将一帧写入终端模拟器
+func (t *sessionTranscriber) feed(frame asciicast.Frame) error {
+	switch frame.EventType {
+	case asciicast.ResizeEventType:
+		if cols, rows, ok := frame.Size(); ok {
+			t.screen.Resize(cols, rows)
+		}
+		return nil
+	case asciicast.ShellEventType:
+		t.time = frame.Time
+		t.shellEvent(string(frame.EventData))
+		return nil
+	case asciicast.CwdEventType:
+		t.addCwd(frame.Time, string(frame.EventData))
+		return nil
+	}
+	data, err := frame.OutputData()
+	if err != nil || data == nil {
+		return err
+	}
+	t.time = math.Max(frame.Time, frame.EndTime)
+	t.scrolled = 0
+	t.screen.Write(data)
+	t.trackPending()
+	t.samplePrompt()
 	return nil
 }
 
-// 是否为压缩帧
-func (f *castFrame) IsCompressed() bool {
-	return f.EventType == "z"
+// trackPending 检查等待输入的提示符行：光标离开该行(或该行被滚走)时视为命令已提交，
+// 输入过长自动换行到下一行时仍属于同一行
+func (t *sessionTranscriber) trackPending() {
+	p := t.pending
+	if p == nil {
+		return
+	}
+	_, y, _ := t.screen.Cursor()
+	row := p.row - t.scrolled
+	onPrompt := row >= 0 && strings.HasPrefix(t.screen.LineText(row), p.prompt)
+	if t.integrated {
+		// 由C事件确定提交时刻，这里只跟踪提示符行的位置
+		p.row = row
+		if onPrompt {
+			p.text = t.joinedText(row)
+		}
+		return
+	}
+	if onPrompt && y >= row && t.wrappedUntil(row, y) {
+		p.row = row
+		p.text = t.joinedText(row)
+		return
+	}
+	t.submit(row)
 }
 
-// 处理压缩帧
-func processCompressedFrame(frame castFrame) ([]byte, error) {
-	// 解码base64数据
-	decoded, err := base64.StdEncoding.DecodeString(string(frame.EventData))
-	if err != nil {
-		return nil, fmt.Errorf("base64解码失败: %v", err)
+// submit 记录等待输入的提示符行的命令已提交，row为该行当前在屏幕中的位置，负数表示已滚出屏幕。
+// 提交时才输出之前的命令：该行被原地改写成了其他内容(如进度输出)时，说明它只是看起来像提示符
+func (t *sessionTranscriber) submit(row int) {
+	p := t.pending
+	// 找到提示符行现在的内容
+	text := p.text
+	if line := t.screen.LineText(row); row >= 0 && strings.HasPrefix(line, p.prompt) {
+		text = t.joinedText(row)
+	} else if row >= 0 && strings.TrimSpace(line) != "" && !t.integrated {
+		t.rejectPending()
+		return
+	} else if idx := len(t.history) + row; row < 0 && idx >= 0 && idx < len(t.history) {
+		if h := t.history[idx].text; strings.HasPrefix(h, p.prompt) && len(h) >= len(p.text) {
+			text = h
+		}
 	}
+	// 新的提示符说明之前的命令都已结束
+	if p.prompt != continuationPrompt {
+		t.emitUntil(row, false)
+	}
+	t.submissions = append(t.submissions, promptEvent{
+		time:         t.time,
+		cmd:          strings.TrimSpace(strings.TrimPrefix(text, p.prompt)),
+		continuation: p.prompt == continuationPrompt,
+	})
+	t.pending = nil
+}
 
-	// 使用gzip解压数据
-	gzipReader, err := gzip.NewReader(bytes.NewReader(decoded))
-	if err != nil {
-		return nil, fmt.Errorf("创建gzip读取器失败: %v", err)
+// rejectPending 丢弃等待输入的提示符行：忘掉这一行新识别出的提示符以及它出现的时刻
+func (t *sessionTranscriber) rejectPending() {
+	if t.pending.learned {
+		delete(t.prompts, t.pending.prompt)
 	}
-	defer gzipReader.Close()
+	t.appearances = t.appearances[:len(t.appearances)-1]
+	t.pending = nil
+}
 
-	// 读取解压后的数据
-	decompressed, err := io.ReadAll(gzipReader)
-	if err != nil {
-		return nil, fmt.Errorf("读取解压数据失败: %v", err)
+// shellEvent 处理录制时捕获的OSC 133事件：B之前的文本为提示符，C为命令提交，D带有退出码
+func (t *sessionTranscriber) shellEvent(data string) {
+	t.integrated = true
+	kind, status, hasStatus := asciicast.ParseShellEvent(data)
+	switch kind {
+	case "B":
+		x, y, _ := t.screen.Cursor()
+		line := t.screen.Line(y)
+		prefix := strings.TrimRight(vt.CellsText(line[:min(x, len(line))]), " ")
+		if prefix != "" {
+			t.promptShown(prefix, y)
+		}
+	case "C":
+		if t.pending != nil {
+			t.submit(t.pending.row)
+		}
+	case "D":
+		if hasStatus {
+			t.exits = append(t.exits, exitEvent{time: t.time, status: status})
+		}
 	}
+}
 
-	return decompressed, nil
+// wrappedUntil 第from行到第to-1行是否都写满了整行(即自动换行到了第to行)
+func (t *sessionTranscriber) wrappedUntil(from, to int) bool {
+	for y := from; y < to; y++ {
+		if !newTranscriptLine(t.screen.Line(y)).full {
+			return false
+		}
+	}
+	return true
 }
 
-// ToJSON 将录像文件转换为简化的JSON格式
-func (r *Runner) ToJSON() error {
-	if r.FilePath == "" {
-		return fmt.Errorf("未指定输入文件")
+// joinedText 返回从第y行开始、包括自动换行的后续行在内的文本
+func (t *sessionTranscriber) joinedText(y int) string {
+	_, rows := t.screen.Size()
+	var b strings.Builder
+	for ; y < rows; y++ {
+		line := newTranscriptLine(t.screen.Line(y))
+		b.WriteString(line.text)
+		if !line.full {
+			break
+		}
 	}
+	return b.String()
+}
 
-	// 如果没有指定输出文件，则使用与输入文件相同的基础名称，但扩展名为.json
-	outputFile := r.FilePath
-	if strings.HasSuffix(outputFile, ".cast") {
-		outputFile = strings.ReplaceAll(outputFile, ".cast", ".json")
-	} else {
-		outputFile = outputFile + ".json"
+// isPrompt 判断光标前的文本是否为提示符：有shell集成事件时只识别续行提示符，
+// 指定了promptRe时整个文本须与之匹配，否则以promptChars中的字符结尾即可
+func (t *sessionTranscriber) isPrompt(prefix string) bool {
+	if prefix == continuationPrompt {
+		return true
 	}
+	if t.integrated {
+		return false
+	}
+	if t.promptRe != nil {
+		loc := t.promptRe.FindStringIndex(prefix)
+		return loc != nil && strings.TrimRight(prefix[:loc[1]], " ") == prefix
+	}
+	last := []rune(prefix)[len([]rune(prefix))-1]
+	return strings.ContainsRune(promptChars, last)
+}
 
-	// 读取录像文件
-	data, err := os.ReadFile(r.FilePath)
-	if err != nil {
-		return fmt.Errorf("读取文件失败: %v", err)
+// CompilePromptRegex 编译提示符模式，模式总是从行首开始匹配
+func CompilePromptRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	if _, err := regexp.Compile(expr); err != nil {
+		return nil, fmt.Errorf(util.T("invalid prompt regexp: %v"), err)
 	}
+	return regexp.Compile("^(?:" + expr + ")")
+}
 
-	// 按行分割JSON
-	lines := strings.Split(string(data), "\n")
-	if len(lines) < 2 {
-		return fmt.Errorf("录像文件格式不正确")
+// samplePrompt 光标停在一个以提示符结尾、后面没有内容的行上时，记录光标前的文本为提示符
+func (t *sessionTranscriber) samplePrompt() {
+	x, y, visible := t.screen.Cursor()
+	if !visible || t.screen.AltScreen() || x == 0 {
+		return
+	}
+	line := t.screen.Line(y)
+	prefix := strings.TrimRight(vt.CellsText(line[:x]), " ")
+	if prefix == "" || vt.CellsText(line) != vt.CellsText(line[:x]) {
+		return
+	}
+	if !t.isPrompt(prefix) {
+		return
 	}
+	if t.integrated {
+		// 提示符由B事件确定，这里只学习续行提示符
+		t.prompts[prefix] = struct{}{}
+		return
+	}
+	t.promptShown(prefix, y)
+}
 
-	// 第一行是文件头信息，忽略
-	frameLines := lines[1:]
+// promptShown 记录第y行出现了提示符prefix
+func (t *sessionTranscriber) promptShown(prefix string, y int) {
+	_, known := t.prompts[prefix]
+	t.prompts[prefix] = struct{}{}
+	if t.pending != nil {
+		return
+	}
+	t.pending = &pendingPrompt{prompt: prefix, row: y, text: vt.CellsText(t.screen.Line(y)), learned: !known}
+	t.appearances = append(t.appearances, promptEvent{time: t.time, continuation: prefix == continuationPrompt})
+}
 
-	var commands []CommandOutput
-	var currentCommand string
-	var currentOutput strings.Builder
+// emitUntil 输出屏幕第row行(负数表示已滚出屏幕的行)之前尚未输出的内容中的命令，
+// 并丢弃已输出的历史行；final为true时输出全部剩余内容
+func (t *sessionTranscriber) emitUntil(row int, final bool) {
+	_, rows := t.screen.Size()
+	if final {
+		row = rows
+	}
+	start := t.base + len(t.history) // 屏幕第0行的绝对行号
+	end := start + row
+	lines := []transcriptLine{}
+	for i, line := range t.history {
+		if abs := t.base + i; abs >= t.done && abs < end {
+			lines = append(lines, line)
+		}
+	}
+	for y := max(0, t.done-start); y < row; y++ {
+		lines = append(lines, newTranscriptLine(t.screen.Line(y)))
+	}
+	t.done = max(t.done, end)
+	t.history = t.history[max(0, len(t.history)+min(row, 0)):]
+	t.base = start - len(t.history)
+
+	text := joinWrapped(trimBlankLines(lines))
+	commands := t.splitCommands(text)
+	if final && t.emitted == 0 && len(commands) == 0 && len(text) > 0 {
+		// 没有识别出提示符时，第一行作为命令，其余作为输出
+		commands = append(commands, CommandOutput{
+			Cmd:     strings.TrimSpace(text[0]),
+			Out:     joinOutput(text[1:]),
+			guessed: true,
+		})
+	} else {
+		t.assignTimes(commands)
+	}
+	for _, c := range commands {
+		c.Cwd = t.cwdAt(c.Start)
+		if t.err == nil {
+			t.err = t.emit(c)
+		}
+		t.emitted++
+	}
+}
 
-	// 创建正则表达式匹配命令行的提示符和输入模式
-	cmdPattern := regexp.MustCompile(`^[^\r\n]*[$#>]\s+[^$#>]+$`)
+// addCwd 记录at时刻OSC 7报告的工作目录
+func (t *sessionTranscriber) addCwd(at float64, data string) {
+	if _, path := asciicast.ParseCwdEvent(data); path != "" {
+		t.cwds = append(t.cwds, cwdEvent{time: at, path: path})
+	}
+}
 
-	for _, line := range frameLines {
-		if len(line) == 0 {
+// cwdAt 返回at时刻提交的命令的工作目录，即在此之前最后报告的目录。与提交同一帧报告的目录
+// 来自命令结束后的提示符(如很快结束的cd)，不算在内。同一目录可能由事件和输出中的序列各报告一次，
+// 时间相同时以后记录的为准
+func (t *sessionTranscriber) cwdAt(at float64) string {
+	cwd, last := "", -1.0
+	for _, e := range t.cwds {
+		if e.time < at && e.time >= last {
+			cwd, last = e.path, e.time
+		}
+	}
+	return cwd
+}
+
+// joinWrapped 将写满整行的行与下一行合并
+func joinWrapped(lines []transcriptLine) []string {
+	result := []string{}
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line.text)
+		if line.full {
 			continue
 		}
+		result = append(result, b.String())
+		b.Reset()
+	}
+	if b.Len() > 0 {
+		result = append(result, b.String())
+	}
+	return result
+}
 
-		// 解析帧
-		var frame castFrame
-		if err := json.Unmarshal([]byte(line), &frame); err != nil {
-			fmt.Printf("解析帧失败: %v, 行: %s\n", err, line)
+// continuationPrompt shell默认的续行提示符(PS2)
+const continuationPrompt = ">"
+
+// matchPrompt 如果行以观察到的提示符开头，返回提示符及之后的命令；有多个匹配时取最短的提示符
+func (t *sessionTranscriber) matchPrompt(line string) (prompt, cmd string, ok bool) {
+	if t.promptRe != nil {
+		if loc := t.promptRe.FindStringIndex(line); loc != nil && loc[1] > 0 {
+			return strings.TrimRight(line[:loc[1]], " "), strings.TrimSpace(line[loc[1]:]), true
+		}
+	}
+	for p := range t.prompts {
+		if t.promptRe != nil && p != continuationPrompt {
 			continue
 		}
+		if strings.HasPrefix(line, p) && (!ok || len(p) < len(prompt)) {
+			prompt, ok = p, true
+		}
+	}
+	if !ok {
+		return "", "", false
+	}
+	return prompt, strings.TrimSpace(line[len(prompt):]), true
+}
 
-		var outputData []byte
-		if frame.IsCompressed() {
-			// 处理压缩帧
-			decompressed, err := processCompressedFrame(frame)
-			if err != nil {
-				fmt.Printf("处理压缩帧失败: %v\n", err)
+// splitCommands 按提示符将会话文本拆分为命令及其输出
+func (t *sessionTranscriber) splitCommands(lines []string) []CommandOutput {
+	commands := []CommandOutput{}
+	var current *CommandOutput
+	var out []string
+	flush := func() {
+		if current != nil && current.Cmd != "" {
+			current.Out = joinOutput(out)
+			commands = append(commands, *current)
+		}
+		current, out = nil, nil
+	}
+	for _, line := range lines {
+		if prompt, cmd, ok := t.matchPrompt(line); ok {
+			// 续行提示符之后的内容属于上一条命令(如here document)
+			if prompt == continuationPrompt && current != nil && len(out) == 0 {
+				current.Cmd += "\n" + cmd
 				continue
 			}
-			outputData = decompressed
-		} else {
-			outputData = frame.EventData
+			flush()
+			current = &CommandOutput{Cmd: cmd}
+			continue
 		}
-
-		// 将输出数据转换为字符串
-		outputStr := string(outputData)
-
-		// 改进的命令行识别逻辑
-		// 1. 检查是否只包含一行以回车结尾的内容
-		// 2. 或者匹配常见的命令行模式
-		isCommand := false
-
-		// 检查是否是单行命令输入
-		if (strings.HasSuffix(outputStr, "\r\n") || strings.HasSuffix(outputStr, "\n")) &&
-			strings.Count(outputStr, "\n") <= 1 && strings.Count(outputStr, "\r") <= 1 {
-			trimmedStr := strings.TrimRight(outputStr, "\r\n")
-			if len(trimmedStr) > 0 && !strings.ContainsAny(trimmedStr, "\r\n") {
-				isCommand = true
-			}
+		if current != nil {
+			out = append(out, line)
 		}
+	}
+	flush()
+	return commands
+}
 
-		// 如果不是单行命令，尝试用正则匹配常见的命令模式
-		if !isCommand && cmdPattern.MatchString(strings.TrimRight(outputStr, "\r\n")) {
-			isCommand = true
+// assignTimes 按顺序将命令与提交事件对应，填充开始、结束时间和退出码，并丢弃用过的事件。
+// 续行和空命令的提交不对应任何命令；命令在下一个非续行提示符出现时结束
+func (t *sessionTranscriber) assignTimes(commands []CommandOutput) {
+	for i := range commands {
+		for len(t.submissions) > 0 && (t.submissions[0].continuation || t.submissions[0].cmd == "") {
+			t.submissions = t.submissions[1:]
+		}
+		if len(t.submissions) == 0 {
+			return
 		}
+		c := &commands[i]
+		c.Start = t.submissions[0].time
+		t.submissions = t.submissions[1:]
 
-		if isCommand {
-			// 如果当前有命令和输出，保存它们
-			if currentCommand != "" && currentOutput.Len() > 0 {
-				commands = append(commands, CommandOutput{
-					Cmd: currentCommand,
-					Out: currentOutput.String(),
-				})
-			}
+		c.End = t.time
+		for len(t.appearances) > 0 && (t.appearances[0].time < c.Start || t.appearances[0].continuation) {
+			t.appearances = t.appearances[1:]
+		}
+		if len(t.appearances) > 0 {
+			c.End = t.appearances[0].time
+		}
+		c.Duration = roundTime(c.End - c.Start)
 
-			// 设置新的当前命令（移除结尾的回车换行）
-			currentCommand = strings.TrimRight(outputStr, "\r\n")
-			currentOutput.Reset()
-		} else {
-			// 追加到当前输出
-			currentOutput.WriteString(outputStr)
+		for len(t.exits) > 0 && t.exits[0].time < c.Start {
+			t.exits = t.exits[1:]
+		}
+		if len(t.exits) > 0 && t.exits[0].time <= c.End {
+			status := t.exits[0].status
+			c.ExitStatus = &status
 		}
 	}
+}
 
-	// 添加最后一个命令及其输出
-	if currentCommand != "" && currentOutput.Len() > 0 {
-		commands = append(commands, CommandOutput{
-			Cmd: currentCommand,
-			Out: currentOutput.String(),
-		})
+func joinOutput(lines []string) string {
+	lines = trimTrailingEmpty(lines)
+	if len(lines) == 0 {
+		return ""
 	}
+	return strings.Join(lines, "\n") + "\n"
+}
 
-	// 如果没有提取到命令，尝试简单处理
-	if len(commands) == 0 {
-		// 将所有数据分割为可能的命令和输出
-		allText := strings.Builder{}
-		for _, line := range frameLines {
-			if len(line) == 0 {
-				continue
-			}
+func trimTrailingEmpty(lines []string) []string {
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	return lines[:end]
+}
 
-			var frame castFrame
-			if err := json.Unmarshal([]byte(line), &frame); err != nil {
-				continue
-			}
+// transcribe 读取cast文件，逐帧重建会话，每识别出一条完整的命令就调用emit
+func transcribe(in io.Reader, promptRe *regexp.Regexp, emit func(CommandOutput) error) error {
+	dec := asciicast.NewDecoder(in)
+	dec.OnInvalid = func(n int, line []byte, err error) {
+		fmt.Println(util.Tf("failed to parse the frame on line %d: %v, line: %s", n, err, line))
+	}
+	header, err := dec.Header()
+	if err != nil {
+		return fmt.Errorf(util.T("invalid cast header: %v"), err)
+	}
+	t := newSessionTranscriber(header.Width, header.Height, promptRe, emit)
+	for _, frame := range dec.All() {
+		if ferr := t.feed(frame); ferr != nil {
+			fmt.Println(util.Tf("failed to process a compressed frame: %v", ferr))
+		}
+		if t.err != nil {
+			break
+		}
+	}
+	if err := dec.Err(); err != nil {
+		return fmt.Errorf(util.T("reading the file failed: %v"), err)
+	}
+	if t.err == nil {
+		t.emitUntil(0, true)
+	}
+	return t.err
+}
 
-			var outputData []byte
-			if frame.IsCompressed() {
-				decompressed, err := processCompressedFrame(frame)
-				if err != nil {
-					continue
-				}
-				outputData = decompressed
-			} else {
-				outputData = frame.EventData
-			}
+// errStopTranscribe 不再需要更多命令时由emit返回，停止识别
+var errStopTranscribe = errors.New("stop transcribing")
 
-			allText.Write(outputData)
+// firstCommand 返回录制的帧中在提示符后识别出的第一条非空命令，没有识别出时返回空。
+// 使用内存中的帧而不是录像文件，压缩的帧组中无法看出提示符出现的时刻
+func firstCommand(width, height int, frames []asciicast.Frame, promptRe *regexp.Regexp) string {
+	command := ""
+	t := newSessionTranscriber(width, height, promptRe, func(c CommandOutput) error {
+		if c.guessed || strings.TrimSpace(c.Cmd) == "" {
+			return nil
+		}
+		command = c.Cmd
+		return errStopTranscribe
+	})
+	for _, frame := range frames {
+		t.feed(frame)
+		if t.err != nil {
+			return command
 		}
+	}
+	t.emitUntil(0, true)
+	return command
+}
 
-		// 分割所有文本为行
-		allLines := strings.Split(allText.String(), "\n")
-		var cmd, out strings.Builder
+// ToJSON 将录像文件转换为简化的JSON格式；NDJSON为true时每识别出一条命令就写入一行，
+// 不在内存中保存全部结果
+func (r *Runner) ToJSON() error {
+	if r.FilePath == "" {
+		return errors.New(util.T("no input file given"))
+	}
 
-		for i, line := range allLines {
-			line = strings.TrimRight(line, "\r")
-			if i == 0 && len(line) > 0 {
-				// 第一行作为命令
-				cmd.WriteString(line)
-			} else if len(line) > 0 {
-				// 其他行作为输出
-				out.WriteString(line)
-				out.WriteString("\n")
-			}
-		}
+	// 如果没有指定输出文件，则使用与输入文件相同的基础名称，但扩展名为.json(或.ndjson)
+	ext := ".json"
+	if r.NDJSON {
+		ext = ".ndjson"
+	}
+	outputFile := r.FilePath
+	if strings.HasSuffix(outputFile, ".cast") {
+		outputFile = strings.TrimSuffix(outputFile, ".cast") + ext
+	} else {
+		outputFile = outputFile + ext
+	}
+
+	promptRe, err := CompilePromptRegex(r.promptRegex())
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(r.FilePath)
+	if err != nil {
+		return fmt.Errorf(util.T("reading the file failed: %v"), err)
+	}
+	defer f.Close()
 
-		if cmd.Len() > 0 && out.Len() > 0 {
-			commands = append(commands, CommandOutput{
-				Cmd: cmd.String(),
-				Out: out.String(),
-			})
+	if r.NDJSON {
+		if err := writeNDJSON(f, promptRe, outputFile); err != nil {
+			return err
 		}
+		fmt.Println(util.Tf("Converted, output file: %s", outputFile))
+		return nil
+	}
+
+	commands := []CommandOutput{}
+	if err := transcribe(f, promptRe, func(c CommandOutput) error {
+		commands = append(commands, c)
+		return nil
+	}); err != nil {
+		return err
 	}
 
 	// 将结果写入JSON文件
 	resultJSON, err := json.Marshal(commands)
 	if err != nil {
-		return fmt.Errorf("生成JSON失败: %v", err)
+		return fmt.Errorf(util.T("generating JSON failed: %v"), err)
 	}
 
 	if err := os.WriteFile(outputFile, resultJSON, 0644); err != nil {
-		return fmt.Errorf("写入JSON文件失败: %v", err)
+		return fmt.Errorf(util.T("writing the JSON file failed: %v"), err)
 	}
 
-	fmt.Printf("转换成功，输出文件: %s\n", outputFile)
+	fmt.Println(util.Tf("Converted, output file: %s", outputFile))
 	return nil
 }
+
+// promptRegex 命令行指定的提示符模式优先，其次为配置文件[transcript]中的prompt-regex
+func (r *Runner) promptRegex() string {
+	if r.PromptRegex != "" || cfg == nil {
+		return r.PromptRegex
+	}
+	return cfg.TranscriptPromptRegex()
+}
+
+// writeNDJSON 边重建边写入，每行一个命令
+func writeNDJSON(in io.Reader, promptRe *regexp.Regexp, outputFile string) error {
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf(util.T("writing the JSON file failed: %v"), err)
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+	if err := transcribe(in, promptRe, func(c CommandOutput) error {
+		if err := enc.Encode(c); err != nil {
+			return fmt.Errorf(util.T("writing the JSON file failed: %v"), err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf(util.T("writing the JSON file failed: %v"), err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tojson的结果与testdata/tojson中的.json逐字节相同
+func TestToJSONGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		desc string
+	}{
+		{"shell", "逐字回显输入的普通shell会话"},
+		{"tui", "在备用屏幕中运行的全屏程序，其画面不进入输出"},
+		{"fake_prompt", "输出中以提示符字符结尾、随后被原地改写的进度行不是提示符"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", "tojson", tt.name+".cast"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			commands := []CommandOutput{}
+			if err := transcribe(f, nil, func(c CommandOutput) error {
+				commands = append(commands, c)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(commands, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", "tojson", tt.name+".json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s: output differs from %s\ngot:\n%s\nwant:\n%s", tt.desc, golden, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/util"
+)
+
+// transcriptSeq 注释时关心的输出内容：CSI序列、RIS、OSC序列和响铃
+var transcriptSeq = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]|\x1bc|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x07`)
+
+// colorNames 基本的16种颜色
+var colorNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// transcriptNote 用文字描述的一个终端事件
+type transcriptNote struct {
+	time  float64
+	text  string
+	color bool // 颜色变化，只在命令的输出中汇总，不单独列出
+}
+
+// transcriptParagraph 文字记录中的一段：一条命令及其输出，或命令之外的一个终端事件
+type transcriptParagraph struct {
+	time    float64
+	command *CommandOutput
+	notes   []transcriptNote
+}
+
+// Transcript 将录像写为便于屏幕阅读器朗读的纯文本：每段以时间开头，命令前加上"Command:"，
+// 之后是输出和退出码，工作目录改变时在命令前说明。annotate时还用文字描述清屏、颜色变化、全屏程序、标题、响铃、大小改变和标记
+func (r *Runner) Transcript(fPath string, annotate bool, w io.Writer) error {
+	promptRe, err := CompilePromptRegex(r.promptRegex())
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := asciicast.NewDecoder(f)
+	header, err := dec.Header()
+	if err != nil {
+		return fmt.Errorf(util.T("invalid cast header: %v"), err)
+	}
+	var notes []transcriptNote
+	if annotate {
+		notes = transcriptNotes(dec)
+		if err := dec.Err(); err != nil {
+			return err
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var commands []CommandOutput
+	if err := transcribe(f, promptRe, func(c CommandOutput) error {
+		commands = append(commands, c)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	writeTranscriptHeader(out, fPath, header)
+	cwd := ""
+	for _, p := range transcriptParagraphs(commands, notes) {
+		fmt.Fprintln(out)
+		// 工作目录只在改变时说明
+		showCwd := p.command != nil && p.command.Cwd != "" && p.command.Cwd != cwd
+		if showCwd {
+			cwd = p.command.Cwd
+		}
+		writeTranscriptParagraph(out, p, showCwd)
+	}
+	return out.Flush()
+}
+
+// writeTranscriptHeader 写入标题，以及录制时间、终端大小和时长
+func writeTranscriptHeader(w io.Writer, fPath string, header *asciicast.Header) {
+	title := header.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(fPath), ".cast")
+	}
+	fmt.Fprintf(w, "Transcript of %s\n", title)
+	var facts []string
+	if header.Timestamp > 0 {
+		facts = append(facts, "recorded on "+time.Unix(header.Timestamp, 0).Format("2 January 2006 at 15:04"))
+	}
+	if header.Width > 0 && header.Height > 0 {
+		facts = append(facts, fmt.Sprintf("%d columns by %d rows", header.Width, header.Height))
+	}
+	if header.Duration > 0 {
+		facts = append(facts, "duration "+transcriptClock(float64(header.Duration)))
+	}
+	if len(facts) > 0 {
+		text := strings.Join(facts, ", ")
+		fmt.Fprintf(w, "%s%s.\n", strings.ToUpper(text[:1]), text[1:])
+	}
+}
+
+// writeTranscriptParagraph 写入一段。命令之外的事件单独成段，命令中的事件写在输出之后；
+// showCwd时在命令之后说明工作目录
+func writeTranscriptParagraph(w io.Writer, p transcriptParagraph, showCwd bool) {
+	c := p.command
+	if c == nil {
+		for _, n := range p.notes {
+			fmt.Fprintf(w, "[%s] %s.\n", transcriptClock(n.time), sentence(n.text))
+		}
+		return
+	}
+	fmt.Fprintf(w, "[%s] Command: %s\n", transcriptClock(p.time), strings.ReplaceAll(c.Cmd, "\n", "\nContinued: "))
+	if showCwd {
+		fmt.Fprintf(w, "In directory %s.\n", c.Cwd)
+	}
+	if c.Out == "" {
+		fmt.Fprintln(w, "No output.")
+	} else {
+		fmt.Fprint(w, c.Out)
+	}
+	var colors []string
+	for _, n := range p.notes {
+		if n.color {
+			if !containsString(colors, n.text) {
+				colors = append(colors, n.text)
+			}
+			continue
+		}
+		fmt.Fprintf(w, "At %s: %s.\n", transcriptClock(n.time), n.text)
+	}
+	if len(colors) > 0 {
+		fmt.Fprintf(w, "Output shown in %s.\n", joinWords(colors))
+	}
+	if c.ExitStatus != nil {
+		fmt.Fprintf(w, "Exit status %d.\n", *c.ExitStatus)
+	}
+}
+
+// transcriptParagraphs 按时间排列命令和事件，命令执行期间的事件归入该命令
+func transcriptParagraphs(commands []CommandOutput, notes []transcriptNote) []transcriptParagraph {
+	paragraphs := make([]transcriptParagraph, 0, len(commands))
+	for i := range commands {
+		paragraphs = append(paragraphs, transcriptParagraph{time: commands[i].Start, command: &commands[i]})
+	}
+	var loose []transcriptParagraph
+	for _, n := range notes {
+		owner := -1
+		for i, c := range commands {
+			if c.End > c.Start && n.time >= c.Start && n.time < c.End {
+				owner = i
+				break
+			}
+		}
+		switch {
+		case owner >= 0:
+			paragraphs[owner].notes = append(paragraphs[owner].notes, n)
+		case n.color:
+			// 提示符等命令之外的颜色变化不描述
+		case len(loose) > 0 && loose[len(loose)-1].time == n.time:
+			loose[len(loose)-1].notes = append(loose[len(loose)-1].notes, n)
+		default:
+			loose = append(loose, transcriptParagraph{time: n.time, notes: []transcriptNote{n}})
+		}
+	}
+	paragraphs = append(paragraphs, loose...)
+	sort.SliceStable(paragraphs, func(i, j int) bool { return paragraphs[i].time < paragraphs[j].time })
+	return paragraphs
+}
+
+// transcriptNotes 从各帧中找出值得描述的终端事件，同一帧中重复的事件只记录一次
+func transcriptNotes(dec *asciicast.Decoder) []transcriptNote {
+	var notes []transcriptNote
+	for _, frame := range dec.All() {
+		var texts []string
+		switch frame.EventType {
+		case asciicast.MarkerEventType:
+			if label := string(frame.EventData); label != "" {
+				texts = append(texts, fmt.Sprintf("marker %q", label))
+			} else {
+				texts = append(texts, "marker")
+			}
+		case asciicast.AnnotationEventType:
+			texts = append(texts, fmt.Sprintf("annotation %q", string(frame.EventData)))
+		case asciicast.ResizeEventType:
+			if cols, rows, ok := frame.Size(); ok {
+				texts = append(texts, fmt.Sprintf("terminal resized to %d columns by %d rows", cols, rows))
+			}
+		}
+		for _, text := range texts {
+			notes = append(notes, transcriptNote{time: frame.Time, text: text})
+		}
+		data, err := frame.OutputData()
+		if err != nil || data == nil {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, seq := range transcriptSeq.FindAll(data, -1) {
+			for _, n := range describeSequence(seq) {
+				if !seen[n.text] {
+					seen[n.text] = true
+					n.time = frame.Time
+					notes = append(notes, n)
+				}
+			}
+		}
+	}
+	return notes
+}
+
+// describeSequence 用文字描述一个转义序列，没有意义的序列返回nil
+func describeSequence(seq []byte) []transcriptNote {
+	s := string(seq)
+	switch {
+	case s == "\x07":
+		return []transcriptNote{{text: "bell rang"}}
+	case s == "\x1bc":
+		return []transcriptNote{{text: "screen cleared"}}
+	case strings.HasPrefix(s, "\x1b]"):
+		body := strings.TrimSuffix(strings.TrimSuffix(s[2:], "\x07"), "\x1b\\")
+		num, title, _ := strings.Cut(body, ";")
+		if (num == "0" || num == "2") && title != "" {
+			return []transcriptNote{{text: fmt.Sprintf("window title set to %q", title)}}
+		}
+		return nil
+	}
+	params, final := s[2:len(s)-1], s[len(s)-1]
+	switch final {
+	case 'J':
+		if params == "2" || params == "3" {
+			return []transcriptNote{{text: "screen cleared"}}
+		}
+	case 'h', 'l':
+		for _, p := range strings.Split(strings.TrimPrefix(params, "?"), ";") {
+			if strings.HasPrefix(params, "?") && (p == "1049" || p == "1047" || p == "47") {
+				if final == 'h' {
+					return []transcriptNote{{text: "full-screen program opened, its screens are not transcribed"}}
+				}
+				return []transcriptNote{{text: "full-screen program closed"}}
+			}
+		}
+	case 'm':
+		if name := sgrColor(params); name != "" {
+			return []transcriptNote{{text: name, color: true}}
+		}
+	}
+	return nil
+}
+
+// sgrColor 返回SGR参数设置的前景色名称，没有设置前景色时返回空
+func sgrColor(params string) string {
+	parts := strings.Split(params, ";")
+	name := ""
+	for i := 0; i < len(parts); i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case n >= 30 && n <= 37:
+			name = colorNames[n-30]
+		case n >= 90 && n <= 97:
+			name = "bright " + colorNames[n-90]
+		case n == 38 && i+2 < len(parts) && parts[i+1] == "5":
+			c, _ := strconv.Atoi(parts[i+2])
+			switch {
+			case c < 8:
+				name = colorNames[c]
+			case c < 16:
+				name = "bright " + colorNames[c-8]
+			default:
+				name = "a custom color"
+			}
+			i += 2
+		case n == 38 && i+4 < len(parts) && parts[i+1] == "2":
+			name = "a custom color"
+			i += 4
+		case n == 48 && i+1 < len(parts):
+			// 背景色的参数
+			if parts[i+1] == "5" {
+				i += 2
+			} else if parts[i+1] == "2" {
+				i += 4
+			}
+		}
+	}
+	return name
+}
+
+// transcriptClock 将秒数显示为1:05或1:02:03
+func transcriptClock(t float64) string {
+	s := int(t)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// sentence 首字母大写
+func sentence(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// joinWords 以逗号和and连接，如"red, green and blue"
+func joinWords(words []string) string {
+	if len(words) == 1 {
+		return words[0]
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " and " + words[len(words)-1]
+}
+
+// containsString 判断list中是否有s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -2,33 +2,101 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"os/user"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/x6nux/asciinema/util"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
-	Upload_API = "https://asciinema.org/api/asciicasts"
+	Upload_API = "%s/api/asciicasts"
 )
 
-func (r *Runner) Upload() (resp string, err error) {
-	file, err := os.Open(r.FilePath)
+// uploadResponse asciinema-server以JSON返回的上传结果
+type uploadResponse struct {
+	URL     string `json:"url"`
+	Message string `json:"message"`
+}
+
+// UploadResult 上传到一个目标的结果
+type UploadResult struct {
+	Destination string
+	Response    string // 服务器的提示信息
+	Err         error
+}
+
+// Upload 按照官方asciinema客户端的方式上传录像：以用户名和install ID进行Basic认证，
+// 只上传标准的asciicast v2，返回服务器的提示信息(其中包含录像的链接)
+func (r *Runner) Upload() (string, error) {
+	return r.uploadTo(cfg.ApiUrl(), cfg.ApiToken(), "")
+}
+
+// UploadMulti 同时上传到配置文件中[destination "名称"]定义的多个目标，按names的顺序返回每个目标的结果。
+// 有未定义的目标时不上传
+func (r *Runner) UploadMulti(names []string) ([]UploadResult, error) {
+	type destination struct{ url, token string }
+	dests := make([]destination, len(names))
+	for i, name := range names {
+		url, token, ok := cfg.Destination(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown destination %q, define it as [destination \"%s\"] with a url in %s", name, name, cfg.Path)
+		}
+		dests[i] = destination{url, token}
+	}
+	results := make([]UploadResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			resp, err := r.uploadTo(dests[i].url, dests[i].token, name)
+			results[i] = UploadResult{Destination: name, Response: resp, Err: err}
+		}(i, name)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// uploadTo 上传到apiURL指定的asciinema服务器，name不为空时服务器的警告带上目标名称
+func (r *Runner) uploadTo(apiURL, installID, name string) (resp string, err error) {
+	end := traceOperation("upload", attribute.String("acast.file", r.FilePath), attribute.String("acast.server", apiURL))
+	defer func() {
+		if err != nil {
+			metricUploadErrors.Add(1)
+		}
+		end(err)
+	}()
+	payload, err := uploadPayload(r.FilePath)
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
 
 	buf := &bytes.Buffer{}
 	writer := multipart.NewWriter(buf)
 	filePart, err := writer.CreateFormFile("asciicast", "ascii.cast")
-	_, err = io.Copy(filePart, file)
+	if err != nil {
+		return "", err
+	}
+	filePart.Write(payload)
 	writer.Close()
-	req, _ := http.NewRequest("POST", Upload_API, buf)
-	req.SetBasicAuth("goAsciinema", cfg.ApiToken())
+	req, err := http.NewRequest("POST", fmt.Sprintf(Upload_API, strings.TrimRight(apiURL, "/")), buf)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(uploadUser(), installID)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Add("User-Agent", "goAsciinema/1.0.0")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", uploadUserAgent())
 	client := &http.Client{
 		Timeout: time.Second * 600,
 	}
@@ -36,12 +104,77 @@ func (r *Runner) Upload() (resp string, err error) {
 	if err != nil {
 		return "", err
 	}
-	body := &bytes.Buffer{}
-	_, err = body.ReadFrom(rsp.Body)
+	defer rsp.Body.Close()
+	body, err := io.ReadAll(rsp.Body)
 	if err != nil {
 		return "", err
 	}
-	rsp.Body.Close()
-	resp = body.String()
-	return resp, err
+	for _, warning := range rsp.Header.Values("Warning") {
+		if name != "" {
+			warning = name + ": " + warning
+		}
+		util.Warningf("%s", warning)
+	}
+	switch {
+	case rsp.StatusCode == http.StatusUnauthorized:
+		return "", fmt.Errorf("invalid or revoked install ID, run acast auth to check it")
+	case rsp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("upload API not found at %s, check the server URL", req.URL)
+	case rsp.StatusCode == http.StatusRequestEntityTooLarge:
+		return "", fmt.Errorf("sorry, your asciicast is too big")
+	case rsp.StatusCode >= 300:
+		if msg := strings.TrimSpace(string(body)); msg != "" && len(msg) < 1024 {
+			return "", fmt.Errorf("HTTP status %d: %s", rsp.StatusCode, msg)
+		}
+		return "", fmt.Errorf("HTTP status %d", rsp.StatusCode)
+	}
+	if strings.HasPrefix(rsp.Header.Get("Content-Type"), "application/json") {
+		result := uploadResponse{}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return "", fmt.Errorf("invalid response from the server: %v", err)
+		}
+		return util.FirstNonBlank(result.Message, result.URL), nil
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// uploadPayload 将录像转换为asciinema-server能解析的标准asciicast v2：
+// 解压压缩帧，去掉扩展事件和头部中的扩展字段
+func uploadPayload(fPath string) ([]byte, error) {
+	cast, err := readCast(fPath)
+	if err != nil {
+		return nil, err
+	}
+	if cast.Version != 2 {
+		return nil, fmt.Errorf("only asciicast v2 recordings can be uploaded, %s is version %d", fPath, cast.Version)
+	}
+	if cast.Stdout, err = standardFrames(cast.Stdout); err != nil {
+		return nil, err
+	}
+	cast.Machine, cast.Audio = nil, nil
+	return encodeCast(cast)
+}
+
+// uploadUser 返回Basic认证的用户名，与官方客户端一样使用当前的系统用户
+func uploadUser() string {
+	name := util.FirstNonBlank(os.Getenv("USER"), os.Getenv("LOGNAME"), os.Getenv("USERNAME"))
+	if name == "" {
+		if u, err := user.Current(); err == nil {
+			name = u.Username
+		}
+	}
+	return util.FirstNonBlank(name, "acast")
+}
+
+// uploadUserAgent 返回与官方客户端格式相同的User-Agent，如asciinema/1.2.0 Go/1.23.0 Linux/6.1.0-x86_64，
+// 服务器据此显示录制所在的系统
+func uploadUserAgent() string {
+	system := map[string]string{"linux": "Linux", "darwin": "Darwin", "windows": "Windows", "freebsd": "FreeBSD"}[runtime.GOOS]
+	system = util.FirstNonBlank(system, runtime.GOOS)
+	if release := osRelease(); release != "" {
+		system += "/" + release + "-" + runtime.GOARCH
+	} else {
+		system += "/" + runtime.GOARCH
+	}
+	return fmt.Sprintf("asciinema/%s Go/%s %s", Version, strings.TrimPrefix(runtime.Version(), "go"), system)
 }
@@ -0,0 +1,431 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/util"
+)
+
+// 后台录制的默认终端大小
+const (
+	daemonCols = 80
+	daemonRows = 24
+)
+
+// daemonStopTimeout 停止录制时等待程序在SIGHUP后退出的时间，超时后强制结束
+const daemonStopTimeout = 5 * time.Second
+
+// daemonSubscriberBuffer 每个实时订阅者等待发送的帧数，订阅者跟不上时丢弃多出的帧
+const daemonSubscriberBuffer = 1024
+
+// daemonHistoryBytes 录制中的会话在内存中保留的最近输出，新的观看者连接时用来重建屏幕
+const daemonHistoryBytes = 256 << 10
+
+var (
+	// ErrSessionNotFound 指定的录制会话不存在
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrInvalidFile 请求的录像文件不在录像目录中
+	ErrInvalidFile = errors.New("the file must be a relative path inside the recording directory")
+)
+
+// StartOptions acast daemon开始一个后台录制的参数
+type StartOptions struct {
+	File       string   `json:"file,omitempty"`        // 录像文件，相对于录像目录，为空时使用<会话ID>.cast
+	Command    string   `json:"command,omitempty"`     // 录制的命令，为空时使用$SHELL
+	Title      string   `json:"title,omitempty"`       // 录像标题
+	Cols       int      `json:"cols,omitempty"`        // 终端列数，列数或行数为0时为80x24
+	Rows       int      `json:"rows,omitempty"`        // 终端行数
+	Env        []string `json:"env,omitempty"`         // 额外的环境变量(KEY=VAL)
+	AllowInput bool     `json:"allow_input,omitempty"` // 允许WebSocket客户端向被录制的程序输入，输入记录到<file>.input.log中
+}
+
+// SessionInfo 一个后台录制会话的状态
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	File       string    `json:"file"`
+	Command    string    `json:"command"`
+	Title      string    `json:"title,omitempty"`
+	Cols       int       `json:"cols"`
+	Rows       int       `json:"rows"`
+	Started    time.Time `json:"started"`
+	Running    bool      `json:"running"`
+	Frames     int64     `json:"frames"`
+	Duration   float64   `json:"duration"`            // 已录制的时长(秒)
+	ExitCode   *int      `json:"exit_code,omitempty"` // 程序退出后的退出码
+	Error      string    `json:"error,omitempty"`
+	AllowInput bool      `json:"allow_input,omitempty"` // 允许WebSocket客户端输入
+}
+
+// daemonSession 一个在伪终端中运行、不连接任何真实终端的录制
+type daemonSession struct {
+	info    SessionInfo
+	process *os.Process
+	input   chan []byte
+	audit   string // 注入的输入的审计日志，不允许输入时为空
+	done    chan struct{}
+	metrics *daemonMetrics
+
+	mu          sync.Mutex
+	subscribers map[chan asciicast.Frame]struct{}
+	history     []byte // 最近的输出，录制结束后清空
+}
+
+// daemonManager 管理acast daemon中的所有录制会话
+type daemonManager struct {
+	runner  *Runner
+	dir     string
+	metrics daemonMetrics
+
+	mu       sync.Mutex
+	sessions map[string]*daemonSession
+}
+
+func newDaemonManager(r *Runner, dir string) (*daemonManager, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &daemonManager{runner: r, dir: dir, sessions: map[string]*daemonSession{}}, nil
+}
+
+// castPath 返回录像在录像目录中的路径，不允许写到录像目录之外
+func (m *daemonManager) castPath(name string) (string, error) {
+	if !strings.HasSuffix(name, ".cast") {
+		name += ".cast"
+	}
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidFile, name)
+	}
+	return filepath.Join(m.dir, name), nil
+}
+
+// Start 在伪终端中运行命令并以流式写入的方式录制
+func (m *daemonManager) Start(opts StartOptions) (_ *SessionInfo, err error) {
+	defer func() {
+		if err != nil {
+			m.metrics.failed.Add(1)
+		}
+	}()
+	id := newSessionToken()
+	path, err := m.castPath(util.FirstNonBlank(opts.File, id))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%w: %s", os.ErrExist, path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	command := util.FirstNonBlank(opts.Command, os.Getenv("SHELL"), cfg.RecordCommand())
+	cols, rows := opts.Cols, opts.Rows
+	if cols <= 0 || rows <= 0 {
+		cols, rows = daemonCols, daemonRows
+	}
+
+	header := &asciicast.Header{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: time.Now().Unix(),
+		Command:   command,
+		Title:     opts.Title,
+		Env:       &asciicast.Env{Term: "xterm-256color", Shell: os.Getenv("SHELL")},
+	}
+	writer, err := NewStreamWriter(path, header)
+	if err != nil {
+		return nil, err
+	}
+	if m.runner.SyncInterval > 0 {
+		writer.syncIntervalMs = m.runner.SyncInterval
+	}
+	writer.enableCompress = !m.runner.DisableCompress
+
+	env := append(os.Environ(), "TERM=xterm-256color", asciicast.RecEnv+"=1", asciicast.RecordingEnv+"=true")
+	env = append(env, opts.Env...)
+	c := exec.Command("sh", "-c", command)
+	c.Env = env
+	master, err := startPty(c, cols, rows)
+	if err != nil {
+		writer.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	s := &daemonSession{
+		info: SessionInfo{
+			ID:         id,
+			File:       path,
+			Command:    command,
+			Title:      opts.Title,
+			Cols:       cols,
+			Rows:       rows,
+			Started:    time.Now(),
+			Running:    true,
+			AllowInput: opts.AllowInput,
+		},
+		process:     c.Process,
+		input:       make(chan []byte, 64),
+		done:        make(chan struct{}),
+		metrics:     &m.metrics,
+		subscribers: map[chan asciicast.Frame]struct{}{},
+	}
+	if opts.AllowInput {
+		s.audit = path + ".input.log"
+	}
+	m.mu.Lock()
+	m.sessions[id] = s
+	m.mu.Unlock()
+	m.metrics.started.Add(1)
+
+	queue := newFrameQueue(util.FirstNonBlank(m.runner.Backpressure, BackpressureBlock), frameQueueSize, writer.WriteFrame)
+	stream := asciicast.NewStreamWithCallback(m.runner.MaxWait, func(frame asciicast.Frame) {
+		queue.Push(frame)
+		s.publish(frame)
+	})
+	go func() {
+		for {
+			select {
+			case data := <-s.input:
+				master.Write(data)
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := master.Read(buf)
+			if n > 0 {
+				stream.Write(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		waitErr := c.Wait()
+		// 程序退出后，留在后台的子进程可能一直占用伪终端，读取不会结束
+		select {
+		case <-readDone:
+		case <-time.After(200 * time.Millisecond):
+		}
+		master.Close()
+		<-readDone
+		stream.Close()
+		queue.Close()
+		header.Duration = asciicast.Duration(stream.Duration().Seconds())
+		writer.Close()
+		FixCast(path)
+
+		s.mu.Lock()
+		s.info.Running = false
+		s.info.Duration = stream.Duration().Seconds()
+		code := c.ProcessState.ExitCode()
+		s.info.ExitCode = &code
+		var exitErr *exec.ExitError
+		if waitErr != nil && !errors.As(waitErr, &exitErr) {
+			s.info.Error = waitErr.Error()
+		}
+		for ch := range s.subscribers {
+			close(ch)
+		}
+		s.subscribers = nil
+		s.history = nil
+		s.mu.Unlock()
+		m.metrics.finished.Add(1)
+		close(s.done)
+	}()
+
+	info := s.snapshot()
+	return &info, nil
+}
+
+// publish 将一帧发送给所有实时订阅者
+func (s *daemonSession) publish(frame asciicast.Frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.info.Frames++
+	s.info.Duration = frame.Time
+	s.metrics.frames.Add(1)
+	if frame.EventType == asciicast.OutputEventType {
+		s.metrics.bytes.Add(int64(len(frame.EventData)))
+		s.history = append(s.history, frame.EventData...)
+		if over := len(s.history) - daemonHistoryBytes; over > 0 {
+			// 从完整的一行开始，尽量不截断转义序列
+			if i := bytes.IndexByte(s.history[over:], '\n'); i >= 0 {
+				over += i + 1
+			}
+			s.history = append(s.history[:0], s.history[over:]...)
+		}
+	}
+	for ch := range s.subscribers {
+		select {
+		case ch <- frame:
+		default:
+		}
+	}
+}
+
+// Subscribe 返回实时接收录制的帧的通道，录制结束时通道被关闭；返回的函数取消订阅
+func (s *daemonSession) Subscribe() (<-chan asciicast.Frame, func()) {
+	_, ch, cancel := s.subscribe()
+	return ch, cancel
+}
+
+// subscribe 与Subscribe相同，同时返回订阅时内存中最近的输出，录制已经结束时为nil
+func (s *daemonSession) subscribe() ([]byte, <-chan asciicast.Frame, func()) {
+	ch := make(chan asciicast.Frame, daemonSubscriberBuffer)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscribers == nil {
+		close(ch)
+		return nil, ch, func() {}
+	}
+	s.subscribers[ch] = struct{}{}
+	s.metrics.viewers.Add(1)
+	return bytes.Clone(s.history), ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (s *daemonSession) snapshot() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.info
+}
+
+// Get 返回指定的会话
+func (m *daemonManager) Get(id string) (*daemonSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return s, nil
+}
+
+// Stop 像关闭终端一样向程序发送SIGHUP，等待录像写完后返回会话的最终状态
+func (m *daemonManager) Stop(id string) (*SessionInfo, error) {
+	s, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-s.done:
+	default:
+		hangupProcess(s.process)
+		select {
+		case <-s.done:
+		case <-time.After(daemonStopTimeout):
+			s.process.Kill()
+			<-s.done
+		}
+	}
+	info := s.snapshot()
+	return &info, nil
+}
+
+// StopAll 停止所有正在录制的会话，daemon退出时调用
+func (m *daemonManager) StopAll() {
+	var wg sync.WaitGroup
+	for _, info := range m.List() {
+		if info.Running {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				m.Stop(id)
+			}(info.ID)
+		}
+	}
+	wg.Wait()
+}
+
+// List 返回所有会话的状态，按开始时间排序
+func (m *daemonManager) List() []SessionInfo {
+	m.mu.Lock()
+	sessions := make([]*daemonSession, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	m.mu.Unlock()
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, s.snapshot())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Started.Before(infos[j].Started) })
+	return infos
+}
+
+// DaemonServeOptions acast daemon的选项
+type DaemonServeOptions struct {
+	Dir      string // 录像目录
+	GRPCAddr string // gRPC服务的监听地址，为空时不提供
+	HTTPAddr string // REST API的监听地址，为空时不提供
+	Token    string // 访问两种接口需要的令牌，未指定时随机生成
+}
+
+// Daemon 以服务方式运行，通过gRPC接口或REST API开始、停止和查看后台录制，直到被中断。
+// 退出时停止所有录制，录像都会被正常写完
+func (r *Runner) Daemon(opts DaemonServeOptions) error {
+	if opts.GRPCAddr == "" && opts.HTTPAddr == "" {
+		return errors.New("nothing to serve, use --grpc or --http")
+	}
+	m, err := newDaemonManager(r, opts.Dir)
+	if err != nil {
+		return err
+	}
+	util.AddCleanup(m.StopAll)
+	// 客户端可以通过两种接口执行任意命令，不提供不需要令牌的访问
+	if opts.Token == "" {
+		opts.Token = newSessionToken() + newSessionToken()
+		log.Printf("acast daemon: no --token given, clients must send \"Authorization: Bearer %s\"", opts.Token)
+	}
+	if opts.GRPCAddr != "" {
+		addr, stop, err := serveGRPC(opts.GRPCAddr, m, opts.Token)
+		if err != nil {
+			return fmt.Errorf("cannot serve gRPC: %v", err)
+		}
+		defer stop()
+		log.Printf("acast daemon: gRPC service %s on %s, recordings in %s", grpcServiceName, addr, opts.Dir)
+	}
+	if opts.HTTPAddr != "" {
+		addr, stop, err := serveDaemonHTTP(opts.HTTPAddr, m, opts.Token)
+		if err != nil {
+			return fmt.Errorf("cannot serve the REST API: %v", err)
+		}
+		defer stop()
+		log.Printf("acast daemon: REST API on http://%s/api/v1/, recordings in %s", addr, opts.Dir)
+	}
+	select {}
+}
+
+// validToken 以固定时间比较请求中的Authorization头部与令牌，令牌为空时拒绝所有请求
+func validToken(authorization, token string) bool {
+	if token == "" {
+		return false
+	}
+	given, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// grpcServiceName acast daemon的gRPC服务，定义见docs/control.proto
+const grpcServiceName = "acast.v1.Control"
+
+// controlFile 服务和消息的描述，与docs/control.proto一致。
+// 消息在运行时通过dynamicpb构造，不需要生成代码；服务注册了反射，grpcurl等工具可以直接调用
+var controlFile protoreflect.FileDescriptor
+
+func init() {
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	i32 := descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum()
+	i64 := descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()
+	dbl := descriptorpb.FieldDescriptorProto_TYPE_DOUBLE.Enum()
+	boolean := descriptorpb.FieldDescriptorProto_TYPE_BOOL.Enum()
+	byt := descriptorpb.FieldDescriptorProto_TYPE_BYTES.Enum()
+	msg := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+	field := func(name string, number int32, typ *descriptorpb.FieldDescriptorProto_Type, typeName ...string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   typ,
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if len(typeName) > 0 {
+			f.TypeName = proto.String(typeName[0])
+		}
+		return f
+	}
+	repeated := func(f *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+		f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		return f
+	}
+	message := func(name string, fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: fields}
+	}
+	method := func(name, in, out string, stream bool) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String(".acast.v1." + in),
+			OutputType:      proto.String(".acast.v1." + out),
+			ServerStreaming: proto.Bool(stream),
+		}
+	}
+	session := ".acast.v1.Session"
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("acast/v1/control.proto"),
+		Package: proto.String("acast.v1"),
+		Syntax:  proto.String("proto3"),
+		Options: &descriptorpb.FileOptions{GoPackage: proto.String("github.com/x6nux/asciinema/cmd")},
+		MessageType: []*descriptorpb.DescriptorProto{
+			message("Session",
+				field("id", 1, str), field("file", 2, str), field("command", 3, str), field("title", 4, str),
+				field("cols", 5, i32), field("rows", 6, i32), field("started", 7, i64), field("running", 8, boolean),
+				field("frames", 9, i64), field("duration", 10, dbl), field("exit_code", 11, i32), field("error", 12, str),
+				field("allow_input", 13, boolean)),
+			message("StartRecordingRequest",
+				field("file", 1, str), field("command", 2, str), field("title", 3, str),
+				field("cols", 4, i32), field("rows", 5, i32), repeated(field("env", 6, str)), field("allow_input", 7, boolean)),
+			message("StopRecordingRequest", field("id", 1, str)),
+			message("ListSessionsRequest"),
+			message("ListSessionsResponse", repeated(field("sessions", 1, msg, session))),
+			message("FramesRequest", field("id", 1, str)),
+			message("Frame", field("time", 1, dbl), field("type", 2, str), field("data", 3, byt)),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Control"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("StartRecording", "StartRecordingRequest", "Session", false),
+				method("StopRecording", "StopRecordingRequest", "Session", false),
+				method("ListSessions", "ListSessionsRequest", "ListSessionsResponse", false),
+				method("Frames", "FramesRequest", "Frame", true),
+			},
+		}},
+	}
+	fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	if err != nil {
+		panic(err)
+	}
+	if err := protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+		panic(err)
+	}
+	controlFile = fd
+}
+
+// newControlMessage 创建一个空的消息
+func newControlMessage(name protoreflect.Name) *dynamicpb.Message {
+	return dynamicpb.NewMessage(controlFile.Messages().ByName(name))
+}
+
+// messageField 返回消息中的字段值
+func messageField(m *dynamicpb.Message, name protoreflect.Name) protoreflect.Value {
+	return m.Get(m.Descriptor().Fields().ByName(name))
+}
+
+// setMessageField 设置消息中的字段，零值不设置
+func setMessageField(m *dynamicpb.Message, name protoreflect.Name, v interface{}) {
+	fd := m.Descriptor().Fields().ByName(name)
+	switch v := v.(type) {
+	case string:
+		if v != "" {
+			m.Set(fd, protoreflect.ValueOfString(v))
+		}
+	case int:
+		if v != 0 {
+			m.Set(fd, protoreflect.ValueOfInt32(int32(v)))
+		}
+	case int64:
+		if v != 0 {
+			m.Set(fd, protoreflect.ValueOfInt64(v))
+		}
+	case float64:
+		if v != 0 {
+			m.Set(fd, protoreflect.ValueOfFloat64(v))
+		}
+	case bool:
+		if v {
+			m.Set(fd, protoreflect.ValueOfBool(v))
+		}
+	case []byte:
+		if len(v) > 0 {
+			m.Set(fd, protoreflect.ValueOfBytes(v))
+		}
+	}
+}
+
+// sessionMessage 将会话状态转换为Session消息
+func sessionMessage(info *SessionInfo) *dynamicpb.Message {
+	m := newControlMessage("Session")
+	setMessageField(m, "id", info.ID)
+	setMessageField(m, "file", info.File)
+	setMessageField(m, "command", info.Command)
+	setMessageField(m, "title", info.Title)
+	setMessageField(m, "cols", info.Cols)
+	setMessageField(m, "rows", info.Rows)
+	setMessageField(m, "started", info.Started.Unix())
+	setMessageField(m, "running", info.Running)
+	setMessageField(m, "frames", info.Frames)
+	setMessageField(m, "duration", info.Duration)
+	if info.ExitCode != nil {
+		setMessageField(m, "exit_code", *info.ExitCode)
+	}
+	setMessageField(m, "error", info.Error)
+	setMessageField(m, "allow_input", info.AllowInput)
+	return m
+}
+
+// grpcError 将会话管理的错误转换为gRPC状态
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrSessionNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidFile):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, os.ErrExist):
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// unaryHandler 构造一元方法的处理函数
+func unaryHandler(in protoreflect.Name, method string, handle func(m *daemonManager, req *dynamicpb.Message) (proto.Message, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newControlMessage(in)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			call := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return handle(srv.(*daemonManager), req.(*dynamicpb.Message))
+			}
+			if interceptor == nil {
+				return call(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + grpcServiceName + "/" + method}, call)
+		},
+	}
+}
+
+// controlServiceDesc acast.v1.Control服务
+var controlServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		unaryHandler("StartRecordingRequest", "StartRecording", func(m *daemonManager, req *dynamicpb.Message) (proto.Message, error) {
+			opts := StartOptions{
+				File:       messageField(req, "file").String(),
+				Command:    messageField(req, "command").String(),
+				Title:      messageField(req, "title").String(),
+				Cols:       int(messageField(req, "cols").Int()),
+				Rows:       int(messageField(req, "rows").Int()),
+				AllowInput: messageField(req, "allow_input").Bool(),
+			}
+			env := messageField(req, "env").List()
+			for i := 0; i < env.Len(); i++ {
+				opts.Env = append(opts.Env, env.Get(i).String())
+			}
+			info, err := m.Start(opts)
+			if err != nil {
+				return nil, grpcError(err)
+			}
+			return sessionMessage(info), nil
+		}),
+		unaryHandler("StopRecordingRequest", "StopRecording", func(m *daemonManager, req *dynamicpb.Message) (proto.Message, error) {
+			info, err := m.Stop(messageField(req, "id").String())
+			if err != nil {
+				return nil, grpcError(err)
+			}
+			return sessionMessage(info), nil
+		}),
+		unaryHandler("ListSessionsRequest", "ListSessions", func(m *daemonManager, req *dynamicpb.Message) (proto.Message, error) {
+			resp := newControlMessage("ListSessionsResponse")
+			list := resp.Mutable(resp.Descriptor().Fields().ByName("sessions")).List()
+			for _, info := range m.List() {
+				list.Append(protoreflect.ValueOfMessage(sessionMessage(&info)))
+			}
+			return resp, nil
+		}),
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Frames",
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			req := newControlMessage("FramesRequest")
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			s, err := srv.(*daemonManager).Get(messageField(req, "id").String())
+			if err != nil {
+				return grpcError(err)
+			}
+			frames, cancel := s.Subscribe()
+			defer cancel()
+			for {
+				select {
+				case frame, ok := <-frames:
+					if !ok {
+						return nil
+					}
+					if err := stream.SendMsg(frameMessage(frame)); err != nil {
+						return err
+					}
+				case <-stream.Context().Done():
+					return stream.Context().Err()
+				}
+			}
+		},
+	}},
+	Metadata: "acast/v1/control.proto",
+}
+
+// frameMessage 将录制的帧转换为Frame消息
+func frameMessage(frame asciicast.Frame) *dynamicpb.Message {
+	m := newControlMessage("Frame")
+	setMessageField(m, "time", frame.Time)
+	setMessageField(m, "type", frame.EventType)
+	setMessageField(m, "data", frame.EventData)
+	return m
+}
+
+// tokenAuth 检查请求的authorization元数据中的令牌
+func tokenAuth(ctx context.Context, token string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if validToken(v, token) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid token")
+}
+
+// serveGRPC 在addr上提供acast.v1.Control服务，要求客户端在authorization元数据中提供"Bearer <token>"，
+// 包括反射调用。token为空时拒绝所有调用。返回实际监听的地址和关闭服务的函数
+func serveGRPC(addr string, m *daemonManager, token string) (string, func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", nil, err
+	}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := tokenAuth(ctx, token); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := tokenAuth(ss.Context(), token); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	server.RegisterService(&controlServiceDesc, m)
+	reflection.Register(server)
+	go server.Serve(ln)
+	return ln.Addr().String(), server.Stop, nil
+}
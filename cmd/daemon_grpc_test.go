@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestServeGRPCRequiresToken(t *testing.T) {
+	m, err := newDaemonManager(&Runner{}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"secret", ""} {
+		addr, stop, err := serveGRPC("127.0.0.1:0", m, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			stop()
+			t.Fatal(err)
+		}
+		list := func(ctx context.Context) error {
+			resp := newControlMessage("ListSessionsResponse")
+			return conn.Invoke(ctx, "/"+grpcServiceName+"/ListSessions", newControlMessage("ListSessionsRequest"), resp)
+		}
+		ctx := context.Background()
+		for _, auth := range []string{"", "Bearer wrong", "Bearer "} {
+			callCtx := ctx
+			if auth != "" {
+				callCtx = metadata.AppendToOutgoingContext(ctx, "authorization", auth)
+			}
+			if err := list(callCtx); status.Code(err) != codes.Unauthenticated {
+				t.Errorf("token %q, authorization %q: got %v, want Unauthenticated", token, auth, err)
+			}
+		}
+		if token != "" {
+			if err := list(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)); err != nil {
+				t.Errorf("token %q: call with the token failed: %v", token, err)
+			}
+		}
+		conn.Close()
+		stop()
+	}
+}
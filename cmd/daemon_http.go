@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// daemonHTTPError REST API返回的错误
+type daemonHTTPError struct {
+	Error string `json:"error"`
+}
+
+// writeDaemonJSON 以JSON格式返回v
+func writeDaemonJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// writeDaemonError 按照错误的种类返回对应的状态码
+func writeDaemonError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrSessionNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, ErrInvalidFile):
+		code = http.StatusBadRequest
+	case errors.Is(err, os.ErrExist):
+		code = http.StatusConflict
+	}
+	writeDaemonJSON(w, code, daemonHTTPError{Error: err.Error()})
+}
+
+// requireToken 要求请求带有"Authorization: Bearer <token>"头部
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !validToken(req.Header.Get("Authorization"), token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="acast"`)
+			writeDaemonJSON(w, http.StatusUnauthorized, daemonHTTPError{Error: "missing or invalid token"})
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// daemonHTTPHandler acast daemon的REST API：
+//
+//	GET  /healthz                        健康检查，不需要令牌
+//	GET  /metrics                        Prometheus格式的指标，不需要令牌
+//	GET  /api/v1/sessions                列出所有录制
+//	POST /api/v1/sessions                开始录制，请求体与StartOptions一致
+//	GET  /api/v1/sessions/{id}           查看录制的状态
+//	POST /api/v1/sessions/{id}/stop      停止录制，录像写完后返回最终状态
+//	GET  /api/v1/sessions/{id}/cast      下载录像，录制中时为已经写入的部分
+//	GET  /api/v1/sessions/{id}/play      以纯文本按时间戳实时播放录像，可以用speed和start调整
+//	GET  /api/v1/sessions/{id}/attach    WebSocket，可以直接用xterm.js的attach插件显示，见daemonAttachHandler
+func daemonHTTPHandler(m *daemonManager, token string) http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/v1/sessions", func(w http.ResponseWriter, req *http.Request) {
+		writeDaemonJSON(w, http.StatusOK, m.List())
+	})
+	api.HandleFunc("POST /api/v1/sessions", func(w http.ResponseWriter, req *http.Request) {
+		opts := StartOptions{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<20)).Decode(&opts); err != nil {
+			writeDaemonJSON(w, http.StatusBadRequest, daemonHTTPError{Error: "invalid request: " + err.Error()})
+			return
+		}
+		info, err := m.Start(opts)
+		if err != nil {
+			writeDaemonError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/api/v1/sessions/"+info.ID)
+		writeDaemonJSON(w, http.StatusCreated, info)
+	})
+	api.HandleFunc("GET /api/v1/sessions/{id}", func(w http.ResponseWriter, req *http.Request) {
+		s, err := m.Get(req.PathValue("id"))
+		if err != nil {
+			writeDaemonError(w, err)
+			return
+		}
+		writeDaemonJSON(w, http.StatusOK, s.snapshot())
+	})
+	api.HandleFunc("POST /api/v1/sessions/{id}/stop", func(w http.ResponseWriter, req *http.Request) {
+		info, err := m.Stop(req.PathValue("id"))
+		if err != nil {
+			writeDaemonError(w, err)
+			return
+		}
+		writeDaemonJSON(w, http.StatusOK, info)
+	})
+	api.HandleFunc("GET /api/v1/sessions/{id}/cast", func(w http.ResponseWriter, req *http.Request) {
+		s, err := m.Get(req.PathValue("id"))
+		if err != nil {
+			writeDaemonError(w, err)
+			return
+		}
+		path := s.snapshot().File
+		w.Header().Set("Content-Type", "application/x-asciicast")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filepath.Base(path)+`"`)
+		http.ServeFile(w, req, path)
+	})
+	api.HandleFunc("GET /api/v1/sessions/{id}/play", daemonPlayHandler(m))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, req *http.Request) {
+		writeDaemonJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.Handle("GET /metrics", m.metricsHandler())
+	mux.Handle("/api/", requireToken(token, api))
+	mux.Handle("GET /api/v1/sessions/{id}/attach", daemonAttachHandler(m, token))
+	return mux
+}
+
+// serveDaemonHTTP 在addr上提供REST API，返回实际监听的地址和关闭服务的函数
+func serveDaemonHTTP(addr string, m *daemonManager, token string) (string, func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", nil, err
+	}
+	server := &http.Server{Handler: daemonHTTPHandler(m, token)}
+	go server.Serve(ln)
+	return ln.Addr().String(), func() { server.Close() }, nil
+}
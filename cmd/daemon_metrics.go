@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// daemonMetrics acast daemon的运行指标，以Prometheus文本格式在/metrics中提供
+type daemonMetrics struct {
+	started  atomic.Int64 // 开始的录制数
+	finished atomic.Int64 // 结束的录制数
+	failed   atomic.Int64 // 未能开始的录制数
+	frames   atomic.Int64 // 录制的帧数
+	bytes    atomic.Int64 // 录制的输出字节数
+	viewers  atomic.Int64 // 实时观看的连接数，包括gRPC的Frames和WebSocket
+}
+
+// promMetric Prometheus的一个不带标签的指标
+type promMetric struct {
+	name  string
+	typ   string // counter或gauge
+	help  string
+	value float64
+}
+
+// writePromMetrics 按Prometheus文本格式写出指标
+func writePromMetrics(w io.Writer, metrics []promMetric) {
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n",
+			m.name, m.help, m.name, m.typ, m.name, strconv.FormatFloat(m.value, 'g', -1, 64))
+	}
+}
+
+// collect 返回当前的指标
+func (m *daemonManager) collect() []promMetric {
+	active, viewers := 0, 0
+	m.mu.Lock()
+	sessions := make([]*daemonSession, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	m.mu.Unlock()
+	for _, s := range sessions {
+		s.mu.Lock()
+		if s.info.Running {
+			active++
+		}
+		viewers += len(s.subscribers)
+		s.mu.Unlock()
+	}
+	return []promMetric{
+		{"acast_daemon_recordings_started_total", "counter", "Recordings started.", float64(m.metrics.started.Load())},
+		{"acast_daemon_recordings_finished_total", "counter", "Recordings that have ended and been written.", float64(m.metrics.finished.Load())},
+		{"acast_daemon_recordings_failed_total", "counter", "Recordings that could not be started.", float64(m.metrics.failed.Load())},
+		{"acast_daemon_sessions_active", "gauge", "Recordings currently running.", float64(active)},
+		{"acast_daemon_frames_total", "counter", "Output frames recorded.", float64(m.metrics.frames.Load())},
+		{"acast_daemon_output_bytes_total", "counter", "Output bytes recorded.", float64(m.metrics.bytes.Load())},
+		{"acast_daemon_viewers", "gauge", "Live viewers currently connected.", float64(viewers)},
+		{"acast_daemon_viewer_connections_total", "counter", "Live viewer connections accepted.", float64(m.metrics.viewers.Load())},
+		{"acast_upload_errors_total", "counter", "Failed uploads.", float64(metricUploadErrors.Value())},
+	}
+}
+
+// metricsHandler 提供Prometheus格式的/metrics
+func (m *daemonManager) metricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writePromMetrics(w, m.collect())
+	})
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+)
+
+// paceOptions 按时间戳播放录像的参数
+type paceOptions struct {
+	Speed float64 // 播放速度，2为两倍速
+	Start float64 // 从第几秒开始播放，之前的输出在开始时一起发送
+}
+
+// parsePaceOptions 读取speed和start查询参数
+func parsePaceOptions(query url.Values) (paceOptions, error) {
+	opts := paceOptions{Speed: 1}
+	if v := query.Get("speed"); v != "" {
+		speed, err := strconv.ParseFloat(v, 64)
+		if err != nil || speed <= 0 {
+			return opts, fmt.Errorf("invalid speed %q", v)
+		}
+		opts.Speed = speed
+	}
+	if v := query.Get("start"); v != "" {
+		start, err := strconv.ParseFloat(v, 64)
+		if err != nil || start < 0 {
+			return opts, fmt.Errorf("invalid start %q", v)
+		}
+		opts.Start = start
+	}
+	return opts, nil
+}
+
+// playPaced 按录像中的时间戳依次用send发送输出，ctx被取消或send出错时停止
+func playPaced(ctx context.Context, frames []asciicast.Frame, opts paceOptions, send func([]byte) error) error {
+	var backlog []byte
+	begin := time.Now()
+	for _, frame := range frames {
+		data, err := frame.OutputData()
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		if frame.Time <= opts.Start {
+			backlog = append(backlog, data...)
+			continue
+		}
+		if len(backlog) > 0 {
+			if err := send(backlog); err != nil {
+				return err
+			}
+			backlog = nil
+		}
+		wait := time.Duration((frame.Time-opts.Start)/opts.Speed*float64(time.Second)) - time.Since(begin)
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if err := send(data); err != nil {
+			return err
+		}
+	}
+	if len(backlog) > 0 {
+		return send(backlog)
+	}
+	return nil
+}
+
+// daemonPlayHandler 以纯文本按时间戳实时播放会话的录像，curl -N等不理解asciicast的客户端也能观看。
+// 录制中时播放已经写入的部分
+func daemonPlayHandler(m *daemonManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		s, err := m.Get(req.PathValue("id"))
+		if err != nil {
+			writeDaemonError(w, err)
+			return
+		}
+		opts, err := parsePaceOptions(req.URL.Query())
+		if err != nil {
+			writeDaemonJSON(w, http.StatusBadRequest, daemonHTTPError{Error: err.Error()})
+			return
+		}
+		rec, err := readCast(s.snapshot().File)
+		if err != nil {
+			writeDaemonError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+		rc := http.NewResponseController(w)
+		playPaced(req.Context(), rec.Stdout, opts, func(data []byte) error {
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			return rc.Flush()
+		})
+	}
+}
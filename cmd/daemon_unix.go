@@ -0,0 +1,21 @@
+//go:build darwin || freebsd || dragonfly || linux
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+// startPty 在指定大小的伪终端中启动命令，返回伪终端的主设备
+func startPty(c *exec.Cmd, cols, rows int) (*os.File, error) {
+	return pty.StartWithSize(c, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+}
+
+// hangupProcess 向程序所在的进程组发送SIGHUP，与关闭终端的效果相同
+func hangupProcess(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGHUP)
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// startPty Windows上暂不支持后台录制
+func startPty(c *exec.Cmd, cols, rows int) (*os.File, error) {
+	return nil, errors.New("background recording is not supported on Windows yet")
+}
+
+func hangupProcess(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"golang.org/x/net/websocket"
+)
+
+// Input 将按键写入被录制的程序，录制已经结束时丢弃
+func (s *daemonSession) Input(data []byte) {
+	select {
+	case s.input <- data:
+	case <-s.done:
+	}
+}
+
+// daemonAttachHandler 以xterm.js的attach插件使用的协议通过WebSocket提供录制的输出：
+// 服务器将终端输出作为二进制消息发送。默认只读，只有开始录制时设置了AllowInput的会话才将
+// 客户端发送的文本或二进制消息作为按键写入被录制的程序，并记录到<file>.input.log中；?readonly=1时仍然只读。
+// 浏览器无法设置WebSocket请求的头部，令牌也可以通过?token=传递。
+// ?play=1时改为按时间戳从头播放录像(可以用speed和start调整)，播放完后关闭连接；
+// ?format=asciicast时先发送asciicast v2的头部，之后每条文本消息是一个带时间戳的事件，供acast attach使用
+func daemonAttachHandler(m *daemonManager, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		authorization := req.Header.Get("Authorization")
+		if t := query.Get("token"); t != "" {
+			authorization = "Bearer " + t
+		}
+		if !validToken(authorization, token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="acast"`)
+			writeDaemonJSON(w, http.StatusUnauthorized, daemonHTTPError{Error: "missing or invalid token"})
+			return
+		}
+		s, err := m.Get(req.PathValue("id"))
+		if err != nil {
+			writeDaemonError(w, err)
+			return
+		}
+		readOnly, _ := strconv.ParseBool(query.Get("readonly"))
+		readOnly = readOnly || s.audit == ""
+		play, _ := strconv.ParseBool(query.Get("play"))
+		timed := query.Get("format") == "asciicast"
+		opts, err := parsePaceOptions(query)
+		if err != nil {
+			writeDaemonJSON(w, http.StatusBadRequest, daemonHTTPError{Error: err.Error()})
+			return
+		}
+		// 不检查Origin，访问由令牌控制
+		websocket.Server{Handler: func(ws *websocket.Conn) {
+			if play {
+				s.replay(ws, opts)
+			} else {
+				s.attach(ws, readOnly, timed)
+			}
+		}}.ServeHTTP(w, req)
+	})
+}
+
+// attach 先发送最近的输出以重建屏幕，录制中时随后实时发送新的输出，录制结束或客户端断开时返回。
+// timed为true时以asciicast v2的格式发送
+func (s *daemonSession) attach(ws *websocket.Conn, readOnly, timed bool) {
+	defer ws.Close()
+	info := s.snapshot()
+	send := func(t float64, data []byte) error {
+		if !timed {
+			return websocket.Message.Send(ws, data)
+		}
+		line, err := json.Marshal(asciicast.Frame{Time: t, EventType: asciicast.OutputEventType, EventData: data})
+		if err != nil {
+			return err
+		}
+		return websocket.Message.Send(ws, string(line))
+	}
+	if timed {
+		header, _ := json.Marshal(asciicast.Header{
+			Version:   2,
+			Width:     info.Cols,
+			Height:    info.Rows,
+			Timestamp: info.Started.Unix(),
+			Command:   info.Command,
+			Title:     info.Title,
+		})
+		if websocket.Message.Send(ws, string(header)) != nil {
+			return
+		}
+	}
+	history, frames, cancel := s.subscribe()
+	defer cancel()
+	if history == nil {
+		info.Duration = 0
+		// 录制已经结束，录像已经完整写入
+		if rec, err := readCast(s.snapshot().File); err == nil {
+			var backlog bytes.Buffer
+			for _, frame := range rec.Stdout {
+				if data, err := frame.OutputData(); err == nil {
+					backlog.Write(data)
+				}
+			}
+			history = backlog.Bytes()
+		}
+	}
+	// 最近的输出作为订阅时的一个事件发送
+	if len(history) > 0 && send(info.Duration, history) != nil {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		viewer := ws.Request().RemoteAddr
+		if !readOnly {
+			writeAudit(s.audit, info.Started, "%s joined with input", viewer)
+			defer writeAudit(s.audit, info.Started, "%s left", viewer)
+		}
+		for {
+			var msg []byte
+			if err := websocket.Message.Receive(ws, &msg); err != nil {
+				return
+			}
+			if !readOnly && len(msg) > 0 {
+				writeAudit(s.audit, info.Started, "%s typed %q", viewer, msg)
+				s.Input(msg)
+			}
+		}
+	}()
+	for {
+		select {
+		case frame, ok := <-frames:
+			if !ok {
+				return
+			}
+			if frame.EventType != asciicast.OutputEventType {
+				continue
+			}
+			if send(frame.Time, frame.EventData) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// replay 按时间戳播放录像，客户端断开时停止
+func (s *daemonSession) replay(ws *websocket.Conn, opts paceOptions) {
+	defer ws.Close()
+	rec, err := readCast(s.snapshot().File)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		defer cancel()
+		var msg []byte
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+	}()
+	playPaced(ctx, rec.Stdout, opts, func(data []byte) error {
+		return websocket.Message.Send(ws, data)
+	})
+}
@@ -0,0 +1,75 @@
+//go:build darwin || freebsd || dragonfly || linux
+
+package cmd
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/x6nux/asciinema/util"
+	"golang.org/x/net/websocket"
+)
+
+// attach默认只读，只有设置了AllowInput的会话接受输入，并记录到<file>.input.log中
+func TestDaemonAttachInput(t *testing.T) {
+	if cfg == nil {
+		var err error
+		if cfg, err = util.GetConfig(map[string]string{util.DefaultHomeEnv: t.TempDir()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, allow := range []bool{false, true} {
+		dir := t.TempDir()
+		m, err := newDaemonManager(&Runner{}, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := filepath.Join(dir, "got.txt")
+		info, err := m.Start(StartOptions{Command: "cat > " + got, AllowInput: allow})
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := httptest.NewServer(daemonHTTPHandler(m, "secret"))
+		ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/v1/sessions/"+info.ID+"/attach?token=secret", "", srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		websocket.Message.Send(ws, "hello\r")
+
+		// 只读时等一小段时间，确认输入没有到达
+		wait := 300 * time.Millisecond
+		if allow {
+			wait = 5 * time.Second
+		}
+		var data []byte
+		for deadline := time.Now().Add(wait); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+			if data, _ = os.ReadFile(got); len(data) > 0 {
+				break
+			}
+		}
+		ws.Close()
+		m.Stop(info.ID)
+		srv.Close()
+
+		audit, _ := os.ReadFile(info.File + ".input.log")
+		if allow {
+			if string(data) != "hello\n" {
+				t.Errorf("allow_input: program got %q, want %q", data, "hello\n")
+			}
+			if !strings.Contains(string(audit), `typed "hello\r"`) {
+				t.Errorf("allow_input: input is not in the audit log:\n%s", audit)
+			}
+		} else {
+			if len(data) > 0 {
+				t.Errorf("read-only session: program got %q", data)
+			}
+			if len(audit) > 0 {
+				t.Errorf("read-only session: unexpected audit log:\n%s", audit)
+			}
+		}
+	}
+}
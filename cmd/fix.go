@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/gvcgo/goutils/pkgs/gutils"
+	"github.com/x6nux/asciinema/asciicast"
 )
 
 var descardingList []string = []string{
@@ -20,21 +26,65 @@ func verify(line string) bool {
 	return true
 }
 
+// FixCast 去掉录制时混入录像的终端回复。通过asciicast.Decoder逐行读取并写入同目录的临时文件，
+// 不受单行长度的限制，也不需要把整个录像读入内存；有内容被丢弃时才替换原文件
 func FixCast(fPath string) {
-	content, _ := os.ReadFile(fPath)
-	if len(content) > 0 {
-		sList := strings.Split(string(content), "\n")
-		data := []string{}
-		for _, line := range sList {
-			if verify(line) {
-				data = append(data, line)
-			}
+	in, err := os.Open(fPath)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	tmp, err := tempFileIn(filepath.Dir(fPath))
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp)
+	out, err := os.Create(tmp)
+	if err != nil {
+		return
+	}
+	w := bufio.NewWriter(out)
+	dec := asciicast.NewDecoder(in)
+	// 无法解析的行原样保留，只去掉终端回复
+	dec.OnInvalid = func(n int, line []byte, err error) {
+		w.Write(append(line, '\n'))
+	}
+	header, err := dec.HeaderLine()
+	if err != nil {
+		out.Close()
+		return
+	}
+	w.Write(append(header, '\n'))
+	dropped := false
+	for dec.Next() {
+		if line := dec.Raw(); verify(string(line)) {
+			w.Write(append(line, '\n'))
+		} else {
+			dropped = true
 		}
-		if len(data) > 0 {
-			s := strings.Join(data, "\n")
-			os.WriteFile(fPath, []byte(s), os.ModePerm)
+	}
+	if dec.Err() != nil {
+		// 读取出错时不替换原文件，避免截断录像
+		dropped = false
+	}
+	err = w.Flush()
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || !dropped {
+		return
+	}
+	// 有内容被丢弃时先备份，保证修复可以撤销
+	if backupEnabled() {
+		if _, err := backupFile(fPath); err != nil {
+			return
 		}
 	}
+	in.Close()
+	if info, err := os.Stat(fPath); err == nil {
+		os.Chmod(tmp, info.Mode())
+	}
+	os.Rename(tmp, fPath)
 }
 
 func FixHeaderForEditOperations(inputFile, outputFile string) {
@@ -45,9 +95,84 @@ func FixHeaderForEditOperations(inputFile, outputFile string) {
 		sList := strings.SplitN(string(content1), "\n", 2)
 		header := sList[0]
 		content2, _ := os.ReadFile(outputFile)
-		sList = strings.SplitN(string(content2), "\n", 2)
+		sList = strings.Split(string(content2), "\n")
 		sList[0] = header
+		// 编辑库按默认格式写出时间，统一为asciicast.TimePrecision位小数
+		formatEventTimes(sList[1:])
 		data := strings.Join(sList, "\n")
 		os.WriteFile(outputFile, []byte(data), os.ModePerm)
 	}
 }
+
+// formatEventTimes 将事件行中的时间按asciicast.TimePrecision重新格式化，其他内容不变
+func formatEventTimes(lines []string) {
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "[") {
+			continue
+		}
+		var event []json.RawMessage
+		var t float64
+		if json.Unmarshal([]byte(line), &event) != nil || len(event) == 0 || json.Unmarshal(event[0], &t) != nil {
+			continue
+		}
+		event[0] = json.RawMessage(asciicast.EncodeTime(t))
+		if data, err := json.Marshal(event); err == nil {
+			lines[i] = string(data)
+		}
+	}
+}
+
+// RewriteHeader 将cast文件的头部行替换为header。头部和其余内容依次写入同目录的临时文件，
+// 完成后再替换原文件并保留原来的权限，不会把整个录像读入内存，失败时原文件保持不变
+func RewriteHeader(fPath string, header *asciicast.Header) (err error) {
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(in)
+	// 跳过原来的头部行
+	first, err := r.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fPath), ".acast-*.cast")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	w := bufio.NewWriter(tmp)
+	w.Write(headerJSON)
+	if bytes.HasSuffix(first, []byte("\n")) {
+		w.WriteByte('\n')
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	// Windows上不能替换仍然打开着的文件
+	in.Close()
+	return os.Rename(tmp.Name(), fPath)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/x6nux/asciinema/asciicast"
+)
+
+func TestRewriteHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"events", "{\"version\": 2}\n[0.5, \"o\", \"hi\"]\n[1.0, \"o\", \"\\r\\n\"]\n", "{\"version\":2,\"width\":100,\"height\":30,\"env\":null}\n[0.5, \"o\", \"hi\"]\n[1.0, \"o\", \"\\r\\n\"]\n"},
+		{"header only", "{\"version\": 2}\n", "{\"version\":2,\"width\":100,\"height\":30,\"env\":null}\n"},
+		{"no newline", "{\"version\": 2}", "{\"version\":2,\"width\":100,\"height\":30,\"env\":null}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "in.cast")
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := RewriteHeader(path, &asciicast.Header{Version: 2, Width: 100, Height: 30}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+				t.Errorf("mode = %v (%v), want 0600", info.Mode().Perm(), err)
+			}
+			// 临时文件不应留在目录中
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("%d files left in the directory, want 1", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/x6nux/asciinema/util"
+)
+
+// 录制钩子的类型，也是--hook和配置文件[hooks]中的名称
+const (
+	PreRecordHook  = "pre-record"  // 开始录制前执行，失败时不录制
+	PostRecordHook = "post-record" // 录像写入文件后执行，失败时只警告
+)
+
+// recordHooks 返回录制前后执行的钩子：先是配置文件[hooks]中的，然后是--hook指定的
+func (r *Runner) recordHooks() (pre, post []string, err error) {
+	if !r.NoConfigHooks {
+		pre = append(pre, cfg.PreRecordHooks()...)
+		post = append(post, cfg.PostRecordHooks()...)
+	}
+	for _, h := range r.Hooks {
+		name, command, ok := strings.Cut(h, "=")
+		if !ok || strings.TrimSpace(command) == "" {
+			return nil, nil, fmt.Errorf("invalid hook %q, use %s=COMMAND or %s=COMMAND", h, PreRecordHook, PostRecordHook)
+		}
+		switch name {
+		case PreRecordHook:
+			pre = append(pre, command)
+		case PostRecordHook:
+			post = append(post, command)
+		default:
+			return nil, nil, fmt.Errorf("unknown hook %q, use %s or %s", name, PreRecordHook, PostRecordHook)
+		}
+	}
+	return pre, post, nil
+}
+
+// hookPath 返回传给钩子的录像路径，钩子可能切换目录，所以使用绝对路径
+func (r *Runner) hookPath() string {
+	path, err := filepath.Abs(r.FilePath)
+	if err != nil {
+		return r.FilePath
+	}
+	return path
+}
+
+// hookEnv 返回传给钩子的录像信息。录制结束后还包括时长、终端大小和录制时间
+func (r *Runner) hookEnv(command string) []string {
+	vars := []string{
+		"ACAST_FILE=" + r.hookPath(),
+		"ACAST_TITLE=" + r.Title,
+		"ACAST_COMMAND=" + command,
+	}
+	if c := r.Cast; c != nil {
+		vars = append(vars,
+			"ACAST_DURATION="+strconv.FormatFloat(float64(c.Duration), 'f', 3, 64),
+			"ACAST_COLS="+strconv.Itoa(c.Width),
+			"ACAST_ROWS="+strconv.Itoa(c.Height),
+			"ACAST_TIMESTAMP="+strconv.FormatInt(r.timestamp(c.Timestamp), 10),
+		)
+	}
+	return vars
+}
+
+// runRecordHooks 依次执行钩子，钩子可以使用终端，录像路径作为$1(Windows上为%ACAST_FILE%)传入。
+// 某个钩子失败时不再执行之后的钩子
+func runRecordHooks(name string, hooks []string, path string, vars []string) error {
+	for _, command := range hooks {
+		c := hookCommand(command, path)
+		c.Env = append(append(os.Environ(), "ACAST_HOOK="+name), vars...)
+		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := c.Run(); err != nil {
+			return fmt.Errorf(util.T("%s hook %q failed: %v"), name, command, err)
+		}
+	}
+	return nil
+}
+
+// hookCommand 以sh执行钩子，Windows上以cmd执行
+func hookCommand(command, path string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command, "sh", path)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ipfsAddResult IPFS节点/api/v0/add接口的返回结果
+type ipfsAddResult struct {
+	Name string
+	Hash string
+	Size string
+}
+
+// UploadIPFS 通过本地IPFS节点的API添加并固定(pin)录像，返回CID
+func (r *Runner) UploadIPFS() (string, error) {
+	file, err := os.Open(r.FilePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// 边读文件边上传，避免把大文件整个读入内存
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		part, err := writer.CreateFormFile("file", filepath.Base(r.FilePath))
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	api := strings.TrimRight(cfg.IPFSAPI(), "/") + "/api/v0/add?pin=true&cid-version=1"
+	req, err := http.NewRequest("POST", api, pr)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	client := &http.Client{Timeout: time.Second * 600}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("ipfs node not reachable: %v", err)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(rsp.Body)
+		return "", fmt.Errorf("ipfs add failed with status %v: %s", rsp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	// 每个添加的文件返回一行JSON，只上传了一个文件，取最后一行
+	var result ipfsAddResult
+	scanner := bufio.NewScanner(rsp.Body)
+	for scanner.Scan() {
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return "", fmt.Errorf("invalid ipfs add response: %v", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if result.Hash == "" {
+		return "", fmt.Errorf("ipfs add returned no cid")
+	}
+	return result.Hash, nil
+}
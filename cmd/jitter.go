@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"io"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+)
+
+// jitterBufferFrames 抖动缓冲最多保存的帧数，满时阻塞接收
+const jitterBufferFrames = 4096
+
+// jitterLateTolerance 帧比计划晚到多少时认为缓冲已经耗尽
+const jitterLateTolerance = 50 * time.Millisecond
+
+// jitterBuffer 将通过网络实时收到的帧延迟一段时间后按录制时的时间戳输出，抹平到达时间的抖动，
+// 播放不会因为网络的波动而卡顿。帧比计划晚到(缓冲已经耗尽)时重新缓冲
+type jitterBuffer struct {
+	delay  time.Duration
+	out    io.Writer
+	frames chan asciicast.Frame
+	done   chan error
+}
+
+// newJitterBuffer 创建抖动缓冲，delay为0时收到即输出
+func newJitterBuffer(out io.Writer, delay time.Duration) *jitterBuffer {
+	b := &jitterBuffer{
+		delay:  delay,
+		out:    out,
+		frames: make(chan asciicast.Frame, jitterBufferFrames),
+		done:   make(chan error, 1),
+	}
+	go b.loop()
+	return b
+}
+
+// Push 放入收到的一帧
+func (b *jitterBuffer) Push(frame asciicast.Frame) {
+	b.frames <- frame
+}
+
+// Close 输出缓冲中剩余的帧后返回
+func (b *jitterBuffer) Close() error {
+	close(b.frames)
+	return <-b.done
+}
+
+func (b *jitterBuffer) loop() {
+	var anchor time.Time // 时间戳0对应的本地时间
+	var err error
+	for frame := range b.frames {
+		if err != nil {
+			continue
+		}
+		if b.delay > 0 {
+			offset := time.Duration(frame.Time * float64(time.Second))
+			if anchor.IsZero() || time.Since(anchor.Add(offset)) > jitterLateTolerance {
+				anchor = time.Now().Add(b.delay - offset)
+			}
+			time.Sleep(time.Until(anchor.Add(offset)))
+		}
+		_, err = b.out.Write(frame.EventData)
+	}
+	b.done <- err
+}
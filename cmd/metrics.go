@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"expvar"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// 录制的运行指标，通过record --metrics-addr以expvar的形式在/debug/vars中提供
+var (
+	metricFramesRecorded = new(expvar.Int) // 录制的帧数
+	metricBytesRecorded  = new(expvar.Int) // 录制的输出字节数
+	metricFramesWritten  = new(expvar.Int) // 流式写入文件的帧数(压缩前)
+	metricFsyncs         = new(expvar.Int) // 流式写入时调用fsync的次数
+	metricUploadErrors   = new(expvar.Int) // 上传失败的次数
+
+	recordStatus struct {
+		sync.Mutex
+		start time.Time
+		file  string       // 正在流式写入的文件
+		queue *frameQueue  // 流式写入的队列
+		sink  *sessionSink // attach的会话
+	}
+)
+
+func init() {
+	m := expvar.NewMap("acast")
+	m.Set("frames_recorded", metricFramesRecorded)
+	m.Set("bytes_recorded", metricBytesRecorded)
+	m.Set("frames_written", metricFramesWritten)
+	m.Set("fsyncs", metricFsyncs)
+	m.Set("upload_errors", metricUploadErrors)
+	m.Set("file_bytes", expvar.Func(func() interface{} { return recordFileSize() }))
+	m.Set("compression_ratio", expvar.Func(func() interface{} {
+		// 录制的输出字节数与文件大小之比，未流式写入时为0
+		if size := recordFileSize(); size > 0 {
+			return float64(metricBytesRecorded.Value()) / float64(size)
+		}
+		return 0.0
+	}))
+	m.Set("frames_dropped", expvar.Func(func() interface{} {
+		recordStatus.Lock()
+		defer recordStatus.Unlock()
+		if q := recordStatus.queue; q != nil {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			return q.dropped
+		}
+		return 0
+	}))
+	m.Set("frames_coalesced", expvar.Func(func() interface{} {
+		recordStatus.Lock()
+		defer recordStatus.Unlock()
+		if q := recordStatus.queue; q != nil {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			return q.coalesced
+		}
+		return 0
+	}))
+	m.Set("viewers", expvar.Func(func() interface{} {
+		recordStatus.Lock()
+		defer recordStatus.Unlock()
+		if s := recordStatus.sink; s != nil {
+			return s.viewers()
+		}
+		return 0
+	}))
+	m.Set("uptime_seconds", expvar.Func(func() interface{} {
+		recordStatus.Lock()
+		defer recordStatus.Unlock()
+		if recordStatus.start.IsZero() {
+			return 0.0
+		}
+		return time.Since(recordStatus.start).Seconds()
+	}))
+}
+
+// recordFileSize 返回正在流式写入的文件的大小
+func recordFileSize() int64 {
+	recordStatus.Lock()
+	path := recordStatus.file
+	recordStatus.Unlock()
+	if path == "" {
+		return 0
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// metricsWriter 作为录制输出的镜像统计录制的帧数和字节数
+type metricsWriter struct{}
+
+func (metricsWriter) Write(p []byte) (int, error) {
+	metricFramesRecorded.Add(1)
+	metricBytesRecorded.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// serveMetrics 在addr上提供/debug/vars，返回关闭服务的函数
+func serveMetrics(addr string) (string, func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", nil, err
+	}
+	recordStatus.Lock()
+	recordStatus.start = time.Now()
+	recordStatus.Unlock()
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	server := &http.Server{Handler: mux}
+	go server.Serve(ln)
+	return ln.Addr().String(), func() { server.Close() }, nil
+}
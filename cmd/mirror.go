@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/x6nux/asciinema/util"
+)
+
+// mirrorBuffer 镜像中等待写入的输出块数，镜像终端跟不上时丢弃多出的输出
+const mirrorBuffer = 256
+
+// mirrorWriter 将录制的输出实时复制到另一个终端设备。
+// 写入在单独的协程中进行，镜像终端阻塞或被关闭都不会影响录制
+type mirrorWriter struct {
+	path    string
+	f       *os.File
+	ch      chan []byte
+	done    chan struct{}
+	dropped bool
+
+	mu  sync.Mutex
+	err error
+}
+
+func newMirrorWriter(path string) (*mirrorWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	m := &mirrorWriter{
+		path: path,
+		f:    f,
+		ch:   make(chan []byte, mirrorBuffer),
+		done: make(chan struct{}),
+	}
+	go m.loop()
+	return m, nil
+}
+
+func (m *mirrorWriter) loop() {
+	defer close(m.done)
+	for data := range m.ch {
+		if m.failed() {
+			continue
+		}
+		if _, err := m.f.Write(data); err != nil {
+			m.mu.Lock()
+			m.err = err
+			m.mu.Unlock()
+		}
+	}
+}
+
+func (m *mirrorWriter) failed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err != nil
+}
+
+// Write 从不返回错误，以免中断录制
+func (m *mirrorWriter) Write(p []byte) (int, error) {
+	if m.failed() {
+		return len(p), nil
+	}
+	data := make([]byte, len(p))
+	copy(data, p)
+	select {
+	case m.ch <- data:
+	default:
+		m.dropped = true
+	}
+	return len(p), nil
+}
+
+// Close 写完剩余的输出后关闭设备，并报告镜像过程中出现的问题
+func (m *mirrorWriter) Close() error {
+	close(m.ch)
+	<-m.done
+	if m.err != nil {
+		util.Warningf("Mirroring to %s stopped: %v", m.path, m.err)
+	} else if m.dropped {
+		util.Warningf("%s could not keep up, some output was not mirrored.", m.path)
+	}
+	return m.f.Close()
+}
+
+// openMirrors 打开--mirror指定的终端设备，返回写入所有设备的writer和关闭函数
+func openMirrors(paths []string) (io.Writer, func(), error) {
+	var writers []io.Writer
+	var mirrors []*mirrorWriter
+	closeAll := func() {
+		for _, m := range mirrors {
+			m.Close()
+		}
+	}
+	for _, path := range paths {
+		m, err := newMirrorWriter(path)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		mirrors = append(mirrors, m)
+		writers = append(writers, m)
+	}
+	if len(writers) == 0 {
+		return nil, func() {}, nil
+	}
+	return io.MultiWriter(writers...), closeAll, nil
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/x6nux/asciinema/util"
+)
+
+// notifyEnabled 通过--notify或配置文件的[notify]开启桌面通知
+func (r *Runner) notifyEnabled() bool {
+	return r.Notify || (cfg != nil && cfg.NotifyEnabled())
+}
+
+// NotifyFinished 操作完成时发送桌面通知，耗时少于配置的min-duration时不通知
+func (r *Runner) NotifyFinished(op string, start time.Time, err error) {
+	if !r.notifyEnabled() {
+		return
+	}
+	elapsed := time.Since(start)
+	if cfg != nil && elapsed.Seconds() < cfg.NotifyMinDuration() {
+		return
+	}
+	msg := fmt.Sprintf("%s finished in %s", op, elapsed.Round(time.Second))
+	if err != nil {
+		msg = fmt.Sprintf("%s failed: %v", op, err)
+	}
+	if err := util.Notify("acast", msg); err != nil {
+		util.Warningf("Failed to send the desktop notification: %v", err)
+	}
+}
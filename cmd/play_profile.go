@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/terminal"
+	"github.com/x6nux/asciinema/util"
+)
+
+const (
+	// profileLagLimit 写入比录像时间晚了超过这个时长的帧算作跟不上
+	profileLagLimit = 100 * time.Millisecond
+	// profileLateShare 跟不上的帧超过这个比例时给出警告
+	profileLateShare = 0.01
+)
+
+// loadPlayCast 读取要播放的录像，设置了Profile时同时返回记录了每帧解码耗时的性能记录
+func (r *Runner) loadPlayCast(fPath string) (*asciicast.Asciicast, *terminal.PlaybackProfile, error) {
+	prof := r.newPlayProfile()
+	if prof == nil {
+		c, err := readCast(fPath)
+		return c, nil, err
+	}
+	c, err := readCastTimed(fPath, func(d time.Duration) {
+		prof.Decode = append(prof.Decode, d)
+	})
+	return c, prof, err
+}
+
+// newPlayProfile 设置了Profile时返回空的性能记录，否则返回nil
+func (r *Runner) newPlayProfile() *terminal.PlaybackProfile {
+	if !r.Profile {
+		return nil
+	}
+	return &terminal.PlaybackProfile{}
+}
+
+// printPlayProfile 输出各阶段耗时的百分位数，写入经常落后于录像时间时给出警告
+func printPlayProfile(w io.Writer, fPath string, prof *terminal.PlaybackProfile, elapsed time.Duration) {
+	fmt.Fprintf(w, "Playback profile of %s: %d frames, %d bytes written in %s\n", fPath, len(prof.Write), prof.Bytes, formatLatency(elapsed))
+	fmt.Fprintf(w, "%-12s %8s %10s %10s %10s %10s %10s\n", "stage", "frames", "p50", "p90", "p99", "max", "total")
+	stages := []struct {
+		name    string
+		samples []time.Duration
+		total   bool // 落后的时长相加没有意义
+	}{
+		{"decode", prof.Decode, true},
+		{"decompress", prof.Decompress, true},
+		{"write", prof.Write, true},
+		{"lag", prof.Lag, false},
+	}
+	for _, stage := range stages {
+		s := terminal.Stats(stage.samples)
+		if s.Count == 0 {
+			continue
+		}
+		total := "-"
+		if stage.total {
+			total = formatLatency(s.Total)
+		}
+		fmt.Fprintf(w, "%-12s %8d %10s %10s %10s %10s %10s\n", stage.name, s.Count,
+			formatLatency(s.P50), formatLatency(s.P90), formatLatency(s.P99), formatLatency(s.Max), total)
+	}
+	late := prof.Late(profileLagLimit)
+	if late > 0 && float64(late) >= profileLateShare*float64(len(prof.Lag)) {
+		util.PrintWarning(util.T("The terminal could not keep up: %d of %d frames were written more than %v late (up to %s behind). Try --max-chunk to split large frames."),
+			late, len(prof.Lag), profileLagLimit, formatLatency(terminal.Stats(prof.Lag).Max))
+	}
+}
+
+// formatLatency 以合适的单位显示耗时，如850ns、12.3µs、4.56ms、1.23s
+func formatLatency(d time.Duration) string {
+	switch {
+	case d < time.Microsecond:
+		return fmt.Sprintf("%dns", d.Nanoseconds())
+	case d < time.Millisecond:
+		return fmt.Sprintf("%.1fµs", float64(d)/float64(time.Microsecond))
+	case d < time.Second:
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	}
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
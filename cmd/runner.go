@@ -3,13 +3,13 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
 
 	"github.com/x6nux/asciinema/asciicast"
 	"github.com/x6nux/asciinema/util"
+	"golang.org/x/term"
 )
 
 type Runner struct {
@@ -20,9 +20,58 @@ type Runner struct {
 	FilePath        string
 	Cast            *asciicast.Asciicast
 	StreamWrite     bool
-	SyncInterval    int64 // 同步间隔（毫秒）
-	DisableCompress bool  // 是否禁用压缩
-	CompressRatio   int   // 压缩比例，值越大压缩效果越明显但可能影响回放质量
+	SyncInterval    int64    // 同步间隔（毫秒）
+	DisableCompress bool     // 是否禁用压缩
+	CompressRatio   int      // 压缩比例，值越大压缩效果越明显但可能影响回放质量
+	Force           bool     // 强制执行：录制时允许嵌套录制，播放时忽略终端大小检查
+	EnvSet          []string // 注入到被录制shell中的环境变量(KEY=VAL)
+	EnvRecord       bool     // 是否将注入的环境变量记录到头部
+	Meta            []string // 记录到头部的机器信息：hostname、user、os、cwd或all
+	Cols            int      // 录制时固定的终端列数，为0时跟随真实终端
+	Rows            int      // 录制时固定的终端行数，为0时跟随真实终端
+	Mirror          []string // 录制时实时复制输出的终端设备，如/dev/pts/7
+	NoAttach        bool     // 录制时不允许acast attach观看
+	AllowInput      bool     // 录制时允许持有令牌的观看者通过attach输入
+	Deterministic   bool     // 录制时将帧时间取整并且不记录录制时间，便于比较录像
+	Backpressure    string   // 流式写入跟不上输出时的策略：block、drop-oldest或coalesce
+	MetricsAddr     string   // 录制时在该地址提供expvar指标，为空时不提供
+	Command         string   // 录制的命令，为空时使用$SHELL
+	Syslog          string   // 录制时将输出按行转发到该syslog地址，为空时不转发
+	Filters         []string // 录制时帧依次经过的过滤器，如strip-osc、redact-regex=RE、rate-limit=30
+	BellEvents      bool     // 录制时输出中有响铃则另外记录响铃事件
+	CaptureMouse    bool     // 录制时将鼠标上报记录为输入事件
+	CapturePaste    bool     // 录制时将每次粘贴记录为输入事件
+	AltScreen       bool     // 是否在备用屏幕缓冲区中播放
+	TryResize       bool     // 播放时终端过小是否尝试调整终端大小
+	SpeedEase       float64  // 调整速度时区间边界的过渡时长（秒）
+	CutKeep         bool     // 剪切时只保留指定区间，而不是删除它
+	NoBackup        bool     // 原地编辑时不创建.bak备份
+	NDJSON          bool     // tojson每行输出一条命令，而不是一个JSON数组
+	PromptRegex     string   // 识别命令提示符的正则表达式，为空时自动识别
+	Hyperlinks      string   // 导出时对OSC 8超链接的处理：keep保留或strip去掉
+	GifStart        float64  // 导出GIF的开始时间（秒）
+	GifEnd          float64  // 导出GIF的结束时间（秒），为0时到结尾
+	GifFPS          int      // 导出GIF的最大帧率，为0时使用agg的默认值
+	GifSpeed        float64  // 导出GIF的播放速度
+	GifMaxFrames    int      // 导出GIF的最大帧数，通过降低帧率实现
+	AnimFormat      string   // 导出动画的格式：gif、apng或webp
+	Theme           string   // 导出时的配色：内置配色名称、recorded或自定义的JSON文件
+	FontSize        int      // 导出时的字号，为0时使用默认值
+	FontFamily      string   // 导出时的字体，多个字体以逗号分隔
+	NoAudio         bool     // 播放和导出MP4时不使用旁白音频
+	NoAnnotations   bool     // 导出HTML和GIF时不显示acast annotate添加的注释
+	PauseOnMarkers  bool     // 播放到标记时暂停，按任意键继续
+	Tee             string   // 播放时将输出复制到该文件
+	Unsafe          bool     // 播放和attach时不去掉危险的转义序列
+	Bell            string   // 播放时对响铃的处理：audible、visual或ignore
+	Images          string   // 播放时对sixel和iTerm2图片的处理：auto、passthrough或placeholder
+	MaxChunk        int      // 播放时将超过该字节数的输出帧拆成小块逐块输出，0表示不拆分
+	Profile         bool     // 播放时记录每帧的解码、解压和写入耗时，结束时输出百分位数
+	Notify          bool     // 长时间操作完成时发送桌面通知
+	RecordDir       string   // 录像文件名不含目录时保存到的目录，来自配置文件[record]中的dir
+	Hooks           []string // 录制前后执行的钩子，格式为pre-record=命令或post-record=命令
+	NoConfigHooks   bool     // 不执行配置文件[hooks]中的钩子
+	AutoTitle       bool     // 录制结束后以第一条命令作为标题
 }
 
 func New(filename ...string) (r *Runner) {
@@ -43,6 +92,13 @@ func New(filename ...string) (r *Runner) {
 		r.Title = strings.Split(name, ".")[0]
 	}
 	initAsciinema()
+	// 配置文件[record]中的默认值，命令行参数优先
+	r.RecordDir = cfg.RecordDir()
+	r.DisableCompress = cfg.RecordDisableCompress()
+	if ratio := cfg.RecordCompressRatio(); ratio > 0 {
+		r.CompressRatio = ratio
+	}
+	r.AutoTitle = cfg.RecordAutoTitle()
 	return
 }
 
@@ -59,6 +115,10 @@ var (
 )
 
 func showCursorBack() {
+	// 标准输出被重定向时(如管道)不能写入控制序列
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return
+	}
 	fmt.Fprintf(os.Stdout, "\x1b[?25h")
 }
 
@@ -70,17 +130,13 @@ func initAsciinema() {
 	}
 
 	if runtime.GOOS != "windows" && !util.IsUtf8Locale(env) {
-		fmt.Println("asciinema needs a UTF-8 native locale to run. Check the output of `locale` command.")
+		fmt.Println(util.T("asciinema needs a UTF-8 native locale to run. Check the output of `locale` command."))
 		os.Exit(1)
 	}
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		<-c
-		showCursorBack()
-		os.Exit(1)
-	}()
+	// 被信号中断时最后恢复光标，其他清理函数(修复录像、恢复终端)先运行
+	util.AddCleanup(showCursorBack)
+	util.HandleSignals()
 	defer showCursorBack()
 
 	var err error
@@ -89,4 +145,16 @@ func initAsciinema() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	if gateway := cfg.IPFSGateway(); gateway != "" {
+		asciicast.IPFSGateway = gateway
+	}
+	asciicast.HTTPHeaders = cfg.HTTPHeaders()
+	asciicast.S3Endpoint = cfg.S3Endpoint()
+	// 配置文件[ui]中的颜色模式和配色，--color优先
+	if err := util.SetColorMode(cfg.UIColor()); err != nil {
+		util.Warningf("%v", err)
+	}
+	if err := util.SetTheme(cfg.UITheme()); err != nil {
+		util.Warningf("%v", err)
+	}
 }
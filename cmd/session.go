@@ -0,0 +1,347 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x6nux/asciinema/asciicast"
+	"github.com/x6nux/asciinema/vt"
+)
+
+const (
+	sessionExt = ".sock"
+	// sessionBuffer 每个观看者等待发送的事件数，观看者跟不上时断开它，不影响录制
+	sessionBuffer = 1024
+	// sessionNameMax 限制会话名称的长度，unix socket的路径长度有限
+	sessionNameMax = 32
+)
+
+var sessionNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// sessionDir 返回本机录制会话的unix socket所在的目录，只有当前用户可以访问
+func sessionDir() string {
+	name := "acast-sessions"
+	if uid := os.Getuid(); uid >= 0 {
+		name += "-" + strconv.Itoa(uid)
+	}
+	return filepath.Join(os.TempDir(), name)
+}
+
+// sessionPath 返回会话的socket路径
+func sessionPath(name string) string {
+	return filepath.Join(sessionDir(), name+sessionExt)
+}
+
+// sessionSink 录制会话的输出接收端：监听一个unix socket，将输出以asciicast v2
+// 事件流的形式实时发送给acast attach。新的观看者先收到头部和当前画面的快照。
+// 设置了令牌时，持有令牌的观看者可以向被录制的程序输入，所有输入都记录到审计日志中
+type sessionSink struct {
+	name   string
+	ln     net.Listener
+	header asciicast.Header
+	start  time.Time
+	token  string      // 为空时观看者只读
+	input  chan []byte // 观看者的输入，写入被录制的程序
+	audit  string      // 审计日志的路径
+	done   chan struct{}
+
+	mu      sync.Mutex
+	screen  *vt.Screen
+	clients map[net.Conn]chan []byte
+	closed  bool
+}
+
+// viewerMessage 观看者发给会话的消息，每行一个JSON对象。
+// 先发送带token和viewer的认证消息，之后每条消息携带一段输入
+type viewerMessage struct {
+	Token  string `json:"token,omitempty"`
+	Viewer string `json:"viewer,omitempty"`
+	Input  string `json:"input,omitempty"`
+}
+
+// sessionError 会话拒绝观看者时发送的消息，之后断开连接
+type sessionError struct {
+	Error string `json:"error"`
+}
+
+// newSessionSink 以录像的标题为名称创建会话，名称已被占用时加上进程号。
+// token不为空时允许持有该令牌的观看者输入，输入记录到audit文件中
+func newSessionSink(title string, header asciicast.Header, token, audit string) (*sessionSink, error) {
+	if err := os.MkdirAll(sessionDir(), 0700); err != nil {
+		return nil, err
+	}
+	name := strings.Trim(sessionNameRe.ReplaceAllString(title, "-"), "-")
+	if len(name) > sessionNameMax {
+		name = name[:sessionNameMax]
+	}
+	if name == "" {
+		name = "session"
+	}
+	if sessionAlive(name) {
+		name = fmt.Sprintf("%s-%d", name, os.Getpid())
+	}
+	path := sessionPath(name)
+	os.Remove(path) // 残留的socket文件
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	s := &sessionSink{
+		name:    name,
+		ln:      ln,
+		header:  header,
+		start:   time.Now(),
+		token:   token,
+		input:   make(chan []byte, sessionBuffer),
+		audit:   audit,
+		done:    make(chan struct{}),
+		screen:  vt.New(header.Width, header.Height),
+		clients: map[net.Conn]chan []byte{},
+	}
+	go s.accept()
+	return s, nil
+}
+
+func (s *sessionSink) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		ch := make(chan []byte, sessionBuffer)
+		header, _ := json.Marshal(s.header)
+		ch <- append(header, '\n')
+		ch <- s.event(s.screen.Snapshot())
+		s.clients[conn] = ch
+		s.mu.Unlock()
+		go s.serve(conn, ch)
+	}
+}
+
+// serve 向一个观看者发送事件
+func (s *sessionSink) serve(conn net.Conn, ch chan []byte) {
+	go s.readViewer(conn)
+	for line := range ch {
+		if _, err := conn.Write(line); err != nil {
+			s.drop(conn, "")
+			break
+		}
+	}
+	conn.Close()
+}
+
+// readViewer 读取观看者发来的消息，认证通过的观看者的输入被转发给被录制的程序
+func (s *sessionSink) readViewer(conn net.Conn) {
+	defer s.drop(conn, "")
+	viewer := ""
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var msg viewerMessage
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+		if msg.Token != "" || msg.Viewer != "" {
+			switch {
+			case s.token == "":
+				s.drop(conn, "input is not allowed in this session, the recorder can enable it with --allow-input")
+				return
+			case subtle.ConstantTimeCompare([]byte(msg.Token), []byte(s.token)) != 1:
+				s.auditf("rejected %s: wrong token", msg.Viewer)
+				s.drop(conn, "wrong token")
+				return
+			}
+			viewer = msg.Viewer
+			s.auditf("%s joined with input", viewer)
+			continue
+		}
+		if viewer == "" || msg.Input == "" {
+			continue
+		}
+		s.auditf("%s typed %q", viewer, msg.Input)
+		select {
+		case s.input <- []byte(msg.Input):
+		case <-s.done:
+			return
+		}
+	}
+	if viewer != "" {
+		s.auditf("%s left", viewer)
+	}
+}
+
+// auditf 在审计日志中记录一行，带有时间和相对录制开始的时间
+func (s *sessionSink) auditf(format string, args ...interface{}) {
+	writeAudit(s.audit, s.start, format, args...)
+}
+
+// writeAudit 在审计日志path中追加一行，带有时间和相对录制开始(start)的时间，path为空时不记录
+func writeAudit(path string, start time.Time, format string, args ...interface{}) {
+	if path == "" {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s %.3f %s\n", time.Now().Format(time.RFC3339), time.Since(start).Seconds(), fmt.Sprintf(format, args...))
+}
+
+// drop 断开一个观看者，reason不为空时先将原因发给观看者
+func (s *sessionSink) drop(conn net.Conn, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ch, ok := s.clients[conn]; ok {
+		if reason != "" {
+			line, _ := json.Marshal(sessionError{Error: reason})
+			select {
+			case ch <- append(line, '\n'):
+			default:
+			}
+		}
+		delete(s.clients, conn)
+		close(ch)
+	}
+}
+
+// event 将输出编码为一行asciicast v2事件
+func (s *sessionSink) event(data string) []byte {
+	line, _ := json.Marshal([]interface{}{asciicast.EncodeTime(time.Since(s.start).Seconds()), "o", data})
+	return append(line, '\n')
+}
+
+// Write 接收录制的输出并转发给所有观看者，从不返回错误，以免中断录制
+func (s *sessionSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.screen.Write(p)
+	if len(s.clients) == 0 {
+		return len(p), nil
+	}
+	line := s.event(string(p))
+	for conn, ch := range s.clients {
+		select {
+		case ch <- line:
+		default:
+			delete(s.clients, conn)
+			close(ch)
+		}
+	}
+	return len(p), nil
+}
+
+// viewers 返回当前的观看者数
+func (s *sessionSink) viewers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// Close 结束会话，所有观看者都会收到结束
+func (s *sessionSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		close(s.done)
+	}
+	s.closed = true
+	for conn, ch := range s.clients {
+		delete(s.clients, conn)
+		close(ch)
+	}
+	s.mu.Unlock()
+	err := s.ln.Close()
+	os.Remove(sessionPath(s.name))
+	return err
+}
+
+// newSessionToken 生成允许观看者输入的随机令牌
+func newSessionToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// sessionAlive 检查会话是否仍在录制，清理已经结束的会话留下的socket文件
+func sessionAlive(name string) bool {
+	path := sessionPath(name)
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		os.Remove(path)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// listSessions 返回本机正在录制的会话
+func listSessions() []string {
+	entries, _ := os.ReadDir(sessionDir())
+	var names []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), sessionExt)
+		if ok && sessionAlive(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findSession 按名称或名称的前缀查找会话，name为空时只有一个会话才能确定
+func findSession(name string) (string, error) {
+	names := listSessions()
+	if len(names) == 0 {
+		return "", fmt.Errorf("no recording session is running")
+	}
+	var found []string
+	for _, n := range names {
+		if n == name {
+			return n, nil
+		}
+		if strings.HasPrefix(n, name) {
+			found = append(found, n)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no session named %q, running sessions: %s", name, strings.Join(names, ", "))
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("%q matches several sessions: %s", name, strings.Join(found, ", "))
+}
+
+// readSessionHeader 读取会话事件流的头部
+func readSessionHeader(r *bufio.Reader) (*asciicast.Header, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	header := &asciicast.Header{}
+	if err := json.Unmarshal(line, header); err != nil {
+		return nil, fmt.Errorf("invalid session header: %v", err)
+	}
+	return header, nil
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// StdioPath 表示标准输入/标准输出的文件名
+const StdioPath = "-"
+
+// withStdio 支持编辑命令使用"-"作为输入或输出，便于在管道中串联；
+// 标准输入先缓存到临时文件，输出写入临时文件后再复制到标准输出，
+// 这样依赖文件路径的后续处理(如FixHeaderForEditOperations)仍然有效。
+// 输入输出为同一文件时先备份为file.cast.bak，输出写入同目录的临时文件，
+// 成功后才替换原文件，失败时原文件保持不变
+func (r *Runner) withStdio(inFilePath, outFilePath string, edit func(in, out string) error) (err error) {
+	if inFilePath == StdioPath {
+		if inFilePath, err = bufferToTemp(os.Stdin); err != nil {
+			return err
+		}
+		defer os.Remove(inFilePath)
+	}
+	target := outFilePath
+	inPlace := sameFile(inFilePath, outFilePath)
+	if inPlace {
+		if !r.NoBackup && backupEnabled() {
+			if _, err = backupFile(inFilePath); err != nil {
+				return err
+			}
+		}
+		if outFilePath, err = tempFileIn(filepath.Dir(target)); err != nil {
+			return err
+		}
+		defer os.Remove(outFilePath)
+	}
+	toStdout := outFilePath == StdioPath
+	if toStdout {
+		if outFilePath, err = bufferToTemp(nil); err != nil {
+			return err
+		}
+		defer os.Remove(outFilePath)
+	}
+	if err = edit(inFilePath, outFilePath); err != nil {
+		return err
+	}
+	if inPlace {
+		if info, err := os.Stat(target); err == nil {
+			os.Chmod(outFilePath, info.Mode())
+		}
+		return os.Rename(outFilePath, target)
+	}
+	if !toStdout {
+		return nil
+	}
+	f, err := os.Open(outFilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(os.Stdout, f)
+	return err
+}
+
+// tempFileIn 在目录dir中创建一个空的临时文件，返回文件路径
+func tempFileIn(dir string) (string, error) {
+	f, err := os.CreateTemp(dir, ".acast-*.cast")
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// bufferToTemp 创建临时文件并写入r的内容(r为nil时为空文件)，返回文件路径
+func bufferToTemp(r io.Reader) (string, error) {
+	f, err := os.CreateTemp("", "acast-*.cast")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if r != nil {
+		if _, err = io.Copy(f, r); err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+	}
+	return f.Name(), nil
+}
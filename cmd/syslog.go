@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x6nux/asciinema/util"
+)
+
+// syslogBuffer 等待发送的行数，syslog服务器跟不上时丢弃多出的行
+const syslogBuffer = 1024
+
+// syslogPEN 结构化数据使用的企业编号(RFC 5612中保留给文档和示例的编号)
+const syslogPEN = 32473
+
+// syslogPriority facility为local0，severity为info
+const syslogPriority = 16*8 + 6
+
+// syslogLine 一行重建的输出
+type syslogLine struct {
+	at     time.Time // 该行开始输出的时间
+	offset float64   // 距录制开始的秒数
+	text   string
+}
+
+// syslogWriter 作为录制输出的镜像，将去掉转义序列后的输出按行以RFC 5424格式发送到syslog，
+// 每行带有会话ID和在录像中的时间。发送在单独的协程中进行，syslog服务器不可用不会影响录制
+type syslogWriter struct {
+	addr    string
+	network string
+	address string
+	session string
+	host    string
+	start   time.Time
+
+	extract textExtractor
+	ch      chan syslogLine
+	done    chan struct{}
+	conn    net.Conn
+	dropped int
+
+	mu  sync.Mutex
+	err error
+}
+
+// newSyslogWriter 连接addr指定的syslog服务器，addr的格式为udp://host:514、tcp://host:601或unix:///dev/log
+func newSyslogWriter(addr, session string) (*syslogWriter, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &syslogWriter{
+		addr:    addr,
+		session: session,
+		host:    util.FirstNonBlank(util.Hostname(), "-"),
+		start:   time.Now(),
+		ch:      make(chan syslogLine, syslogBuffer),
+		done:    make(chan struct{}),
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		s.network, s.address = u.Scheme, u.Host
+		if u.Port() == "" {
+			port := "514"
+			if u.Scheme == "tcp" {
+				port = "601"
+			}
+			s.address = net.JoinHostPort(u.Hostname(), port)
+		}
+	case "unix":
+		s.network, s.address = "unixgram", u.Path
+	default:
+		return nil, fmt.Errorf("unsupported syslog address %q, use udp://host:port, tcp://host:port or unix:///path", addr)
+	}
+	if err := s.dial(); err != nil {
+		return nil, err
+	}
+	go s.loop()
+	return s, nil
+}
+
+func (s *syslogWriter) dial() error {
+	conn, err := net.DialTimeout(s.network, s.address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *syslogWriter) loop() {
+	defer close(s.done)
+	for line := range s.ch {
+		if s.failed() {
+			continue
+		}
+		msg := s.format(line)
+		err := s.send(msg)
+		if err != nil && s.network == "tcp" {
+			// 连接断开时重连一次
+			s.conn.Close()
+			if err = s.dial(); err == nil {
+				err = s.send(msg)
+			}
+		}
+		if err != nil {
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+		}
+	}
+}
+
+// format 按RFC 5424格式化一行
+func (s *syslogWriter) format(line syslogLine) string {
+	return fmt.Sprintf("<%d>1 %s %s acast %d - [session@%d id=\"%s\" offset=\"%.3f\"] %s",
+		syslogPriority, line.at.UTC().Format(time.RFC3339Nano), s.host, os.Getpid(),
+		syslogPEN, syslogParam(s.session), line.offset, line.text)
+}
+
+// send 发送一条消息，tcp使用RFC 6587的长度前缀分帧
+func (s *syslogWriter) send(msg string) error {
+	if s.network == "tcp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := s.conn.Write([]byte(msg))
+	return err
+}
+
+// syslogParam 转义结构化数据参数值中的"、\和]
+func syslogParam(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(v)
+}
+
+func (s *syslogWriter) failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err != nil
+}
+
+// Write 从不返回错误，以免中断录制
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	s.extract.write(time.Since(s.start).Seconds(), p)
+	s.queue()
+	return len(p), nil
+}
+
+// queue 将提取出的完整行放入发送队列
+func (s *syslogWriter) queue() {
+	for _, l := range s.extract.lines {
+		at := s.start.Add(time.Duration(l.Time * float64(time.Second)))
+		select {
+		case s.ch <- syslogLine{at: at, offset: l.Time, text: l.Text}:
+		default:
+			s.dropped++
+		}
+	}
+	s.extract.lines = s.extract.lines[:0]
+}
+
+// Close 发送最后一行未结束的输出和剩余的行，并报告发送过程中出现的问题
+func (s *syslogWriter) Close() error {
+	s.extract.flush()
+	s.queue()
+	close(s.ch)
+	<-s.done
+	if s.err != nil {
+		util.Warningf("Forwarding to syslog %s stopped: %v", s.addr, s.err)
+	} else if s.dropped > 0 {
+		util.Warningf("Syslog %s could not keep up, %d lines were not forwarded.", s.addr, s.dropped)
+	}
+	return s.conn.Close()
+}
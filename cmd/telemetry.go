@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x6nux/asciinema/util"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName tracer和meter的名称
+const instrumentationName = "github.com/x6nux/asciinema"
+
+// telemetryTimeout 退出时发送剩余span和指标的最长时间
+const telemetryTimeout = 5 * time.Second
+
+var (
+	telemetryOnce     sync.Once
+	telemetryShutdown []func(context.Context) error
+	shutdownOnce      sync.Once
+	operationDuration metric.Float64Histogram
+)
+
+// initTelemetry 按照OpenTelemetry的标准环境变量配置span和指标的导出：
+// 设置了OTEL_EXPORTER_OTLP_ENDPOINT(或OTEL_EXPORTER_OTLP_TRACES_ENDPOINT、OTEL_EXPORTER_OTLP_METRICS_ENDPOINT)时
+// 通过OTLP/HTTP导出，OTEL_TRACES_EXPORTER或OTEL_METRICS_EXPORTER为none时关闭对应的导出，
+// OTEL_SDK_DISABLED=true时全部关闭。未配置时使用OpenTelemetry默认的空实现，没有任何开销
+func initTelemetry() {
+	telemetryOnce.Do(func() {
+		defer func() {
+			operationDuration, _ = otel.Meter(instrumentationName).Float64Histogram("acast.operation.duration",
+				metric.WithUnit("s"), metric.WithDescription("Duration of record, upload, convert and play operations"))
+		}()
+		if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+			return
+		}
+		ctx := context.Background()
+		res, err := resource.New(ctx,
+			resource.WithAttributes(semconv.ServiceName("acast"), semconv.ServiceVersion(Version)),
+			resource.WithFromEnv(),
+			resource.WithTelemetrySDK(),
+			resource.WithHost(),
+		)
+		if err != nil {
+			res = resource.Default()
+		}
+		if otlpEnabled("TRACES") {
+			exporter, err := otlptracehttp.New(ctx)
+			if err != nil {
+				util.Warningf("OpenTelemetry traces are not exported: %v", err)
+			} else {
+				provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+				otel.SetTracerProvider(provider)
+				telemetryShutdown = append(telemetryShutdown, provider.Shutdown)
+			}
+		}
+		if otlpEnabled("METRICS") {
+			exporter, err := otlpmetrichttp.New(ctx)
+			if err != nil {
+				util.Warningf("OpenTelemetry metrics are not exported: %v", err)
+			} else {
+				provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)), sdkmetric.WithResource(res))
+				otel.SetMeterProvider(provider)
+				telemetryShutdown = append(telemetryShutdown, provider.Shutdown)
+			}
+		}
+		if len(telemetryShutdown) > 0 {
+			// 被信号中断时也发送已经结束的span
+			util.AddCleanup(ShutdownTelemetry)
+		}
+	})
+}
+
+// otlpEnabled 检查signal(TRACES或METRICS)是否配置了OTLP导出
+func otlpEnabled(signal string) bool {
+	if exporter := os.Getenv("OTEL_" + signal + "_EXPORTER"); exporter != "" && exporter != "otlp" {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_"+signal+"_ENDPOINT") != ""
+}
+
+// ShutdownTelemetry 发送剩余的span和指标，程序退出前调用，可重复调用
+func ShutdownTelemetry() {
+	shutdownOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), telemetryTimeout)
+		defer cancel()
+		for _, shutdown := range telemetryShutdown {
+			shutdown(ctx)
+		}
+	})
+}
+
+// traceOperation 开始名为acast.<name>的span，返回结束span的函数：
+// 结束时记录错误，并将时长记录到acast.operation.duration指标中
+func traceOperation(name string, attrs ...attribute.KeyValue) func(error) {
+	initTelemetry()
+	start := time.Now()
+	_, span := otel.Tracer(instrumentationName).Start(context.Background(), "acast."+name, trace.WithAttributes(attrs...))
+	return func(err error) {
+		metricAttrs := []attribute.KeyValue{attribute.String("acast.operation", name)}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			metricAttrs = append(metricAttrs, semconv.ErrorTypeOther)
+		}
+		span.End()
+		operationDuration.Record(context.Background(), time.Since(start).Seconds(), metric.WithAttributes(metricAttrs...))
+	}
+}
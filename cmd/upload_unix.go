@@ -0,0 +1,14 @@
+//go:build darwin || freebsd || dragonfly || linux
+
+package cmd
+
+import "golang.org/x/sys/unix"
+
+// osRelease 返回内核版本，即uname -r
+func osRelease() string {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return ""
+	}
+	return unix.ByteSliceToString(uts.Release[:])
+}
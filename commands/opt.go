@@ -5,13 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/signal"
 	"runtime"
 	"strings"
 
 	"github.com/olivere/ndjson"
 	"github.com/x6nux/asciinema/asciicast"
 	"github.com/x6nux/asciinema/util"
+	"golang.org/x/term"
 )
 
 // Options options to pass to various commands.
@@ -21,6 +21,7 @@ type Options struct {
 	MaxWait float64
 	Yes     bool
 	Quite   bool
+	Force   bool // 允许在另一个录制会话中录制
 }
 
 // New creates a new Options instance.
@@ -52,6 +53,9 @@ func (o *Options) Play(cast *asciicast.Asciicast) error {
 // Rec records the terminal and returns the asciicast and error.
 func (o *Options) Rec() (*asciicast.Asciicast, *bytes.Buffer, error) {
 	initAsciinema()
+	if asciicast.IsRecording(env) && !o.Force {
+		return &asciicast.Asciicast{}, nil, fmt.Errorf("already recording in this terminal (%s is set)", asciicast.RecEnv)
+	}
 	command := "C:\\WINDOWS\\System32\\WindowsPowerShell\\v1.0\\powershell.exe -NoProfile"
 	if runtime.GOOS != "windows" {
 		command = util.FirstNonBlank(os.Getenv("SHELL"), cfg.RecordCommand())
@@ -83,6 +87,9 @@ func (o *Options) Rec() (*asciicast.Asciicast, *bytes.Buffer, error) {
 		Timestamp: cast.Timestamp,
 		Duration:  cast.Duration,
 		Env:       cast.Env,
+		Theme:     cast.Theme,
+		Machine:   cast.Machine,
+		Audio:     cast.Audio,
 	}
 
 	// add header
@@ -91,7 +98,7 @@ func (o *Options) Rec() (*asciicast.Asciicast, *bytes.Buffer, error) {
 		return &asciicast.Asciicast{}, nil, err
 	}
 	for _, f := range cast.Stdout {
-		if err := r.Encode([]interface{}{f.Time, "o", string(f.EventData)}); err != nil {
+		if err := r.Encode([]interface{}{asciicast.EncodeTime(f.Time), f.EventType, string(f.EventData)}); err != nil {
 			panic(err)
 		}
 	}
@@ -103,17 +110,13 @@ func initAsciinema() {
 	env = environment()
 
 	if runtime.GOOS != "windows" && !util.IsUtf8Locale(env) {
-		fmt.Println("asciinema needs a UTF-8 native locale to run. Check the output of `locale` command.")
+		fmt.Println(util.T("asciinema needs a UTF-8 native locale to run. Check the output of `locale` command."))
 		os.Exit(1)
 	}
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		<-c
-		showCursorBack()
-		os.Exit(1)
-	}()
+	// 被信号中断时最后恢复光标，其他清理函数(修复录像、恢复终端)先运行
+	util.AddCleanup(showCursorBack)
+	util.HandleSignals()
 	defer showCursorBack()
 
 	cfg, err = util.GetConfig(env)
@@ -137,6 +140,10 @@ func environment() map[string]string {
 }
 
 func showCursorBack() {
+	// 标准输出被重定向时(如管道)不能写入控制序列
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return
+	}
 	fmt.Fprintf(os.Stdout, "\x1b[?25h")
 }
 
@@ -9,9 +9,9 @@ type PlayCommand struct {
 	Player terminal.Player
 }
 
-func NewPlayCommand() *PlayCommand {
+func NewPlayCommand(opts ...terminal.PlayOptions) *PlayCommand {
 	return &PlayCommand{
-		Player: terminal.NewPlayer(),
+		Player: terminal.NewPlayer(opts...),
 	}
 }
 
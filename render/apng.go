@@ -0,0 +1,285 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+const (
+	colorTypeRGB  = 2
+	colorTypeRGBA = 6
+)
+
+// apngFrame 动画中的一帧，只保存与上一帧相比发生变化的区域
+type apngFrame struct {
+	rect  image.Rectangle
+	img   *image.RGBA
+	delay int // 单位为1/100秒，与GIF相同
+}
+
+// GifToAPNG 将GIF动画转换为APNG。每帧先按GIF的处理方式合成到画布上，
+// 再只写入与上一帧不同的区域，通常比GIF更小；颜色来自GIF，仍然只有256色
+func GifToAPNG(r io.Reader, w io.Writer) error {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return err
+	}
+	if len(g.Image) == 0 {
+		return fmt.Errorf("gif has no frames")
+	}
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(bounds)
+	last := image.NewRGBA(bounds)
+	var frames []apngFrame
+	for i, src := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+		draw.Draw(canvas, src.Bounds(), src, src.Bounds().Min, draw.Over)
+
+		rect := bounds
+		if i > 0 {
+			rect = changedRect(last, canvas)
+		}
+		if rect.Empty() {
+			frames[len(frames)-1].delay += g.Delay[i]
+		} else {
+			frames = append(frames, apngFrame{rect: rect, img: cloneRGBA(canvas.SubImage(rect).(*image.RGBA)), delay: g.Delay[i]})
+			draw.Draw(last, rect, canvas, rect.Min, draw.Src)
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, src.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return writeAPNG(w, bounds, frames, apngPlays(g.LoopCount))
+}
+
+// apngPlays 将GIF的循环次数转换为APNG的播放次数，0表示无限循环
+func apngPlays(loopCount int) uint32 {
+	switch {
+	case loopCount == 0:
+		return 0
+	case loopCount < 0:
+		return 1
+	default:
+		return uint32(loopCount) + 1
+	}
+}
+
+func writeAPNG(w io.Writer, bounds image.Rectangle, frames []apngFrame, plays uint32) error {
+	colorType := byte(colorTypeRGB)
+	for _, f := range frames {
+		if !f.img.Opaque() {
+			colorType = colorTypeRGBA
+			break
+		}
+	}
+	cw := &chunkWriter{w: w}
+	cw.write(pngSignature)
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(bounds.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(bounds.Dy()))
+	ihdr[8] = 8 // 位深
+	ihdr[9] = colorType
+	cw.chunk("IHDR", ihdr)
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(frames)))
+	binary.BigEndian.PutUint32(actl[4:], plays)
+	cw.chunk("acTL", actl)
+
+	var seq uint32
+	for i, f := range frames {
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(f.rect.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(f.rect.Dy()))
+		binary.BigEndian.PutUint32(fctl[12:], uint32(f.rect.Min.X-bounds.Min.X))
+		binary.BigEndian.PutUint32(fctl[16:], uint32(f.rect.Min.Y-bounds.Min.Y))
+		binary.BigEndian.PutUint16(fctl[20:], uint16(min(f.delay, 0xffff)))
+		binary.BigEndian.PutUint16(fctl[22:], 100)
+		// dispose_op和blend_op均为0：保留画布，直接覆盖区域
+		cw.chunk("fcTL", fctl)
+		seq++
+
+		data, err := encodeImageData(f.img, colorType)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			cw.chunk("IDAT", data)
+		} else {
+			fdat := make([]byte, 4, 4+len(data))
+			binary.BigEndian.PutUint32(fdat, seq)
+			cw.chunk("fdAT", append(fdat, data...))
+			seq++
+		}
+	}
+	cw.chunk("IEND", nil)
+	return cw.err
+}
+
+// chunkWriter 写入PNG块，记录第一个错误
+type chunkWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (cw *chunkWriter) write(p []byte) {
+	if cw.err == nil {
+		_, cw.err = cw.w.Write(p)
+	}
+}
+
+func (cw *chunkWriter) chunk(name string, data []byte) {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], name)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	footer := binary.BigEndian.AppendUint32(nil, crc.Sum32())
+	cw.write(header)
+	cw.write(data)
+	cw.write(footer)
+}
+
+// encodeImageData 按PNG格式过滤并压缩图像数据，每行选择绝对值之和最小的过滤方式。
+// 所有帧必须使用IHDR中的颜色类型，因此不能直接使用image/png
+func encodeImageData(img *image.RGBA, colorType byte) ([]byte, error) {
+	bpp := 4
+	if colorType == colorTypeRGB {
+		bpp = 3
+	}
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	stride := width * bpp
+	prev := make([]byte, stride)
+	cur := make([]byte, stride)
+	filtered := make([][]byte, 5)
+	for i := range filtered {
+		filtered[i] = make([]byte, stride+1)
+		filtered[i][0] = byte(i)
+	}
+
+	var buf bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	for y := 0; y < height; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		if bpp == 4 {
+			copy(cur, row)
+		} else {
+			for x := 0; x < width; x++ {
+				copy(cur[x*3:x*3+3], row[x*4:x*4+3])
+			}
+		}
+		best, bestSum := 0, -1
+		for ft := range filtered {
+			out := filtered[ft][1:]
+			sum := 0
+			for i := range cur {
+				var a, b, c byte
+				if i >= bpp {
+					a, c = cur[i-bpp], prev[i-bpp]
+				}
+				b = prev[i]
+				var v byte
+				switch ft {
+				case 0:
+					v = cur[i]
+				case 1:
+					v = cur[i] - a
+				case 2:
+					v = cur[i] - b
+				case 3:
+					v = cur[i] - byte((int(a)+int(b))/2)
+				case 4:
+					v = cur[i] - paeth(a, b, c)
+				}
+				out[i] = v
+				sum += abs(int(int8(v)))
+			}
+			if bestSum < 0 || sum < bestSum {
+				best, bestSum = ft, sum
+			}
+		}
+		if _, err := zw.Write(filtered[best]); err != nil {
+			return nil, err
+		}
+		prev, cur = cur, prev
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// changedRect 返回两幅画布中内容不同的最小矩形，相同时返回空矩形
+func changedRect(a, b *image.RGBA) image.Rectangle {
+	var rect image.Rectangle
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		off := a.PixOffset(bounds.Min.X, y)
+		rowA, rowB := a.Pix[off:off+bounds.Dx()*4], b.Pix[off:off+bounds.Dx()*4]
+		if bytes.Equal(rowA, rowB) {
+			continue
+		}
+		minX, maxX := -1, 0
+		for x := 0; x < bounds.Dx(); x++ {
+			if !bytes.Equal(rowA[x*4:x*4+4], rowB[x*4:x*4+4]) {
+				if minX < 0 {
+					minX = x
+				}
+				maxX = x + 1
+			}
+		}
+		rect = rect.Union(image.Rect(bounds.Min.X+minX, y, bounds.Min.X+maxX, y+1))
+	}
+	return rect
+}
+
+func cloneRGBA(src *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+	return dst
+}
@@ -0,0 +1,119 @@
+package render
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/x6nux/asciinema/asciicast"
+)
+
+// PlayerURL 网页中使用的asciinema-player，固定版本以保证导出的页面行为一致
+const PlayerURL = "https://cdn.jsdelivr.net/npm/asciinema-player@3.8.0"
+
+//go:embed html/player.html
+var htmlFS embed.FS
+
+var htmlTemplate = template.Must(template.ParseFS(htmlFS, "html/player.html"))
+
+// Chapter 由标记生成的章节
+type Chapter struct {
+	Time  float64
+	Label string
+}
+
+// Clock 返回章节开始时间的显示形式，如1:05或1:02:03
+func (c Chapter) Clock() string {
+	s := int(c.Time)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// Chapters 将录像中的标记(m事件)转换为章节，没有名称的标记按顺序命名
+func Chapters(frames []asciicast.Frame) []Chapter {
+	var chapters []Chapter
+	for _, f := range frames {
+		if f.EventType != asciicast.MarkerEventType {
+			continue
+		}
+		label := string(f.EventData)
+		if label == "" {
+			label = fmt.Sprintf("Chapter %d", len(chapters)+1)
+		}
+		chapters = append(chapters, Chapter{Time: f.Time, Label: label})
+	}
+	return chapters
+}
+
+// HTMLStyle 网页播放器的配色和字体，零值使用播放器的默认设置
+type HTMLStyle struct {
+	Theme      *asciicast.Theme // 配色，为nil时使用录像头部记录的配色
+	FontSize   int              // 字号(像素)，为0时按页面宽度缩放
+	FontFamily string           // 字体，多个字体以逗号分隔
+}
+
+// themeCSS 将配色转换为asciinema-player的自定义配色(CSS变量)，调色板只有8色时亮色与普通颜色相同，
+// 没有调色板时使用asciinema配色的调色板
+func themeCSS(t *asciicast.Theme) (template.CSS, error) {
+	if err := t.Validate(); err != nil {
+		return "", err
+	}
+	palette := t.Palette
+	if palette == "" {
+		palette = themes["asciinema"].Palette
+	}
+	colors := strings.Split(palette, ":")
+	if len(colors) == 8 {
+		colors = append(colors, colors...)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, ".asciinema-player-theme-acast { --term-color-foreground: %s; --term-color-background: %s;", t.Fg, t.Bg)
+	for i, c := range colors {
+		fmt.Fprintf(&b, " --term-color-%d: %s;", i, c)
+	}
+	b.WriteString(" }")
+	return template.CSS(b.String()), nil
+}
+
+// HTML 生成内嵌录像的独立网页，标记显示为章节列表和进度条上的刻度，点击即可跳转；
+// 注释在播放到其时间段时显示为播放器右上角的标注。cast为asciicast v2格式的录像内容，不能包含压缩帧
+func HTML(w io.Writer, title string, cast []byte, chapters []Chapter, annotations []asciicast.Annotation, style HTMLStyle) error {
+	// 传给播放器的markers选项，用于在进度条上显示刻度
+	markers := make([][]interface{}, 0, len(chapters))
+	for _, c := range chapters {
+		markers = append(markers, []interface{}{c.Time, c.Label})
+	}
+	var theme template.CSS
+	if style.Theme != nil {
+		var err error
+		if theme, err = themeCSS(style.Theme); err != nil {
+			return err
+		}
+	}
+	fontSize := ""
+	if style.FontSize > 0 {
+		fontSize = fmt.Sprintf("%dpx", style.FontSize)
+	}
+	var buf bytes.Buffer
+	err := htmlTemplate.Execute(&buf, map[string]interface{}{
+		"Title":       title,
+		"PlayerURL":   PlayerURL,
+		"Cast":        string(cast),
+		"Markers":     markers,
+		"Chapters":    chapters,
+		"Annotations": annotations,
+		"Theme":       theme,
+		"FontSize":    fontSize,
+		"FontFamily":  style.FontFamily,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,439 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+)
+
+// qrVersion 纠错等级L下各版本的码字数量
+type qrVersion struct {
+	codewords int   // 总码字数
+	eccLen    int   // 每块的纠错码字数
+	blocks    int   // 块数
+	align     []int // 校正图形的中心坐标
+}
+
+// 只支持版本1~10，纠错等级L，最多可编码271字节，足够用于链接
+var qrVersions = []qrVersion{
+	{26, 7, 1, nil},
+	{44, 10, 1, []int{6, 18}},
+	{70, 15, 1, []int{6, 22}},
+	{100, 20, 1, []int{6, 26}},
+	{134, 26, 1, []int{6, 30}},
+	{172, 18, 2, []int{6, 34}},
+	{196, 20, 2, []int{6, 22, 38}},
+	{242, 24, 2, []int{6, 24, 42}},
+	{292, 30, 2, []int{6, 26, 46}},
+	{346, 18, 4, []int{6, 28, 50}},
+}
+
+// qrECLevelL 纠错等级L在格式信息中的编码
+const qrECLevelL = 1
+
+// QRCode 以字节模式将text编码为二维码，返回模块矩阵(true为深色)，不包含静区
+func QRCode(text string) ([][]bool, error) {
+	data := []byte(text)
+	for i, v := range qrVersions {
+		version := i + 1
+		capacity := v.codewords - v.eccLen*v.blocks
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+len(data)*8 > capacity*8 {
+			continue
+		}
+		q := newQR(version)
+		q.drawCodewords(q.addECC(encodeBytes(data, countBits, capacity), v))
+		q.applyBestMask()
+		return q.modules, nil
+	}
+	return nil, fmt.Errorf("text is too long for a QR code (%d bytes)", len(data))
+}
+
+// encodeBytes 生成字节模式的数据码字：模式、长度、数据、终止符及填充
+func encodeBytes(data []byte, countBits, capacity int) []byte {
+	var bits []bool
+	appendBits := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, v>>i&1 == 1)
+		}
+	}
+	appendBits(0x4, 4)
+	appendBits(len(data), countBits)
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+	appendBits(0, min(4, capacity*8-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+
+	result := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		result = append(result, b)
+	}
+	for pad := byte(0xec); len(result) < capacity; pad ^= 0xec ^ 0x11 {
+		result = append(result, pad)
+	}
+	return result
+}
+
+type qrCode struct {
+	version  int
+	size     int
+	modules  [][]bool
+	function [][]bool // 功能图形所在的模块，不放置数据也不掩模
+}
+
+func newQR(version int) *qrCode {
+	size := version*4 + 17
+	q := &qrCode{version: version, size: size}
+	q.modules = make([][]bool, size)
+	q.function = make([][]bool, size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+	q.drawFunctionPatterns()
+	return q
+}
+
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+func (q *qrCode) drawFunctionPatterns() {
+	for i := 0; i < q.size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	// 位置探测图形及分隔符
+	for _, c := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < q.size && y >= 0 && y < q.size {
+					d := max(abs(dx), abs(dy))
+					q.set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	// 校正图形，与位置探测图形重叠的除外
+	align := qrVersions[q.version-1].align
+	last := len(align) - 1
+	for i, y := range align {
+		for j, x := range align {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	q.drawFormatBits(0) // 先占位，确定掩模后重画
+	q.drawVersion()
+}
+
+// drawFormatBits 画出纠错等级和掩模编号组成的格式信息(BCH(15,5)编码)，共两份
+func (q *qrCode) drawFormatBits(mask int) {
+	data := qrECLevelL<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true) // 固定的深色模块
+}
+
+// drawVersion 版本7及以上需要画出版本信息(BCH(18,6)编码)，共两份
+func (q *qrCode) drawVersion() {
+	if q.version < 7 {
+		return
+	}
+	rem := q.version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1f25
+	}
+	bits := q.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := bits>>i&1 == 1
+		a, b := q.size-11+i%3, i/3
+		q.set(a, b, dark)
+		q.set(b, a, dark)
+	}
+}
+
+// addECC 将数据分块并计算纠错码，然后交错排列各块的码字
+func (q *qrCode) addECC(data []byte, v qrVersion) []byte {
+	shortBlocks := v.blocks - v.codewords%v.blocks
+	shortLen := v.codewords / v.blocks
+	divisor := rsDivisor(v.eccLen)
+	var blocks [][]byte
+	k := 0
+	for i := 0; i < v.blocks; i++ {
+		n := shortLen - v.eccLen
+		if i >= shortBlocks {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		ecc := rsRemainder(block, divisor)
+		if i < shortBlocks {
+			block = append(block, 0) // 占位，使各块等长
+		}
+		blocks = append(blocks, append(block, ecc...))
+	}
+	result := make([]byte, 0, v.codewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortLen-v.eccLen || j >= shortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// drawCodewords 从右下角开始，以两列为一组上下往返放置数据位
+func (q *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // 跳过竖直的定位图形
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = q.size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = data[i>>3]>>(7-i&7)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyBestMask 尝试8种掩模，选择罚分最低的一种
+func (q *qrCode) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask) // 异或两次即还原
+	}
+	q.applyMask(best)
+	q.drawFormatBits(best)
+}
+
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.function[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			q.modules[y][x] = q.modules[y][x] != invert
+		}
+	}
+}
+
+// penalty 按标准中的四条规则计算罚分
+func (q *qrCode) penalty() int {
+	p := 0
+	at := func(x, y int, vertical bool) bool {
+		if vertical {
+			return q.modules[x][y]
+		}
+		return q.modules[y][x]
+	}
+	finder := []bool{true, false, true, true, true, false, true}
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < q.size; y++ {
+			run := 0
+			for x := 0; x < q.size; x++ {
+				// 规则1：同色连续5个及以上
+				if x > 0 && at(x, y, vertical) == at(x-1, y, vertical) {
+					run++
+					if run == 5 {
+						p += 3
+					} else if run > 5 {
+						p++
+					}
+				} else {
+					run = 1
+				}
+				// 规则3：类似位置探测图形的1:1:3:1:1图案，一侧有4个浅色模块
+				if x+7 <= q.size {
+					match := true
+					for k, dark := range finder {
+						if at(x+k, y, vertical) != dark {
+							match = false
+							break
+						}
+					}
+					if match && (q.lightRun(x-4, x, y, vertical) || q.lightRun(x+7, x+11, y, vertical)) {
+						p += 40
+					}
+				}
+			}
+		}
+	}
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			// 规则2：2x2的同色块
+			if x > 0 && y > 0 {
+				c := q.modules[y][x]
+				if c == q.modules[y][x-1] && c == q.modules[y-1][x] && c == q.modules[y-1][x-1] {
+					p += 3
+				}
+			}
+		}
+	}
+	// 规则4：深色模块比例偏离50%，每5%罚10分
+	total := q.size * q.size
+	p += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+	return p
+}
+
+// lightRun 判断[from, to)范围内是否均为浅色，超出边界的部分视为浅色
+func (q *qrCode) lightRun(from, to, y int, vertical bool) bool {
+	for x := from; x < to; x++ {
+		if x < 0 || x >= q.size {
+			continue
+		}
+		if (vertical && q.modules[x][y]) || (!vertical && q.modules[y][x]) {
+			return false
+		}
+	}
+	return true
+}
+
+// rsDivisor 计算Reed-Solomon生成多项式的系数(不含最高次项)
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMul(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMul GF(2^8)上的乘法，本原多项式为0x11d
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11d
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// QRText 将text编码为二维码，并用半高方块字符渲染为终端文本，
+// 每个字符表示上下两个模块，颜色固定为白底黑码，不受终端配色影响
+func QRText(text string) (string, error) {
+	modules, err := QRCode(text)
+	if err != nil {
+		return "", err
+	}
+	const quiet = 2
+	size := len(modules)
+	dark := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		return x >= 0 && y >= 0 && x < size && y < size && modules[y][x]
+	}
+	var sb strings.Builder
+	for y := 0; y < size+quiet*2; y += 2 {
+		sb.WriteString("\x1b[97;40m") // 前景为浅色，背景为深色
+		for x := 0; x < size+quiet*2; x++ {
+			top, bottom := dark(x, y), dark(x, y+1)
+			switch {
+			case !top && !bottom:
+				sb.WriteString("█")
+			case !top:
+				sb.WriteString("▀")
+			case !bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\x1b[0m\n")
+	}
+	return sb.String(), nil
+}
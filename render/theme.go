@@ -0,0 +1,111 @@
+// Package render 提供图片、视频等导出共用的渲染设置
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/x6nux/asciinema/asciicast"
+)
+
+// RecordedTheme 使用录制时记录在头部的配色
+const RecordedTheme = "recorded"
+
+// themes 内置的配色，与agg的内置配色一致
+var themes = map[string]asciicast.Theme{
+	"asciinema": {
+		Fg: "#cccccc", Bg: "#121314",
+		Palette: "#000000:#dd3c69:#4ebf22:#ddaf3c:#26b0d7:#b954e1:#54e1b9:#d9d9d9:#4d4d4d:#dd3c69:#4ebf22:#ddaf3c:#26b0d7:#b954e1:#54e1b9:#ffffff",
+	},
+	"dracula": {
+		Fg: "#f8f8f2", Bg: "#282a36",
+		Palette: "#21222c:#ff5555:#50fa7b:#f1fa8c:#bd93f9:#ff79c6:#8be9fd:#f8f8f2:#6272a4:#ff6e6e:#69ff94:#ffffa5:#d6acff:#ff92df:#a4ffff:#ffffff",
+	},
+	"github-dark": {
+		Fg: "#eceff4", Bg: "#171b21",
+		Palette: "#0e1116:#f97583:#a2fca2:#fabb72:#7db4f9:#c4a0f5:#1f6feb:#eceff4:#6a737d:#bf5a64:#7abf7a:#bf8f57:#608bbf:#997dbf:#1f6feb:#b9bbbf",
+	},
+	"github-light": {
+		Fg: "#171b21", Bg: "#eceff4",
+		Palette: "#0e1116:#f97583:#a2fca2:#fabb72:#7db4f9:#c4a0f5:#1f6feb:#eceff4:#6a737d:#bf5a64:#7abf7a:#bf8f57:#608bbf:#997dbf:#1f6feb:#b9bbbf",
+	},
+	"monokai": {
+		Fg: "#f8f8f2", Bg: "#272822",
+		Palette: "#272822:#f92672:#a6e22e:#f4bf75:#66d9ef:#ae81ff:#a1efe4:#f8f8f2:#75715e:#f92672:#a6e22e:#f4bf75:#66d9ef:#ae81ff:#a1efe4:#f9f8f5",
+	},
+	"nord": {
+		Fg: "#eceff4", Bg: "#2e3440",
+		Palette: "#3b4252:#bf616a:#a3be8c:#ebcb8b:#81a1c1:#b48ead:#88c0d0:#e5e9f0:#4c566a:#bf616a:#a3be8c:#ebcb8b:#81a1c1:#b48ead:#8fbcbb:#eceff4",
+	},
+	"solarized-dark": {
+		Fg: "#839496", Bg: "#002b36",
+		Palette: "#073642:#dc322f:#859900:#b58900:#268bd2:#d33682:#2aa198:#eee8d5:#002b36:#cb4b16:#586e75:#657b83:#839496:#6c71c4:#93a1a1:#fdf6e3",
+	},
+	"solarized-light": {
+		Fg: "#657b83", Bg: "#fdf6e3",
+		Palette: "#073642:#dc322f:#859900:#b58900:#268bd2:#d33682:#2aa198:#eee8d5:#002b36:#cb4b16:#586e75:#657b83:#839496:#6c71c4:#93a1a1:#fdf6e3",
+	},
+}
+
+// aliases 配色的别名
+var aliases = map[string]string{
+	"solarized": "solarized-dark",
+	"github":    "github-dark",
+}
+
+// ThemeNames 返回内置配色的名称
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadTheme 按名称查找配色：内置配色、recorded(录制时的配色，没有时返回nil)，
+// 或者以.json结尾的文件，内容与头部的theme字段格式相同
+func LoadTheme(name string, recorded *asciicast.Theme) (*asciicast.Theme, error) {
+	if name == RecordedTheme {
+		return recorded, nil
+	}
+	if strings.HasSuffix(name, ".json") {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		theme := &asciicast.Theme{}
+		if err := json.Unmarshal(data, theme); err != nil {
+			return nil, fmt.Errorf("invalid theme file %s: %v", name, err)
+		}
+		if err := theme.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid theme file %s: %v", name, err)
+		}
+		return theme, nil
+	}
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+	theme, ok := themes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme %q, must be one of %s, %s or a .json file", name, strings.Join(ThemeNames(), ", "), RecordedTheme)
+	}
+	return &theme, nil
+}
+
+// AggTheme 转换为agg的自定义配色格式：背景色,前景色,调色板，颜色不带#。
+// agg要求提供调色板，没有时使用asciinema配色的调色板
+func AggTheme(t *asciicast.Theme) string {
+	palette := t.Palette
+	if palette == "" {
+		palette = themes["asciinema"].Palette
+	}
+	colors := append([]string{t.Bg, t.Fg}, strings.Split(palette, ":")...)
+	for i, c := range colors {
+		colors[i] = strings.TrimPrefix(c, "#")
+	}
+	return strings.Join(colors, ",")
+}
@@ -0,0 +1,98 @@
+package terminal
+
+import (
+	"fmt"
+	"time"
+)
+
+// BellMode 播放时对录像中响铃(BEL)的处理方式
+type BellMode string
+
+const (
+	BellAudible BellMode = "audible" // 原样输出，由终端响铃
+	BellVisual  BellMode = "visual"  // 不输出BEL，改为反色闪烁一下屏幕
+	BellIgnore  BellMode = "ignore"  // 不输出BEL
+)
+
+const (
+	flashOn  = "\x1b[?5h"
+	flashOff = "\x1b[?5l"
+	// flashDuration 视觉响铃时屏幕反色的时长
+	flashDuration = 100 * time.Millisecond
+)
+
+// ParseBellMode 解析audible、visual或ignore，为空时为audible
+func ParseBellMode(s string) (BellMode, error) {
+	switch mode := BellMode(s); mode {
+	case "":
+		return BellAudible, nil
+	case BellAudible, BellVisual, BellIgnore:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid bell mode %q, must be audible, visual or ignore", s)
+}
+
+// BellScanner 在输出中查找响铃字符，作为OSC等字符串序列结束符的BEL不算响铃。
+// 序列可以跨越多次Scan调用
+type BellScanner struct {
+	state int
+}
+
+// Scan 返回data中响铃的次数，strip为true时返回的数据中去掉了响铃字符，否则原样返回data
+func (s *BellScanner) Scan(data []byte, strip bool) ([]byte, int) {
+	out := data
+	if strip {
+		out = make([]byte, 0, len(data))
+	}
+	bells := 0
+	for _, b := range data {
+		if s.step(b) {
+			bells++
+			if strip {
+				continue
+			}
+		}
+		if strip {
+			out = append(out, b)
+		}
+	}
+	return out, bells
+}
+
+// step 处理一个字节，返回它是否为响铃
+func (s *BellScanner) step(b byte) bool {
+	switch s.state {
+	case stateGround:
+		switch b {
+		case 0x07:
+			return true
+		case 0x1b:
+			s.state = stateEscape
+		}
+	case stateEscape:
+		switch b {
+		case ']', 'P', '_', '^', 'X':
+			s.state = stateString
+		case 0x1b:
+		default:
+			// CSI等序列中的BEL同样会响铃，按普通输出处理
+			s.state = stateGround
+		}
+	case stateString:
+		switch b {
+		case 0x07, 0x18, 0x1a:
+			s.state = stateGround
+		case 0x1b:
+			s.state = stateStringEsc
+		}
+	case stateStringEsc:
+		if b == '\\' {
+			s.state = stateGround
+			return false
+		}
+		// 字符串被新的转义序列打断
+		s.state = stateEscape
+		return s.step(b)
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package terminal
+
+import (
+	"os"
+	"sync"
+
+	"github.com/x6nux/asciinema/util"
+	"golang.org/x/term"
+)
+
+const (
+	pushTitle      = "\x1b[22;0t"
+	popTitle       = "\x1b[23;0t"
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	leaveAltScreen = "\x1b[?1049l"
+	// 重置录像中可能遗留的终端状态：SGR、鼠标模式、括号粘贴、应用光标键、应用键盘、光标显示、反色屏幕
+	resetModes = "\x1b[0m\x1b[?1000l\x1b[?1002l\x1b[?1003l\x1b[?1006l\x1b[?2004l\x1b[?1l\x1b>\x1b[?25h" + flashOff
+)
+
+// terminalGuard 记录播放期间对终端的修改，并保证在任何退出路径上(正常结束、出错、panic、Ctrl-C)恢复
+type terminalGuard struct {
+	out       Terminal
+	altScreen bool
+	rawFd     int
+	rawState  *term.State
+	once      sync.Once
+	remove    func()
+}
+
+// guardTerminal 准备播放用的终端，非交互式终端不做任何修改
+func (r *AsciicastPlayer) guardTerminal() *terminalGuard {
+	g := &terminalGuard{out: r.Terminal}
+	if !r.isTTY() {
+		g.once.Do(func() {})
+		return g
+	}
+	g.out.Write([]byte(pushTitle))
+	if r.Options.AltScreen {
+		g.altScreen = true
+		g.out.Write([]byte(enterAltScreen))
+	}
+	// 被中断退出时同样需要恢复
+	g.remove = util.AddCleanup(g.Restore)
+	return g
+}
+
+// makeRaw 将标准输入切换为raw模式，恢复时自动退出
+func (g *terminalGuard) makeRaw(f *os.File) error {
+	fd := int(f.Fd())
+	if !term.IsTerminal(fd) {
+		return nil
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	g.rawFd, g.rawState = fd, state
+	return nil
+}
+
+// Restore 恢复终端状态，可重复调用
+func (g *terminalGuard) Restore() {
+	g.once.Do(func() {
+		if g.rawState != nil {
+			term.Restore(g.rawFd, g.rawState)
+		}
+		g.out.Write([]byte(resetModes))
+		if g.altScreen {
+			g.out.Write([]byte(leaveAltScreen))
+		}
+		g.out.Write([]byte(popTitle))
+		if g.remove != nil {
+			g.remove()
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package terminal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/x6nux/asciinema/vt"
+)
+
+// hudRefresh 状态栏显示时刷新播放时间的间隔
+const hudRefresh = 250 * time.Millisecond
+
+// statusBar 播放时的单行状态栏，占用终端的最后一行。
+// 录像内容始终写入屏幕模型；状态栏显示期间由屏幕模型重绘录像内容，
+// 隐藏时按屏幕模型恢复整个画面，之后继续直接输出，因此不会破坏回放的内容
+type statusBar struct {
+	out        Terminal
+	screen     *vt.Screen
+	cols, rows int // 终端大小
+	visible    bool
+	status     string
+	lines      []string // 终端各行当前显示的内容，只重绘变化的行
+	altScreen  bool     // 显示状态栏时真实终端是否处于录像的备用屏幕
+}
+
+func newStatusBar(out Terminal, width, height, cols, rows int) *statusBar {
+	return &statusBar{
+		out:    out,
+		screen: vt.New(width, height),
+		cols:   cols,
+		rows:   rows,
+	}
+}
+
+// write 输出录像内容
+func (s *statusBar) write(data []byte) error {
+	s.screen.Write(data)
+	if !s.visible {
+		return s.out.Write(data)
+	}
+	return s.redraw()
+}
+
+// rewind 清空屏幕模型和终端，准备从头重放
+func (s *statusBar) rewind() error {
+	s.screen.Reset()
+	if !s.visible {
+		return s.out.Write([]byte(rewindScreen))
+	}
+	return nil
+}
+
+// toggle 显示或隐藏状态栏
+func (s *statusBar) toggle() error {
+	s.visible = !s.visible
+	s.lines = nil
+	if s.visible {
+		s.altScreen = s.screen.AltScreen()
+		return s.redraw()
+	}
+	return s.restore()
+}
+
+// update 更新状态栏的文字，显示时立即重绘
+func (s *statusBar) update(status string) error {
+	s.status = status
+	if !s.visible {
+		return nil
+	}
+	return s.redraw()
+}
+
+// redraw 按屏幕模型重绘变化的行，然后绘制状态栏并恢复光标位置
+func (s *statusBar) redraw() error {
+	if s.lines == nil {
+		s.lines = make([]string, s.rows)
+		for i := range s.lines {
+			s.lines[i] = "\x00" // 确保第一次全部重绘
+		}
+	}
+	var b strings.Builder
+	b.WriteString("\x1b[?25l")
+	for y := 0; y < s.rows-1; y++ {
+		line := s.renderLine(y)
+		if line != s.lines[y] {
+			fmt.Fprintf(&b, "\x1b[%d;1H\x1b[0m%s\x1b[0m\x1b[K", y+1, line)
+			s.lines[y] = line
+		}
+	}
+	status := truncate(s.status, s.cols)
+	status += strings.Repeat(" ", s.cols-len([]rune(status)))
+	fmt.Fprintf(&b, "\x1b[%d;1H\x1b[0;7m%s\x1b[0m", s.rows, status)
+	s.moveCursor(&b)
+	return s.out.Write([]byte(b.String()))
+}
+
+// restore 隐藏状态栏后按屏幕模型恢复整个画面和光标、滚动区域等状态
+func (s *statusBar) restore() error {
+	var b strings.Builder
+	if alt := s.screen.AltScreen(); alt != s.altScreen {
+		if alt {
+			b.WriteString("\x1b[?1049h")
+		} else {
+			b.WriteString("\x1b[?1049l")
+		}
+	}
+	b.WriteString("\x1b[0m\x1b[r\x1b[H\x1b[2J")
+	for y := 0; y < s.rows; y++ {
+		if line := s.renderLine(y); line != "" {
+			fmt.Fprintf(&b, "\x1b[%d;1H%s\x1b[0m", y+1, line)
+		}
+	}
+	if top, bottom := s.screen.ScrollRegion(); top > 0 || bottom < s.rows-1 {
+		fmt.Fprintf(&b, "\x1b[%d;%dr", top+1, bottom+1)
+	}
+	s.moveCursor(&b)
+	b.WriteString(s.screen.Pen().SGR())
+	return s.out.Write([]byte(b.String()))
+}
+
+// renderLine 渲染屏幕模型的第y行，超出终端宽度的部分被截掉
+func (s *statusBar) renderLine(y int) string {
+	cells := s.screen.Line(y)
+	if len(cells) > s.cols {
+		cells = cells[:s.cols]
+	}
+	return vt.RenderCells(cells)
+}
+
+// moveCursor 将光标移到屏幕模型中的位置并恢复其可见性
+func (s *statusBar) moveCursor(b *strings.Builder) {
+	x, y, visible := s.screen.Cursor()
+	fmt.Fprintf(b, "\x1b[%d;%dH", y+1, x+1)
+	if visible {
+		b.WriteString("\x1b[?25h")
+	} else {
+		b.WriteString("\x1b[?25l")
+	}
+}
+
+// truncate 将文字截断到n个字符以内
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
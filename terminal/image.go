@@ -0,0 +1,416 @@
+package terminal
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ImageMode 播放时对录像中sixel、iTerm2和kitty图片的处理方式
+type ImageMode string
+
+const (
+	ImageAuto        ImageMode = "auto"        // 终端支持的图片原样输出，其他图片显示为占位文字
+	ImagePassthrough ImageMode = "passthrough" // 原样输出所有图片
+	ImagePlaceholder ImageMode = "placeholder" // 所有图片都显示为占位文字
+)
+
+const (
+	// maxImageBytes 不去掉危险序列时，单个图片序列最多缓存的字节数，超出后丢弃
+	maxImageBytes = 32 << 20
+	// maxImageHead 显示占位文字时保留的图片序列开头的字节数，其中有图片的大小和文件名
+	maxImageHead = 512
+	// imageQueryTimeout 等待终端回应DA1查询的最长时间
+	imageQueryTimeout = 300 * time.Millisecond
+	// kittyQueryID 查询kitty图片协议时使用的图片编号
+	kittyQueryID = 31
+	// kittyCell kitty的Unicode占位符，与组合附加符号一起表示图片的一个单元格
+	kittyCell = '\U0010EEEE'
+)
+
+// imageFilter额外使用的状态，在sanitize.go中的状态之后
+const (
+	stateCell      = stateStringEsc + 1 + iota // 可能是kitty占位符的UTF-8字节
+	stateCellMarks                             // kitty占位符之后的组合附加符号
+)
+
+// ParseImageMode 解析auto、passthrough或placeholder，为空时为auto
+func ParseImageMode(s string) (ImageMode, error) {
+	switch mode := ImageMode(s); mode {
+	case "":
+		return ImageAuto, nil
+	case ImageAuto, ImagePassthrough, ImagePlaceholder:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid image mode %q, must be auto, passthrough or placeholder", s)
+}
+
+// imageProtocol 图片序列使用的协议
+type imageProtocol int
+
+const (
+	imageNone    imageProtocol = iota
+	imageSixel                 // DCS P1;P2;P3 q 数据 ST
+	imageITerm2                // OSC 1337 ; File=参数:base64数据 ST，以及分段传输的MultipartFile、FilePart、FileEnd
+	imageKitty                 // APC G 控制数据;base64数据 ST
+	imageUnknown               // 序列还不完整，无法判断
+)
+
+// iterm2Prefixes iTerm2图片协议的OSC内容前缀
+var iterm2Prefixes = []string{"1337;File=", "1337;MultipartFile=", "1337;FilePart=", "1337;FileEnd"}
+
+// imageSupport 终端支持的图片协议
+type imageSupport struct {
+	sixel  bool
+	iterm2 bool
+	kitty  bool
+}
+
+// allows 判断协议为proto的图片能否原样输出
+func (s imageSupport) allows(proto imageProtocol) bool {
+	switch proto {
+	case imageSixel:
+		return s.sixel
+	case imageITerm2:
+		return s.iterm2
+	case imageKitty:
+		return s.kitty
+	}
+	return false
+}
+
+// all 判断是否支持所有图片协议
+func (s imageSupport) all() bool {
+	return s.sixel && s.iterm2 && s.kitty
+}
+
+// imageKind 根据字符串序列seq(以ESC P、ESC ]或ESC _开头，不含结束符)的开头判断其图片协议
+func imageKind(seq []byte) imageProtocol {
+	if len(seq) < 2 {
+		return imageUnknown
+	}
+	body := seq[2:]
+	switch seq[1] {
+	case 'P':
+		// 参数之后紧跟q的是sixel，DECRQSS($q)、XTGETTCAP(+q)等有中间字节
+		for _, b := range body {
+			switch {
+			case b == 'q':
+				return imageSixel
+			case b != ';' && (b < '0' || b > '9'):
+				return imageNone
+			}
+		}
+		return imageUnknown
+	case ']':
+		for _, prefix := range iterm2Prefixes {
+			if bytes.HasPrefix(body, []byte(prefix)) {
+				return imageITerm2
+			}
+		}
+		for _, prefix := range iterm2Prefixes {
+			if strings.HasPrefix(prefix, string(body)) {
+				return imageUnknown
+			}
+		}
+	case '_':
+		switch {
+		case len(body) == 0:
+			return imageUnknown
+		case body[0] == 'G':
+			return imageKitty
+		}
+	}
+	return imageNone
+}
+
+// imageStart 图片序列的开头
+var imageStart = regexp.MustCompile(`\x1bP[0-9;]*q|\x1b\]1337;(?:Multipart)?File=|\x1b_G`)
+
+// hasImage 判断输出帧(o)或压缩帧(z)中是否有图片序列，压缩帧边解压边查找，不保留解压后的数据
+func hasImage(frame Frame) bool {
+	switch frame.GetEventType() {
+	case "o":
+		return imageStart.Match(frame.GetEventData())
+	case "z":
+		gz, err := gzip.NewReader(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(frame.GetEventData())))
+		if err != nil {
+			return false
+		}
+		defer gz.Close()
+		return imageStart.MatchReader(bufio.NewReader(gz))
+	}
+	return false
+}
+
+// sixelRaster sixel数据开头的光栅属性，其中有图片的宽和高(像素)
+var sixelRaster = regexp.MustCompile(`^"\d*;\d*;(\d+);(\d+)`)
+
+// imagePlaceholder 返回替代图片序列的占位文字，head为序列的开头。分段传输的图片只在开始处显示一次，
+// 只传输不显示的kitty图片、kitty的其他命令和iTerm2协议的文件下载不显示
+func imagePlaceholder(head []byte) []byte {
+	var label string
+	switch imageKind(head) {
+	case imageSixel:
+		label = "sixel image"
+		data := head[bytes.IndexByte(head, 'q')+1:]
+		if m := sixelRaster.FindSubmatch(data); m != nil {
+			label += fmt.Sprintf(" %sx%s", m[1], m[2])
+		}
+	case imageITerm2:
+		args, ok := iterm2Args(head)
+		if !ok || args["inline"] != "1" {
+			return nil
+		}
+		label = "image"
+		if name, err := base64.StdEncoding.DecodeString(args["name"]); err == nil && len(name) > 0 {
+			label += " " + strconv.QuoteToGraphic(string(name))
+		}
+	case imageKitty:
+		keys := kittyKeys(head)
+		// 没有a时为只传输(t)，U=1的虚拟放置由占位符显示
+		if (keys["a"] != "T" && keys["a"] != "p") || keys["U"] == "1" {
+			return nil
+		}
+		label = "kitty image"
+		if keys["s"] != "" && keys["v"] != "" {
+			label += fmt.Sprintf(" %sx%s", keys["s"], keys["v"])
+		}
+	default:
+		return nil
+	}
+	return []byte("\x1b[7m[" + label + "]\x1b[27m")
+}
+
+// iterm2Args 解析iTerm2图片序列开头File=或MultipartFile=之后的参数，其他iTerm2序列ok为false
+func iterm2Args(seq []byte) (args map[string]string, ok bool) {
+	body := string(seq[2:])
+	if !strings.HasPrefix(body, "1337;File=") && !strings.HasPrefix(body, "1337;MultipartFile=") {
+		return nil, false
+	}
+	params, _, _ := strings.Cut(body[strings.Index(body, "=")+1:], ":")
+	args = map[string]string{}
+	for _, arg := range strings.Split(params, ";") {
+		key, value, _ := strings.Cut(arg, "=")
+		args[key] = value
+	}
+	return args, true
+}
+
+// iterm2Download 判断iTerm2序列是否为让终端下载文件(而不是显示内联图片)
+func iterm2Download(seq []byte) bool {
+	args, ok := iterm2Args(seq)
+	return ok && args["inline"] != "1"
+}
+
+// kittyKeys 解析kitty图片序列的控制数据，即G之后、分号之前以逗号分隔的key=value
+func kittyKeys(seq []byte) map[string]string {
+	control, _, _ := bytes.Cut(seq[3:], []byte(";"))
+	keys := map[string]string{}
+	for _, kv := range strings.Split(string(control), ",") {
+		key, value, _ := strings.Cut(kv, "=")
+		keys[key] = value
+	}
+	return keys
+}
+
+// quietKitty 返回不让终端回复的kitty图片序列(不含结束符)：查询(a=q)返回nil，其他命令改为q=2。
+// 播放时终端的回复会被当作按键读入
+func quietKitty(seq []byte) []byte {
+	if kittyKeys(seq)["a"] == "q" {
+		return nil
+	}
+	control, payload, hasPayload := bytes.Cut(seq[3:], []byte(";"))
+	var kept [][]byte
+	for _, kv := range bytes.Split(control, []byte(",")) {
+		if len(kv) > 0 && !bytes.HasPrefix(kv, []byte("q=")) {
+			kept = append(kept, kv)
+		}
+	}
+	out := append([]byte("\x1b_G"), bytes.Join(append(kept, []byte("q=2")), []byte(","))...)
+	if hasPayload {
+		out = append(append(out, ';'), payload...)
+	}
+	return out
+}
+
+// imageFilter 将不原样输出的图片序列替换为占位文字，strip时直接去掉；不原样输出kitty图片时，
+// kitty的Unicode占位符替换为空格。其他内容原样输出，序列可以跨越多次Filter调用
+type imageFilter struct {
+	pass  imageSupport // 原样输出的图片协议
+	strip bool         // 去掉图片，不显示占位文字
+	state int
+	seq   []byte        // 当前字符串序列的开头，或可能是kitty占位符的字节
+	kind  imageProtocol // 当前字符串序列的图片协议
+}
+
+// Filter 返回替换了图片序列后的数据
+func (f *imageFilter) Filter(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for _, b := range data {
+		out = f.step(out, b)
+	}
+	return out
+}
+
+// placeholder 图片序列结束时输出的内容
+func (f *imageFilter) placeholder() []byte {
+	if f.strip {
+		return nil
+	}
+	return imagePlaceholder(f.seq)
+}
+
+// step 处理一个字节，输出追加到out
+func (f *imageFilter) step(out []byte, b byte) []byte {
+	switch f.state {
+	case stateGround:
+		switch {
+		case b == 0x1b:
+			f.state, f.seq = stateEscape, append(f.seq[:0], b)
+			return out
+		case b == 0xf4 && !f.pass.kitty:
+			f.state, f.seq = stateCell, append(f.seq[:0], b)
+			return out
+		}
+		return append(out, b)
+	case stateEscape:
+		if b == 'P' || b == ']' || b == '_' {
+			f.state, f.seq, f.kind = stateString, append(f.seq, b), imageUnknown
+			return out
+		}
+		f.state = stateGround
+		return f.step(append(out, f.seq...), b)
+	case stateString:
+		if f.kind == imageUnknown {
+			if b == 0x07 || b == 0x1b || b == 0x18 || b == 0x1a {
+				f.kind = imageNone
+			} else {
+				f.seq = append(f.seq, b)
+				f.kind = imageKind(f.seq)
+			}
+			if f.kind == imageNone || f.pass.allows(f.kind) {
+				// 不是要替换的图片，之前缓存的开头和之后的内容原样输出
+				f.state = stateGround
+				out = append(out, f.seq...)
+				if b == 0x07 || b == 0x1b || b == 0x18 || b == 0x1a {
+					return f.step(out, b)
+				}
+			}
+			return out
+		}
+		switch {
+		case b == 0x07:
+			f.state = stateGround
+			return append(out, f.placeholder()...)
+		case b == 0x1b:
+			f.state = stateStringEsc
+		case b == 0x18 || b == 0x1a:
+			f.state = stateGround
+		case len(f.seq) < maxImageHead:
+			f.seq = append(f.seq, b)
+		}
+	case stateStringEsc:
+		f.state = stateGround
+		out = append(out, f.placeholder()...)
+		if b != '\\' {
+			// 图片被新的转义序列打断
+			return f.step(f.step(out, 0x1b), b)
+		}
+	case stateCell, stateCellMarks:
+		f.seq = append(f.seq, b)
+		if !utf8.FullRune(f.seq) {
+			return out
+		}
+		r, size := utf8.DecodeRune(f.seq)
+		switch {
+		case f.state == stateCell && r == kittyCell:
+			f.state, f.seq = stateCellMarks, f.seq[:0]
+			return append(out, ' ')
+		case f.state == stateCellMarks && unicode.Is(unicode.Mn, r):
+			// 占位符之后的组合附加符号表示行、列和图片编号的高位，一并去掉
+			f.seq = f.seq[:0]
+			return out
+		}
+		// 不是占位符：其他以0xf4开头的字符原样输出，其余字节重新处理
+		seq := append([]byte{}, f.seq...)
+		if f.state == stateCell {
+			out, seq = append(out, seq[:size]...), seq[size:]
+		}
+		f.state = stateGround
+		for _, c := range seq {
+			out = f.step(out, c)
+		}
+	}
+	return out
+}
+
+// reset 丢弃未结束的序列，从头重放时调用
+func (f *imageFilter) reset() {
+	f.state, f.seq = stateGround, f.seq[:0]
+}
+
+// detectImageSupport 检测播放用的终端支持的图片协议：通过DA1查询的回应中的4号功能判断sixel，
+// 通过kitty图片协议的查询判断kitty协议，通过TERM_PROGRAM和LC_TERMINAL(可以经ssh传递)判断iTerm2协议
+func detectImageSupport(in, out *os.File) imageSupport {
+	var s imageSupport
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "mintty", "rio", "Tabby", "WarpTerminal":
+		s.iterm2 = true
+	}
+	if os.Getenv("LC_TERMINAL") == "iTerm2" {
+		s.iterm2 = true
+	}
+	query := fmt.Sprintf("\x1b_Gi=%d,s=1,v=1,a=q,t=d,f=24;AAAA\x1b\\\x1b[c", kittyQueryID)
+	if reply, err := queryTerminal(in, out, query, imageQueryTimeout); err == nil {
+		s.kitty = bytes.Contains(reply, []byte(fmt.Sprintf("\x1b_Gi=%d;OK", kittyQueryID)))
+		if m := daReply.Find(reply); m != nil {
+			for _, attr := range strings.Split(string(m[3:len(m)-1]), ";") {
+				s.sixel = s.sixel || attr == "4"
+			}
+		}
+	}
+	return s
+}
+
+// ImageStripper 从输出中去掉图片序列，用于录制时的过滤和导出。序列可以跨越多次Strip调用
+type ImageStripper struct {
+	filter imageFilter
+}
+
+// NewImageStripper 返回去掉protocols中协议(kitty、sixel或iterm2)的图片的ImageStripper，
+// protocols为空时去掉所有图片
+func NewImageStripper(protocols []string) (*ImageStripper, error) {
+	s := &ImageStripper{filter: imageFilter{strip: true}}
+	if len(protocols) == 0 {
+		return s, nil
+	}
+	s.filter.pass = imageSupport{sixel: true, iterm2: true, kitty: true}
+	for _, p := range protocols {
+		switch strings.ToLower(strings.TrimSpace(p)) {
+		case "kitty":
+			s.filter.pass.kitty = false
+		case "sixel":
+			s.filter.pass.sixel = false
+		case "iterm2":
+			s.filter.pass.iterm2 = false
+		default:
+			return nil, fmt.Errorf("unknown image protocol %q, use kitty, sixel or iterm2", p)
+		}
+	}
+	return s, nil
+}
+
+// Strip 返回去掉图片序列后的数据，末尾未结束的序列留到下一次调用
+func (s *ImageStripper) Strip(data []byte) []byte {
+	return s.filter.Filter(data)
+}
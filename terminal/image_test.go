@@ -0,0 +1,56 @@
+package terminal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+)
+
+type testFrame struct {
+	typ  string
+	data string
+}
+
+func (f testFrame) GetTime() float64     { return 0 }
+func (f testFrame) GetEventType() string { return f.typ }
+func (f testFrame) GetEventData() []byte { return []byte(f.data) }
+func (f testFrame) IsCompressed() bool   { return f.typ == "z" }
+
+// compressed 返回data压缩后的z帧数据
+func compressed(t *testing.T, data string) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestHasImage(t *testing.T) {
+	sixel := "text\x1bPq#0;2;0;0;0~~\x1b\\"
+	tests := []struct {
+		name  string
+		frame testFrame
+		want  bool
+	}{
+		{"output with sixel", testFrame{"o", sixel}, true},
+		{"output with kitty", testFrame{"o", "\x1b_Ga=T;AAAA\x1b\\"}, true},
+		{"output with iterm2", testFrame{"o", "\x1b]1337;File=inline=1:AAAA\x07"}, true},
+		{"plain output", testFrame{"o", "\x1b[1mbold\x1b[0m"}, false},
+		{"compressed with sixel", testFrame{"z", compressed(t, sixel)}, true},
+		{"compressed plain output", testFrame{"z", compressed(t, "plain")}, false},
+		{"corrupt compressed frame", testFrame{"z", "not base64"}, false},
+		{"input", testFrame{"i", sixel}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasImage(tt.frame); got != tt.want {
+				t.Errorf("hasImage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
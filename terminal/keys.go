@@ -0,0 +1,94 @@
+package terminal
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/x6nux/asciinema/util"
+)
+
+const (
+	keyCtrlC = 0x03
+	// rewindScreen 后退跳转前重置屏幕，之后从头快速重放到目标位置
+	rewindScreen = "\x1b[0m\x1b[r\x1b[2J\x1b[H"
+	// backJumpGrace 后退跳转时忽略刚刚经过的标记，避免连续按键停在同一个标记上
+	backJumpGrace = 1.0
+)
+
+// ErrInterrupted 播放时按下Ctrl-C。raw模式下Ctrl-C不会产生中断信号，由调用方按中断处理
+var ErrInterrupted = errors.New("playback interrupted")
+
+var (
+	keysOnce sync.Once
+	keys     chan byte
+)
+
+// readKeys 在后台读取标准输入的按键。读取协程在整个进程中只启动一次，
+// 以免依次播放多个录像时多个协程争抢输入
+func readKeys() <-chan byte {
+	keysOnce.Do(func() {
+		keys = make(chan byte, 16)
+		go func() {
+			buf := make([]byte, 64)
+			for {
+				n, err := os.Stdin.Read(buf)
+				for _, b := range buf[:n] {
+					select {
+					case keys <- b:
+					default:
+					}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	})
+	return keys
+}
+
+// waitKey 按clock等待d时长，期间有按键时立即返回该按键
+func waitKey(clock util.Clock, d time.Duration, keys <-chan byte) (byte, bool) {
+	if d < 0 {
+		d = 0
+	}
+	select {
+	case <-clock.After(d):
+		return 0, false
+	case k := <-keys:
+		return k, true
+	}
+}
+
+// isMarker 判断是否为标记事件
+func isMarker(f Frame) bool {
+	return !f.IsCompressed() && f.GetEventType() == "m"
+}
+
+// isAnnotation 判断是否为acast annotate添加的注释事件
+func isAnnotation(f Frame) bool {
+	return !f.IsCompressed() && f.GetEventType() == "a"
+}
+
+// nextMarker 返回从pos开始的第一个标记，没有时返回-1
+func nextMarker(frames []Frame, pos int) int {
+	for k := pos; k < len(frames); k++ {
+		if isMarker(frames[k]) {
+			return k
+		}
+	}
+	return -1
+}
+
+// prevMarker 返回录像时间now之前的标记，没有时返回-1(即录像开头)
+func prevMarker(frames []Frame, pos int, now float64) int {
+	now -= backJumpGrace
+	for k := pos - 1; k >= 0; k-- {
+		if isMarker(frames[k]) && frames[k].GetTime() < now {
+			return k
+		}
+	}
+	return -1
+}
@@ -0,0 +1,73 @@
+package terminal
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+const (
+	// PasteBegin 括号粘贴模式下终端在粘贴内容之前发送的序列
+	PasteBegin = "\x1b[200~"
+	// PasteEnd 括号粘贴模式下终端在粘贴内容之后发送的序列
+	PasteEnd = "\x1b[201~"
+	// pasteWait 其他输入最多等待粘贴结束的时间，避免缺少结束序列时一直等待
+	pasteWait = 2 * time.Second
+)
+
+// pasteGate 保证用户粘贴的内容连续写入被录制程序：一次粘贴可能分成多次读取，
+// 粘贴过程中其他来源的输入(如远程观看者的按键)等粘贴结束后再写入，不会插入粘贴内容中间
+type pasteGate struct {
+	mu   sync.Mutex
+	idle chan struct{} // 没有在粘贴时已关闭
+	tail []byte        // 上一次输入末尾可能是开始或结束序列开头的部分
+}
+
+func newPasteGate() *pasteGate {
+	idle := make(chan struct{})
+	close(idle)
+	return &pasteGate{idle: idle}
+}
+
+// user 在写入用户的输入之前调用，返回的函数在写入之后调用
+func (g *pasteGate) user(data []byte) func() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	buf := append(g.tail, data...)
+	begin := bytes.LastIndex(buf, []byte(PasteBegin))
+	end := bytes.LastIndex(buf, []byte(PasteEnd))
+	g.tail = append([]byte{}, buf[max(len(buf)-len(PasteBegin)+1, 0):]...)
+	pasting := g.pasting()
+	switch {
+	case begin > end && !pasting:
+		g.idle = make(chan struct{})
+	case end > begin && pasting:
+		idle := g.idle
+		return func() { close(idle) }
+	}
+	return func() {}
+}
+
+// pasting 判断是否在粘贴中，调用时须持有mu
+func (g *pasteGate) pasting() bool {
+	select {
+	case <-g.idle:
+		return false
+	default:
+		return true
+	}
+}
+
+// wait 在写入其他输入之前调用，等待正在进行的粘贴结束，done被关闭时返回false
+func (g *pasteGate) wait(done <-chan struct{}) bool {
+	g.mu.Lock()
+	idle := g.idle
+	g.mu.Unlock()
+	select {
+	case <-idle:
+	case <-time.After(pasteWait):
+	case <-done:
+		return false
+	}
+	return true
+}
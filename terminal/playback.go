@@ -0,0 +1,349 @@
+package terminal
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	playbackHelp = "m/M marker  space pause  [/] speed  0 reset  t hide"
+	// speedFlash 调整速度后在状态栏中显示新速度的时长
+	speedFlash = 2 * time.Second
+	minSpeed   = 1.0 / 16
+	maxSpeed   = 64.0
+
+	// noteDuration 注释在状态栏中显示的录像时长(秒)，与asciicast.AnnotationDuration相同
+	noteDuration = 5.0
+)
+
+// playback 一次播放的状态
+type playback struct {
+	player *AsciicastPlayer
+	frames []Frame
+	pos    int // 下一个要播放的帧
+	clock  *playClock
+	keys   <-chan byte  // 非交互式播放时为nil
+	bar    *statusBar   // 非交互式播放时为nil
+	held   string       // 在标记处暂停时为标记的名称
+	safe   *sanitizer   // 设置了Unsafe时为nil
+	images imageSupport // 原样输出的图片协议
+	holder *imageFilter // 将其他图片替换为占位文字，支持所有图片协议时为nil
+	bells  BellScanner
+
+	speed      float64   // 初始播放速度，按0时恢复
+	flash      string    // 状态栏中短暂显示的提示
+	flashUntil time.Time // 提示消失的时间
+	autoHide   bool      // 状态栏是为显示提示或注释而临时打开的，都消失后自动隐藏
+	note       string    // 状态栏中显示的注释
+	noteUntil  float64   // 注释消失的录像时间
+}
+
+// run 按时间依次输出各帧，等待期间处理按键
+func (p *playback) run(speed float64) error {
+	if len(p.frames) == 0 {
+		return nil
+	}
+	p.speed = speed
+	if !p.player.Options.Unsafe {
+		p.safe = &sanitizer{images: p.images}
+	}
+	if !p.images.all() {
+		p.holder = &imageFilter{pass: p.images}
+	}
+	p.clock = newPlayClock(p.player.clock(), p.frames[0].GetTime(), speed)
+	for p.pos < len(p.frames) {
+		frame := p.frames[p.pos]
+		if wait := p.clock.until(frame.GetTime()); wait > 0 {
+			if p.bar != nil && p.bar.visible && wait > hudRefresh {
+				wait = hudRefresh
+			}
+			if key, ok := waitKey(p.clock.clock, wait, p.keys); ok {
+				if err := p.handleKey(key); err != nil {
+					return err
+				}
+			}
+			if err := p.updateStatus(); err != nil {
+				return err
+			}
+			continue
+		}
+		p.pos++
+		p.resize(frame)
+		// 标记和注释也先交给注册的处理函数
+		if err := p.play(frame); err != nil {
+			return err
+		}
+		if isMarker(frame) && p.player.Options.PauseOnMarkers && p.keys != nil {
+			p.holdAt(frame)
+		}
+		if isAnnotation(frame) {
+			if err := p.showNote(frame); err != nil {
+				return err
+			}
+		}
+	}
+	// 结束时隐藏状态栏，留下完整的最后一屏
+	if p.bar != nil && p.bar.visible {
+		return p.bar.toggle()
+	}
+	return nil
+}
+
+// play 输出一帧，设置了Profile时记录解压和写入的耗时
+func (p *playback) play(frame Frame) error {
+	prof := p.player.Options.Profile
+	if prof == nil {
+		if data, ok := p.player.frameData(frame); ok {
+			return p.write(data)
+		}
+		return nil
+	}
+	lag := -p.clock.until(frame.GetTime())
+	start := time.Now()
+	data, ok := p.player.frameData(frame)
+	if !ok {
+		return nil
+	}
+	decoded := time.Now()
+	err := p.write(data)
+	prof.addFrame(frame.IsCompressed(), decoded.Sub(start), time.Since(decoded), lag, len(data))
+	return err
+}
+
+// handleKey 处理播放时的按键
+func (p *playback) handleKey(key byte) error {
+	switch key {
+	case keyCtrlC:
+		return ErrInterrupted
+	case ' ':
+		p.held = ""
+		p.clock.togglePause()
+	case 't':
+		if p.bar != nil {
+			p.autoHide = false
+			p.bar.status = p.statusText()
+			return p.bar.toggle()
+		}
+	case '[', '-':
+		return p.setSpeed(p.clock.speed / 2)
+	case ']', '+', '=':
+		return p.setSpeed(p.clock.speed * 2)
+	case '0':
+		return p.setSpeed(p.speed)
+	case 'm':
+		if k := nextMarker(p.frames, p.pos); k >= 0 {
+			return p.seekMarker(k)
+		}
+	case 'M':
+		return p.seekMarker(prevMarker(p.frames, p.pos, p.clock.now()))
+	default:
+		// 暂停时按任意键继续
+		if p.clock.paused {
+			p.held = ""
+			p.clock.togglePause()
+		}
+	}
+	return nil
+}
+
+// setSpeed 调整播放速度，并在状态栏中短暂显示新的速度
+func (p *playback) setSpeed(speed float64) error {
+	p.clock.setSpeed(min(max(speed, minSpeed), maxSpeed))
+	if p.bar == nil {
+		return nil
+	}
+	p.flash = fmt.Sprintf("speed %gx", p.clock.speed)
+	p.flashUntil = p.clock.clock.Now().Add(speedFlash)
+	return p.openBar()
+}
+
+// showNote 在状态栏中显示录像中的注释，直到下一条注释或noteDuration之后
+func (p *playback) showNote(frame Frame) error {
+	if p.bar == nil {
+		return nil
+	}
+	p.note = string(frame.GetEventData())
+	p.noteUntil = frame.GetTime() + noteDuration
+	return p.openBar()
+}
+
+// openBar 为显示提示或注释临时打开状态栏，已经显示时只更新内容
+func (p *playback) openBar() error {
+	if !p.bar.visible {
+		p.autoHide = true
+		p.bar.status = p.statusText()
+		return p.bar.toggle()
+	}
+	return p.bar.update(p.statusText())
+}
+
+// updateStatus 刷新状态栏，提示和注释过期后将其去掉，临时打开的状态栏在都去掉后隐藏
+func (p *playback) updateStatus() error {
+	if p.bar == nil {
+		return nil
+	}
+	if p.flash != "" && p.clock.clock.Now().After(p.flashUntil) {
+		p.flash = ""
+	}
+	if p.note != "" && p.clock.now() >= p.noteUntil {
+		p.note = ""
+	}
+	if p.autoHide && p.flash == "" && p.note == "" && p.bar.visible {
+		p.autoHide = false
+		return p.bar.toggle()
+	}
+	return p.bar.update(p.statusText())
+}
+
+// holdAt 在标记处暂停，等待按键继续
+func (p *playback) holdAt(marker Frame) {
+	p.held = string(marker.GetEventData())
+	if p.held == "" {
+		p.held = "marker"
+	}
+	p.clock.set(marker.GetTime())
+	if !p.clock.paused {
+		p.clock.togglePause()
+	}
+}
+
+// seekMarker 跳到标记k，设置了PauseOnMarkers时停在该标记处
+func (p *playback) seekMarker(k int) error {
+	if err := p.seek(k); err != nil {
+		return err
+	}
+	switch {
+	case k < 0:
+		p.held = ""
+	case p.player.Options.PauseOnMarkers:
+		p.holdAt(p.frames[k])
+	}
+	return nil
+}
+
+// seek 跳到第k帧之后(k为-1时回到开头)。跳转时不等待，一次性输出中间所有帧的内容，
+// 保证画面与目标位置一致；后退时清屏后从头重放
+func (p *playback) seek(k int) error {
+	from := p.pos
+	p.note = ""
+	if k < p.pos {
+		from = 0
+		if p.safe != nil {
+			p.safe.reset()
+		}
+		if p.holder != nil {
+			p.holder.reset()
+		}
+		p.bells = BellScanner{}
+		var err error
+		if p.bar != nil {
+			err = p.bar.rewind()
+		} else {
+			err = p.player.Terminal.Write([]byte(rewindScreen))
+		}
+		if err == nil {
+			err = p.tee([]byte(rewindScreen))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var buf []byte
+	for _, f := range p.frames[from : k+1] {
+		if data, ok := p.player.frameData(f); ok {
+			buf = append(buf, data...)
+		}
+	}
+	p.pos = k + 1
+	p.clock.set(p.frames[max(k, 0)].GetTime())
+	if len(buf) == 0 && (p.bar == nil || !p.bar.visible) {
+		return nil
+	}
+	return p.write(buf)
+}
+
+// resize 处理录像中的大小改变事件：屏幕模型随之改变大小，设置了Resize且终端小于新的大小时，
+// 尝试通过转义序列调整终端大小
+func (p *playback) resize(frame Frame) {
+	cols, rows, ok := frameSize(frame)
+	if !ok {
+		return
+	}
+	if p.bar != nil {
+		p.bar.screen.Resize(cols, rows)
+	}
+	if !p.player.Options.Resize || !p.player.isTTY() {
+		return
+	}
+	if termRows, termCols, err := p.player.Terminal.Size(); err == nil && (termCols < cols || termRows < rows) {
+		p.player.Terminal.Write([]byte(fmt.Sprintf("\x1b[8;%d;%dt", rows, cols)))
+	}
+}
+
+// write 输出录像内容，交互式播放时同时更新屏幕模型
+func (p *playback) write(data []byte) error {
+	if p.holder != nil {
+		data = p.holder.Filter(data)
+	}
+	if p.safe != nil {
+		data = p.safe.Sanitize(data)
+	}
+	bells := 0
+	if mode := p.player.Options.Bell; mode == BellVisual || mode == BellIgnore {
+		data, bells = p.bells.Scan(data, true)
+		if mode == BellIgnore {
+			bells = 0
+		}
+	}
+	var err error
+	if p.bar == nil {
+		err = p.player.Terminal.Write(data)
+	} else {
+		p.bar.status = p.statusText()
+		err = p.bar.write(data)
+	}
+	if err == nil && bells > 0 {
+		err = p.visualBell()
+	}
+	if err != nil {
+		return err
+	}
+	return p.tee(data)
+}
+
+// visualBell 视觉响铃：短暂地将屏幕反色
+func (p *playback) visualBell() error {
+	if err := p.player.Terminal.Write([]byte(flashOn)); err != nil {
+		return err
+	}
+	p.clock.clock.Sleep(flashDuration)
+	return p.player.Terminal.Write([]byte(flashOff))
+}
+
+// tee 将输出的录像内容复制到PlayOptions.Tee，状态栏等播放器自身的输出不会被复制
+func (p *playback) tee(data []byte) error {
+	if p.player.Options.Tee == nil {
+		return nil
+	}
+	_, err := p.player.Options.Tee.Write(data)
+	return err
+}
+
+// statusText 状态栏的内容：当前的注释、播放时间、速度和暂停状态
+func (p *playback) statusText() string {
+	total := p.frames[len(p.frames)-1].GetTime()
+	status := fmt.Sprintf(" %.1fs / %.1fs  %gx", min(p.clock.now(), total), total, p.clock.speed)
+	if p.note != "" {
+		status = " » " + p.note + " " + status
+	}
+	switch {
+	case p.held != "":
+		status += fmt.Sprintf("  [paused at %s]", p.held)
+	case p.clock.paused:
+		status += "  [paused]"
+	}
+	if p.flash != "" {
+		status += "  " + p.flash
+	}
+	return status + "  " + playbackHelp
+}
@@ -0,0 +1,51 @@
+package terminal
+
+import (
+	"io"
+	"testing"
+)
+
+// bufTerminal 将输出记录下来的Terminal
+type bufTerminal struct {
+	out []byte
+}
+
+func (t *bufTerminal) Size() (int, int, error)                               { return 24, 80, nil }
+func (t *bufTerminal) Record(command string, w io.Writer, e ...string) error { return nil }
+func (t *bufTerminal) Write(data []byte) error                               { t.out = append(t.out, data...); return nil }
+func (t *bufTerminal) SetSize(cols, rows int)                                {}
+func (t *bufTerminal) SetInput(in <-chan []byte)                             {}
+func (t *bufTerminal) SetInputTap(w io.Writer)                               {}
+
+// 为标记和注释注册的处理函数在播放时被调用
+func TestPlaybackCallsMarkerAndAnnotationHandlers(t *testing.T) {
+	out := &bufTerminal{}
+	var player Player = &AsciicastPlayer{Terminal: out, Options: PlayOptions{Unsafe: true}}
+	r, ok := player.(HandlerRegistry)
+	if !ok {
+		t.Fatal("the player does not implement HandlerRegistry")
+	}
+	called := map[string]int{}
+	for _, typ := range []string{"m", "a"} {
+		r.Handle(typ, func(frame Frame) ([]byte, error) {
+			called[frame.GetEventType()]++
+			return []byte("[" + string(frame.GetEventData()) + "]"), nil
+		})
+	}
+	frames := []Frame{
+		testFrame{"o", "one "},
+		testFrame{"m", "intro"},
+		testFrame{"a", "5\tnote"},
+		testFrame{"o", " two"},
+	}
+	p := &playback{player: player.(*AsciicastPlayer), frames: frames, images: imageSupport{sixel: true, iterm2: true, kitty: true}}
+	if err := p.run(1); err != nil {
+		t.Fatal(err)
+	}
+	if called["m"] != 1 || called["a"] != 1 {
+		t.Errorf("handlers called %v, want m and a once each", called)
+	}
+	if want := "one [intro][5\tnote] two"; string(out.out) != want {
+		t.Errorf("output %q, want %q", out.out, want)
+	}
+}
@@ -0,0 +1,53 @@
+package terminal
+
+import (
+	"time"
+
+	"github.com/x6nux/asciinema/util"
+)
+
+// playClock 播放时钟，将真实时间换算为录像时间，支持暂停和跳转
+type playClock struct {
+	base   float64   // anchor时刻对应的录像时间
+	anchor time.Time // 最近一次设置时钟的真实时间
+	speed  float64
+	paused bool
+	clock  util.Clock
+}
+
+func newPlayClock(clock util.Clock, start, speed float64) *playClock {
+	return &playClock{base: start, anchor: clock.Now(), speed: speed, clock: clock}
+}
+
+// now 返回当前的录像时间
+func (c *playClock) now() float64 {
+	if c.paused {
+		return c.base
+	}
+	return c.base + c.clock.Now().Sub(c.anchor).Seconds()*c.speed
+}
+
+// set 跳转到录像时间t
+func (c *playClock) set(t float64) {
+	c.base, c.anchor = t, c.clock.Now()
+}
+
+// togglePause 暂停或继续
+func (c *playClock) togglePause() {
+	c.set(c.now())
+	c.paused = !c.paused
+}
+
+// setSpeed 调整播放速度，当前的录像时间保持不变
+func (c *playClock) setSpeed(speed float64) {
+	c.set(c.now())
+	c.speed = speed
+}
+
+// until 返回距离录像时间t还需等待的真实时间，暂停时返回一个很长的时间
+func (c *playClock) until(t float64) time.Duration {
+	if c.paused {
+		return time.Hour
+	}
+	return time.Duration((t - c.now()) / c.speed * float64(time.Second))
+}
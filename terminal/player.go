@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"time"
+
+	"github.com/x6nux/asciinema/util"
+	"golang.org/x/term"
 )
 
 // 自定义本地类型，避免循环引用asciicast包
@@ -29,15 +34,106 @@ type Player interface {
 	Play(cast Cast, speed float64) error
 }
 
-// AsciicastPlayer 实现了Player接口
+// HandlerRegistry 可以为事件类型注册处理函数的播放器，NewPlayer返回的播放器实现了该接口，
+// 使用时通过类型断言取得：player.(terminal.HandlerRegistry)
+type HandlerRegistry interface {
+	// Handle 注册事件类型eventType的处理函数，替换已有的处理函数(包括内置的o和z)
+	Handle(eventType string, handler EventHandler)
+}
+
+// EventHandler 播放到某种事件时调用，返回要输出到终端的数据，没有要输出的内容时返回nil。
+// 返回错误时跳过该事件并记录日志，播放继续。跳转时中间的事件也会依次调用，因此处理函数不应等待
+type EventHandler func(frame Frame) ([]byte, error)
+
+// PlayOptions 播放选项
+type PlayOptions struct {
+	AltScreen      bool             // 在备用屏幕缓冲区中播放，仅对交互式终端生效
+	Force          bool             // 终端小于录像时仍然播放
+	Resize         bool             // 终端小于录像时尝试通过转义序列调整终端大小
+	PauseOnMarkers bool             // 播放到标记时暂停，按任意键继续，仅对交互式终端生效
+	Tee            io.Writer        // 不为nil时将输出到终端的录像内容同时复制一份
+	Clock          util.Clock       // 播放计时的时钟，为nil时使用系统时钟
+	Unsafe         bool             // 原样输出录像内容，不去掉修改标题、写剪贴板、查询终端等危险的转义序列
+	Bell           BellMode         // 对录像中响铃的处理方式，为空时原样输出
+	Images         ImageMode        // 对录像中sixel、iTerm2和kitty图片的处理方式，为空时为ImageAuto
+	Profile        *PlaybackProfile // 不为nil时记录每帧的解压和写入耗时
+}
+
+// AsciicastPlayer 实现了Player和HandlerRegistry接口
 type AsciicastPlayer struct {
 	Terminal Terminal
+	Options  PlayOptions
+	handlers map[string]EventHandler // 为nil时使用内置的处理函数
 }
 
-func NewPlayer() Player {
-	return &AsciicastPlayer{
+func NewPlayer(opts ...PlayOptions) Player {
+	p := &AsciicastPlayer{
 		Terminal: NewTerminal(),
 	}
+	if len(opts) > 0 {
+		p.Options = opts[0]
+	}
+	return p
+}
+
+// Handle 注册事件类型eventType的处理函数，handler为nil时该类型的事件不再输出。
+// 标记(m)和注释(a)调用处理函数之后仍然会在标记处暂停、在状态栏中显示注释
+func (r *AsciicastPlayer) Handle(eventType string, handler EventHandler) {
+	if r.handlers == nil {
+		r.handlers = map[string]EventHandler{
+			"o": outputEvent,
+			"z": r.processCompressedFrame,
+		}
+	}
+	if handler == nil {
+		delete(r.handlers, eventType)
+		return
+	}
+	r.handlers[eventType] = handler
+}
+
+// clock 返回播放计时的时钟
+func (r *AsciicastPlayer) clock() util.Clock {
+	if r.Options.Clock != nil {
+		return r.Options.Clock
+	}
+	return util.SystemClock
+}
+
+// isTTY 检查播放输出是否为交互式终端
+func (r *AsciicastPlayer) isTTY() bool {
+	if p, ok := r.Terminal.(*Pty); ok {
+		return term.IsTerminal(int(p.Stdout.Fd()))
+	}
+	return false
+}
+
+// checkSize 比较录像与当前终端的大小，终端过小时拒绝播放(除非设置了Force)
+func (r *AsciicastPlayer) checkSize(cast Cast) error {
+	width, height := cast.GetWidth(), cast.GetHeight()
+	if width <= 0 || height <= 0 || !r.isTTY() {
+		return nil
+	}
+	rows, cols, err := r.Terminal.Size()
+	if err != nil || (cols >= width && rows >= height) {
+		return nil
+	}
+
+	if r.Options.Resize {
+		// xterm窗口调整序列，并非所有终端都支持
+		r.Terminal.Write([]byte(fmt.Sprintf("\x1b[8;%d;%dt", height, width)))
+		time.Sleep(200 * time.Millisecond)
+		rows, cols, _ = r.Terminal.Size()
+		if cols >= width && rows >= height {
+			return nil
+		}
+	}
+
+	if !r.Options.Force {
+		return fmt.Errorf(util.T("terminal size %dx%d is smaller than the recording size %dx%d, enlarge the terminal or use --force"), cols, rows, width, height)
+	}
+	util.Warningf("Terminal size %dx%d is smaller than the recording size %dx%d, playback may be garbled.", cols, rows, width, height)
+	return nil
 }
 
 // processCompressedFrame 处理新版z型压缩帧，解码并解压缩数据
@@ -45,20 +141,20 @@ func (p *AsciicastPlayer) processCompressedFrame(frame Frame) ([]byte, error) {
 	// 解码base64数据
 	decoded, err := base64.StdEncoding.DecodeString(string(frame.GetEventData()))
 	if err != nil {
-		return nil, fmt.Errorf("base64解码失败: %v", err)
+		return nil, fmt.Errorf(util.T("base64 decoding failed: %v"), err)
 	}
 
 	// 使用gzip解压数据
 	gzipReader, err := gzip.NewReader(bytes.NewReader(decoded))
 	if err != nil {
-		return nil, fmt.Errorf("创建gzip读取器失败: %v", err)
+		return nil, fmt.Errorf(util.T("creating the gzip reader failed: %v"), err)
 	}
 	defer gzipReader.Close()
 
 	// 读取解压后的数据
 	decompressed, err := io.ReadAll(gzipReader)
 	if err != nil {
-		return nil, fmt.Errorf("读取解压数据失败: %v", err)
+		return nil, fmt.Errorf(util.T("reading the decompressed data failed: %v"), err)
 	}
 
 	return decompressed, nil
@@ -66,16 +162,11 @@ func (p *AsciicastPlayer) processCompressedFrame(frame Frame) ([]byte, error) {
 
 // Play 播放一个ASCII录屏
 func (r *AsciicastPlayer) Play(cast Cast, speed float64) error {
-	// 调整终端大小 - 不使用SetSize，因为Terminal接口没有这个方法
-	// 这里只获取终端大小信息，不进行调整
-	if cast.GetWidth() > 0 && cast.GetHeight() > 0 {
-		// 注意：此处不再尝试调整终端大小
-		// r.Terminal.SetSize(cast.GetWidth(), cast.GetHeight())
+	// 检查终端大小是否能容纳录像
+	if err := r.checkSize(cast); err != nil {
+		return err
 	}
 
-	// 设置初始时间
-	var timeAdjustment time.Duration
-
 	// 尝试不同的类型断言获取帧数据
 	var frames []Frame
 
@@ -90,61 +181,84 @@ func (r *AsciicastPlayer) Play(cast Cast, speed float64) error {
 			if frame, ok := f.(Frame); ok {
 				frames[i] = frame
 			} else {
-				return fmt.Errorf("帧 #%d 不是有效的Frame类型", i)
+				return fmt.Errorf(util.T("frame #%d is not a valid Frame"), i)
 			}
 		}
 	} else {
 		// 无法获取帧数据
-		return fmt.Errorf("不支持的帧类型")
+		return errors.New(util.T("unsupported frame type"))
 	}
 
-	// 遍历所有帧
-	for i, frame := range frames {
-		var sleepTime time.Duration
+	guard := r.guardTerminal()
+	defer guard.Restore()
 
-		// 计算等待时间
-		if i > 0 {
-			// 使用当前帧与前一帧的时间差作为等待时间
-			delay := frame.GetTime() - frames[i-1].GetTime()
-			if delay < 0 {
-				delay = 0
+	p := &playback{player: r, frames: frames, images: r.imageSupport(frames)}
+	// 交互式播放时读取按键：m/M跳到下一个/上一个标记，空格暂停，t显示状态栏
+	if r.isTTY() && term.IsTerminal(int(os.Stdin.Fd())) {
+		if err := guard.makeRaw(os.Stdin); err == nil {
+			p.keys = readKeys()
+			if rows, cols, err := r.Terminal.Size(); err == nil && rows > 1 {
+				p.bar = newStatusBar(r.Terminal, cast.GetWidth(), cast.GetHeight(), cols, rows)
 			}
-			sleepTime = time.Duration(float64(delay)*1000/speed) * time.Millisecond
 		}
+	}
+	return p.run(speed)
+}
 
-		// 等待相应时间（减去处理前一帧所用的时间）
-		if sleepTime > timeAdjustment {
-			time.Sleep(sleepTime - timeAdjustment)
+// imageSupport 返回播放时原样输出的图片协议。自动检测时，输出不是终端则原样保留所有图片，
+// 录像中有图片时才查询终端。查找图片时不调用注册的处理函数
+func (r *AsciicastPlayer) imageSupport(frames []Frame) imageSupport {
+	all := imageSupport{sixel: true, iterm2: true, kitty: true}
+	switch r.Options.Images {
+	case ImagePassthrough:
+		return all
+	case ImagePlaceholder:
+		return imageSupport{}
+	}
+	if !r.isTTY() {
+		return all
+	}
+	for _, frame := range frames {
+		if hasImage(frame) {
+			return detectImageSupport(os.Stdin, r.Terminal.(*Pty).Stdout)
 		}
+	}
+	return all
+}
 
-		startTime := time.Now()
-
-		// 处理帧数据
-		var data []byte
-		var err error
-
-		// 根据帧类型进行处理
-		if frame.IsCompressed() {
-			// 处理压缩帧
-			data, err = r.processCompressedFrame(frame)
-			if err != nil {
-				log.Printf("处理压缩帧失败: %v", err)
-				continue
-			}
-		} else {
-			// 处理普通输出帧
-			data = frame.GetEventData()
-		}
+// frameData 返回帧要输出到终端的数据：默认输出帧(o)原样输出，压缩帧(z)解压后输出；
+// 输入(i)、标记(m)、大小改变(r)、退出(x)等事件以及没有注册处理函数的事件不输出
+func (r *AsciicastPlayer) frameData(frame Frame) ([]byte, bool) {
+	var handler EventHandler
+	switch {
+	case r.handlers != nil:
+		handler = r.handlers[frame.GetEventType()]
+	case frame.GetEventType() == "o":
+		handler = outputEvent
+	case frame.GetEventType() == "z":
+		handler = r.processCompressedFrame
+	}
+	if handler == nil {
+		return nil, false
+	}
+	data, err := handler(frame)
+	if err != nil {
+		log.Print(util.Tf("failed to handle %q event: %v", frame.GetEventType(), err))
+		return nil, false
+	}
+	return data, data != nil
+}
 
-		// 输出到终端 - Terminal.Write只返回error，不是标准的(int, error)
-		err = r.Terminal.Write(data)
-		if err != nil {
-			return err
-		}
+// outputEvent 输出帧的内容原样输出
+func outputEvent(frame Frame) ([]byte, error) {
+	return frame.GetEventData(), nil
+}
 
-		// 计算处理这一帧所花费的时间，用于下一帧的等待时间调整
-		timeAdjustment = time.Since(startTime)
+// frameSize 返回大小改变事件(r)中的列数和行数，数据格式为"列x行"
+func frameSize(frame Frame) (cols, rows int, ok bool) {
+	if frame.GetEventType() != "r" {
+		return 0, 0, false
 	}
-
-	return nil
+	n, _ := fmt.Sscanf(string(frame.GetEventData()), "%dx%d", &cols, &rows)
+	return cols, rows, n == 2 && cols > 0 && rows > 0
 }
@@ -0,0 +1,62 @@
+package terminal
+
+import (
+	"slices"
+	"time"
+)
+
+// PlaybackProfile 播放的性能记录：每帧的解码、解压和写入耗时，以及开始写入时比录像中的时间晚了多少。
+// 解码在读取录像时发生，由调用方记录
+type PlaybackProfile struct {
+	Decode     []time.Duration // 读取录像时每帧的解码耗时
+	Decompress []time.Duration // 每个压缩帧的解压耗时
+	Write      []time.Duration // 每帧写入终端的耗时，包括去掉危险序列等处理
+	Lag        []time.Duration // 每帧开始写入时落后于录像时间的时长
+	Bytes      int             // 写入终端的字节数
+}
+
+// LatencyStats 一组耗时的统计
+type LatencyStats struct {
+	Count              int
+	P50, P90, P99, Max time.Duration
+	Total              time.Duration
+}
+
+// Stats 统计一组耗时，百分位数取最接近的样本
+func Stats(samples []time.Duration) LatencyStats {
+	s := LatencyStats{Count: len(samples)}
+	if len(samples) == 0 {
+		return s
+	}
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	at := func(p float64) time.Duration {
+		return sorted[min(len(sorted)-1, int(p*float64(len(sorted))))]
+	}
+	s.P50, s.P90, s.P99, s.Max = at(0.5), at(0.9), at(0.99), sorted[len(sorted)-1]
+	for _, d := range sorted {
+		s.Total += d
+	}
+	return s
+}
+
+// Late 返回落后于录像时间超过limit的帧数
+func (p *PlaybackProfile) Late(limit time.Duration) int {
+	n := 0
+	for _, d := range p.Lag {
+		if d > limit {
+			n++
+		}
+	}
+	return n
+}
+
+// addFrame 记录一帧的解压(compressed为true时)和写入耗时
+func (p *PlaybackProfile) addFrame(compressed bool, decompress, write, lag time.Duration, bytes int) {
+	if compressed {
+		p.Decompress = append(p.Decompress, decompress)
+	}
+	p.Write = append(p.Write, write)
+	p.Lag = append(p.Lag, max(lag, 0))
+	p.Bytes += bytes
+}
@@ -0,0 +1,269 @@
+package terminal
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// echoTimeout 终端回复的回显超过这个时间还没有出现在输出中时不再等待
+const echoTimeout = time.Second
+
+// seqScanner 从字节流中逐个取出完整的转义序列(ESC x、CSI、OSC、DCS等)，序列可以跨越多次写入
+type seqScanner struct {
+	state int
+	seq   []byte
+}
+
+// feed 处理一个字节，b结束了一个转义序列时返回该序列，否则返回nil
+func (s *seqScanner) feed(b byte) []byte {
+	switch s.state {
+	case stateGround:
+		if b == 0x1b {
+			s.state, s.seq = stateEscape, append(s.seq[:0], b)
+		}
+	case stateEscape:
+		s.seq = append(s.seq, b)
+		switch b {
+		case '[':
+			s.state = stateCSI
+		case ']', 'P', '_', '^', 'X':
+			s.state = stateString
+		case 0x1b:
+			s.seq = s.seq[1:]
+		default:
+			s.state = stateGround
+			return s.seq
+		}
+	case stateCSI:
+		s.seq = append(s.seq, b)
+		if b >= 0x40 && b <= 0x7e {
+			s.state = stateGround
+			return s.seq
+		}
+		if b == 0x18 || b == 0x1a || len(s.seq) > maxSequenceBytes {
+			s.state = stateGround
+		}
+	case stateString:
+		switch {
+		case b == 0x07:
+			s.state = stateGround
+			return append(s.seq, b)
+		case b == 0x1b:
+			s.state = stateStringEsc
+		case b == 0x18 || b == 0x1a || len(s.seq) > maxSequenceBytes:
+			s.state = stateGround
+		default:
+			s.seq = append(s.seq, b)
+		}
+	case stateStringEsc:
+		if b == '\\' {
+			s.state = stateGround
+			return append(s.seq, 0x1b, b)
+		}
+		s.state, s.seq = stateEscape, append(s.seq[:0], 0x1b)
+		return s.feed(b)
+	}
+	return nil
+}
+
+// isTerminalQuery 判断被录制程序输出的序列是否为需要终端回复的查询
+func isTerminalQuery(seq []byte) bool {
+	if len(seq) < 2 {
+		return false
+	}
+	switch seq[1] {
+	case 'Z':
+		// DECID
+		return len(seq) == 2
+	case ']':
+		// OSC 4、10、11等颜色查询
+		return bytes.Contains(seq, []byte(";?"))
+	case 'P':
+		// DECRQSS、XTGETTCAP
+		return bytes.HasPrefix(seq[2:], []byte("$q")) || bytes.HasPrefix(seq[2:], []byte("+q"))
+	case '[':
+		body, final := seq[2:len(seq)-1], seq[len(seq)-1]
+		switch {
+		case final == 'c':
+			// DA1、DA2、DA3
+			return len(body) == 0 || string(body) == "0" || body[0] == '>' || body[0] == '='
+		case final == 'n':
+			// DSR，包括光标位置
+			return len(body) > 0
+		case final == 'p' && bytes.HasSuffix(body, []byte("$")):
+			// DECRQM
+			return true
+		case final == 'q' && bytes.HasPrefix(body, []byte(">")):
+			// XTVERSION
+			return true
+		case final == 't':
+			// 窗口大小、位置和标题的报告
+			switch string(body) {
+			case "11", "13", "14", "15", "16", "18", "19", "20", "21":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isTerminalResponse 判断标准输入中的序列是否可能是终端对查询的回复，
+// 只在有未回复的查询时才使用，避免把同样格式的按键(如Shift-F3的CSI 1;2R)当作回复
+func isTerminalResponse(seq []byte) bool {
+	if len(seq) < 3 {
+		return false
+	}
+	switch seq[1] {
+	case ']', 'P':
+		return true
+	case '[':
+		body, final := seq[2:len(seq)-1], seq[len(seq)-1]
+		switch final {
+		case 'R', 'n', 't':
+			return true
+		case 'c':
+			return len(body) > 0 && (body[0] == '?' || body[0] == '>' || body[0] == '=')
+		case 'y':
+			return bytes.HasSuffix(body, []byte("$"))
+		}
+	}
+	return false
+}
+
+// queryPassThrough 跟踪被录制程序向终端发出的查询(DA、DSR、光标位置等)。终端的回复照常通过标准输入
+// 转发给被录制程序，但伪终端处于回显模式时会把回复回显到输出中，这部分回显不应出现在录像里
+type queryPassThrough struct {
+	mu      sync.Mutex
+	pending int // 还没有收到回复的查询数
+	out     seqScanner
+	in      seqScanner
+	echoes  []pendingEcho
+	// echoMode 返回伪终端当前是否回显输入，以及控制字符是否回显为^X的形式
+	echoMode func() (echo, echoctl bool)
+}
+
+// pendingEcho 等待从录制的输出中去掉的回显
+type pendingEcho struct {
+	data     []byte
+	deadline time.Time
+}
+
+func newQueryPassThrough(echoMode func() (echo, echoctl bool)) *queryPassThrough {
+	return &queryPassThrough{echoMode: echoMode}
+}
+
+// Outgoing 扫描被录制程序的输出，记录其中的查询，应在输出写到终端之前调用
+func (q *queryPassThrough) Outgoing(data []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, b := range data {
+		if seq := q.out.feed(b); seq != nil && isTerminalQuery(seq) {
+			q.pending++
+		}
+	}
+}
+
+// Incoming 扫描发给被录制程序的输入，识别终端的回复
+func (q *queryPassThrough) Incoming(data []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, b := range data {
+		seq := q.in.feed(b)
+		if seq == nil || q.pending == 0 || !isTerminalResponse(seq) {
+			continue
+		}
+		q.pending--
+		if echo, echoctl := q.echoMode(); echo {
+			q.echoes = append(q.echoes, pendingEcho{data: echoForm(seq, echoctl), deadline: time.Now().Add(echoTimeout)})
+		}
+	}
+}
+
+// echoForm 返回伪终端回显seq的内容，echoctl时控制字符回显为^X
+func echoForm(seq []byte, echoctl bool) []byte {
+	if !echoctl {
+		return append([]byte{}, seq...)
+	}
+	out := make([]byte, 0, len(seq)+4)
+	for _, b := range seq {
+		switch {
+		case b == 0x7f:
+			out = append(out, '^', '?')
+		case b < 0x20 && b != '\t' && b != '\n':
+			out = append(out, '^', b^0x40)
+		default:
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Recorded 返回写入录像的writer，写入的输出会去掉终端回复的回显。
+// 回显可能被拆到两次写入中，末尾可能是回显开头的部分会留到下一次写入
+func (q *queryPassThrough) Recorded(w io.Writer) *echoStripper {
+	return &echoStripper{q: q, w: w}
+}
+
+type echoStripper struct {
+	q    *queryPassThrough
+	w    io.Writer
+	held []byte
+}
+
+func (s *echoStripper) Write(p []byte) (int, error) {
+	data := append(s.held, p...)
+	s.held = nil
+	s.q.mu.Lock()
+	now := time.Now()
+	echoes := s.q.echoes[:0]
+	for _, e := range s.q.echoes {
+		if i := bytes.Index(data, e.data); i >= 0 {
+			data = append(data[:i:i], data[i+len(e.data):]...)
+		} else if now.Before(e.deadline) {
+			echoes = append(echoes, e)
+		}
+	}
+	s.q.echoes = echoes
+	held := 0
+	for _, e := range echoes {
+		held = max(held, partialPrefix(data, e.data))
+	}
+	s.q.mu.Unlock()
+	s.held = append([]byte{}, data[len(data)-held:]...)
+	data = data[:len(data)-held]
+	if len(data) > 0 {
+		if _, err := s.w.Write(data); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush 写出留下的输出，录制结束时调用
+func (s *echoStripper) Flush() error {
+	if len(s.held) == 0 {
+		return nil
+	}
+	_, err := s.w.Write(s.held)
+	s.held = nil
+	return err
+}
+
+// partialPrefix 返回data末尾与echo开头相同的最长长度，不包括整个echo
+func partialPrefix(data, echo []byte) int {
+	for k := min(len(data), len(echo)-1); k > 0; k-- {
+		if bytes.HasSuffix(data, echo[:k]) {
+			return k
+		}
+	}
+	return 0
+}
+
+// writerFunc 将函数用作io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,197 @@
+package terminal
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// maxSequenceBytes 单个转义序列最多缓存的字节数，超出后按危险序列丢弃
+const maxSequenceBytes = 8192
+
+// mouseModes 开启鼠标上报的DEC私有模式，播放时终端的鼠标上报会被当作按键读入
+var mouseModes = map[int]bool{9: true, 1000: true, 1001: true, 1002: true, 1003: true, 1005: true, 1006: true, 1015: true, 1016: true}
+
+const (
+	stateGround = iota
+	stateEscape
+	stateCSI
+	stateString    // OSC、DCS、APC、PM、SOS的内容
+	stateStringEsc // 字符串中遇到ESC，等待ST(ESC \)
+)
+
+// sanitizer 在播放不可信的录像时去掉危险的转义序列：修改标题和剪贴板(OSC 52)等OSC序列(只保留OSC 8超链接和允许的图片)、
+// DCS/APC/PM/SOS(允许的图片除外)、让终端回复的查询(DA、DSR、DECRQM、XTVERSION等)、窗口操作(CSI t)和鼠标上报模式。
+// 序列可以跨越多次Sanitize调用
+type sanitizer struct {
+	state  int
+	seq    []byte       // 当前还未结束的序列
+	keep   bool         // 当前字符串序列是否保留
+	images imageSupport // 原样输出的图片协议，sixel为DCS序列，iTerm2图片为OSC 1337序列，kitty图片为APC序列
+}
+
+// Sanitize 返回去掉危险序列后的数据，未结束的序列留到下一次调用
+func (s *sanitizer) Sanitize(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for _, b := range data {
+		switch s.state {
+		case stateGround:
+			if b == 0x1b {
+				s.state, s.seq = stateEscape, append(s.seq[:0], b)
+				continue
+			}
+			out = append(out, b)
+		case stateEscape:
+			s.seq = append(s.seq, b)
+			switch b {
+			case '[':
+				s.state = stateCSI
+			case ']':
+				s.state, s.keep = stateString, true
+			case 'P':
+				s.state, s.keep = stateString, s.images.sixel
+			case '_':
+				s.state, s.keep = stateString, s.images.kitty
+			case '^', 'X':
+				s.state, s.keep = stateString, false
+			case 'Z':
+				// DECID，与DA一样让终端回复
+				s.state = stateGround
+			case 0x1b:
+				s.seq = s.seq[1:]
+			default:
+				out = append(out, s.seq...)
+				s.state = stateGround
+			}
+		case stateCSI:
+			if b == 0x18 || b == 0x1a {
+				s.state = stateGround
+				continue
+			}
+			s.seq = append(s.seq, b)
+			if b >= 0x40 && b <= 0x7e {
+				out = append(out, sanitizeCSI(s.seq)...)
+				s.state = stateGround
+			} else if len(s.seq) > maxSequenceBytes {
+				s.state = stateGround
+			}
+		case stateString:
+			switch {
+			case b == 0x18 || b == 0x1a:
+				s.state = stateGround
+			case b == 0x07:
+				s.endString(&out, b)
+			case b == 0x1b:
+				s.state = stateStringEsc
+			case s.keep:
+				s.seq = append(s.seq, b)
+				if len(s.seq) > s.limit() {
+					s.keep = false
+				}
+			}
+		case stateStringEsc:
+			if b == '\\' {
+				s.endString(&out, 0x1b, b)
+				continue
+			}
+			// 字符串被新的转义序列打断
+			s.state, s.seq = stateEscape, append(s.seq[:0], 0x1b)
+			out = append(out, s.Sanitize([]byte{b})...)
+		}
+	}
+	return out
+}
+
+// endString 字符串序列以terminator结束，允许的OSC序列输出到out
+func (s *sanitizer) endString(out *[]byte, terminator ...byte) {
+	switch {
+	case !s.keep || !s.allowed():
+	case imageKind(s.seq) == imageKitty:
+		if seq := quietKitty(s.seq); seq != nil {
+			*out = append(append(*out, seq...), terminator...)
+		}
+	default:
+		*out = append(append(*out, s.seq...), terminator...)
+	}
+	s.state = stateGround
+}
+
+// Sanitizer 去掉不可信的终端输出(如attach观看的会话)中危险的转义序列，与播放时的处理相同，
+// 图片序列也会被去掉。序列可以跨越多次Sanitize调用
+type Sanitizer struct {
+	s sanitizer
+}
+
+// NewSanitizer 返回一个新的Sanitizer
+func NewSanitizer() *Sanitizer {
+	return &Sanitizer{}
+}
+
+// Sanitize 返回去掉危险序列后的数据，未结束的序列留到下一次调用
+func (s *Sanitizer) Sanitize(data []byte) []byte {
+	return s.s.Sanitize(data)
+}
+
+// reset 丢弃未结束的序列，从头重放时调用
+func (s *sanitizer) reset() {
+	s.state, s.seq = stateGround, s.seq[:0]
+}
+
+// limit 当前字符串序列最多缓存的字节数，允许的图片可以更大
+func (s *sanitizer) limit() int {
+	if kind := imageKind(s.seq); kind != imageNone && s.images.allows(kind) {
+		return maxImageBytes
+	}
+	return maxSequenceBytes
+}
+
+// allowed 判断当前字符串序列能否输出：OSC 8超链接和允许的图片，iTerm2协议的文件下载不能输出。
+// kitty图片序列输出前还要去掉查询并禁止终端回复
+func (s *sanitizer) allowed() bool {
+	if kind := imageKind(s.seq); s.images.allows(kind) {
+		return kind != imageITerm2 || !iterm2Download(s.seq)
+	}
+	return s.seq[1] == ']' && allowedOSC(s.seq[2:])
+}
+
+// allowedOSC 判断参数为params的OSC序列能否输出，只允许OSC 8超链接
+func allowedOSC(params []byte) bool {
+	num, _, _ := bytes.Cut(params, []byte(";"))
+	return string(num) == "8"
+}
+
+// sanitizeCSI 返回完整的CSI序列seq去掉危险部分后的内容
+func sanitizeCSI(seq []byte) []byte {
+	body := seq[2 : len(seq)-1]
+	final := seq[len(seq)-1]
+	switch {
+	case final == 'n' || final == 'c' || final == 't' || final == 'x':
+		// DSR、DA、窗口操作、DECREQTPARM
+		return nil
+	case bytes.HasSuffix(body, []byte("$")) && (final == 'p' || final == 'w' || final == 'u'):
+		// DECRQM、DECRQPSR、DECRQTSR
+		return nil
+	case final == 'q' && bytes.HasPrefix(body, []byte(">")):
+		// XTVERSION
+		return nil
+	case (final == 'h' || final == 'l') && bytes.HasPrefix(body, []byte("?")):
+		return stripMouseModes(seq)
+	}
+	return seq
+}
+
+// stripMouseModes 从DEC私有模式设置序列中去掉鼠标上报模式，全部去掉时返回nil
+func stripMouseModes(seq []byte) []byte {
+	final := seq[len(seq)-1]
+	var kept [][]byte
+	for _, p := range bytes.Split(seq[3:len(seq)-1], []byte(";")) {
+		if n, err := strconv.Atoi(string(p)); err == nil && mouseModes[n] {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	out := append([]byte("\x1b[?"), bytes.Join(kept, []byte(";"))...)
+	return append(out, final)
+}
@@ -1,9 +1,15 @@
-package terminal
-
-import "io"
-
-type Terminal interface {
-	Size() (int, int, error)
-	Record(command string, writer io.Writer, envs ...string) error
-	Write([]byte) error
-}
+package terminal
+
+import "io"
+
+type Terminal interface {
+	Size() (int, int, error)
+	Record(command string, writer io.Writer, envs ...string) error
+	Write([]byte) error
+	// SetSize 固定被录制程序的终端大小，为0时跟随真实终端
+	SetSize(cols, rows int)
+	// SetInput 设置额外写入被录制程序的输入，如远程观看者的按键
+	SetInput(in <-chan []byte)
+	// SetInputTap 将用户在真实终端中的输入同时复制到w，用于录制输入事件，为nil时不复制
+	SetInputTap(w io.Writer)
+}
@@ -24,6 +24,10 @@ import (
 type Pty struct {
 	Stdin  *os.File
 	Stdout *os.File
+	Cols   int // 固定的终端大小，为0时跟随真实终端
+	Rows   int
+	Input  <-chan []byte // 额外写入被录制程序的输入
+	Tap    io.Writer     // 用户的输入同时复制到这里
 }
 
 func NewTerminal() Terminal {
@@ -31,9 +35,42 @@ func NewTerminal() Terminal {
 }
 
 func (p *Pty) Size() (int, int, error) {
+	if p.Cols > 0 && p.Rows > 0 {
+		return p.Rows, p.Cols, nil
+	}
 	return pty.Getsize(p.Stdout)
 }
 
+func (p *Pty) SetSize(cols, rows int) {
+	p.Cols, p.Rows = cols, rows
+}
+
+func (p *Pty) SetInput(in <-chan []byte) {
+	p.Input = in
+}
+
+func (p *Pty) SetInputTap(w io.Writer) {
+	p.Tap = w
+}
+
+// copyInput 将额外的输入写入被录制程序，直到done被关闭。用户正在粘贴时等粘贴结束后再写入
+func (p *Pty) copyInput(w io.Writer, gate *pasteGate, done <-chan struct{}) {
+	if p.Input == nil {
+		return
+	}
+	for {
+		select {
+		case data := <-p.Input:
+			if !gate.wait(done) {
+				return
+			}
+			w.Write(data)
+		case <-done:
+			return
+		}
+	}
+}
+
 func (p *Pty) Record(command string, w io.Writer, envs ...string) error {
 	// start command in pty
 	cmd := exec.Command("sh", "-c", command)
@@ -67,23 +104,50 @@ func (p *Pty) Record(command string, w io.Writer, envs ...string) error {
 		if err != nil {
 			return err
 		}
-		defer raw.TcSetAttr(fd, oldState)
+		restore := func() { raw.TcSetAttr(fd, oldState) }
+		// 录制被信号中断时同样需要恢复终端
+		remove := util.AddCleanup(restore)
+		defer func() {
+			remove()
+			restore()
+		}()
 	}
 
 	// do initial resize
 	p.resize(master)
 
+	// 终端对查询的回复随标准输入转发，回显不写入录像
+	queries := newQueryPassThrough(func() (bool, bool) { return echoMode(master) })
+
+	gate := newPasteGate()
+
 	// start stdin -> master copying
-	stop := util.Copy(master, p.Stdin)
+	stop := util.Copy(writerFunc(func(data []byte) (int, error) {
+		queries.Incoming(data)
+		if p.Tap != nil {
+			p.Tap.Write(data)
+		}
+		defer gate.user(data)()
+		return master.Write(data)
+	}), p.Stdin)
+	inputDone := make(chan struct{})
+	defer close(inputDone)
+	go p.copyInput(master, gate, inputDone)
 
 	// copy pty master -> p.stdout & w
 
 	stdout := transform.NewWriter(w, unicode.UTF8.NewEncoder())
 	defer stdout.Close()
+	recorded := queries.Recorded(stdout)
 
 	stdoutWaitChan := make(chan struct{})
 	go func() {
-		io.Copy(io.MultiWriter(p.Stdout, stdout), master)
+		io.Copy(io.MultiWriter(writerFunc(func(data []byte) (int, error) {
+			// 在终端收到查询之前记录，终端的回复不会先于查询到达
+			queries.Outgoing(data)
+			return len(data), nil
+		}), p.Stdout, recorded), master)
+		recorded.Flush()
 		stdoutWaitChan <- struct{}{}
 	}()
 
@@ -104,6 +168,15 @@ func (p *Pty) Record(command string, w io.Writer, envs ...string) error {
 	return nil
 }
 
+// echoMode 返回伪终端是否回显输入，以及控制字符是否回显为^X的形式
+func echoMode(master *os.File) (echo, echoctl bool) {
+	attr, err := raw.TcGetAttr(master.Fd())
+	if err != nil {
+		return false, false
+	}
+	return attr.Lflag&syscall.ECHO != 0, attr.Lflag&syscall.ECHOCTL != 0
+}
+
 func (p *Pty) Write(data []byte) error {
 	_, err := p.Stdout.Write(data)
 	if err != nil {
@@ -121,7 +194,7 @@ func (p *Pty) Write(data []byte) error {
 func (p *Pty) resize(f *os.File) {
 	var rows, cols int
 
-	if terminal.IsTerminal(int(p.Stdout.Fd())) {
+	if (p.Cols > 0 && p.Rows > 0) || terminal.IsTerminal(int(p.Stdout.Fd())) {
 		rows, cols, _ = p.Size()
 	} else {
 		rows = 24
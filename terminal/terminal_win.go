@@ -21,6 +21,10 @@ https://github.com/ActiveState/termtest
 type Pty struct {
 	Stdin  *os.File
 	Stdout *os.File
+	Cols   int // 固定的终端大小，为0时跟随真实终端
+	Rows   int
+	Input  <-chan []byte // 额外写入被录制程序的输入
+	Tap    io.Writer     // 用户的输入同时复制到这里
 }
 
 func NewTerminal() Terminal {
@@ -28,10 +32,43 @@ func NewTerminal() Terminal {
 }
 
 func (p *Pty) Size() (rows, cols int, err error) {
+	if p.Cols > 0 && p.Rows > 0 {
+		return p.Rows, p.Cols, nil
+	}
 	coord, err := winpty.WinConsoleScreenSize()
 	return coord.Y, coord.X, err
 }
 
+func (p *Pty) SetSize(cols, rows int) {
+	p.Cols, p.Rows = cols, rows
+}
+
+func (p *Pty) SetInput(in <-chan []byte) {
+	p.Input = in
+}
+
+func (p *Pty) SetInputTap(w io.Writer) {
+	p.Tap = w
+}
+
+// copyInput 将额外的输入写入被录制程序，直到done被关闭。用户正在粘贴时等粘贴结束后再写入
+func (p *Pty) copyInput(w io.Writer, gate *pasteGate, done <-chan struct{}) {
+	if p.Input == nil {
+		return
+	}
+	for {
+		select {
+		case data := <-p.Input:
+			if !gate.wait(done) {
+				return
+			}
+			w.Write(data)
+		case <-done:
+			return
+		}
+	}
+}
+
 func (p *Pty) Record(command string, w io.Writer, envs ...string) error {
 	height, width, _ := p.Size()
 	if width == 0 {
@@ -55,10 +92,20 @@ func (p *Pty) Record(command string, w io.Writer, envs ...string) error {
 	stdout := transform.NewWriter(w, unicode.UTF8.NewEncoder())
 	defer stdout.Close()
 
+	gate := newPasteGate()
 	go func() {
 		go io.Copy(io.MultiWriter(p.Stdout, stdout), cpty)
-		io.Copy(cpty, p.Stdin)
+		io.Copy(writerFunc(func(data []byte) (int, error) {
+			if p.Tap != nil {
+				p.Tap.Write(data)
+			}
+			defer gate.user(data)()
+			return cpty.Write(data)
+		}), p.Stdin)
 	}()
+	inputDone := make(chan struct{})
+	defer close(inputDone)
+	go p.copyInput(cpty, gate, inputDone)
 
 	exitCode, err := cpty.Wait(context.Background())
 	if err != nil {
@@ -0,0 +1,65 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Colors 终端回应OSC 10/11/4查询得到的颜色，格式为#rrggbb
+type Colors struct {
+	Fg      string
+	Bg      string
+	Palette map[int]string // 调色板序号到颜色
+}
+
+var colorReply = regexp.MustCompile(`\x1b\](10|11|4;(\d+));rgb:([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})(?:\x07|\x1b\\)`)
+
+// daReply DA1查询的回应
+var daReply = regexp.MustCompile(`\x1b\[\?[0-9;]*c`)
+
+// colorQuery 查询前景色、背景色和前16个调色板颜色，最后附上DA1查询
+func colorQuery() string {
+	q := "\x1b]10;?\x1b\\\x1b]11;?\x1b\\"
+	for i := 0; i < 16; i++ {
+		q += fmt.Sprintf("\x1b]4;%d;?\x1b\\", i)
+	}
+	return q + "\x1b[c"
+}
+
+// QueryColors 通过OSC 10/11/4查询终端的前景色、背景色和调色板
+func QueryColors(in, out *os.File, timeout time.Duration) (*Colors, error) {
+	reply, err := queryTerminal(in, out, colorQuery(), timeout)
+	if err != nil {
+		return nil, err
+	}
+	return parseColorReplies(reply), nil
+}
+
+// parseColorReplies 从终端的回应中解析颜色
+func parseColorReplies(data []byte) *Colors {
+	colors := &Colors{Palette: map[int]string{}}
+	for _, m := range colorReply.FindAllStringSubmatch(string(data), -1) {
+		color := "#" + scaleChannel(m[3]) + scaleChannel(m[4]) + scaleChannel(m[5])
+		switch m[1] {
+		case "10":
+			colors.Fg = color
+		case "11":
+			colors.Bg = color
+		default:
+			if i, err := strconv.Atoi(m[2]); err == nil {
+				colors.Palette[i] = color
+			}
+		}
+	}
+	return colors
+}
+
+// scaleChannel 将1到4位十六进制的颜色分量转换为2位
+func scaleChannel(hex string) string {
+	v, _ := strconv.ParseUint(hex, 16, 16)
+	max := uint64(1)<<(4*len(hex)) - 1
+	return fmt.Sprintf("%02x", (v*255+max/2)/max)
+}
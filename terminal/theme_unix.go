@@ -0,0 +1,58 @@
+//go:build darwin || freebsd || dragonfly || linux
+
+package terminal
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/x6nux/asciinema/util"
+	terminal "golang.org/x/term"
+)
+
+// queryTerminal 向终端发出query并返回终端的回应。query应以DA1查询结尾，
+// 所有终端都会回应DA1，收到它的回应后就不必等到超时
+func queryTerminal(in, out *os.File, query string, timeout time.Duration) ([]byte, error) {
+	fd := int(in.Fd())
+	if !terminal.IsTerminal(fd) || !terminal.IsTerminal(int(out.Fd())) {
+		return nil, errors.New("not a terminal")
+	}
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	defer terminal.Restore(fd, state)
+
+	if _, err := out.WriteString(query); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	var reply []byte
+	buf := make([]byte, 1024)
+	for !daReply.Match(reply) {
+		left := time.Until(deadline)
+		if left <= 0 {
+			break
+		}
+		rfds := &syscall.FdSet{}
+		util.FD_SET(rfds, fd)
+		tv := syscall.NsecToTimeval(left.Nanoseconds())
+		if err := util.Select(fd+1, rfds, nil, nil, &tv); err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			break
+		}
+		if !util.FD_ISSET(rfds, fd) {
+			break
+		}
+		n, err := in.Read(buf)
+		reply = append(reply, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	return reply, nil
+}
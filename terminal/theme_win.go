@@ -0,0 +1,14 @@
+//go:build windows
+
+package terminal
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// queryTerminal Windows控制台不支持查询终端
+func queryTerminal(in, out *os.File, query string, timeout time.Duration) ([]byte, error) {
+	return nil, errors.New("querying the terminal is not supported on windows")
+}
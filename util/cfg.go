@@ -3,8 +3,10 @@ package util
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/gcfg.v1"
 )
@@ -14,6 +16,8 @@ const (
 	DefaultCommand        = "/bin/sh"
 	DefaultHomeEnv        = "ASCIINEMA_CONFIG_HOME"
 	DefaultConfigFileName = "aciinema.conf"
+	DefaultBackupSuffix   = ".bak"
+	DefaultIPFSAPI        = "http://127.0.0.1:5001"
 )
 
 type ConfigAPI struct {
@@ -22,29 +26,94 @@ type ConfigAPI struct {
 }
 
 type ConfigRecord struct {
-	Command string
-	MaxWait float64
-	Yes     bool
+	Command         string
+	MaxWait         float64
+	Yes             bool
+	Dir             string // 录像文件名不含目录时保存到该目录，为空时为当前目录
+	DisableCompress bool   `gcfg:"disable-compress"` // 默认不压缩重复的输出
+	CompressRatio   int    `gcfg:"compress-ratio"`   // 默认的压缩比例
+	AutoTitle       bool   `gcfg:"auto-title"`       // 没有指定标题时以第一条命令作为标题
 }
 
 type ConfigPlay struct {
 	MaxWait float64
 }
 
+type ConfigEdit struct {
+	NoBackup     bool   `gcfg:"no-backup"`     // 原地编辑时不创建备份
+	BackupSuffix string `gcfg:"backup-suffix"` // 备份文件后缀，默认为.bak
+}
+
+type ConfigTranscript struct {
+	PromptRegex string `gcfg:"prompt-regex"` // 识别命令提示符的正则表达式
+}
+
+type ConfigUI struct {
+	Color string // 颜色模式：auto、always或never
+	Theme string // 配色：default或colorblind
+}
+
+// ConfigHooks 录制前后执行的命令，每个键可以有多个，按顺序执行
+type ConfigHooks struct {
+	PreRecord  []string `gcfg:"pre-record"`  // 开始录制前执行，失败时不录制
+	PostRecord []string `gcfg:"post-record"` // 录像写入文件后执行，如提交到git、上传或发送通知
+}
+
+type ConfigNotify struct {
+	Enabled     bool    // 长时间操作完成时发送桌面通知
+	MinDuration float64 `gcfg:"min-duration"` // 耗时少于该秒数的操作不通知
+}
+
+type ConfigIPFS struct {
+	Gateway string // 打开ipfs://、ipns://地址时使用的HTTP网关
+	API     string // 上传时使用的IPFS节点API地址
+}
+
+// ConfigHTTP 通过HTTP打开录像时发往某个主机的请求，在配置文件中定义为[http "主机"]
+type ConfigHTTP struct {
+	Header []string // 附加的请求头，格式为"名称: 值"，可以有多个
+}
+
+type ConfigS3 struct {
+	Endpoint string // S3兼容服务的地址(如MinIO)，为空时使用AWS S3
+}
+
+// ConfigRemote sync使用的同步目标，在配置文件中定义为[remote "名称"]
+type ConfigRemote struct {
+	URL string // 目标地址：s3://、ssh://、webdav(s)://、user@host:路径或本地目录
+}
+
+// ConfigDestination upload --to使用的上传目标，在配置文件中定义为[destination "名称"]
+type ConfigDestination struct {
+	URL   string // asciinema服务器地址
+	Token string // 该服务器使用的install ID，为空时使用[api]中的token
+}
+
 type ConfigUser struct {
 	Token string
 }
 
 type ConfigFile struct {
-	API    ConfigAPI
-	Record ConfigRecord
-	Play   ConfigPlay
-	User   ConfigUser // old location of token
+	API         ConfigAPI
+	Record      ConfigRecord
+	Play        ConfigPlay
+	Edit        ConfigEdit
+	Transcript  ConfigTranscript
+	Notify      ConfigNotify
+	UI          ConfigUI
+	Hooks       ConfigHooks
+	IPFS        ConfigIPFS
+	HTTP        map[string]*ConfigHTTP
+	S3          ConfigS3
+	Remote      map[string]*ConfigRemote
+	Destination map[string]*ConfigDestination
+	User        ConfigUser // old location of token
 }
 
 type Config struct {
 	File *ConfigFile
 	Env  map[string]string
+	Path string // 配置文件的路径
 }
 
 func (c *Config) ApiUrl() string {
@@ -55,6 +124,24 @@ func (c *Config) ApiToken() string {
 	return FirstNonBlank(c.File.API.Token, c.File.User.Token)
 }
 
+// Destination 返回名为name的上传目标的服务器地址和install ID
+func (c *Config) Destination(name string) (url, token string, ok bool) {
+	dest := c.File.Destination[name]
+	if dest == nil || dest.URL == "" {
+		return "", "", false
+	}
+	return dest.URL, FirstNonBlank(dest.Token, c.ApiToken()), true
+}
+
+// Remote 返回名为name的同步目标的地址
+func (c *Config) Remote(name string) (string, bool) {
+	remote := c.File.Remote[name]
+	if remote == nil || remote.URL == "" {
+		return "", false
+	}
+	return remote.URL, true
+}
+
 func (c *Config) RecordCommand() string {
 	return FirstNonBlank(c.File.Record.Command, c.Env["SHELL"], DefaultCommand)
 }
@@ -67,20 +154,109 @@ func (c *Config) RecordYes() bool {
 	return c.File.Record.Yes
 }
 
+// RecordDir 返回录像目录，~开头时展开为用户目录
+func (c *Config) RecordDir() string {
+	dir := c.File.Record.Dir
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, dir[1:])
+		}
+	}
+	return dir
+}
+
+func (c *Config) RecordDisableCompress() bool {
+	return c.File.Record.DisableCompress
+}
+
+func (c *Config) RecordCompressRatio() int {
+	return c.File.Record.CompressRatio
+}
+
+func (c *Config) RecordAutoTitle() bool {
+	return c.File.Record.AutoTitle
+}
+
+func (c *Config) PreRecordHooks() []string {
+	return c.File.Hooks.PreRecord
+}
+
+func (c *Config) PostRecordHooks() []string {
+	return c.File.Hooks.PostRecord
+}
+
 func (c *Config) PlayMaxWait() float64 {
 	return c.File.Play.MaxWait
 }
 
+func (c *Config) EditBackup() bool {
+	return !c.File.Edit.NoBackup
+}
+
+func (c *Config) EditBackupSuffix() string {
+	return FirstNonBlank(c.File.Edit.BackupSuffix, DefaultBackupSuffix)
+}
+
+func (c *Config) TranscriptPromptRegex() string {
+	return c.File.Transcript.PromptRegex
+}
+
+func (c *Config) UIColor() string {
+	return c.File.UI.Color
+}
+
+func (c *Config) UITheme() string {
+	return FirstNonBlank(c.Env["ACAST_THEME"], c.File.UI.Theme)
+}
+
+func (c *Config) NotifyEnabled() bool {
+	return c.File.Notify.Enabled
+}
+
+func (c *Config) NotifyMinDuration() float64 {
+	return c.File.Notify.MinDuration
+}
+
+// IPFSGateway 返回IPFS网关，为空时使用默认网关
+func (c *Config) IPFSGateway() string {
+	return FirstNonBlank(c.Env["ASCIINEMA_IPFS_GATEWAY"], c.File.IPFS.Gateway)
+}
+
+func (c *Config) IPFSAPI() string {
+	return FirstNonBlank(c.Env["ASCIINEMA_IPFS_API"], c.File.IPFS.API, DefaultIPFSAPI)
+}
+
+// HTTPHeaders 返回[http "主机"]中为各个主机配置的请求头，忽略没有冒号的行
+func (c *Config) HTTPHeaders() map[string]http.Header {
+	headers := map[string]http.Header{}
+	for host, h := range c.File.HTTP {
+		header := http.Header{}
+		for _, line := range h.Header {
+			name, value, ok := strings.Cut(line, ":")
+			if !ok || strings.TrimSpace(name) == "" {
+				continue
+			}
+			header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		headers[host] = header
+	}
+	return headers
+}
+
+func (c *Config) S3Endpoint() string {
+	return FirstNonBlank(c.Env["ASCIINEMA_S3_ENDPOINT"], c.File.S3.Endpoint)
+}
+
 func GetConfig(env map[string]string) (*Config, error) {
-	cfg, err := loadConfigFile(env)
+	cfg, path, err := loadConfigFile(env)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Config{cfg, env}, nil
+	return &Config{cfg, env, path}, nil
 }
 
-func loadConfigFile(env map[string]string) (*ConfigFile, error) {
+func loadConfigFile(env map[string]string) (*ConfigFile, string, error) {
 	pathsToCheck := make([]string, 0, 4)
 	if env[DefaultHomeEnv] != "" {
 		pathsToCheck = append(pathsToCheck,
@@ -102,15 +278,16 @@ func loadConfigFile(env map[string]string) (*ConfigFile, error) {
 
 	if cfgPath == "" {
 		if len(pathsToCheck) == 0 {
-			return nil, errors.New("need $HOME")
+			return nil, "", errors.New("need $HOME")
 		}
 		cfgPath = pathsToCheck[0]
 		if err := createConfigFile(cfgPath); err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	}
 
-	return readConfigFile(cfgPath)
+	cfg, err := readConfigFile(cfgPath)
+	return cfg, cfgPath, err
 }
 
 func readConfigFile(cfgPath string) (*ConfigFile, error) {
@@ -122,6 +299,70 @@ func readConfigFile(cfgPath string) (*ConfigFile, error) {
 	return &cfg, nil
 }
 
+// SetApiToken 修改配置文件[api]一节中的token(即install ID)，保留文件的其余内容
+func (c *Config) SetApiToken(token string) error {
+	if err := c.SetValue("api", "token", token); err != nil {
+		return err
+	}
+	c.File.API.Token = token
+	return nil
+}
+
+// SetValue 修改配置文件中section一节的key，没有该项时添加到这一节的末尾，没有这一节时添加到文件末尾，
+// 保留文件的其余内容。只修改文件，调用者负责更新c.File
+func (c *Config) SetValue(section, key, value string) error {
+	data, err := os.ReadFile(c.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var lines []string
+	if trimmed := strings.TrimRight(string(data), "\n"); trimmed != "" {
+		lines = strings.Split(trimmed, "\n")
+	}
+	value = quoteConfigValue(value)
+	current, end, done := "", -1, false // end为这一节最后一个非空行之后的位置
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			current = strings.ToLower(strings.TrimSpace(trimmed[1 : len(trimmed)-1]))
+			if current == section && end < 0 {
+				end = i + 1
+			}
+			continue
+		}
+		if current != section {
+			continue
+		}
+		if trimmed != "" && end >= 0 && !done {
+			end = i + 1
+		}
+		name, _, ok := strings.Cut(trimmed, "=")
+		if ok && strings.EqualFold(strings.TrimSpace(name), key) {
+			lines[i] = key + " = " + value
+			done = true
+		}
+	}
+	switch {
+	case done:
+	case end >= 0:
+		lines = append(lines[:end], append([]string{key + " = " + value}, lines[end:]...)...)
+	default:
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+section+"]", key+" = "+value)
+	}
+	return os.WriteFile(c.Path, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+}
+
+// quoteConfigValue 值中有注释符号、引号或首尾空白时加上引号
+func quoteConfigValue(value string) string {
+	if !strings.ContainsAny(value, ";#\"\\") && strings.TrimSpace(value) == value {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
 func createConfigFile(cfgPath string) error {
 	apiToken := NewUUID().String()
 	contents := fmt.Sprintf("[api]\ntoken = %v\n", apiToken)
@@ -0,0 +1,40 @@
+package util
+
+import "sync"
+
+var (
+	cleanupLock sync.Mutex
+	cleanupID   int
+	cleanups    = map[int]func(){}
+)
+
+// AddCleanup 注册由RunCleanups执行的清理函数f(例如进程被中断时)，返回的函数用于注销f
+func AddCleanup(f func()) (remove func()) {
+	cleanupLock.Lock()
+	defer cleanupLock.Unlock()
+	cleanupID++
+	id := cleanupID
+	cleanups[id] = f
+	return func() {
+		cleanupLock.Lock()
+		delete(cleanups, id)
+		cleanupLock.Unlock()
+	}
+}
+
+// RunCleanups 按注册顺序倒序执行并注销所有清理函数
+func RunCleanups() {
+	cleanupLock.Lock()
+	list := make([]func(), 0, len(cleanups))
+	for id := cleanupID; id > 0 && len(list) < len(cleanups); id-- {
+		if f, ok := cleanups[id]; ok {
+			list = append(list, f)
+		}
+	}
+	cleanups = map[int]func(){}
+	cleanupLock.Unlock()
+
+	for _, f := range list {
+		f()
+	}
+}
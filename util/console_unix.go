@@ -0,0 +1,6 @@
+//go:build !windows
+
+package util
+
+// installConsoleHandler 非Windows下不做任何事，关闭终端由SIGHUP处理
+func installConsoleHandler() {}
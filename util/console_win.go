@@ -0,0 +1,36 @@
+//go:build windows
+
+package util
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modKernel32               = windows.NewLazySystemDLL("kernel32.dll")
+	fSetConsoleCtrlHandler    = modKernel32.NewProc("SetConsoleCtrlHandler")
+	consoleCtrlHandlerPointer uintptr
+)
+
+// consoleCtrlHandler 由Windows在单独的线程中调用。关闭控制台窗口、注销或关机时，
+// 处理函数一返回进程就会被结束，因此在这里执行清理(写入并修复录像文件、恢复控制台)后再退出。
+// Ctrl-C和Ctrl-Break交给Go运行时，作为os.Interrupt上报
+func consoleCtrlHandler(event uint32) uintptr {
+	switch event {
+	case windows.CTRL_CLOSE_EVENT, windows.CTRL_LOGOFF_EVENT, windows.CTRL_SHUTDOWN_EVENT:
+		RunCleanups()
+		os.Exit(1)
+	}
+	return 0
+}
+
+// installConsoleHandler 通过SetConsoleCtrlHandler注册consoleCtrlHandler
+func installConsoleHandler() {
+	if fSetConsoleCtrlHandler.Find() != nil {
+		return
+	}
+	consoleCtrlHandlerPointer = windows.NewCallback(consoleCtrlHandler)
+	fSetConsoleCtrlHandler.Call(consoleCtrlHandlerPointer, 1)
+}
@@ -13,13 +13,13 @@ func BeQuiet() {
 }
 
 func Printf(s string, args ...interface{}) {
-	fmt.Fprintf(loggerOutput, "\x1b[32m~ %v\x1b[0m\n", fmt.Sprintf(s, args...))
+	fmt.Fprintln(loggerOutput, Colorize(theme.Status, "~ "+Tf(s, args...)))
 }
 
 func ReplaceWarningf(s string, args ...interface{}) {
-	fmt.Fprintf(loggerOutput, "\r\x1b[33m~ %v\x1b[0m", fmt.Sprintf(s, args...))
+	fmt.Fprint(loggerOutput, "\r"+Colorize(theme.StatusWarning, "~ "+Tf(s, args...)))
 }
 
 func Warningf(s string, args ...interface{}) {
-	fmt.Fprintf(loggerOutput, "\x1b[33m~ %v\x1b[0m\n", fmt.Sprintf(s, args...))
+	fmt.Fprintln(loggerOutput, Colorize(theme.StatusWarning, "~ "+Tf(s, args...)))
 }
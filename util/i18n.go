@@ -0,0 +1,196 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 支持的界面语言
+const (
+	LangEnglish = "en"
+	LangChinese = "zh"
+)
+
+// lang 当前的界面语言，由SetLang设置，默认根据环境变量选择
+var lang = DetectLang(os.Getenv)
+
+// catalogs 各语言的消息目录，以英文消息(格式字符串)为键，没有翻译的消息显示英文
+var catalogs = map[string]map[string]string{
+	LangChinese: zhMessages,
+}
+
+// DetectLang 按LC_ALL、LC_MESSAGES、LANG的顺序(与POSIX相同)从环境变量选择界面语言，
+// 如zh_CN.UTF-8为中文，C、POSIX以及没有翻译的语言为英文
+func DetectLang(getenv func(string) string) string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := getenv(name); value != "" {
+			return normalizeLang(value)
+		}
+	}
+	return LangEnglish
+}
+
+// normalizeLang 将zh_CN.UTF-8、zh-TW、en_US等区域设置转为语言代码，不支持的语言返回英文
+func normalizeLang(locale string) string {
+	code := strings.ToLower(locale)
+	if i := strings.IndexAny(code, "_-.@"); i >= 0 {
+		code = code[:i]
+	}
+	if _, ok := catalogs[code]; ok {
+		return code
+	}
+	return LangEnglish
+}
+
+// SetLang 设置界面语言，如--lang zh；为空时保留根据环境变量选择的语言
+func SetLang(value string) error {
+	if value == "" {
+		return nil
+	}
+	code := normalizeLang(value)
+	if code == LangEnglish && !strings.HasPrefix(strings.ToLower(value), LangEnglish) {
+		return fmt.Errorf("unsupported language %q, use %s or %s", value, LangEnglish, LangChinese)
+	}
+	lang = code
+	return nil
+}
+
+// Lang 返回当前的界面语言
+func Lang() string {
+	return lang
+}
+
+// T 返回消息在当前语言下的翻译，可以作为格式字符串使用。
+// 没有翻译的"<操作> failed: %+v"形式的错误提示保留操作名(即子命令名)，只翻译其余部分
+func T(msg string) string {
+	catalog := catalogs[lang]
+	if catalog == nil {
+		return msg
+	}
+	if translated, ok := catalog[msg]; ok {
+		return translated
+	}
+	for suffix, translated := range catalogSuffixes[lang] {
+		if strings.HasSuffix(msg, suffix) {
+			return strings.TrimSuffix(msg, suffix) + translated
+		}
+	}
+	return msg
+}
+
+// Tf 按翻译后的格式字符串格式化
+func Tf(format string, args ...interface{}) string {
+	return fmt.Sprintf(T(format), args...)
+}
+
+// catalogSuffixes 按后缀翻译的消息
+var catalogSuffixes = map[string]map[string]string{
+	LangChinese: {
+		" failed: %+v": " 失败: %+v",
+	},
+}
+
+// zhMessages 中文消息目录
+var zhMessages = map[string]string{
+	// 录制
+	"Asciicast recording started.":                                                            "开始录制。",
+	"Asciicast recording with stream writing started.":                                        "开始录制，边录制边写入文件。",
+	`Hit Ctrl-D or type "exit" to finish.`:                                                    `按Ctrl-D或输入"exit"结束录制。`,
+	"Asciicast recording finished.":                                                           "录制结束。",
+	"Recording at %vx%v, which is larger than the current terminal (%vx%v).":                  "录制大小为%vx%v，大于当前终端(%vx%v)。",
+	"The output may look garbled here, but the recording is not affected.":                    "这里的显示可能错乱，但不影响录像。",
+	"Current terminal size is %vx%v.":                                                         "当前终端大小为%vx%v。",
+	"It may be too big to be properly replayed on smaller screens.":                           "在较小的屏幕上可能无法正常播放。",
+	"You can now resize it. Press <Enter> to start recording.":                                "现在可以调整终端大小，按<Enter>开始录制。",
+	"Live viewing with attach is not available: %v":                                           "无法通过attach实时观看: %v",
+	"Watch live with: acast attach %s":                                                        "实时观看: acast attach %s",
+	"Viewers can type into this session with: acast attach --input --token %s %s":             "观看者可以这样向会话输入: acast attach --input --token %s %s",
+	"Their input is logged to %s.":                                                            "他们的输入记录在%s。",
+	"Metrics at http://%s/debug/vars":                                                         "运行指标: http://%s/debug/vars",
+	"Forwarding output to syslog %s, session %s":                                              "输出转发到syslog %s，会话%s",
+	"Forwarding to syslog %s stopped: %v":                                                     "转发到syslog %s已停止: %v",
+	"Syslog %s could not keep up, %d lines were not forwarded.":                               "syslog %s处理不过来，%d行没有转发。",
+	"Mirroring to %s stopped: %v":                                                             "镜像到%s已停止: %v",
+	"%s could not keep up, some output was not mirrored.":                                     "%s处理不过来，部分输出没有镜像。",
+	"already recording in this terminal (%s is set), use --force to start a nested recording": "这个终端已经在录制(设置了%s)，使用--force开始嵌套录制",
+	"asciinema needs a UTF-8 native locale to run. Check the output of `locale` command.":     "asciinema需要UTF-8区域设置才能运行，请检查`locale`命令的输出。",
+	"%s hook %q failed: %v":                                                                   "%s钩子%q失败: %v",
+	"Could not set the title from the first command: %v":                                      "无法以第一条命令作为标题: %v",
+
+	// 播放
+	"Terminal size %dx%d is smaller than the recording size %dx%d, playback may be garbled.":            "终端大小%dx%d小于录像大小%dx%d，播放可能错乱。",
+	"terminal size %dx%d is smaller than the recording size %dx%d, enlarge the terminal or use --force": "终端大小%dx%d小于录像大小%dx%d，请放大终端或使用--force",
+	"Terminal size %dx%d is smaller than the session size %dx%d, the output may be garbled.":            "终端大小%dx%d小于会话大小%dx%d，显示可能错乱。",
+	"failed to handle %q event: %v":  "处理%q事件失败: %v",
+	"frame #%d is not a valid Frame": "帧 #%d 不是有效的Frame类型",
+	"unsupported frame type":         "不支持的帧类型",
+	"Narration audio not found: %v":  "找不到旁白音频: %v",
+	"No audio player found (mpv, ffplay or afplay), playing without narration.": "找不到音频播放器(mpv、ffplay或afplay)，播放时没有旁白。",
+	"Failed to play narration: %v": "播放旁白失败: %v",
+	"The terminal could not keep up: %d of %d frames were written more than %v late (up to %s behind). Try --max-chunk to split large frames.": "终端跟不上播放: %[2]d帧中有%[1]d帧的写入晚了超过%[3]v(最多落后%[4]s)。可以用--max-chunk拆分较大的帧。",
+
+	// 录像文件
+	"%s: line %d is not a valid event, skipped: %v": "%s: 第%d行不是有效的事件，已跳过: %v",
+	"invalid cast header: %v":                       "录像文件头解析失败: %v",
+	"base64 decoding failed: %v":                    "base64解码失败: %v",
+	"creating the gzip reader failed: %v":           "创建gzip读取器失败: %v",
+	"reading the decompressed data failed: %v":      "读取解压数据失败: %v",
+	"compressing the data failed: %v":               "压缩数据失败: %v",
+	"closing the compressor failed: %v":             "关闭压缩器失败: %v",
+	"Skipping %s: %v":                               "跳过%s: %v",
+
+	// tojson
+	"invalid prompt regexp: %v":                          "提示符模式不正确: %v",
+	"failed to parse the frame on line %d: %v, line: %s": "解析第%d行的帧失败: %v, 行: %s",
+	"failed to process a compressed frame: %v":           "处理压缩帧失败: %v",
+	"reading the file failed: %v":                        "读取文件失败: %v",
+	"no input file given":                                "未指定输入文件",
+	"generating JSON failed: %v":                         "生成JSON失败: %v",
+	"writing the JSON file failed: %v":                   "写入JSON文件失败: %v",
+	"Converted, output file: %s":                         "转换成功，输出文件: %s",
+	"tojson failed: %+v":                                 "转换为JSON失败: %+v",
+
+	// init
+	"Setting up acast. The answers are saved to %s.":                           "设置acast，回答保存在%s。",
+	"Press Enter to keep the value in brackets.":                               "直接回车保留方括号中的值。",
+	"asciinema server URL":                                                     "asciinema服务器地址",
+	"Shell to record":                                                          "录制的shell",
+	"Compress repeated output in recordings":                                   "压缩录像中重复的输出",
+	"Compression ratio, higher compresses more":                                "压缩比例，越大压缩得越多",
+	"Directory for new recordings, - for the current directory":                "新录像保存的目录，-表示当前目录",
+	"Link this machine with your asciinema account now":                        "现在将这台机器关联到你的asciinema账号",
+	"Please answer y or n.":                                                    "请回答y或n。",
+	"%q is not an http:// or https:// URL":                                     "%q不是http://或https://地址",
+	"%q is not a positive whole number":                                        "%q不是正整数",
+	"Saved %s.":                                                                "已保存%s。",
+	"Checking %s ...":                                                          "正在检查%s ...",
+	"Could not reach the server: %v. Uploads will fail until it is reachable.": "无法连接服务器: %v。在能够连接之前上传会失败。",
+	"The server is reachable.":                                                 "可以连接服务器。",
+	"The URL was copied to the clipboard.":                                     "地址已复制到剪贴板。",
+
+	// 其他
+	"Failed to send the desktop notification: %v":                              "发送桌面通知失败: %v",
+	"Failed to copy the url to the clipboard: %v":                              "复制地址到剪贴板失败: %v",
+	"%s (copied to the clipboard)":                                             "%s (已复制到剪贴板)",
+	"Session recording is not available: %v":                                   "无法录制会话: %v",
+	"OpenTelemetry traces are not exported: %v":                                "不导出OpenTelemetry追踪数据: %v",
+	"OpenTelemetry metrics are not exported: %v":                               "不导出OpenTelemetry指标: %v",
+	"%d files processed: %d succeeded, %d failed":                              "处理了%d个文件: %d个成功，%d个失败",
+	"%s: upload failed: %+v":                                                   "%s: 上传失败: %+v",
+	"%s failed: %v":                                                            "%s 失败: %v",
+	"store put failed: %s: %+v":                                                "store put 失败: %s: %+v",
+	"unsupported os":                                                           "不支持的操作系统",
+	"no recording session is running":                                          "没有正在录制的会话",
+	"install ID imported":                                                      "已导入安装ID",
+	"new install ID: %s":                                                       "新的安装ID: %s",
+	"Packed %d casts into %s":                                                  "已将%d个录像打包到%s",
+	"%s: %d bytes in %d chunks, %d new, %d bytes written":                      "%s: %d字节，%d块，其中%d块是新的，写入%d字节",
+	"attach failed: --input needs the --token printed by record --allow-input": "attach 失败: --input需要record --allow-input输出的--token",
+	"Recordings uploaded with the old ID stay in your account; run acast auth to link the new one.": "用旧ID上传的录像仍在你的账号中；运行acast auth关联新的ID。",
+	"agg<https://github.com/asciinema/agg> is not installed.":                                       "没有安装agg<https://github.com/asciinema/agg>。",
+	"Please use vm<https://github.com/gvcgo/version-manager> to install agg.":                       "请使用vm<https://github.com/gvcgo/version-manager>安装agg。",
+	"ffmpeg<https://ffmpeg.org> is not installed.":                                                  "没有安装ffmpeg<https://ffmpeg.org>。",
+	"gif2webp<https://developers.google.com/speed/webp/docs/gif2webp> is not installed.":            "没有安装gif2webp<https://developers.google.com/speed/webp/docs/gif2webp>。",
+	"Please install libwebp (e.g. apt install webp, brew install webp).":                            "请安装libwebp(如apt install webp、brew install webp)。",
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 仓库中每个传给T或Tf的消息都有中文翻译
+func TestCatalogComplete(t *testing.T) {
+	fset := token.NewFileSet()
+	err := filepath.WalkDir("..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == "testdata") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 || !isTranslateCall(file, call.Fun) {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			msg, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return true
+			}
+			if !translated(LangChinese, msg) {
+				t.Errorf("%s: %q has no %s translation", fset.Position(lit.Pos()), msg, LangChinese)
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// isTranslateCall 判断fun是否为util包中的T或Tf
+func isTranslateCall(file *ast.File, fun ast.Expr) bool {
+	switch f := fun.(type) {
+	case *ast.Ident:
+		return file.Name.Name == "util" && (f.Name == "T" || f.Name == "Tf")
+	case *ast.SelectorExpr:
+		pkg, ok := f.X.(*ast.Ident)
+		return ok && pkg.Name == "util" && (f.Sel.Name == "T" || f.Sel.Name == "Tf")
+	}
+	return false
+}
+
+// translated 判断消息在语言code的目录中有没有翻译，包括按后缀翻译的
+func translated(code, msg string) bool {
+	if _, ok := catalogs[code][msg]; ok {
+		return true
+	}
+	for suffix := range catalogSuffixes[code] {
+		if strings.HasSuffix(msg, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package util
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var handleSignalsOnce sync.Once
+
+// HandleSignals 为结束进程的信号(SIGINT、SIGTERM和SIGHUP)安装唯一的处理函数：
+// 倒序执行已注册的清理函数，写入并修复打开的录像、恢复终端，然后以状态码1退出。
+// Windows下关闭控制台窗口时的处理相同。重复调用不会生效
+func HandleSignals() {
+	handleSignalsOnce.Do(func() {
+		installConsoleHandler()
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		go func() {
+			<-c
+			RunCleanups()
+			os.Exit(1)
+		}()
+	})
+}
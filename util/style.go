@@ -0,0 +1,162 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+// 颜色模式，由--color或配置文件[ui]中的color选择
+const (
+	ColorAuto   = "auto"   // 输出到终端时使用颜色，遵循NO_COLOR和CLICOLOR_FORCE
+	ColorAlways = "always" // 总是使用颜色，如CI日志支持颜色时
+	ColorNever  = "never"  // 不使用颜色
+)
+
+// Theme CLI提示使用的颜色，可以是#rrggbb或ANSI颜色编号
+type Theme struct {
+	Info          string // INFO提示
+	Success       string // SUCCESS提示
+	Warning       string // WARNING提示
+	Error         string // ERROR提示
+	Status        string // 录制等过程中以~开头的状态信息
+	StatusWarning string // 以~开头的警告
+}
+
+// Themes 内置的配色，colorblind使用Okabe-Ito色板，红绿色盲也能区分成功和错误
+var Themes = map[string]Theme{
+	"default": {
+		Info:          "#40E0D0",
+		Success:       "#32CD32",
+		Warning:       "#FFFF00",
+		Error:         "#FF6347",
+		Status:        "2",
+		StatusWarning: "3",
+	},
+	"colorblind": {
+		Info:          "#56B4E9",
+		Success:       "#0072B2",
+		Warning:       "#F0E442",
+		Error:         "#D55E00",
+		Status:        "#56B4E9",
+		StatusWarning: "#F0E442",
+	},
+}
+
+var (
+	theme        = Themes["default"]
+	colorEnabled = detectColor(os.Getenv, os.Stdout)
+	profile      = termenv.Ascii // 输出颜色使用的色彩模式
+)
+
+func init() {
+	applyColorProfile()
+}
+
+// detectColor 自动模式下是否使用颜色：设置了NO_COLOR时不使用，设置了CLICOLOR_FORCE(不为0)时总是使用，
+// 否则只在输出到终端(TERM不为dumb)时使用
+func detectColor(getenv func(string) string, out *os.File) bool {
+	if getenv("NO_COLOR") != "" {
+		return false
+	}
+	if force := getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true
+	}
+	return getenv("TERM") != "dumb" && term.IsTerminal(int(out.Fd()))
+}
+
+// applyColorProfile 按colorEnabled选择色彩模式，lipgloss(包括gprint)也使用同样的模式
+func applyColorProfile() {
+	profile = termenv.Ascii
+	if colorEnabled {
+		profile = termenv.NewOutput(os.Stdout).ColorProfile()
+		if profile == termenv.Ascii {
+			profile = termenv.ANSI256
+		}
+	}
+	lipgloss.SetColorProfile(profile)
+}
+
+// SetColorMode 设置颜色模式，为空时与auto相同
+func SetColorMode(mode string) error {
+	switch mode {
+	case "", ColorAuto:
+		colorEnabled = detectColor(os.Getenv, os.Stdout)
+	case ColorAlways:
+		colorEnabled = true
+	case ColorNever:
+		colorEnabled = false
+	default:
+		return fmt.Errorf("unknown color mode %q, use %s, %s or %s", mode, ColorAuto, ColorAlways, ColorNever)
+	}
+	applyColorProfile()
+	return nil
+}
+
+// SetTheme 按名称选择配色，为空时使用默认配色
+func SetTheme(name string) error {
+	if name == "" {
+		name = "default"
+	}
+	t, ok := Themes[name]
+	if !ok {
+		names := make([]string, 0, len(Themes))
+		for n := range Themes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown theme %q, use %s", name, strings.Join(names, " or "))
+	}
+	theme = t
+	return nil
+}
+
+// CurrentTheme 返回当前使用的配色
+func CurrentTheme() Theme {
+	return theme
+}
+
+// ColorEnabled 返回CLI输出是否使用颜色
+func ColorEnabled() bool {
+	return colorEnabled
+}
+
+// Colorize 以color为前景色显示s，不使用颜色时原样返回
+func Colorize(color, s string) string {
+	if !colorEnabled {
+		return s
+	}
+	return termenv.String(s).Foreground(profile.Color(color)).String()
+}
+
+// printHint 以"  ERROR   消息"的形式输出，标签的背景和消息的颜色由配色决定；
+// 不使用颜色时只输出文字，便于在CI日志中查找
+func printHint(hint, color, format string, v ...interface{}) {
+	if !colorEnabled {
+		fmt.Println(hint + " " + fmt.Sprintf(format, v...))
+		return
+	}
+	badge := termenv.String(hint).Foreground(profile.Color("#000000")).Background(profile.Color(color)).String()
+	fmt.Println(badge + " " + Colorize(color, fmt.Sprintf(format, v...)))
+}
+
+func PrintInfo(format string, v ...interface{}) {
+	printHint("  INFO   ", theme.Info, format, v...)
+}
+
+func PrintSuccess(format string, v ...interface{}) {
+	printHint(" SUCCESS ", theme.Success, format, v...)
+}
+
+func PrintWarning(format string, v ...interface{}) {
+	printHint(" WARNING ", theme.Warning, format, v...)
+}
+
+func PrintError(format string, v ...interface{}) {
+	printHint("  ERROR  ", theme.Error, format, v...)
+}
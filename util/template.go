@@ -0,0 +1,158 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// strftimeTokens strftime转换字符到go时间格式的映射
+var strftimeTokens = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'Z': "MST",
+	'z': "-0700",
+}
+
+// Strftime 按类似strftime的格式(如"%Y%m%d-%H%M")格式化t，未知的转换字符原样保留
+func Strftime(layout string, t time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' || i == len(layout)-1 {
+			b.WriteByte(layout[i])
+			continue
+		}
+		i++
+		c := layout[i]
+		switch c {
+		case '%':
+			b.WriteByte('%')
+		case 's':
+			fmt.Fprintf(&b, "%d", t.Unix())
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		default:
+			if goLayout, ok := strftimeTokens[c]; ok {
+				b.WriteString(t.Format(goLayout))
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+// Hostname 返回本机的短主机名
+func Hostname() string {
+	name, _ := os.Hostname()
+	return strings.Split(name, ".")[0]
+}
+
+// Username 返回当前用户名
+func Username() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name := u.Username
+		// windows下返回的是DOMAIN\user
+		if idx := strings.LastIndex(name, "\\"); idx >= 0 {
+			name = name[idx+1:]
+		}
+		return name
+	}
+	return FirstNonBlank(os.Getenv("USER"), os.Getenv("USERNAME"))
+}
+
+// templateVars 文件名和标题模板中的{name}占位符。只计算用到的占位符，
+// 不在git工作区中时git相关的占位符为空
+var templateVars = map[string]func(t time.Time) string{
+	"hostname":   func(time.Time) string { return Hostname() },
+	"user":       func(time.Time) string { return Username() },
+	"date":       func(t time.Time) string { return t.Format("2006-01-02") },
+	"time":       func(t time.Time) string { return t.Format("15:04") },
+	"os":         func(time.Time) string { return runtime.GOOS },
+	"cwd":        func(time.Time) string { return workDirName() },
+	"git_branch": func(time.Time) string { return gitOutput("rev-parse", "--abbrev-ref", "HEAD") },
+	"git_commit": func(time.Time) string { return gitOutput("rev-parse", "--short", "HEAD") },
+	"git_repo":   func(time.Time) string { return gitRepoName() },
+}
+
+// templateVar 匹配{name}占位符
+var templateVar = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// expandTemplate 展开strftime转换字符和已知的{name}占位符，每个值都经过clean处理，未知的占位符原样保留
+func expandTemplate(tmpl string, t time.Time, clean func(string) string) string {
+	if !strings.ContainsAny(tmpl, "%{") {
+		return tmpl
+	}
+	return templateVar.ReplaceAllStringFunc(Strftime(tmpl, t), func(m string) string {
+		value, ok := templateVars[m[1:len(m)-1]]
+		if !ok {
+			return m
+		}
+		return clean(value(t))
+	})
+}
+
+// ExpandNameTemplate 展开文件名模板中的strftime转换字符和{hostname}、{user}、{date}等占位符，
+// 使自动录制得到"demo-20240101-1200.cast"这样唯一的文件名
+func ExpandNameTemplate(tmpl string, t time.Time) string {
+	sanitize := strings.NewReplacer("/", "_", "\\", "_", " ", "_", ":", "-")
+	return expandTemplate(tmpl, t, sanitize.Replace)
+}
+
+// emptyBrackets 匹配占位符展开为空后留下的括号及其前面的空白
+var emptyBrackets = regexp.MustCompile(`\s*(\(\s*\)|\[\s*\])`)
+
+// ExpandTitleTemplate 在开始录制时展开"demo on {hostname} {date} ({git_branch})"这样的标题模板，
+// 占位符展开为空后留下的括号(如不在git工作区中时的({git_branch}))会被删除
+func ExpandTitleTemplate(tmpl string, t time.Time) string {
+	title := expandTemplate(tmpl, t, strings.TrimSpace)
+	if title != tmpl && !emptyBrackets.MatchString(tmpl) {
+		title = strings.TrimSpace(emptyBrackets.ReplaceAllString(title, ""))
+	}
+	return title
+}
+
+// workDirName 返回工作目录的名称
+func workDirName() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(dir)
+}
+
+// gitRepoName 返回git工作区顶层目录的名称
+func gitRepoName() string {
+	top := gitOutput("rev-parse", "--show-toplevel")
+	if top == "" {
+		return ""
+	}
+	return filepath.Base(top)
+}
+
+// gitOutput 在工作目录中运行git并返回去掉首尾空白的输出，git失败或未安装时返回空字符串
+func gitOutput(args ...string) string {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,211 @@
+package vt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Color 颜色，0表示默认颜色
+type Color uint32
+
+const (
+	colorIndexed Color = 1 << 24
+	colorRGB     Color = 1 << 25
+)
+
+// IndexedColor 返回调色板中第n个颜色(0-255)
+func IndexedColor(n int) Color {
+	return colorIndexed | Color(n&0xff)
+}
+
+// RGBColor 返回一个真彩色
+func RGBColor(r, g, b int) Color {
+	return colorRGB | Color(r&0xff)<<16 | Color(g&0xff)<<8 | Color(b&0xff)
+}
+
+// IsDefault 是否为默认颜色
+func (c Color) IsDefault() bool {
+	return c == 0
+}
+
+// Index 返回调色板颜色的序号
+func (c Color) Index() (int, bool) {
+	if c&colorIndexed == 0 {
+		return 0, false
+	}
+	return int(c & 0xff), true
+}
+
+// RGB 返回真彩色的分量
+func (c Color) RGB() (r, g, b int, ok bool) {
+	if c&colorRGB == 0 {
+		return 0, 0, 0, false
+	}
+	return int(c >> 16 & 0xff), int(c >> 8 & 0xff), int(c & 0xff), true
+}
+
+// 文本样式标志
+const (
+	Bold uint16 = 1 << iota
+	Faint
+	Italic
+	Underline
+	Blink
+	Inverse
+	Hidden
+	Strike
+)
+
+// Attr 单元格的显示属性
+type Attr struct {
+	FG    Color
+	BG    Color
+	Flags uint16
+}
+
+// Has 是否设置了某个样式
+func (a Attr) Has(flag uint16) bool {
+	return a.Flags&flag != 0
+}
+
+// background 擦除时使用的属性，只保留背景色
+func (a Attr) background() Attr {
+	return Attr{BG: a.BG}
+}
+
+var sgrFlags = []struct {
+	flag    uint16
+	on, off int
+}{
+	{Bold, 1, 22},
+	{Faint, 2, 22},
+	{Italic, 3, 23},
+	{Underline, 4, 24},
+	{Blink, 5, 25},
+	{Inverse, 7, 27},
+	{Hidden, 8, 28},
+	{Strike, 9, 29},
+}
+
+// applySGR 将SGR参数应用到属性上
+func (a *Attr) applySGR(params []int) {
+	if len(params) == 0 {
+		*a = Attr{}
+		return
+	}
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		switch {
+		case p == 0:
+			*a = Attr{}
+		case p == 22:
+			a.Flags &^= Bold | Faint
+		case p >= 1 && p <= 9:
+			for _, f := range sgrFlags {
+				if f.on == p {
+					a.Flags |= f.flag
+				}
+			}
+		case p >= 23 && p <= 29:
+			for _, f := range sgrFlags {
+				if f.off == p {
+					a.Flags &^= f.flag
+				}
+			}
+		case p >= 30 && p <= 37:
+			a.FG = IndexedColor(p - 30)
+		case p == 39:
+			a.FG = 0
+		case p >= 40 && p <= 47:
+			a.BG = IndexedColor(p - 40)
+		case p == 49:
+			a.BG = 0
+		case p >= 90 && p <= 97:
+			a.FG = IndexedColor(p - 90 + 8)
+		case p >= 100 && p <= 107:
+			a.BG = IndexedColor(p - 100 + 8)
+		case p == 38 || p == 48:
+			var c Color
+			c, i = extendedColor(params, i)
+			if p == 38 {
+				a.FG = c
+			} else {
+				a.BG = c
+			}
+		}
+	}
+}
+
+// extendedColor 解析38/48后面的256色或真彩色参数，返回颜色和最后使用的参数下标
+func extendedColor(params []int, i int) (Color, int) {
+	if i+1 >= len(params) {
+		return 0, i
+	}
+	switch params[i+1] {
+	case 5:
+		if i+2 < len(params) {
+			return IndexedColor(params[i+2]), i + 2
+		}
+		return 0, len(params)
+	case 2:
+		if i+4 < len(params) {
+			return RGBColor(params[i+2], params[i+3], params[i+4]), i + 4
+		}
+		return 0, len(params)
+	}
+	return 0, i + 1
+}
+
+// SGR 返回设置该属性的完整SGR序列(以0开头重置)
+func (a Attr) SGR() string {
+	params := []string{"0"}
+	for _, f := range sgrFlags {
+		if a.Has(f.flag) {
+			params = append(params, strconv.Itoa(f.on))
+		}
+	}
+	params = appendColor(params, a.FG, 30)
+	params = appendColor(params, a.BG, 40)
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+func appendColor(params []string, c Color, base int) []string {
+	if idx, ok := c.Index(); ok {
+		switch {
+		case idx < 8:
+			return append(params, strconv.Itoa(base+idx))
+		case idx < 16:
+			return append(params, strconv.Itoa(base+60+idx-8))
+		default:
+			return append(params, strconv.Itoa(base+8), "5", strconv.Itoa(idx))
+		}
+	}
+	if r, g, b, ok := c.RGB(); ok {
+		return append(params, strconv.Itoa(base+8), "2", strconv.Itoa(r), strconv.Itoa(g), strconv.Itoa(b))
+	}
+	return params
+}
+
+// RenderCells 将一行单元格渲染为带SGR序列的文本，去掉行尾使用默认属性的空白
+func RenderCells(cells []Cell) string {
+	end := len(cells)
+	for end > 0 && cells[end-1].Char == ' ' && cells[end-1].Attr == (Attr{}) {
+		end--
+	}
+	var b strings.Builder
+	current := Attr{}
+	for _, c := range cells[:end] {
+		if c.Char == 0 {
+			continue
+		}
+		if c.Attr != current {
+			b.WriteString(c.Attr.SGR())
+			current = c.Attr
+		}
+		b.WriteRune(c.Char)
+	}
+	if current != (Attr{}) {
+		b.WriteString("\x1b[0m")
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package vt
+
+import "testing"
+
+func TestSGR(t *testing.T) {
+	tests := []struct {
+		params string
+		want   Attr
+	}{
+		{"", Attr{}},
+		{"1", Attr{Flags: Bold}},
+		{"1;2", Attr{Flags: Bold | Faint}},
+		{"1;2;22", Attr{}},
+		{"3;4;9", Attr{Flags: Italic | Underline | Strike}},
+		{"4;24", Attr{}},
+		{"5;7;8", Attr{Flags: Blink | Inverse | Hidden}},
+		{"7;27", Attr{}},
+		{"31", Attr{FG: IndexedColor(1)}},
+		{"91", Attr{FG: IndexedColor(9)}},
+		{"42", Attr{BG: IndexedColor(2)}},
+		{"102", Attr{BG: IndexedColor(10)}},
+		{"31;39", Attr{}},
+		{"42;49", Attr{}},
+		{"38;5;208", Attr{FG: IndexedColor(208)}},
+		{"48;2;1;2;3", Attr{BG: RGBColor(1, 2, 3)}},
+		{"38:2:10:20:30", Attr{FG: RGBColor(10, 20, 30)}},
+		{"38;5;208;1", Attr{FG: IndexedColor(208), Flags: Bold}},
+		{"38;5", Attr{}},
+		{"1;31;0", Attr{}},
+		{"1;31;0;4", Attr{Flags: Underline}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.params, func(t *testing.T) {
+			s := New(10, 1)
+			s.WriteString("\x1b[" + tt.params + "m")
+			if got := s.Pen(); got != tt.want {
+				t.Errorf("Pen() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttrSGR(t *testing.T) {
+	tests := []struct {
+		attr Attr
+		want string
+	}{
+		{Attr{}, "\x1b[0m"},
+		{Attr{Flags: Bold, FG: IndexedColor(1)}, "\x1b[0;1;31m"},
+		{Attr{Flags: Italic | Strike}, "\x1b[0;3;9m"},
+		{Attr{FG: IndexedColor(9)}, "\x1b[0;91m"},
+		{Attr{BG: IndexedColor(12)}, "\x1b[0;104m"},
+		{Attr{BG: IndexedColor(200)}, "\x1b[0;48;5;200m"},
+		{Attr{FG: RGBColor(1, 2, 3)}, "\x1b[0;38;2;1;2;3m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want[1:], func(t *testing.T) {
+			if got := tt.attr.SGR(); got != tt.want {
+				t.Errorf("SGR() = %q, want %q", got, tt.want)
+			}
+			// 输出的序列应当能还原出同样的属性
+			s := New(10, 1)
+			s.WriteString("\x1b[1;2;3;4;5;7;8;9;31;42m" + tt.want)
+			if got := s.Pen(); got != tt.attr {
+				t.Errorf("Pen() after %q = %+v, want %+v", tt.want, got, tt.attr)
+			}
+		})
+	}
+}
+
+func TestCellAttr(t *testing.T) {
+	s := New(10, 2)
+	s.WriteString("\x1b[1;31mab\x1b[0mc\r\n\x1b[44mx\x1b[2K")
+	line := s.Line(0)
+	if want := (Attr{Flags: Bold, FG: IndexedColor(1)}); line[0].Attr != want || line[1].Attr != want {
+		t.Errorf("cells 0-1 have %+v %+v, want %+v", line[0].Attr, line[1].Attr, want)
+	}
+	if line[2].Attr != (Attr{}) {
+		t.Errorf("cell 2 has %+v, want default", line[2].Attr)
+	}
+	// 擦除只保留背景色
+	if got, want := s.Line(1)[0], (Cell{Char: ' ', Attr: Attr{BG: IndexedColor(4)}}); got != want {
+		t.Errorf("erased cell = %+v, want %+v", got, want)
+	}
+	if got, want := RenderCells(line), "\x1b[0;1;31mab\x1b[0mc"; got != want {
+		t.Errorf("RenderCells() = %q, want %q", got, want)
+	}
+}
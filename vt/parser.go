@@ -0,0 +1,307 @@
+package vt
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type parserState int
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateCharset // ESC ( 等字符集选择，跳过下一个字节
+	stateCSI
+	stateOSC
+	stateString // DCS/SOS/PM/APC，内容被忽略
+)
+
+type parser struct {
+	state   parserState
+	buf     []byte // CSI参数或OSC内容
+	pending []byte // 未完整的UTF-8字节
+	strEsc  bool   // 字符串状态中遇到了ESC，可能是ST
+}
+
+// Write 将终端输出写入屏幕模型，实现io.Writer
+func (s *Screen) Write(p []byte) (int, error) {
+	data := p
+	if len(s.parser.pending) > 0 {
+		data = append(s.parser.pending, p...)
+		s.parser.pending = nil
+	}
+	for i := 0; i < len(data); {
+		b := data[i]
+		if s.parser.state == stateGround && b >= 0x80 {
+			if !utf8.FullRune(data[i:]) {
+				s.parser.pending = append([]byte{}, data[i:]...)
+				break
+			}
+			r, size := utf8.DecodeRune(data[i:])
+			s.put(r)
+			i += size
+			continue
+		}
+		s.feed(b)
+		i++
+	}
+	return len(p), nil
+}
+
+// WriteString 写入字符串
+func (s *Screen) WriteString(str string) {
+	s.Write([]byte(str))
+}
+
+func (s *Screen) feed(b byte) {
+	p := &s.parser
+	switch p.state {
+	case stateGround:
+		if b < 0x20 || b == 0x7f {
+			s.control(b)
+		} else {
+			s.put(rune(b))
+		}
+	case stateEscape:
+		s.escape(b)
+	case stateCharset:
+		p.state = stateGround
+	case stateCSI:
+		switch {
+		case b == 0x1b:
+			p.state = stateEscape
+		case b < 0x20:
+			s.control(b)
+		case b >= 0x40 && b <= 0x7e:
+			s.csi(string(p.buf), b)
+			p.state = stateGround
+		default:
+			p.buf = append(p.buf, b)
+		}
+	case stateOSC, stateString:
+		if p.strEsc {
+			p.strEsc = false
+			if b == '\\' {
+				s.endString()
+				return
+			}
+			p.buf = append(p.buf, 0x1b)
+		}
+		switch b {
+		case 0x07:
+			s.endString()
+		case 0x1b:
+			p.strEsc = true
+		default:
+			p.buf = append(p.buf, b)
+		}
+	}
+}
+
+func (s *Screen) endString() {
+	if s.parser.state == stateOSC {
+		s.osc(string(s.parser.buf))
+	}
+	s.parser.state = stateGround
+	s.parser.buf = s.parser.buf[:0]
+}
+
+// control 处理C0控制字符
+func (s *Screen) control(b byte) {
+	switch b {
+	case '\b':
+		if s.cursor.X > 0 {
+			s.cursor.X--
+		}
+		s.wrapNext = false
+	case '\t':
+		s.tab()
+	case '\n', '\v', '\f':
+		s.lineFeed()
+		s.wrapNext = false
+	case '\r':
+		s.cursor.X = 0
+		s.wrapNext = false
+	case 0x1b:
+		s.parser.state = stateEscape
+	}
+}
+
+// escape 处理ESC之后的字节
+func (s *Screen) escape(b byte) {
+	p := &s.parser
+	p.state = stateGround
+	switch b {
+	case '[':
+		p.state = stateCSI
+		p.buf = p.buf[:0]
+	case ']':
+		p.state = stateOSC
+		p.buf = p.buf[:0]
+	case 'P', 'X', '^', '_':
+		p.state = stateString
+		p.buf = p.buf[:0]
+	case '(', ')', '*', '+', '#', '%':
+		p.state = stateCharset
+	case '7':
+		s.saveCursor()
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.cursor.X = 0
+		s.lineFeed()
+	case 'M':
+		s.reverseIndex()
+	case 'H':
+		s.tabs[s.cursor.X] = true
+	case 'c':
+		s.Reset()
+	}
+}
+
+// parseParams 解析CSI参数，缺省的参数为0
+func parseParams(str string) []int {
+	if str == "" {
+		return nil
+	}
+	fields := strings.Split(strings.ReplaceAll(str, ":", ";"), ";")
+	params := make([]int, len(fields))
+	for i, f := range fields {
+		params[i], _ = strconv.Atoi(f)
+	}
+	return params
+}
+
+func param(params []int, i, def int) int {
+	if i < len(params) && params[i] > 0 {
+		return params[i]
+	}
+	return def
+}
+
+// csi 处理完整的CSI序列
+func (s *Screen) csi(raw string, final byte) {
+	private := ""
+	if raw != "" && strings.ContainsRune("?<=>", rune(raw[0])) {
+		private, raw = raw[:1], raw[1:]
+	}
+	// 去掉中间字节
+	raw = strings.TrimRight(raw, " !\"#$%&'()*+,-./")
+	params := parseParams(raw)
+	n := param(params, 0, 1)
+
+	if private == "?" {
+		if final == 'h' || final == 'l' {
+			s.setPrivateModes(params, final == 'h')
+		}
+		return
+	}
+	if private != "" {
+		return
+	}
+
+	c := &s.cursor
+	switch final {
+	case '@':
+		s.insertChars(n)
+	case 'A':
+		s.moveTo(c.X, c.Y-n)
+	case 'B', 'e':
+		s.moveTo(c.X, c.Y+n)
+	case 'C', 'a':
+		s.moveTo(c.X+n, c.Y)
+	case 'D':
+		s.moveTo(c.X-n, c.Y)
+	case 'E':
+		s.moveTo(0, c.Y+n)
+	case 'F':
+		s.moveTo(0, c.Y-n)
+	case 'G', '`':
+		s.moveTo(n-1, c.Y)
+	case 'H', 'f':
+		s.moveTo(param(params, 1, 1)-1, n-1)
+	case 'I':
+		for i := 0; i < n; i++ {
+			s.tab()
+		}
+	case 'J':
+		s.eraseDisplay(param(params, 0, 0))
+	case 'K':
+		s.eraseLine(param(params, 0, 0))
+	case 'L':
+		s.insertLines(n)
+	case 'M':
+		s.deleteLines(n)
+	case 'P':
+		s.deleteChars(n)
+	case 'S':
+		s.scrollUp(n)
+	case 'T':
+		s.scrollDown(n)
+	case 'X':
+		s.eraseCells(c.Y, c.X, c.X+n)
+	case 'b':
+		if s.lastChar != 0 {
+			for i := 0; i < n; i++ {
+				s.put(s.lastChar)
+			}
+		}
+	case 'd':
+		s.moveTo(c.X, n-1)
+	case 'g':
+		switch param(params, 0, 0) {
+		case 0:
+			s.tabs[c.X] = false
+		case 3:
+			s.tabs = make([]bool, s.cols)
+		}
+	case 'm':
+		c.Attr.applySGR(params)
+	case 'r':
+		top, bottom := n-1, param(params, 1, s.rows)-1
+		if top < bottom && bottom < s.rows {
+			s.top, s.bottom = top, bottom
+			s.moveTo(0, 0)
+		}
+	case 's':
+		s.saveCursor()
+	case 'u':
+		s.restoreCursor()
+	}
+}
+
+// setPrivateModes 处理DEC私有模式
+func (s *Screen) setPrivateModes(params []int, on bool) {
+	for _, mode := range params {
+		switch mode {
+		case 7:
+			s.autoWrap = on
+		case 25:
+			s.hidden = !on
+		case 47, 1047:
+			s.setAltScreen(on)
+		case 1049:
+			if on {
+				s.saveCursor()
+				s.setAltScreen(true)
+			} else {
+				s.setAltScreen(false)
+				s.restoreCursor()
+			}
+		}
+	}
+}
+
+// osc 处理OSC序列
+func (s *Screen) osc(data string) {
+	if s.OnOSC != nil {
+		s.OnOSC(data)
+	}
+	code, text, _ := strings.Cut(data, ";")
+	if code == "0" || code == "2" {
+		s.title = text
+	}
+}
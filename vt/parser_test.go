@@ -0,0 +1,203 @@
+package vt
+
+import (
+	"reflect"
+	"testing"
+)
+
+// screenLines 返回屏幕每一行的纯文本
+func screenLines(s *Screen) []string {
+	_, rows := s.Size()
+	lines := make([]string, rows)
+	for y := range lines {
+		lines[y] = s.LineText(y)
+	}
+	return lines
+}
+
+func TestCSICursor(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		x, y  int
+	}{
+		{"CUP", "\x1b[3;4H", 3, 2},
+		{"CUP default", "\x1b[3;4H\x1b[H", 0, 0},
+		{"CUP clamps", "\x1b[99;99H", 9, 4},
+		{"HVP", "\x1b[2;2f", 1, 1},
+		{"CUU", "\x1b[3;4H\x1b[2A", 3, 0},
+		{"CUU clamps", "\x1b[10A", 0, 0},
+		{"CUD", "\x1b[2B", 0, 2},
+		{"CUF", "\x1b[5C", 5, 0},
+		{"CUF clamps", "\x1b[50C", 9, 0},
+		{"CUB", "\x1b[3;4H\x1b[2D", 1, 2},
+		{"CNL", "\x1b[2;5H\x1b[E", 0, 2},
+		{"CPL", "\x1b[3;5H\x1b[F", 0, 1},
+		{"CHA", "\x1b[7G", 6, 0},
+		{"VPA", "\x1b[3C\x1b[4d", 3, 3},
+		{"tab", "ab\tc", 9, 0},
+		{"CR", "abc\r", 0, 0},
+		{"LF keeps column", "abc\n", 3, 1},
+		{"BS", "abc\b\b", 1, 0},
+		{"save and restore", "\x1b[2;3Hx\x1b[s\x1b[H\x1b[u", 3, 1},
+		{"DECSC and DECRC", "\x1b[4;5H\x1b7\x1b[H\x1b8", 4, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(10, 5)
+			s.WriteString(tt.input)
+			if x, y, _ := s.Cursor(); x != tt.x || y != tt.y {
+				t.Errorf("cursor at %d,%d, want %d,%d", x, y, tt.x, tt.y)
+			}
+		})
+	}
+}
+
+func TestCSIErase(t *testing.T) {
+	const setup = "abcde\r\nfghij\r\nklmno\x1b[2;3H"
+	tests := []struct {
+		name  string
+		input string
+		lines []string
+	}{
+		{"EL to end", "\x1b[K", []string{"abcde", "fg", "klmno"}},
+		{"EL to start", "\x1b[1K", []string{"abcde", "   ij", "klmno"}},
+		{"EL whole line", "\x1b[2K", []string{"abcde", "", "klmno"}},
+		{"ED to end", "\x1b[J", []string{"abcde", "fg", ""}},
+		{"ED to start", "\x1b[1J", []string{"", "   ij", "klmno"}},
+		{"ED whole screen", "\x1b[2J", []string{"", "", ""}},
+		{"ECH", "\x1b[2X", []string{"abcde", "fg  j", "klmno"}},
+		{"DCH", "\x1b[2P", []string{"abcde", "fgj", "klmno"}},
+		{"ICH", "\x1b[2@", []string{"abcde", "fg  h", "klmno"}},
+		{"IL", "\x1b[L", []string{"abcde", "", "fghij"}},
+		{"DL", "\x1b[M", []string{"abcde", "klmno", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(5, 3)
+			s.WriteString(setup + tt.input)
+			if got := screenLines(s); !reflect.DeepEqual(got, tt.lines) {
+				t.Errorf("lines = %q, want %q", got, tt.lines)
+			}
+		})
+	}
+}
+
+func TestScrollRegion(t *testing.T) {
+	const setup = "1\r\n2\r\n3\r\n4\r\n5"
+	tests := []struct {
+		name        string
+		input       string
+		lines       []string
+		top, bottom int
+	}{
+		{"LF at region bottom", "\x1b[2;4r\x1b[4;1H\n", []string{"1", "3", "4", "", "5"}, 1, 3},
+		{"RI at region top", "\x1b[2;4r\x1b[2;1H\x1bM", []string{"1", "", "2", "3", "5"}, 1, 3},
+		{"SU", "\x1b[2;4r\x1b[S", []string{"1", "3", "4", "", "5"}, 1, 3},
+		{"SD", "\x1b[2;4r\x1b[2T", []string{"1", "", "", "2", "5"}, 1, 3},
+		{"IL inside region", "\x1b[2;4r\x1b[3;1H\x1b[L", []string{"1", "2", "", "3", "5"}, 1, 3},
+		{"LF below region", "\x1b[2;4r\x1b[5;1H\n", []string{"1", "2", "3", "4", "5"}, 1, 3},
+		{"LF at screen bottom", "\n", []string{"2", "3", "4", "5", ""}, 0, 4},
+		{"invalid region ignored", "\x1b[4;2r", []string{"1", "2", "3", "4", "5"}, 0, 4},
+		{"reset region", "\x1b[2;4r\x1b[r", []string{"1", "2", "3", "4", "5"}, 0, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(5, 5)
+			s.WriteString(setup + tt.input)
+			if got := screenLines(s); !reflect.DeepEqual(got, tt.lines) {
+				t.Errorf("lines = %q, want %q", got, tt.lines)
+			}
+			if top, bottom := s.ScrollRegion(); top != tt.top || bottom != tt.bottom {
+				t.Errorf("scroll region = %d,%d, want %d,%d", top, bottom, tt.top, tt.bottom)
+			}
+		})
+	}
+}
+
+func TestAutoWrap(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		lines   []string
+		x, y    int
+		pending bool
+	}{
+		{"fill line", "abcde", []string{"abcde", ""}, 4, 0, true},
+		{"wrap on next char", "abcdef", []string{"abcde", "f"}, 1, 1, false},
+		{"CR clears pending", "abcde\r", []string{"abcde", ""}, 0, 0, false},
+		{"cursor move clears pending", "abcde\x1b[D", []string{"abcde", ""}, 3, 0, false},
+		{"BS clears pending", "abcde\bX", []string{"abcXe", ""}, 4, 0, false},
+		{"wrap scrolls at bottom", "abcde\r\nfghijk", []string{"fghij", "k"}, 1, 1, false},
+		{"wide char at last column", "abcd中", []string{"abcd", "中"}, 2, 1, false},
+		{"autowrap off", "\x1b[?7labcdefg", []string{"abcdg", ""}, 4, 0, true},
+		{"autowrap on again", "\x1b[?7labcdefg\x1b[?7h\rabcdefg", []string{"abcde", "fg"}, 2, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(5, 2)
+			s.WriteString(tt.input)
+			if got := screenLines(s); !reflect.DeepEqual(got, tt.lines) {
+				t.Errorf("lines = %q, want %q", got, tt.lines)
+			}
+			if x, y, _ := s.Cursor(); x != tt.x || y != tt.y {
+				t.Errorf("cursor at %d,%d, want %d,%d", x, y, tt.x, tt.y)
+			}
+			if got := s.WrapPending(); got != tt.pending {
+				t.Errorf("WrapPending() = %v, want %v", got, tt.pending)
+			}
+		})
+	}
+}
+
+func TestAltScreen(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		text  string
+		alt   bool
+		x, y  int
+		pen   Attr
+	}{
+		{"enter 1049", "main\x1b[?1049h", "", true, 4, 0, Attr{}},
+		{"leave 1049", "main\x1b[?1049halt\x1b[?1049l", "main", false, 4, 0, Attr{}},
+		{"1049 restores cursor", "\x1b[2;3H\x1b[?1049h\x1b[5;5Hx\x1b[?1049l", "", false, 2, 1, Attr{}},
+		{"1049 restores pen", "\x1b[1m\x1b[?1049h\x1b[0m\x1b[?1049l", "", false, 0, 0, Attr{Flags: Bold}},
+		{"enter 47", "main\x1b[?47h", "", true, 4, 0, Attr{}},
+		{"leave 47", "main\x1b[?47halt\x1b[?47l", "main", false, 4, 0, Attr{}},
+		{"leave 1047", "main\x1b[?1047h\x1b[2Jalt\x1b[?1047l", "main", false, 4, 0, Attr{}},
+		{"leave without enter", "main\x1b[?1049l", "main", false, 0, 0, Attr{}},
+		{"enter twice", "main\x1b[?47halt\x1b[?47h\x1b[?47l", "main", false, 4, 0, Attr{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(10, 5)
+			s.WriteString(tt.input)
+			if got := s.Text(); got != tt.text {
+				t.Errorf("text = %q, want %q", got, tt.text)
+			}
+			if got := s.AltScreen(); got != tt.alt {
+				t.Errorf("AltScreen() = %v, want %v", got, tt.alt)
+			}
+			if x, y, _ := s.Cursor(); x != tt.x || y != tt.y {
+				t.Errorf("cursor at %d,%d, want %d,%d", x, y, tt.x, tt.y)
+			}
+			if got := s.Pen(); got != tt.pen {
+				t.Errorf("Pen() = %+v, want %+v", got, tt.pen)
+			}
+		})
+	}
+}
+
+// 备用屏幕中滚出的行不计入回滚内容
+func TestAltScreenScrollOut(t *testing.T) {
+	s := New(5, 2)
+	var out []string
+	s.OnScrollOut = func(line []Cell) {
+		out = append(out, CellsText(line))
+	}
+	s.WriteString("a\r\nb\r\nc\x1b[?1049hx\r\ny\r\nz\x1b[?1049l\r\nd")
+	if want := []string{"a", "b"}; !reflect.DeepEqual(out, want) {
+		t.Errorf("scrolled out %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,477 @@
+// Package vt 实现一个精简的终端模拟器(屏幕模型)，用于在不依赖真实终端的情况下
+// 重建录像在某一时刻的屏幕内容。
+package vt
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/width"
+)
+
+// Cell 屏幕上的一个字符单元
+type Cell struct {
+	Char rune // 字符，宽字符的第二个单元为0
+	Attr Attr // 显示属性
+}
+
+// Cursor 光标状态
+type Cursor struct {
+	X, Y int
+	Attr Attr
+}
+
+// Screen 终端屏幕模型
+type Screen struct {
+	cols, rows int
+	lines      [][]Cell
+	cursor     Cursor
+	saved      Cursor
+	wrapNext   bool // 光标位于行尾，下一个字符需要换行
+	autoWrap   bool
+	hidden     bool // 光标是否隐藏
+	top        int  // 滚动区域上边界
+	bottom     int  // 滚动区域下边界
+	tabs       []bool
+	lastChar   rune
+	title      string
+
+	altLines  [][]Cell // 备用屏幕缓冲区激活时保存的主屏幕内容
+	altCursor Cursor
+	altActive bool
+
+	parser parser
+
+	// OnScrollOut 在一行从屏幕顶部滚出时调用(仅主屏幕)，可用于收集回滚内容
+	OnScrollOut func(line []Cell)
+	// OnOSC 在收到OSC序列时调用，参数为去掉引导和终止符后的内容
+	OnOSC func(data string)
+	// OnClear 在整个主屏幕被清除前调用，参数为清除前的所有行(仅在回调期间有效)
+	OnClear func(lines [][]Cell)
+}
+
+// New 创建一个cols x rows大小的屏幕
+func New(cols, rows int) *Screen {
+	if cols <= 0 {
+		cols = 80
+	}
+	if rows <= 0 {
+		rows = 24
+	}
+	s := &Screen{}
+	s.Resize(cols, rows)
+	s.Reset()
+	return s
+}
+
+// Reset 重置终端状态并清屏
+func (s *Screen) Reset() {
+	s.lines = newLines(s.cols, s.rows)
+	s.cursor = Cursor{}
+	s.saved = Cursor{}
+	s.wrapNext = false
+	s.autoWrap = true
+	s.hidden = false
+	s.top, s.bottom = 0, s.rows-1
+	s.altLines = nil
+	s.altActive = false
+	s.resetTabs()
+}
+
+// Resize 调整屏幕大小，保留左上角的内容
+func (s *Screen) Resize(cols, rows int) {
+	if cols <= 0 || rows <= 0 {
+		return
+	}
+	resize := func(lines [][]Cell) [][]Cell {
+		result := newLines(cols, rows)
+		// 行数变少时保留底部的内容
+		offset := 0
+		if len(lines) > rows {
+			offset = len(lines) - rows
+		}
+		for y := 0; y < rows && y+offset < len(lines); y++ {
+			copy(result[y], lines[y+offset])
+		}
+		return result
+	}
+	if s.lines != nil && len(s.lines) > rows {
+		s.cursor.Y -= len(s.lines) - rows
+		s.saved.Y -= len(s.lines) - rows
+	}
+	if s.altLines != nil && len(s.altLines) > rows {
+		s.altCursor.Y -= len(s.altLines) - rows
+	}
+	s.lines = resize(s.lines)
+	if s.altLines != nil {
+		s.altLines = resize(s.altLines)
+	}
+	s.cols, s.rows = cols, rows
+	s.top, s.bottom = 0, rows-1
+	s.resetTabs()
+	// 保存的光标和主屏幕的光标也可能超出新的大小，恢复时不能越界
+	s.clampCursor(&s.cursor)
+	s.clampCursor(&s.altCursor)
+	s.clampCursor(&s.saved)
+	s.wrapNext = false
+}
+
+// clampCursor 将光标限制在屏幕范围内
+func (s *Screen) clampCursor(c *Cursor) {
+	c.X = clamp(c.X, 0, s.cols-1)
+	c.Y = clamp(c.Y, 0, s.rows-1)
+}
+
+// Size 返回屏幕大小
+func (s *Screen) Size() (cols, rows int) {
+	return s.cols, s.rows
+}
+
+// Cursor 返回光标位置及是否可见
+func (s *Screen) Cursor() (x, y int, visible bool) {
+	return s.cursor.X, s.cursor.Y, !s.hidden
+}
+
+// WrapPending 判断光标是否停在行尾，下一个字符将换到下一行
+func (s *Screen) WrapPending() bool {
+	return s.wrapNext
+}
+
+// Pen 返回当前用于输出文字的显示属性
+func (s *Screen) Pen() Attr {
+	return s.cursor.Attr
+}
+
+// ScrollRegion 返回滚动区域的上下边界(从0开始，包含边界)
+func (s *Screen) ScrollRegion() (top, bottom int) {
+	return s.top, s.bottom
+}
+
+// Title 返回通过OSC 0/2设置的窗口标题
+func (s *Screen) Title() string {
+	return s.title
+}
+
+// AltScreen 是否处于备用屏幕缓冲区
+func (s *Screen) AltScreen() bool {
+	return s.altActive
+}
+
+// Line 返回第y行的单元格(只读)
+func (s *Screen) Line(y int) []Cell {
+	if y < 0 || y >= s.rows {
+		return nil
+	}
+	return s.lines[y]
+}
+
+// LineText 返回第y行的纯文本，去掉行尾空白
+func (s *Screen) LineText(y int) string {
+	return CellsText(s.Line(y))
+}
+
+// Text 返回整个屏幕的纯文本，去掉末尾的空行
+func (s *Screen) Text() string {
+	lines := make([]string, s.rows)
+	for y := range lines {
+		lines[y] = s.LineText(y)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// Snapshot 返回在一个同样大小的空白终端上重现当前画面的输出，
+// 包括各行内容、滚动区域、光标位置和显示属性
+func (s *Screen) Snapshot() string {
+	var b strings.Builder
+	b.WriteString("\x1b[0m\x1b[r\x1b[H\x1b[2J")
+	for y := 0; y < s.rows; y++ {
+		if line := RenderCells(s.lines[y]); line != "" {
+			fmt.Fprintf(&b, "\x1b[%d;1H%s\x1b[0m", y+1, line)
+		}
+	}
+	if s.top > 0 || s.bottom < s.rows-1 {
+		fmt.Fprintf(&b, "\x1b[%d;%dr", s.top+1, s.bottom+1)
+	}
+	fmt.Fprintf(&b, "\x1b[%d;%dH", s.cursor.Y+1, s.cursor.X+1)
+	if s.hidden {
+		b.WriteString("\x1b[?25l")
+	} else {
+		b.WriteString("\x1b[?25h")
+	}
+	b.WriteString(s.cursor.Attr.SGR())
+	return b.String()
+}
+
+// CellsText 将一行单元格转换为纯文本，去掉行尾空白
+func CellsText(cells []Cell) string {
+	var b strings.Builder
+	for _, c := range cells {
+		if c.Char == 0 {
+			continue
+		}
+		b.WriteRune(c.Char)
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+func newLines(cols, rows int) [][]Cell {
+	lines := make([][]Cell, rows)
+	for y := range lines {
+		lines[y] = newLine(cols, Attr{})
+	}
+	return lines
+}
+
+func newLine(cols int, attr Attr) []Cell {
+	line := make([]Cell, cols)
+	blank := Cell{Char: ' ', Attr: attr.background()}
+	for x := range line {
+		line[x] = blank
+	}
+	return line
+}
+
+func (s *Screen) resetTabs() {
+	s.tabs = make([]bool, s.cols)
+	for x := 8; x < s.cols; x += 8 {
+		s.tabs[x] = true
+	}
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// StringWidth 返回文字在终端中占用的列数
+func StringWidth(str string) int {
+	n := 0
+	for _, r := range str {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// runeWidth 返回字符占用的列数
+func runeWidth(r rune) int {
+	if r < 0x20 || (r >= 0x7f && r < 0xa0) {
+		return 0
+	}
+	// 组合字符
+	if r >= 0x300 && r <= 0x36f || r == 0x200b || r >= 0xfe00 && r <= 0xfe0f {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	// emoji大多显示为双宽
+	if r >= 0x1f300 && r <= 0x1faff {
+		return 2
+	}
+	return 1
+}
+
+// put 在光标处写入一个可打印字符
+func (s *Screen) put(r rune) {
+	w := runeWidth(r)
+	if w == 0 {
+		return
+	}
+	if s.wrapNext {
+		s.wrapNext = false
+		if s.autoWrap {
+			s.cursor.X = 0
+			s.lineFeed()
+		}
+	}
+	if w == 2 && s.cursor.X == s.cols-1 {
+		if s.autoWrap {
+			s.lines[s.cursor.Y][s.cursor.X] = Cell{Char: ' ', Attr: s.cursor.Attr}
+			s.cursor.X = 0
+			s.lineFeed()
+		} else {
+			w = 1
+		}
+	}
+	line := s.lines[s.cursor.Y]
+	line[s.cursor.X] = Cell{Char: r, Attr: s.cursor.Attr}
+	if w == 2 && s.cursor.X+1 < s.cols {
+		line[s.cursor.X+1] = Cell{Char: 0, Attr: s.cursor.Attr}
+	}
+	s.lastChar = r
+	if s.cursor.X+w >= s.cols {
+		s.cursor.X = s.cols - 1
+		s.wrapNext = true
+	} else {
+		s.cursor.X += w
+	}
+}
+
+// lineFeed 光标下移一行，到达滚动区域底部时向上滚动
+func (s *Screen) lineFeed() {
+	if s.cursor.Y == s.bottom {
+		s.scrollUp(1)
+	} else if s.cursor.Y < s.rows-1 {
+		s.cursor.Y++
+	}
+}
+
+// reverseIndex 光标上移一行，到达滚动区域顶部时向下滚动
+func (s *Screen) reverseIndex() {
+	if s.cursor.Y == s.top {
+		s.scrollDown(1)
+	} else if s.cursor.Y > 0 {
+		s.cursor.Y--
+	}
+}
+
+func (s *Screen) scrollUp(n int) {
+	n = clamp(n, 0, s.bottom-s.top+1)
+	for i := 0; i < n; i++ {
+		if s.top == 0 && !s.altActive && s.OnScrollOut != nil {
+			s.OnScrollOut(s.lines[0])
+		}
+		copy(s.lines[s.top:s.bottom], s.lines[s.top+1:s.bottom+1])
+		s.lines[s.bottom] = newLine(s.cols, s.cursor.Attr)
+	}
+}
+
+func (s *Screen) scrollDown(n int) {
+	n = clamp(n, 0, s.bottom-s.top+1)
+	for i := 0; i < n; i++ {
+		copy(s.lines[s.top+1:s.bottom+1], s.lines[s.top:s.bottom])
+		s.lines[s.top] = newLine(s.cols, s.cursor.Attr)
+	}
+}
+
+func (s *Screen) moveTo(x, y int) {
+	s.cursor.X = clamp(x, 0, s.cols-1)
+	s.cursor.Y = clamp(y, 0, s.rows-1)
+	s.wrapNext = false
+}
+
+func (s *Screen) tab() {
+	x := s.cursor.X + 1
+	for x < s.cols-1 && !s.tabs[x] {
+		x++
+	}
+	s.cursor.X = clamp(x, 0, s.cols-1)
+}
+
+// eraseCells 用空白清除[from, to)区间的单元格
+func (s *Screen) eraseCells(y, from, to int) {
+	line := s.lines[y]
+	from, to = clamp(from, 0, s.cols), clamp(to, 0, s.cols)
+	blank := Cell{Char: ' ', Attr: s.cursor.Attr.background()}
+	for x := from; x < to; x++ {
+		line[x] = blank
+	}
+}
+
+func (s *Screen) eraseDisplay(mode int) {
+	whole := mode == 2 || mode == 3 || (mode == 0 && s.cursor.X == 0 && s.cursor.Y == 0)
+	if whole && !s.altActive && s.OnClear != nil {
+		s.OnClear(s.lines)
+	}
+	switch mode {
+	case 0:
+		s.eraseCells(s.cursor.Y, s.cursor.X, s.cols)
+		for y := s.cursor.Y + 1; y < s.rows; y++ {
+			s.eraseCells(y, 0, s.cols)
+		}
+	case 1:
+		for y := 0; y < s.cursor.Y; y++ {
+			s.eraseCells(y, 0, s.cols)
+		}
+		s.eraseCells(s.cursor.Y, 0, s.cursor.X+1)
+	case 2, 3:
+		for y := 0; y < s.rows; y++ {
+			s.eraseCells(y, 0, s.cols)
+		}
+	}
+}
+
+func (s *Screen) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		s.eraseCells(s.cursor.Y, s.cursor.X, s.cols)
+	case 1:
+		s.eraseCells(s.cursor.Y, 0, s.cursor.X+1)
+	case 2:
+		s.eraseCells(s.cursor.Y, 0, s.cols)
+	}
+}
+
+func (s *Screen) insertLines(n int) {
+	if s.cursor.Y < s.top || s.cursor.Y > s.bottom {
+		return
+	}
+	top := s.top
+	s.top = s.cursor.Y
+	s.scrollDown(n)
+	s.top = top
+	s.cursor.X = 0
+}
+
+func (s *Screen) deleteLines(n int) {
+	if s.cursor.Y < s.top || s.cursor.Y > s.bottom {
+		return
+	}
+	top := s.top
+	s.top = s.cursor.Y
+	// 删除行不计入回滚内容
+	onScroll := s.OnScrollOut
+	s.OnScrollOut = nil
+	s.scrollUp(n)
+	s.OnScrollOut = onScroll
+	s.top = top
+	s.cursor.X = 0
+}
+
+func (s *Screen) insertChars(n int) {
+	line := s.lines[s.cursor.Y]
+	n = clamp(n, 0, s.cols-s.cursor.X)
+	copy(line[s.cursor.X+n:], line[s.cursor.X:])
+	s.eraseCells(s.cursor.Y, s.cursor.X, s.cursor.X+n)
+}
+
+func (s *Screen) deleteChars(n int) {
+	line := s.lines[s.cursor.Y]
+	n = clamp(n, 0, s.cols-s.cursor.X)
+	copy(line[s.cursor.X:], line[s.cursor.X+n:])
+	s.eraseCells(s.cursor.Y, s.cols-n, s.cols)
+}
+
+func (s *Screen) saveCursor() {
+	s.saved = s.cursor
+}
+
+func (s *Screen) restoreCursor() {
+	s.cursor = s.saved
+	s.moveTo(s.cursor.X, s.cursor.Y)
+}
+
+// setAltScreen 切换备用屏幕缓冲区
+func (s *Screen) setAltScreen(on bool) {
+	if on == s.altActive {
+		return
+	}
+	if on {
+		s.altLines = s.lines
+		s.altCursor = s.cursor
+		s.lines = newLines(s.cols, s.rows)
+	} else {
+		s.lines = s.altLines
+		s.cursor = s.altCursor
+		s.altLines = nil
+		s.clampCursor(&s.cursor)
+	}
+	s.altActive = on
+	s.wrapNext = false
+}
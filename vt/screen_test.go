@@ -0,0 +1,69 @@
+package vt
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 在备用屏幕中缩小后离开备用屏幕，恢复的光标不能超出新的大小
+func TestResizeInAltScreenClampsCursor(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup string // Resize之前写入的内容
+		after string // Resize之后写入的内容
+	}{
+		{"leave alt screen", "\x1b[21;71H\x1b[?47h", "\x1b[?47lx"},
+		{"leave alt screen 1049", "\x1b[21;71H\x1b[?1049h", "\x1b[?1049lx"},
+		{"restore saved cursor", "\x1b[21;71H\x1b7", "\x1b8x"},
+		{"restore saved cursor in alt screen", "\x1b[?47h\x1b[21;71H\x1b7", "\x1b8x\x1b[?47lx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(80, 24)
+			s.WriteString(tt.setup)
+			s.Resize(40, 10)
+			s.WriteString(tt.after)
+			x, y, _ := s.Cursor()
+			if x < 0 || x >= 40 || y < 0 || y >= 10 {
+				t.Errorf("cursor at %d,%d is outside the 40x10 screen", x, y)
+			}
+		})
+	}
+}
+
+// 调整大小不重排已有内容：保留左上角，行数变少时保留底部的行，之后的输出按新的宽度换行
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name       string
+		cols, rows int
+		input      string
+		after      string // Resize之后写入的内容
+		lines      []string
+		x, y       int
+	}{
+		{"fewer rows keeps bottom", 10, 2, "a\r\nb\r\nc", "", []string{"b", "c"}, 1, 1},
+		{"fewer cols truncates", 3, 3, "abcdefgh", "", []string{"abc", "fgh", ""}, 2, 1},
+		{"more cols keeps wrapped lines", 10, 3, "abcdefg", "", []string{"abcde", "fg", ""}, 2, 1},
+		{"output wraps at new width", 10, 3, "abcdefg", "hijklmnop", []string{"abcde", "fghijklmno", "p"}, 1, 2},
+		{"output wraps at narrower width", 3, 3, "", "abcdefg", []string{"abc", "def", "g"}, 1, 2},
+		{"pending wrap cleared", 10, 3, "abcde", "f", []string{"abcdf", "", ""}, 5, 0},
+		{"scroll region reset", 5, 4, "\x1b[2;3r", "\x1b[4;1H\n", []string{"", "", "", ""}, 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(5, 3)
+			s.WriteString(tt.input)
+			s.Resize(tt.cols, tt.rows)
+			s.WriteString(tt.after)
+			if cols, rows := s.Size(); cols != tt.cols || rows != tt.rows {
+				t.Errorf("size = %dx%d, want %dx%d", cols, rows, tt.cols, tt.rows)
+			}
+			if got := screenLines(s); !reflect.DeepEqual(got, tt.lines) {
+				t.Errorf("lines = %q, want %q", got, tt.lines)
+			}
+			if x, y, _ := s.Cursor(); x != tt.x || y != tt.y {
+				t.Errorf("cursor at %d,%d, want %d,%d", x, y, tt.x, tt.y)
+			}
+		})
+	}
+}